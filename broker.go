@@ -1,11 +0,0 @@
-package main
-
-import (
-	"context"
-)
-
-type BrokerInterface interface {
-	Connect(ctx context.Context) error
-	Publish(ctx context.Context, dest Destination, data interface{}) error
-	Close() error
-}
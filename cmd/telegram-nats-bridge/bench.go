@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+func benchRouterCommand(cmd *cobra.Command, args []string) error {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: getLogLevel(),
+	}))
+
+	configPath, _ := cmd.Flags().GetString("config")
+	updatesPath, _ := cmd.Flags().GetString("updates")
+	duration, _ := cmd.Flags().GetDuration("duration")
+
+	if updatesPath == "" {
+		return fmt.Errorf("--updates flag is required")
+	}
+	if duration <= 0 {
+		return fmt.Errorf("--duration must be positive")
+	}
+
+	cfg, router, err := validateConfigFile(configPath, logger)
+	if err != nil {
+		return err
+	}
+
+	updates, err := bridge.LoadUpdates(updatesPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stdout, "benchmarking %d routes (mode=%s, route_workers=%d) with %d updates for %s\n",
+		router.Len(), cfg.Mode, cfg.RouteWorkers, len(updates), duration)
+
+	result, err := bridge.BenchRouter(ctx, router, updates, duration)
+	if err != nil {
+		return err
+	}
+	printBenchResult(os.Stdout, result)
+	return nil
+}
+
+func printBenchResult(out io.Writer, result bridge.BenchResult) {
+	fmt.Fprintf(out, "routed:      %d updates in %s (%.0f routes/sec)\n",
+		result.Routed, result.Elapsed.Round(time.Millisecond), result.RoutesPerSec())
+	if result.Errors > 0 {
+		fmt.Fprintf(out, "errors:      %d\n", result.Errors)
+	}
+	fmt.Fprintf(out, "latency:     p50=%s p99=%s\n", result.P50, result.P99)
+	fmt.Fprintf(out, "allocations: %.1f allocs/op, %.0f B/op\n", result.AllocsPerOp, result.BytesPerOp)
+}
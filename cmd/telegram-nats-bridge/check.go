@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+func checkBot(cmd *cobra.Command, args []string) error {
+	// Initialize logger
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: getLogLevel(),
+	}))
+
+	duration, err := cmd.Flags().GetDuration("duration")
+	if err != nil {
+		return fmt.Errorf("failed to get duration flag: %w", err)
+	}
+	count, err := cmd.Flags().GetInt("count")
+	if err != nil {
+		return fmt.Errorf("failed to get count flag: %w", err)
+	}
+	if duration < 0 || count < 0 {
+		return fmt.Errorf("--duration and --count must not be negative")
+	}
+
+	cfg, client, err := connectCheckBot(cmd, logger)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "\n%s\n\n", bridge.PollConflictWarning)
+	logger.Info("send a message to the bot to see JSON output, press Ctrl+C to exit")
+
+	ctx, cancel := checkContext(duration, logger)
+	defer cancel()
+
+	return bridge.PrintUpdates(ctx, client, os.Stdout, count, cfg.Telegram.IdleSleep(), logger)
+}
+
+// connectCheckBot loads the config given by the --config flag and checks the
+// bot token with getMe
+func connectCheckBot(cmd *cobra.Command, logger *slog.Logger) (*bridge.Config, *bridge.TelegramClient, error) {
+	// Get config path from flag
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		logger.Error("failed to get config flag", "error", err)
+		return nil, nil, fmt.Errorf("failed to get config flag: %w", err)
+	}
+
+	if configPath == "" {
+		logger.Error("--config flag is required")
+		return nil, nil, fmt.Errorf("--config flag is required")
+	}
+
+	// Validate config path
+	if err := bridge.ValidateConfigPath(configPath); err != nil {
+		logger.Error("invalid config path", "error", err)
+		return nil, nil, fmt.Errorf("invalid config path: %w", err)
+	}
+
+	// Load configuration
+	cfg, err := bridge.LoadConfig(configPath, logger)
+	if err != nil {
+		logger.Error("failed to load config", "error", err)
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Validate configuration
+	if err := cfg.Validate(); err != nil {
+		logger.Error("invalid configuration", "error", err)
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// Create Telegram client
+	client := bridge.NewTelegramClientFromConfig(cfg, logger)
+
+	// Test: Get bot info
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	botInfo, err := client.GetMe(ctx)
+	if errors.Is(err, bridge.ErrUnauthorized) {
+		return nil, nil, fmt.Errorf("your TELEGRAM_BOT_TOKEN appears invalid")
+	}
+	if err != nil {
+		logger.Error("failed to get bot info", "error", err)
+		return nil, nil, fmt.Errorf("failed to get bot info: %w", err)
+	}
+
+	logger.Info("bot connected", "username", botInfo.Username, "id", botInfo.Id)
+	return cfg, client, nil
+}
+
+// checkContext returns a context cancelled by SIGINT/SIGTERM or, when
+// duration > 0, after duration
+func checkContext(duration time.Duration, logger *slog.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if duration > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, duration)
+		parent := cancel
+		cancel = func() {
+			cancelTimeout()
+			parent()
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-sigChan:
+			logger.Info("shutting down...")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigChan)
+	}()
+
+	return ctx, cancel
+}
+
+func checkChats(cmd *cobra.Command, args []string) error {
+	// Initialize logger
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: getLogLevel(),
+	}))
+
+	duration, err := cmd.Flags().GetDuration("duration")
+	if err != nil {
+		return fmt.Errorf("failed to get duration flag: %w", err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("--duration must be positive")
+	}
+	emitRoutes, err := cmd.Flags().GetString("emit-routes")
+	if err != nil {
+		return fmt.Errorf("failed to get emit-routes flag: %w", err)
+	}
+	if emitRoutes != "" {
+		if _, err := os.Stat(emitRoutes); err == nil {
+			return fmt.Errorf("%s already exists", emitRoutes)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to check %s: %w", emitRoutes, err)
+		}
+	}
+
+	cfg, client, err := connectCheckBot(cmd, logger)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "\n%s\n\n", bridge.PollConflictWarning)
+	fmt.Fprintf(os.Stderr, "collecting chats for %s, send messages to the bot in the chats to discover\n", duration)
+
+	ctx, cancel := checkContext(duration, logger)
+	defer cancel()
+
+	collector := bridge.NewChatCollector()
+	err = bridge.PollUpdatesLoop(ctx, client, cfg.Telegram.IdleSleep(), logger, func(update bridge.Update) bool {
+		collector.Add(update)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	chats := collector.Chats()
+	if len(chats) == 0 {
+		fmt.Fprintln(os.Stdout, "no chats seen")
+		return nil
+	}
+	if err := bridge.WriteChatsTable(os.Stdout, chats); err != nil {
+		return fmt.Errorf("failed to print chats: %w", err)
+	}
+
+	if emitRoutes != "" {
+		f, err := os.OpenFile(emitRoutes, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create routes file: %w", err)
+		}
+		if err := bridge.WriteChatRoutes(f, chats); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write routes file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write routes file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "routes written to %s\n", emitRoutes)
+	}
+	return nil
+}
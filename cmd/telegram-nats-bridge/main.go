@@ -0,0 +1,141 @@
+// Command telegram-nats-bridge polls Telegram Bot API updates and publishes
+// them to NATS or Kafka
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// getLogLevel returns slog.Level from LOG_LEVEL env variable, defaults to WARN
+func getLogLevel() slog.Level {
+	levelStr := os.Getenv("LOG_LEVEL")
+	switch levelStr {
+	case "DEBUG":
+		return slog.LevelDebug
+	case "INFO":
+		return slog.LevelInfo
+	case "WARN", "WARNING":
+		return slog.LevelWarn
+	case "ERROR":
+		return slog.LevelError
+	default:
+		return slog.LevelWarn
+	}
+}
+
+// newRootCommand creates the telegram-nats-bridge command with all subcommands
+func newRootCommand() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:     "telegram-nats-bridge",
+		Short:   "Bridge between Telegram Bot API and NATS",
+		Version: bridge.Version,
+	}
+
+	runCmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run the bridge",
+		Run:   runBridge,
+	}
+	runCmd.Flags().String("config", "", "Path to configuration file (required)")
+
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check utilities",
+	}
+
+	checkBotCmd := &cobra.Command{
+		Use:   "bot",
+		Short: "Check bot connection and print updates as JSON (conflicts with a running bridge)",
+		RunE:  checkBot,
+	}
+	checkBotCmd.Flags().String("config", "", "Path to configuration file (required)")
+	checkBotCmd.Flags().Duration("duration", 0, "Stop after the given time, e.g. 30s (0 - until Ctrl+C)")
+	checkBotCmd.Flags().Int("count", 0, "Stop after receiving N updates (0 - unlimited)")
+
+	checkChatsCmd := &cobra.Command{
+		Use:   "chats",
+		Short: "Poll updates for a while and list the chats the bot sees",
+		RunE:  checkChats,
+	}
+	checkChatsCmd.Flags().String("config", "", "Path to configuration file (required)")
+	checkChatsCmd.Flags().Duration("duration", 60*time.Second, "How long to poll updates")
+	checkChatsCmd.Flags().String("emit-routes", "", "Write a starter routes YAML with one route per chat to this file")
+
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate configuration and routes without connecting anywhere",
+		RunE:  validateCommand,
+	}
+	validateCmd.Flags().String("config", "", "Path to configuration file (required)")
+
+	replayCmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Replay stored messages through routing rules",
+	}
+
+	replayJetStreamCmd := &cobra.Command{
+		Use:   "jetstream",
+		Short: "Re-route messages from a JetStream stream and republish them",
+		RunE:  replayJetStream,
+	}
+	replayJetStreamCmd.Flags().String("config", "", "Path to configuration file (required)")
+	replayJetStreamCmd.Flags().String("stream", "", "JetStream stream name (required)")
+	replayJetStreamCmd.Flags().Uint64("start-seq", 1, "Stream sequence to start replay from")
+	replayJetStreamCmd.Flags().Bool("dry-run", false, "Route messages without publishing")
+	replayJetStreamCmd.Flags().String("filter", "", "Expr condition to select updates for replay")
+	replayJetStreamCmd.Flags().Int("rate", 0, "Maximum messages per second (0 - unlimited)")
+
+	benchCmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Benchmark utilities",
+	}
+
+	benchRouterCmd := &cobra.Command{
+		Use:   "router",
+		Short: "Route fixture updates in a loop without publishing and report throughput",
+		RunE:  benchRouterCommand,
+	}
+	benchRouterCmd.Flags().String("config", "", "Path to configuration file (required)")
+	benchRouterCmd.Flags().String("updates", "", "File with updates as JSON values, e.g. NDJSON (required)")
+	benchRouterCmd.Flags().Duration("duration", 10*time.Second, "How long to route updates")
+
+	deleteWebhookCmd := &cobra.Command{
+		Use:   "delete-webhook",
+		Short: "Delete the bot webhook so updates can be polled with getUpdates",
+		RunE:  deleteWebhookCommand,
+	}
+	deleteWebhookCmd.Flags().String("config", "", "Path to configuration file (required)")
+	deleteWebhookCmd.Flags().Bool("drop-pending", false, "Drop updates queued for the webhook")
+
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print JSON Schemas of bridge payloads",
+	}
+
+	schemaOutboundCmd := &cobra.Command{
+		Use:   "outbound",
+		Short: "Print JSON Schema of outbound Telegram messages",
+		RunE:  printOutboundSchema,
+	}
+
+	checkCmd.AddCommand(checkBotCmd, checkChatsCmd)
+	replayCmd.AddCommand(replayJetStreamCmd)
+	benchCmd.AddCommand(benchRouterCmd)
+	schemaCmd.AddCommand(schemaOutboundCmd)
+	rootCmd.AddCommand(runCmd, checkCmd, validateCmd, replayCmd, benchCmd, deleteWebhookCmd, schemaCmd)
+
+	return rootCmd
+}
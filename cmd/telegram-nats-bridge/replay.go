@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+func replayJetStream(cmd *cobra.Command, args []string) error {
+	// Initialize logger
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: getLogLevel(),
+	}))
+
+	configPath, _ := cmd.Flags().GetString("config")
+	streamName, _ := cmd.Flags().GetString("stream")
+	startSeq, _ := cmd.Flags().GetUint64("start-seq")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	filter, _ := cmd.Flags().GetString("filter")
+	rate, _ := cmd.Flags().GetInt("rate")
+
+	if configPath == "" {
+		return fmt.Errorf("--config flag is required")
+	}
+
+	if streamName == "" {
+		return fmt.Errorf("--stream flag is required")
+	}
+
+	if rate < 0 {
+		return fmt.Errorf("--rate must be >= 0")
+	}
+
+	if err := bridge.ValidateConfigPath(configPath); err != nil {
+		return fmt.Errorf("invalid config path: %w", err)
+	}
+
+	cfg, err := bridge.LoadConfig(configPath, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// Setup graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		logger.Info("shutting down...")
+		cancel()
+	}()
+
+	stats, err := bridge.ReplayJetStream(ctx, cfg, bridge.ReplayOptions{
+		Stream:   streamName,
+		StartSeq: startSeq,
+		DryRun:   dryRun,
+		Filter:   filter,
+		Rate:     rate,
+	}, logger)
+
+	fmt.Fprintf(os.Stdout, "read: %d, published: %d, skipped: %d, failed: %d\n",
+		stats.Read, stats.Published, stats.Skipped, stats.Failed)
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("replay failed: %w", err)
+	}
+
+	return nil
+}
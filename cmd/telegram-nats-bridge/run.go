@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+
+	"github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+func runBridge(cmd *cobra.Command, args []string) {
+	// Initialize logger
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: getLogLevel(),
+	}))
+
+	// Get config path from flag
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		logger.Error("failed to get config flag", "error", err)
+		os.Exit(1)
+	}
+
+	if configPath == "" {
+		logger.Error("--config flag is required")
+		os.Exit(1)
+	}
+
+	// Validate config path
+	if err := bridge.ValidateConfigPath(configPath); err != nil {
+		logger.Error("invalid config path", "error", err)
+		os.Exit(1)
+	}
+
+	// Load configuration
+	cfg, err := bridge.LoadConfig(configPath, logger)
+	if err != nil {
+		logger.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	// Validate configuration
+	if err := cfg.Validate(); err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	err = bridge.Run(context.Background(), cfg, bridge.Options{Logger: logger, HandleSignals: true})
+	if errors.Is(err, context.Canceled) {
+		// Startup was interrupted by a signal
+		logger.Info("shutting down...")
+		return
+	}
+	if errors.Is(err, bridge.ErrTooManyConflicts) {
+		logger.Error("bridge stopped", "error", err)
+		os.Exit(bridge.ConflictExitCode)
+	}
+	if errors.Is(err, bridge.ErrWatchdogStall) {
+		logger.Error("bridge stopped", "error", err)
+		os.Exit(bridge.WatchdogExitCode)
+	}
+	if err != nil {
+		logger.Error("bridge stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+func validateCommand(cmd *cobra.Command, args []string) error {
+	// Initialize logger
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: getLogLevel(),
+	}))
+
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return fmt.Errorf("failed to get config flag: %w", err)
+	}
+
+	cfg, router, err := validateConfigFile(configPath, logger)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "config is valid: broker=%s, mode=%s, routes=%d (enabled: %d), config_hash=%s\n",
+		cfg.Broker, cfg.Mode, len(cfg.Routes), router.Len(), bridge.ConfigHash(cfg))
+	return nil
+}
+
+// validateConfigFile loads and validates configuration and compiles routes.
+// It makes no network calls.
+func validateConfigFile(configPath string, logger *slog.Logger) (*bridge.Config, *bridge.Router, error) {
+	if configPath == "" {
+		return nil, nil, fmt.Errorf("--config flag is required")
+	}
+
+	if err := bridge.ValidateConfigPath(configPath); err != nil {
+		return nil, nil, fmt.Errorf("invalid config path: %w", err)
+	}
+
+	cfg, err := bridge.LoadConfig(configPath, logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	router, err := bridge.NewRouterFromConfig(cfg, logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid routes: %w", err)
+	}
+
+	return cfg, router, nil
+}
+
+// printOutboundSchema prints the outbound message JSON Schema,
+// pkg/bridge/outbound_message.schema.json is its committed copy
+func printOutboundSchema(cmd *cobra.Command, args []string) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bridge.OutboundMessageSchema())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfigFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name: "valid config",
+			content: `
+nats:
+  url: nats://test:4222
+routes:
+  - condition: "update.Message != nil"
+    subject:
+      type: string
+      value: telegram.messages
+telegram_token: test-token
+`,
+			wantErr: false,
+		},
+		{
+			name: "invalid configuration",
+			content: `
+mode: invalid
+nats:
+  url: nats://test:4222
+telegram_token: test-token
+`,
+			wantErr: true,
+			errMsg:  "invalid configuration",
+		},
+		{
+			name: "invalid route expression",
+			content: `
+nats:
+  url: nats://test:4222
+routes:
+  - condition: "update.NoSuchField != nil"
+    subject:
+      type: string
+      value: telegram.messages
+telegram_token: test-token
+`,
+			wantErr: true,
+			errMsg:  "invalid routes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(configPath, []byte(tt.content), 0644))
+
+			cfg, router, err := validateConfigFile(configPath, logger)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				require.NoError(t, err)
+				assert.NotNil(t, cfg)
+				assert.NotNil(t, router)
+			}
+		})
+	}
+}
+
+func TestValidateConfigFile_MissingPath(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	_, _, err := validateConfigFile("", logger)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--config flag is required")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge"
+	"github.com/spf13/cobra"
+)
+
+func deleteWebhookCommand(cmd *cobra.Command, args []string) error {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: getLogLevel(),
+	}))
+
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return fmt.Errorf("failed to get config flag: %w", err)
+	}
+	dropPending, err := cmd.Flags().GetBool("drop-pending")
+	if err != nil {
+		return fmt.Errorf("failed to get drop-pending flag: %w", err)
+	}
+
+	cfg, _, err := validateConfigFile(configPath, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return bridge.DeleteWebhook(ctx, bridge.NewTelegramClientFromConfig(cfg, logger), os.Stdout, dropPending)
+}
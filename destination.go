@@ -1,7 +0,0 @@
-package main
-
-type Destination struct {
-	Subject string
-	Topic   string
-	Key     string
-}
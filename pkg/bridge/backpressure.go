@@ -0,0 +1,76 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// backpressureHighWater is the share of the pending limit at which polling pauses
+const backpressureHighWater = 0.8
+
+// pendingReporter is implemented by broker clients that buffer outgoing data
+type pendingReporter interface {
+	PendingBytes() int
+}
+
+// Backpressure pauses polling while the broker client buffer is nearly full,
+// so a backlog burst doesn't accumulate in memory or get dropped
+type Backpressure struct {
+	broker    pendingReporter
+	publisher *Publisher
+	stats     *Stats
+	highWater int
+	interval  time.Duration
+	logger    *slog.Logger
+}
+
+// NewBackpressure creates a new Backpressure for the given pending limit in bytes
+func NewBackpressure(broker pendingReporter, publisher *Publisher, stats *Stats, limit int, logger *slog.Logger) *Backpressure {
+	return &Backpressure{
+		broker:    broker,
+		publisher: publisher,
+		stats:     stats,
+		highWater: int(float64(limit) * backpressureHighWater),
+		interval:  100 * time.Millisecond,
+		logger:    logger,
+	}
+}
+
+// Wait blocks while pending bytes are above the high-water mark or until ctx is done.
+// Returns how long polling was paused.
+func (b *Backpressure) Wait(ctx context.Context) time.Duration {
+	start := time.Now()
+
+	pending := b.observe()
+	if pending < b.highWater {
+		return 0
+	}
+
+	b.logger.Warn("broker buffer is nearly full, pausing polling",
+		"pending_bytes", pending,
+		"high_water_bytes", b.highWater)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for pending >= b.highWater {
+		select {
+		case <-ctx.Done():
+			return time.Since(start)
+		case <-ticker.C:
+		}
+		pending = b.observe()
+	}
+
+	waited := time.Since(start)
+	b.logger.Info("broker buffer drained, resuming polling", "pending_bytes", pending, "paused", waited)
+	return waited
+}
+
+// observe updates pending gauges and returns pending bytes
+func (b *Backpressure) observe() int {
+	pending := b.broker.PendingBytes()
+	b.stats.SetPending(pending, b.publisher.Pending())
+	return pending
+}
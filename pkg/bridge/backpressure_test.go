@@ -0,0 +1,73 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowBroker drains its buffer by a fixed amount on every check,
+// like a slow server consuming buffered data
+type slowBroker struct {
+	mu      sync.Mutex
+	pending int
+	drain   int
+}
+
+func (b *slowBroker) PendingBytes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := b.pending
+	b.pending -= b.drain
+	if b.pending < 0 {
+		b.pending = 0
+	}
+	return pending
+}
+
+func TestBackpressure_Wait(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	publisher := NewPublisher(1, 5, &mockBroker{}, logger)
+
+	t.Run("below high water", func(t *testing.T) {
+		stats := NewStats()
+		bp := NewBackpressure(&slowBroker{pending: 100}, publisher, stats, 1000, logger)
+
+		assert.Zero(t, bp.Wait(context.Background()))
+		assert.Equal(t, int64(100), stats.Snapshot().PendingBytes)
+	})
+
+	t.Run("pauses until drained", func(t *testing.T) {
+		stats := NewStats()
+		broker := &slowBroker{pending: 1000, drain: 100}
+		bp := NewBackpressure(broker, publisher, stats, 1000, logger)
+		bp.interval = 10 * time.Millisecond
+
+		waited := bp.Wait(context.Background())
+
+		// 1000 → 900 → 800 → 700: three ticks until below 800
+		assert.GreaterOrEqual(t, waited, 30*time.Millisecond)
+		assert.Less(t, stats.Snapshot().PendingBytes, int64(800))
+	})
+
+	t.Run("stops on context cancel", func(t *testing.T) {
+		bp := NewBackpressure(&slowBroker{pending: 1000}, publisher, NewStats(), 1000, logger)
+		bp.interval = 10 * time.Millisecond
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		bp.Wait(ctx)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
@@ -0,0 +1,150 @@
+package bridge
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BatchSizeHeader carries the number of updates in a publish.batch message
+const BatchSizeHeader = "Tg-Batch-Size"
+
+const (
+	DefaultBatchMaxMessages = 100
+	DefaultBatchMaxDelayMs  = 1000
+)
+
+// batchPublisher is the part of Publisher used by Batcher
+type batchPublisher interface {
+	PublishTracked(key uint64, dest Destination, data interface{}, done func(error))
+}
+
+// Batcher collects update publications per subject and publishes them as
+// one JSON array when a batch reaches max_messages, when max_delay passes
+// since its first update, or on Close.
+type Batcher struct {
+	mu          sync.Mutex
+	publisher   batchPublisher
+	maxMessages int
+	maxDelay    time.Duration
+	batches     map[string]*batch
+	closed      bool
+	// flushes counts batches queued but not published yet
+	flushes sync.WaitGroup
+}
+
+type batch struct {
+	dest     Destination
+	payloads []interface{}
+	done     []func(error)
+	timer    *time.Timer
+}
+
+// NewBatcher returns nil when publish.batch is not configured
+func NewBatcher(cfg *BatchConfig, publisher batchPublisher) *Batcher {
+	if cfg == nil {
+		return nil
+	}
+	return &Batcher{
+		publisher:   publisher,
+		maxMessages: cfg.MaxMessages,
+		maxDelay:    time.Duration(cfg.MaxDelayMs) * time.Millisecond,
+		batches:     make(map[string]*batch),
+	}
+}
+
+// Accepts reports whether a publication to dest is batched: update
+// publications to a subject, requests are not. A nil batcher accepts nothing.
+func (b *Batcher) Accepts(dest Destination) bool {
+	return b != nil && dest.Subject != "" && !dest.Request && !dest.RespondOnly
+}
+
+// Add appends payload to the batch of dest.Subject, done receives the
+// result of the batch publication. After Close payload is published alone.
+func (b *Batcher) Add(dest Destination, payload interface{}, done func(error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		b.publisher.PublishTracked(batchKey(dest.Subject), dest, payload, done)
+		return
+	}
+
+	current, ok := b.batches[dest.Subject]
+	if !ok {
+		current = &batch{dest: dest}
+		b.batches[dest.Subject] = current
+		current.timer = time.AfterFunc(b.maxDelay, func() { b.expire(current) })
+	}
+	current.payloads = append(current.payloads, payload)
+	if done != nil {
+		current.done = append(current.done, done)
+	}
+	if len(current.payloads) >= b.maxMessages {
+		b.flush(current)
+	}
+}
+
+// expire flushes the batch when max_delay passed and it is still pending
+func (b *Batcher) expire(expired *batch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.batches[expired.dest.Subject] == expired {
+		b.flush(expired)
+	}
+}
+
+// Close flushes all pending batches and waits until every flushed batch is
+// published, so the publisher may be closed right after. Later updates are
+// published one by one.
+func (b *Batcher) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.closed = true
+	for _, pending := range b.batches {
+		b.flush(pending)
+	}
+	b.mu.Unlock()
+
+	b.flushes.Wait()
+}
+
+// flush queues the batch; b.mu must be held, so batches of a subject are
+// queued in order
+func (b *Batcher) flush(flushed *batch) {
+	flushed.timer.Stop()
+	delete(b.batches, flushed.dest.Subject)
+
+	dest := flushed.dest
+	dest.Headers = batchHeaders(dest.Headers, len(flushed.payloads))
+	callbacks := flushed.done
+	b.flushes.Add(1)
+	b.publisher.PublishTracked(batchKey(dest.Subject), dest, flushed.payloads, func(err error) {
+		defer b.flushes.Done()
+		for _, done := range callbacks {
+			done(err)
+		}
+	})
+}
+
+// batchHeaders keeps the headers shared by all updates of a batch: the
+// payload schema
+func batchHeaders(headers map[string]string, size int) map[string]string {
+	batched := map[string]string{BatchSizeHeader: strconv.Itoa(size)}
+	if version, ok := headers[PayloadSchemaHeader]; ok {
+		batched[PayloadSchemaHeader] = version
+	}
+	return batched
+}
+
+// batchKey picks the publisher worker of a subject, so its batches are
+// published in order
+func batchKey(subject string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(subject))
+	return h.Sum64()
+}
@@ -0,0 +1,236 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchCall is a publication seen by recordingPublisher
+type batchCall struct {
+	key  uint64
+	dest Destination
+	data interface{}
+	done func(error)
+}
+
+// recordingPublisher records publications without publishing them
+type recordingPublisher struct {
+	mu    sync.Mutex
+	calls []batchCall
+}
+
+func (p *recordingPublisher) PublishTracked(key uint64, dest Destination, data interface{}, done func(error)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, batchCall{key: key, dest: dest, data: data, done: done})
+}
+
+func (p *recordingPublisher) published() []batchCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]batchCall(nil), p.calls...)
+}
+
+func batchDest(subject string) Destination {
+	return Destination{
+		Subject: subject,
+		Headers: map[string]string{CorrelationIDHeader: "42-1", PayloadSchemaHeader: "2"},
+	}
+}
+
+func TestBatcher_MaxMessages(t *testing.T) {
+	publisher := &recordingPublisher{}
+	batcher := NewBatcher(&BatchConfig{MaxMessages: 3, MaxDelayMs: 60000}, publisher)
+
+	var results []error
+	done := func(err error) { results = append(results, err) }
+	for i := range 7 {
+		batcher.Add(batchDest("telegram.messages"), i, done)
+	}
+	batcher.Add(batchDest("telegram.callbacks"), "cb", done)
+
+	calls := publisher.published()
+	require.Len(t, calls, 2, "full batches are published right away")
+	for i, call := range calls {
+		assert.Equal(t, "telegram.messages", call.dest.Subject)
+		assert.Equal(t, []interface{}{3 * i, 3*i + 1, 3*i + 2}, call.data)
+		assert.Equal(t, map[string]string{BatchSizeHeader: "3", PayloadSchemaHeader: "2"}, call.dest.Headers)
+		assert.Equal(t, batchKey("telegram.messages"), call.key)
+	}
+
+	calls[0].done(nil)
+	calls[1].done(errors.New("boom"))
+	assert.Equal(t, []error{nil, nil, nil, errors.New("boom"), errors.New("boom"), errors.New("boom")}, results,
+		"every update gets the result of its batch")
+}
+
+func TestBatcher_MaxDelay(t *testing.T) {
+	publisher := &recordingPublisher{}
+	batcher := NewBatcher(&BatchConfig{MaxMessages: 100, MaxDelayMs: 20}, publisher)
+
+	batcher.Add(batchDest("telegram.messages"), 1, nil)
+	batcher.Add(batchDest("telegram.messages"), 2, nil)
+	batcher.Add(batchDest("telegram.callbacks"), 3, nil)
+	assert.Empty(t, publisher.published())
+
+	require.Eventually(t, func() bool { return len(publisher.published()) == 2 }, 2*time.Second, 5*time.Millisecond)
+
+	bySubject := map[string]interface{}{}
+	for _, call := range publisher.published() {
+		bySubject[call.dest.Subject] = call.data
+	}
+	assert.Equal(t, map[string]interface{}{
+		"telegram.messages":  []interface{}{1, 2},
+		"telegram.callbacks": []interface{}{3},
+	}, bySubject, "subjects are batched separately")
+
+	batcher.Add(batchDest("telegram.messages"), 4, nil)
+	require.Eventually(t, func() bool { return len(publisher.published()) == 3 }, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []interface{}{4}, publisher.published()[2].data, "the next update starts a new window")
+}
+
+func TestBatcher_Close(t *testing.T) {
+	publisher := &recordingPublisher{}
+	batcher := NewBatcher(&BatchConfig{MaxMessages: 100, MaxDelayMs: 60000}, publisher)
+
+	batcher.Add(batchDest("telegram.messages"), 1, nil)
+	batcher.Add(batchDest("telegram.messages"), 2, nil)
+
+	closed := make(chan struct{})
+	go func() {
+		batcher.Close()
+		close(closed)
+	}()
+	require.Eventually(t, func() bool { return len(publisher.published()) == 1 }, 2*time.Second, 5*time.Millisecond)
+	calls := publisher.published()
+	assert.Equal(t, []interface{}{1, 2}, calls[0].data, "pending batches are flushed on shutdown")
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the flushed batch was published")
+	case <-time.After(50 * time.Millisecond):
+	}
+	calls[0].done(nil)
+	<-closed
+
+	batcher.Add(batchDest("telegram.messages"), 3, nil)
+	calls = publisher.published()
+	require.Len(t, calls, 2)
+	assert.Equal(t, 3, calls[1].data, "after Close updates are published alone")
+	assert.Equal(t, batchDest("telegram.messages").Headers, calls[1].dest.Headers)
+}
+
+// payloadBroker records published payloads after a delay
+type payloadBroker struct {
+	mockBroker
+	mu       sync.Mutex
+	payloads []interface{}
+}
+
+func (m *payloadBroker) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	select {
+	case <-time.After(50 * time.Millisecond):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payloads = append(m.payloads, data)
+	return nil
+}
+
+func TestBatcher_CloseBeforePublisher(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	// Without a shutdown timeout the publisher drops whatever is still
+	// queued when it is closed
+	broker := &payloadBroker{}
+	publisher := NewPublisher(1, 0, broker, logger)
+	publisher.Start()
+	batcher := NewBatcher(&BatchConfig{MaxMessages: 100, MaxDelayMs: 60000}, publisher)
+
+	var results []error
+	var mu sync.Mutex
+	done := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, err)
+	}
+	batcher.Add(batchDest("telegram.messages"), 1, done)
+	batcher.Add(batchDest("telegram.messages"), 2, done)
+
+	// The shutdown order of run
+	batcher.Close()
+	publisher.Close()
+
+	assert.Equal(t, []interface{}{[]interface{}{1, 2}}, broker.payloads, "the pending batch is delivered")
+	assert.Equal(t, []error{nil, nil}, results)
+}
+
+func TestBatcher_Accepts(t *testing.T) {
+	batcher := NewBatcher(&BatchConfig{MaxMessages: 10, MaxDelayMs: 1000}, &recordingPublisher{})
+
+	assert.True(t, batcher.Accepts(Destination{Subject: "telegram.messages"}))
+	assert.False(t, batcher.Accepts(Destination{Subject: "telegram.commands", Request: true}))
+	assert.False(t, batcher.Accepts(Destination{RespondOnly: true}))
+
+	var none *Batcher
+	assert.False(t, none.Accepts(Destination{Subject: "telegram.messages"}))
+	none.Close()
+}
+
+func TestBatcher_NATS(t *testing.T) {
+	srv := runEmbeddedNATS(t)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger))
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	conn, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("telegram.>")
+	require.NoError(t, err)
+	require.NoError(t, conn.Flush())
+
+	publisher := NewPublisher(1, 5, client, logger)
+	publisher.Start()
+	defer publisher.Close()
+
+	batcher := NewBatcher(&BatchConfig{MaxMessages: 2, MaxDelayMs: 60000}, publisher)
+	batcher.Add(batchDest("telegram.messages"), map[string]int{"update_id": 1}, nil)
+	batcher.Add(batchDest("telegram.messages"), map[string]int{"update_id": 2}, nil)
+
+	msg, err := sub.NextMsg(2 * time.Second)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"update_id":1},{"update_id":2}]`, string(msg.Data))
+	assert.Equal(t, "2", msg.Header.Get(BatchSizeHeader))
+
+	var updates []json.RawMessage
+	require.NoError(t, json.Unmarshal(msg.Data, &updates))
+	assert.Len(t, updates, 2)
+}
+
+func TestBatchHeaders(t *testing.T) {
+	headers := map[string]string{CorrelationIDHeader: "42-1", PayloadSchemaHeader: "2"}
+	assert.Equal(t, map[string]string{BatchSizeHeader: "2", PayloadSchemaHeader: "2"}, batchHeaders(headers, 2))
+
+	// payload: flatten publications carry no schema version, nor do their batches
+	flat := map[string]string{CorrelationIDHeader: "42-1"}
+	assert.Equal(t, map[string]string{BatchSizeHeader: "2"}, batchHeaders(flat, 2))
+}
@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// benchLatencySamples bounds memory used for latency percentiles, longer runs
+// keep a uniform random sample of this size
+const benchLatencySamples = 1 << 20
+
+// BenchResult is the outcome of a router benchmark run
+type BenchResult struct {
+	Routed      int64
+	Errors      int64
+	Elapsed     time.Duration
+	P50         time.Duration
+	P99         time.Duration
+	AllocsPerOp float64
+	BytesPerOp  float64
+}
+
+// RoutesPerSec returns routed updates per second
+func (r BenchResult) RoutesPerSec() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Routed) / r.Elapsed.Seconds()
+}
+
+// LoadUpdates reads updates from a file of concatenated JSON values: NDJSON
+// fixtures, saved `check bot` output or payloads republished with bot meta
+func LoadUpdates(path string) ([]Update, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open updates file: %w", err)
+	}
+	defer f.Close()
+
+	return readUpdates(f)
+}
+
+// readUpdates decodes every JSON value of r as an update
+func readUpdates(r io.Reader) ([]Update, error) {
+	var updates []Update
+	decoder := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return updates, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("update %d: %w", len(updates)+1, err)
+		}
+
+		update, err := decodeStoredUpdate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("update %d: %w", len(updates)+1, err)
+		}
+		updates = append(updates, update)
+	}
+}
+
+// BenchRouter routes updates in a loop until duration passes or ctx is done
+func BenchRouter(ctx context.Context, router *Router, updates []Update, duration time.Duration) (BenchResult, error) {
+	if len(updates) == 0 {
+		return BenchResult{}, fmt.Errorf("no updates to route")
+	}
+
+	latencies := make([]time.Duration, 0, benchLatencySamples)
+	var result BenchResult
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	deadline := start.Add(duration)
+	for i := 0; ; i++ {
+		// Checking the clock and ctx on every update would skew short routes
+		if i%len(updates) == 0 && (ctx.Err() != nil || time.Now().After(deadline)) {
+			break
+		}
+
+		routeStart := time.Now()
+		_, err := router.Route(updates[i%len(updates)])
+		latency := time.Since(routeStart)
+
+		result.Routed++
+		if err != nil {
+			result.Errors++
+		}
+
+		if len(latencies) < benchLatencySamples {
+			latencies = append(latencies, latency)
+		} else if j := rand.Int64N(result.Routed); j < benchLatencySamples {
+			latencies[j] = latency
+		}
+	}
+	result.Elapsed = time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	result.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / float64(result.Routed)
+	result.BytesPerOp = float64(after.TotalAlloc-before.TotalAlloc) / float64(result.Routed)
+
+	slices.Sort(latencies)
+	result.P50 = percentile(latencies, 0.50)
+	result.P99 = percentile(latencies, 0.99)
+	return result, nil
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
@@ -0,0 +1,94 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadUpdates(t *testing.T) {
+	t.Run("ndjson", func(t *testing.T) {
+		updates, err := readUpdates(strings.NewReader(
+			`{"update_id":1,"message":{"message_id":1,"date":0,"chat":{"id":10,"type":"private"},"text":"hi"}}` + "\n" +
+				`{"update_id":2}` + "\n"))
+		require.NoError(t, err)
+		require.Len(t, updates, 2)
+		assert.Equal(t, "hi", updates[0].Message.Text)
+		assert.Equal(t, int64(2), updates[1].UpdateId)
+	})
+
+	t.Run("check bot output", func(t *testing.T) {
+		updates, err := readUpdates(strings.NewReader("{\n  \"update_id\": 1\n}\n\n{\n  \"update_id\": 2\n}\n\n"))
+		require.NoError(t, err)
+		require.Len(t, updates, 2)
+		assert.Equal(t, int64(2), updates[1].UpdateId)
+	})
+
+	t.Run("wrapped with bot meta", func(t *testing.T) {
+		updates, err := readUpdates(strings.NewReader(`{"bot":{"id":1,"username":"test_bot"},"update":{"update_id":7}}`))
+		require.NoError(t, err)
+		require.Len(t, updates, 1)
+		assert.Equal(t, int64(7), updates[0].UpdateId)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := readUpdates(strings.NewReader(`{"update_id":1}` + "\n" + `{"update_id":`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "update 2")
+	})
+}
+
+func TestLoadUpdates_Fixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.ndjson")
+	var lines []string
+	for _, name := range []string{"business_message", "poll_answer"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "updates", name+".json"))
+		require.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644))
+
+	updates, err := LoadUpdates(path)
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	assert.NotNil(t, updates[0].BusinessMessage)
+	assert.NotNil(t, updates[1].PollAnswer)
+
+	_, err = LoadUpdates(filepath.Join(t.TempDir(), "missing.ndjson"))
+	assert.Error(t, err)
+}
+
+func TestBenchRouter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	router, err := NewRouter(benchRoutes(10, SubjectTypeExpr), "all", 5, logger)
+	require.NoError(t, err)
+
+	result, err := BenchRouter(context.Background(), router, benchUpdates(), 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Positive(t, result.Routed)
+	assert.Zero(t, result.Errors)
+	assert.GreaterOrEqual(t, result.Elapsed, 50*time.Millisecond)
+	assert.Positive(t, result.RoutesPerSec())
+	assert.LessOrEqual(t, result.P50, result.P99)
+	assert.Positive(t, result.AllocsPerOp)
+
+	_, err = BenchRouter(context.Background(), router, nil, time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	assert.Equal(t, time.Duration(5), percentile(sorted, 0.5))
+	assert.Equal(t, time.Duration(9), percentile(sorted, 0.99))
+	assert.Equal(t, time.Duration(0), percentile(nil, 0.5))
+}
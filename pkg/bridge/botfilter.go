@@ -0,0 +1,46 @@
+package bridge
+
+// BotFilter drops messages sent by bots before routing, so bots listening on
+// the bridge subjects don't answer each other in a loop
+type BotFilter struct {
+	ignoreBots bool
+	ignoreSelf bool
+	selfID     int64
+}
+
+// NewBotFilter creates a filter for ignore_bots and ignore_self, selfID is the
+// bridge bot id from getMe. Returns nil when both are off.
+func NewBotFilter(ignoreBots, ignoreSelf bool, selfID int64) *BotFilter {
+	if !ignoreBots && !ignoreSelf {
+		return nil
+	}
+	return &BotFilter{ignoreBots: ignoreBots, ignoreSelf: ignoreSelf, selfID: selfID}
+}
+
+// Drop reports whether the update must be dropped and why: "self" for
+// messages of the bridge bot, "bot" for messages of other bots. Every message
+// variant (messages, channel posts, business messages and their edits) is
+// checked by its from field; other updates are never dropped. A nil filter
+// drops nothing.
+func (f *BotFilter) Drop(update Update) (bool, string) {
+	if f == nil {
+		return false, ""
+	}
+	msg := updateMessage(update)
+	if msg == nil || msg.From == nil {
+		return false, ""
+	}
+
+	switch {
+	case msg.From.Id == f.selfID:
+		// The bridge bot is a bot too, ignore_bots drops it as well
+		if f.ignoreSelf || f.ignoreBots {
+			return true, "self"
+		}
+	case msg.From.IsBot:
+		if f.ignoreBots {
+			return true, "bot"
+		}
+	}
+	return false, ""
+}
@@ -0,0 +1,73 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotFilter_Drop(t *testing.T) {
+	const selfID = 1000
+
+	human := &gotgbot.User{Id: 1, FirstName: "Ann"}
+	bot := &gotgbot.User{Id: 2, FirstName: "Other", IsBot: true}
+	self := &gotgbot.User{Id: selfID, FirstName: "Bridge", IsBot: true}
+
+	// Every message variant carries the sender in from
+	variants := map[string]func(from *gotgbot.User) Update{
+		"message":                 func(from *gotgbot.User) Update { return Update{Message: &gotgbot.Message{From: from}} },
+		"edited_message":          func(from *gotgbot.User) Update { return Update{EditedMessage: &gotgbot.Message{From: from}} },
+		"channel_post":            func(from *gotgbot.User) Update { return Update{ChannelPost: &gotgbot.Message{From: from}} },
+		"edited_channel_post":     func(from *gotgbot.User) Update { return Update{EditedChannelPost: &gotgbot.Message{From: from}} },
+		"business_message":        func(from *gotgbot.User) Update { return Update{BusinessMessage: &gotgbot.Message{From: from}} },
+		"edited_business_message": func(from *gotgbot.User) Update { return Update{EditedBusinessMessage: &gotgbot.Message{From: from}} },
+	}
+
+	tests := []struct {
+		name       string
+		ignoreBots bool
+		ignoreSelf bool
+		from       *gotgbot.User
+		wantDrop   bool
+		wantReason string
+	}{
+		{name: "human with ignore_bots", ignoreBots: true, from: human},
+		{name: "human with ignore_self", ignoreSelf: true, from: human},
+		{name: "bot with ignore_bots", ignoreBots: true, from: bot, wantDrop: true, wantReason: "bot"},
+		{name: "bot with ignore_self", ignoreSelf: true, from: bot},
+		{name: "self with ignore_self", ignoreSelf: true, from: self, wantDrop: true, wantReason: "self"},
+		{name: "self with ignore_bots", ignoreBots: true, from: self, wantDrop: true, wantReason: "self"},
+		{name: "anonymous channel post", ignoreBots: true, ignoreSelf: true, from: nil},
+	}
+
+	for _, tt := range tests {
+		filter := NewBotFilter(tt.ignoreBots, tt.ignoreSelf, selfID)
+		for variant, newUpdate := range variants {
+			t.Run(tt.name+" "+variant, func(t *testing.T) {
+				drop, reason := filter.Drop(newUpdate(tt.from))
+				assert.Equal(t, tt.wantDrop, drop)
+				assert.Equal(t, tt.wantReason, reason)
+			})
+		}
+	}
+}
+
+func TestBotFilter_OtherUpdates(t *testing.T) {
+	filter := NewBotFilter(true, true, 1000)
+
+	// Only messages are filtered, a bot in a callback query or a member
+	// update is not a message author
+	drop, _ := filter.Drop(Update{CallbackQuery: &gotgbot.CallbackQuery{From: gotgbot.User{Id: 2, IsBot: true}}})
+	assert.False(t, drop)
+	drop, _ = filter.Drop(Update{MyChatMember: &gotgbot.ChatMemberUpdated{From: gotgbot.User{Id: 1000, IsBot: true}}})
+	assert.False(t, drop)
+}
+
+func TestBotFilter_Disabled(t *testing.T) {
+	filter := NewBotFilter(false, false, 1000)
+	assert.Nil(t, filter)
+
+	drop, _ := filter.Drop(Update{Message: &gotgbot.Message{From: &gotgbot.User{Id: 2, IsBot: true}}})
+	assert.False(t, drop)
+}
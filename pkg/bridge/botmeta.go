@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// BotIDHeader and BotUsernameHeader carry the identity of the bot that
+// received the update with bot_meta_mode: headers
+const (
+	BotIDHeader       = "Tg-Bot-Id"
+	BotUsernameHeader = "Tg-Bot-Username"
+)
+
+// BotMetaMode selects how include_bot_meta attaches the bot identity
+type BotMetaMode string
+
+const (
+	// BotMetaHeaders sets Tg-Bot-Id and Tg-Bot-Username headers
+	BotMetaHeaders BotMetaMode = "headers"
+	// BotMetaWrap publishes {"bot": {...}, "update": {...}}
+	BotMetaWrap BotMetaMode = "wrap"
+)
+
+// BotMeta identifies the bot that received an update, taken from getMe at startup
+type BotMeta struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// newBotMeta returns the identity of bot
+func newBotMeta(bot *gotgbot.User) BotMeta {
+	return BotMeta{ID: bot.Id, Username: bot.Username}
+}
+
+// BotWrappedUpdate is published instead of the update (bare or enriched)
+// with bot_meta_mode: wrap
+type BotWrappedUpdate struct {
+	Bot    BotMeta     `json:"bot"`
+	Update interface{} `json:"update"`
+}
+
+// wrap returns payload wrapped with the bot identity
+func (b BotMeta) wrap(payload interface{}) BotWrappedUpdate {
+	return BotWrappedUpdate{Bot: b, Update: payload}
+}
+
+// addHeaders adds the bot identity to headers, allocating them if nil
+func (b BotMeta) addHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[BotIDHeader] = strconv.FormatInt(b.ID, 10)
+	if b.Username != "" {
+		headers[BotUsernameHeader] = b.Username
+	}
+	return headers
+}
+
+// decodeStoredUpdate decodes a published payload back into the update,
+// unwrapping the bot identity wrapper or the version 2 envelope if present. Payloads published with
+// publish.stringify_ids are decoded with their ids turned back into numbers.
+func decodeStoredUpdate(data []byte) (Update, error) {
+	update, err := decodeUpdatePayload(data)
+	if err == nil {
+		return update, nil
+	}
+
+	restored, restoreErr := restoreNumericIDs(data)
+	if restoreErr != nil {
+		return update, err
+	}
+	if update, restoredErr := decodeUpdatePayload(restored); restoredErr == nil {
+		return update, nil
+	}
+	return update, err
+}
+
+// decodeUpdatePayload decodes a bare, bot wrapped or enveloped update
+func decodeUpdatePayload(data []byte) (Update, error) {
+	var wrapped struct {
+		SchemaVersion json.RawMessage `json:"schema_version"`
+		Bot           json.RawMessage `json:"bot"`
+		Update        json.RawMessage `json:"update"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && len(wrapped.Update) > 0 &&
+		(len(wrapped.Bot) > 0 || len(wrapped.SchemaVersion) > 0) {
+		data = wrapped.Update
+	}
+
+	var update Update
+	err := json.Unmarshal(data, &update)
+	return update, err
+}
@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotMeta_Wrap(t *testing.T) {
+	bot := newBotMeta(&gotgbot.User{Id: 7, Username: "shop_bot", IsBot: true})
+	update := Update{UpdateId: 42}
+
+	data, err := json.Marshal(bot.wrap(publishedUpdate(update, nil)))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bot":{"id":7,"username":"shop_bot"},"update":{"update_id":42}}`, string(data))
+
+	// Enriched payloads are wrapped as a whole
+	enriched := bot.wrap(publishedUpdate(update, &Enrichment{Chat: &gotgbot.ChatFullInfo{Id: 100}}))
+	data, err = json.Marshal(enriched)
+	require.NoError(t, err)
+	var decoded struct {
+		Bot    BotMeta        `json:"bot"`
+		Update EnrichedUpdate `json:"update"`
+	}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, bot, decoded.Bot)
+	assert.Equal(t, int64(42), decoded.Update.UpdateId)
+	assert.Equal(t, int64(100), decoded.Update.Enriched.Chat.Id)
+
+	assert.Equal(t, update, unwrapUpdate(enriched))
+	assert.Equal(t, update, unwrapUpdate(bot.wrap(update)))
+
+	stored, err := decodeStoredUpdate(data)
+	require.NoError(t, err)
+	assert.Equal(t, update, stored)
+}
+
+func TestBotMeta_AddHeaders(t *testing.T) {
+	bot := BotMeta{ID: 7, Username: "shop_bot"}
+
+	assert.Equal(t, map[string]string{
+		BotIDHeader:       "7",
+		BotUsernameHeader: "shop_bot",
+	}, bot.addHeaders(nil))
+
+	headers := bot.addHeaders(updateHeaders(Update{UpdateId: 42}, "7-42"))
+	assert.Equal(t, map[string]string{
+		CorrelationIDHeader: "7-42",
+		BotIDHeader:         "7",
+		BotUsernameHeader:   "shop_bot",
+	}, headers)
+
+	assert.Equal(t, map[string]string{BotIDHeader: "8"}, BotMeta{ID: 8}.addHeaders(nil))
+}
+
+func TestDecodeStoredUpdate(t *testing.T) {
+	update, err := decodeStoredUpdate([]byte(`{"update_id":5,"message":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"},"text":"hi"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), update.UpdateId)
+	assert.Equal(t, "hi", update.Message.Text)
+
+	// An update field alone is not a bot wrapper
+	update, err = decodeStoredUpdate([]byte(`{"update_id":6,"update":{"update_id":9}}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), update.UpdateId)
+
+	_, err = decodeStoredUpdate([]byte("invalid json"))
+	assert.Error(t, err)
+}
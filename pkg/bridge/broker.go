@@ -0,0 +1,33 @@
+package bridge
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+type BrokerInterface interface {
+	Connect(ctx context.Context) error
+	Publish(ctx context.Context, dest Destination, data interface{}) error
+	Close() error
+}
+
+// RequesterInterface is implemented by brokers supporting request-reply
+type RequesterInterface interface {
+	Request(ctx context.Context, subject string, data interface{}) ([]byte, error)
+}
+
+// MsgRequesterInterface is implemented by brokers whose replies carry
+// headers, the Nats-Msg-Id header of a reply is its default idempotency key
+type MsgRequesterInterface interface {
+	RequestMsg(ctx context.Context, subject string, data interface{}) (*nats.Msg, error)
+}
+
+// NATSClientInterface is implemented by NATSClient and JetStreamClient. Run
+// takes any BrokerInterface, request-reply and the NATS connection features
+// are used when the broker implements them.
+type NATSClientInterface interface {
+	BrokerInterface
+	RequesterInterface
+	NATSConnProvider
+}
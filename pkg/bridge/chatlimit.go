@@ -0,0 +1,109 @@
+package bridge
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ChatLimitReason is the drop reason of updates over chat_limit
+const ChatLimitReason = "chat_limit"
+
+// ChatLimiter drops updates of chats sending more than chat_limit allows
+// before they are routed, so one flooding chat can't take the bridge from
+// the others. Only the most recently seen chats are tracked, a forgotten
+// chat starts again with a full bucket.
+type ChatLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	overflow    ChatLimitOverflow
+	sampleEvery int
+	size        int
+	exempt      map[int64]bool
+	chats       map[int64]*list.Element
+	// order holds the least recently seen chat at the front
+	order *list.List
+	now   func() time.Time
+}
+
+type chatLimitEntry struct {
+	chatID int64
+	bucket *tokenBucket
+	// overflowed counts updates over the limit for sampling
+	overflowed int
+}
+
+// NewChatLimiter returns nil when chat_limit is not configured
+func NewChatLimiter(cfg *ChatLimitConfig) *ChatLimiter {
+	if cfg == nil {
+		return nil
+	}
+	exempt := make(map[int64]bool, len(cfg.ExemptChats))
+	for _, id := range cfg.ExemptChats {
+		exempt[id] = true
+	}
+	return &ChatLimiter{
+		rate:        float64(cfg.PerSec),
+		burst:       float64(cfg.Burst),
+		overflow:    cfg.Overflow,
+		sampleEvery: cfg.SampleEvery,
+		size:        cfg.MaxChats,
+		exempt:      exempt,
+		chats:       make(map[int64]*list.Element),
+		order:       list.New(),
+		now:         time.Now,
+	}
+}
+
+// Drop reports whether the update is over the limit of its chat, the
+// reason is ChatLimitReason. Updates without a chat and updates of exempt
+// chats are never dropped. A nil limiter drops nothing.
+func (l *ChatLimiter) Drop(update Update) (bool, string) {
+	if l == nil {
+		return false, ""
+	}
+	chat := updateChat(update)
+	if chat == nil || l.exempt[chat.Id] {
+		return false, ""
+	}
+	if l.allow(chat.Id) {
+		return false, ""
+	}
+	return true, ChatLimitReason
+}
+
+// allow takes a token of the chat, over the limit it keeps every
+// sampleEvery-th update with overflow: sample
+func (l *ChatLimiter) allow(chatID int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var entry *chatLimitEntry
+	if elem, ok := l.chats[chatID]; ok {
+		l.order.MoveToBack(elem)
+		entry = elem.Value.(*chatLimitEntry)
+	} else {
+		for l.order.Len() >= l.size {
+			front := l.order.Front()
+			l.order.Remove(front)
+			delete(l.chats, front.Value.(*chatLimitEntry).chatID)
+		}
+		entry = &chatLimitEntry{chatID: chatID, bucket: newTokenBucket(l.rate, l.burst, now)}
+		l.chats[chatID] = l.order.PushBack(entry)
+	}
+
+	if entry.bucket.take(now) {
+		return true
+	}
+	entry.overflowed++
+	return l.overflow == ChatLimitSample && entry.overflowed%l.sampleEvery == 0
+}
+
+// len returns the number of tracked chats
+func (l *ChatLimiter) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
@@ -0,0 +1,82 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestChatLimiter returns a limiter on a clock moved by the returned func
+func newTestChatLimiter(cfg ChatLimitConfig) (*ChatLimiter, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	limiter := NewChatLimiter(&cfg)
+	limiter.now = func() time.Time { return now }
+	return limiter, func(d time.Duration) { now = now.Add(d) }
+}
+
+func chatUpdate(chatID int64) Update {
+	return Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: chatID}}}
+}
+
+// countKept returns how many of n updates of the chat are not dropped
+func countKept(limiter *ChatLimiter, chatID int64, n int) int {
+	kept := 0
+	for range n {
+		if drop, _ := limiter.Drop(chatUpdate(chatID)); !drop {
+			kept++
+		}
+	}
+	return kept
+}
+
+func TestChatLimiter_Drop(t *testing.T) {
+	limiter, advance := newTestChatLimiter(ChatLimitConfig{
+		PerSec: 2, Burst: 5, Overflow: ChatLimitDrop, MaxChats: 100, ExemptChats: []int64{-100500},
+	})
+
+	assert.Equal(t, 5, countKept(limiter, -100200, 50), "the burst is let through")
+	assert.Equal(t, 5, countKept(limiter, 42, 5), "chats have their own buckets")
+
+	drop, reason := limiter.Drop(chatUpdate(-100200))
+	assert.True(t, drop)
+	assert.Equal(t, ChatLimitReason, reason)
+
+	advance(time.Second)
+	assert.Equal(t, 2, countKept(limiter, -100200, 10), "the bucket refills at per_sec")
+
+	assert.Equal(t, 100, countKept(limiter, -100500, 100), "exempt chats are not limited")
+
+	drop, _ = limiter.Drop(Update{InlineQuery: &gotgbot.InlineQuery{From: gotgbot.User{Id: 1}}})
+	assert.False(t, drop, "updates without a chat are not limited")
+
+	var none *ChatLimiter
+	drop, _ = none.Drop(chatUpdate(-100200))
+	assert.False(t, drop)
+}
+
+func TestChatLimiter_Sample(t *testing.T) {
+	limiter, _ := newTestChatLimiter(ChatLimitConfig{
+		PerSec: 1, Burst: 1, Overflow: ChatLimitSample, SampleEvery: 10, MaxChats: 100,
+	})
+
+	// 1 within the limit, then 1 of every 10 of the 100 over it
+	assert.Equal(t, 11, countKept(limiter, -100200, 101))
+}
+
+func TestChatLimiter_LRU(t *testing.T) {
+	limiter, _ := newTestChatLimiter(ChatLimitConfig{
+		PerSec: 1, Burst: 1, Overflow: ChatLimitDrop, MaxChats: 2,
+	})
+
+	assert.Equal(t, 1, countKept(limiter, 1, 2))
+	assert.Equal(t, 1, countKept(limiter, 2, 2))
+	// Seeing chat 1 again makes chat 2 the least recently seen one
+	assert.Equal(t, 0, countKept(limiter, 1, 1))
+	assert.Equal(t, 1, countKept(limiter, 3, 1))
+	assert.Equal(t, 2, limiter.len())
+
+	assert.Equal(t, 0, countKept(limiter, 1, 1), "chat 1 is still tracked")
+	assert.Equal(t, 1, countKept(limiter, 2, 1), "forgotten chat 2 starts with a full bucket")
+}
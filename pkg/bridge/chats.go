@@ -0,0 +1,129 @@
+package bridge
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// SeenChat is a chat observed by check chats
+type SeenChat struct {
+	ID       int64
+	Type     string
+	Title    string
+	Username string
+	Updates  int
+}
+
+// ChatCollector collects distinct chats of polled updates, it is the sink
+// of check chats instead of a publisher
+type ChatCollector struct {
+	chats map[int64]*SeenChat
+}
+
+// NewChatCollector creates an empty ChatCollector
+func NewChatCollector() *ChatCollector {
+	return &ChatCollector{chats: make(map[int64]*SeenChat)}
+}
+
+// Add counts the update for its chat, updates without a chat (inline
+// queries, polls, ...) are skipped
+func (c *ChatCollector) Add(update Update) {
+	chat := updateChat(update)
+	if chat == nil {
+		return
+	}
+
+	seen, ok := c.chats[chat.Id]
+	if !ok {
+		seen = &SeenChat{ID: chat.Id}
+		c.chats[chat.Id] = seen
+	}
+	seen.Updates++
+	// Keep the latest known names, a chat may be renamed while polling
+	seen.Type = chat.Type
+	if title := chatTitle(chat.Title, chat.FirstName, chat.LastName); title != "" {
+		seen.Title = title
+	}
+	if chat.Username != "" {
+		seen.Username = chat.Username
+	}
+}
+
+// Chats returns the collected chats, the busiest first
+func (c *ChatCollector) Chats() []SeenChat {
+	chats := make([]SeenChat, 0, len(c.chats))
+	for _, chat := range c.chats {
+		chats = append(chats, *chat)
+	}
+	slices.SortFunc(chats, func(a, b SeenChat) int {
+		if a.Updates != b.Updates {
+			return b.Updates - a.Updates
+		}
+		if a.ID < b.ID {
+			return -1
+		}
+		if a.ID > b.ID {
+			return 1
+		}
+		return 0
+	})
+	return chats
+}
+
+// chatTitle returns the group or channel title, or the name of a private chat
+func chatTitle(title, firstName, lastName string) string {
+	if title != "" {
+		return title
+	}
+	return strings.TrimSpace(firstName + " " + lastName)
+}
+
+// WriteChatsTable prints chats as an aligned table
+func WriteChatsTable(out io.Writer, chats []SeenChat) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAT ID\tTYPE\tTITLE\tUSERNAME\tUPDATES")
+	for _, chat := range chats {
+		username := ""
+		if chat.Username != "" {
+			username = "@" + chat.Username
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", chat.ID, chat.Type, chat.Title, username, chat.Updates)
+	}
+	return w.Flush()
+}
+
+// chatRouteSubject is the subject of the starter route of a chat
+func chatRouteSubject(chatID int64) string {
+	return fmt.Sprintf("telegram.chat_%d", chatID)
+}
+
+// chatRouteCondition matches messages of the chat and their edits, channel
+// posts for channels
+func chatRouteCondition(chat SeenChat) string {
+	if chat.Type == "channel" {
+		return fmt.Sprintf("update.ChannelPost?.Chat.Id == %d || update.EditedChannelPost?.Chat.Id == %d", chat.ID, chat.ID)
+	}
+	return fmt.Sprintf("update.Message?.Chat.Id == %d || update.EditedMessage?.Chat.Id == %d", chat.ID, chat.ID)
+}
+
+// WriteChatRoutes writes a starter routes YAML with one route per chat
+func WriteChatRoutes(out io.Writer, chats []SeenChat) error {
+	var b strings.Builder
+	b.WriteString("# Starter routes generated by `check chats`, one per chat seen while polling.\n")
+	b.WriteString("# Review the conditions and subjects before use.\n")
+	b.WriteString("routes:\n")
+	for _, chat := range chats {
+		// Titles are user input, keep them on a single comment line
+		title := strings.Join(strings.Fields(chat.Title), " ")
+		fmt.Fprintf(&b, "  # %s (%s, %d updates)\n", title, chat.Type, chat.Updates)
+		fmt.Fprintf(&b, "  - condition: %q\n", chatRouteCondition(chat))
+		b.WriteString("    subject:\n")
+		b.WriteString("      type: \"string\"\n")
+		fmt.Fprintf(&b, "      value: %q\n", chatRouteSubject(chat.ID))
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
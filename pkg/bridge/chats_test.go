@@ -0,0 +1,145 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chatFixtures() []Update {
+	group := gotgbot.Chat{Id: -100123, Type: "supergroup", Title: "Dev\nchat", Username: "devchat"}
+	private := gotgbot.Chat{Id: 42, Type: "private", FirstName: "Ann", LastName: "Lee", Username: "ann"}
+	channel := gotgbot.Chat{Id: -100456, Type: "channel", Title: "News"}
+
+	return []Update{
+		{UpdateId: 1, Message: &gotgbot.Message{Chat: group, Text: "hi"}},
+		{UpdateId: 2, Message: &gotgbot.Message{Chat: private, Text: "hello"}},
+		{UpdateId: 3, EditedMessage: &gotgbot.Message{Chat: group, Text: "hi!"}},
+		{UpdateId: 4, ChannelPost: &gotgbot.Message{Chat: channel, Text: "news"}},
+		{UpdateId: 5, CallbackQuery: &gotgbot.CallbackQuery{Id: "cb", Message: &gotgbot.Message{Chat: group}}},
+		{UpdateId: 6, InlineQuery: &gotgbot.InlineQuery{Id: "iq", Query: "x"}},
+	}
+}
+
+func TestChatCollector(t *testing.T) {
+	collector := NewChatCollector()
+	for _, update := range chatFixtures() {
+		collector.Add(update)
+	}
+
+	assert.Equal(t, []SeenChat{
+		{ID: -100123, Type: "supergroup", Title: "Dev\nchat", Username: "devchat", Updates: 3},
+		{ID: -100456, Type: "channel", Title: "News", Updates: 1},
+		{ID: 42, Type: "private", Title: "Ann Lee", Username: "ann", Updates: 1},
+	}, collector.Chats())
+}
+
+func TestWriteChatsTable(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, WriteChatsTable(&out, []SeenChat{
+		{ID: -100123, Type: "supergroup", Title: "Dev", Username: "devchat", Updates: 3},
+		{ID: 42, Type: "private", Title: "Ann Lee", Updates: 1},
+	}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"CHAT", "ID", "TYPE", "TITLE", "USERNAME", "UPDATES"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"-100123", "supergroup", "Dev", "@devchat", "3"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"42", "private", "Ann", "Lee", "1"}, strings.Fields(lines[2]))
+	// Columns are aligned
+	assert.Equal(t, strings.Index(lines[0], "TYPE"), strings.Index(lines[1], "supergroup"))
+}
+
+func TestWriteChatRoutes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	collector := NewChatCollector()
+	for _, update := range chatFixtures() {
+		collector.Add(update)
+	}
+
+	var routes bytes.Buffer
+	require.NoError(t, WriteChatRoutes(&routes, collector.Chats()))
+	assert.Contains(t, routes.String(), "  # Dev chat (supergroup, 3 updates)\n")
+
+	// The emitted file is a valid routes section
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := "telegram_token: test-token\nnats:\n  url: nats://test:4222\n" + routes.String()
+	require.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	router, err := NewRouterFromConfig(cfg, logger)
+	require.NoError(t, err)
+	require.Len(t, cfg.Routes, 3)
+
+	subjects := func(update Update) []string {
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		var got []string
+		for _, dest := range dests {
+			got = append(got, dest.Subject)
+		}
+		return got
+	}
+
+	fixtures := chatFixtures()
+	assert.Equal(t, []string{"telegram.chat_-100123"}, subjects(fixtures[0]))
+	assert.Equal(t, []string{"telegram.chat_42"}, subjects(fixtures[1]))
+	assert.Equal(t, []string{"telegram.chat_-100123"}, subjects(fixtures[2]))
+	assert.Equal(t, []string{"telegram.chat_-100456"}, subjects(fixtures[3]))
+	assert.Empty(t, subjects(fixtures[5]))
+}
+
+func TestPollUpdatesLoop_CollectsChats(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// The first poll returns updates from two chats, later polls wait
+	var polls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if polls.Add(1) > 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"result":[`+
+			`{"update_id":1,"message":{"message_id":1,"date":0,"chat":{"id":7,"type":"private","first_name":"Bob"}}},`+
+			`{"update_id":2,"message":{"message_id":2,"date":0,"chat":{"id":7,"type":"private","first_name":"Bob"}}},`+
+			`{"update_id":3,"channel_post":{"message_id":1,"date":0,"chat":{"id":-1009,"type":"channel","title":"Feed"}}}]}`)
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	collector := NewChatCollector()
+	require.NoError(t, PollUpdatesLoop(ctx, client, time.Millisecond, logger, func(update Update) bool {
+		collector.Add(update)
+		return true
+	}))
+
+	assert.Equal(t, []SeenChat{
+		{ID: 7, Type: "private", Title: "Bob", Updates: 2},
+		{ID: -1009, Type: "channel", Title: "Feed", Updates: 1},
+	}, collector.Chats())
+}
@@ -0,0 +1,149 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// pollRetryInterval is the delay before polling again after a failed getUpdates
+const pollRetryInterval = 5 * time.Second
+
+// pollRetryDelay returns how long to wait after a failed getUpdates, Telegram
+// may ask for a longer pause with retry_after
+func pollRetryDelay(err error) time.Duration {
+	var apiErr *TelegramAPIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > pollRetryInterval {
+		return apiErr.RetryAfter
+	}
+	return pollRetryInterval
+}
+
+// conflictRetryInterval is the delay after the first getUpdates conflict in a
+// row, it doubles with every further one up to maxConflictRetryInterval
+const (
+	conflictRetryInterval    = 30 * time.Second
+	maxConflictRetryInterval = 60 * time.Second
+)
+
+// conflictRetryDelay returns how long to wait after the given number of
+// getUpdates conflicts in a row
+func conflictRetryDelay(conflicts int) time.Duration {
+	delay := conflictRetryInterval
+	for i := 1; i < conflicts && delay < maxConflictRetryInterval; i++ {
+		delay *= 2
+	}
+	return min(delay, maxConflictRetryInterval)
+}
+
+// logPollError logs a failed getUpdates that will be retried
+func logPollError(logger *slog.Logger, err error) {
+	if errors.Is(err, ErrConflict) {
+		logger.Error("getUpdates conflicts with another bot instance or a webhook", "error", err, "hint", conflictHint(err))
+		return
+	}
+	logger.Error("failed to get updates", "error", err)
+}
+
+// conflictHint explains a 409 from getUpdates: Telegram mentions the webhook
+// in the description when one is set, otherwise another instance is polling
+func conflictHint(err error) string {
+	var apiErr *TelegramAPIError
+	if errors.As(err, &apiErr) && strings.Contains(strings.ToLower(apiErr.Description), "webhook") {
+		return "a webhook is configured; run `delete-webhook` to receive updates with getUpdates"
+	}
+	return "another process is polling getUpdates with this token, e.g. another bridge instance or `check bot`; stop it and try again"
+}
+
+// PollConflictWarning is printed by the check commands, which poll
+// getUpdates just like the bridge
+const PollConflictWarning = `WARNING: this command polls getUpdates with the bot token.
+A bridge running with the same token will get 409 Conflict errors and stop
+receiving updates until this command exits, and updates printed here are
+confirmed and won't reach the bridge. Stop the bridge first.`
+
+// UpdatesPoller is the part of TelegramClient used by the check commands
+type UpdatesPoller interface {
+	GetUpdates(ctx context.Context, offset int64) ([]Update, int64, error)
+}
+
+// PrintUpdates polls updates and writes them to out as JSON until ctx is done
+// or, when count > 0, count updates have been written
+func PrintUpdates(ctx context.Context, poller UpdatesPoller, out io.Writer, count int, idleSleep time.Duration, logger *slog.Logger) error {
+	var printed int
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return PollUpdatesLoop(ctx, poller, idleSleep, logger, func(update Update) bool {
+		// Output update as JSON
+		if err := encoder.Encode(update); err != nil {
+			logger.Error("failed to encode update", "error", err)
+		}
+		fmt.Fprintln(out) // Empty line between updates
+
+		printed++
+		if count > 0 && printed >= count {
+			logger.Info("received requested number of updates", "count", count)
+			return false
+		}
+		return true
+	})
+}
+
+// PollUpdatesLoop polls updates for the check commands and passes them to
+// sink until ctx is done or sink returns false. Nothing is published.
+func PollUpdatesLoop(ctx context.Context, poller UpdatesPoller, idleSleep time.Duration, logger *slog.Logger, sink func(Update) bool) error {
+	var offset int64 = 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		updates, nextOffset, err := poller.GetUpdates(ctx, offset)
+		if err != nil {
+			// Check if this is a graceful shutdown or the duration is over
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			if errors.Is(err, ErrUnauthorized) {
+				return fmt.Errorf("your TELEGRAM_BOT_TOKEN appears invalid")
+			}
+			if errors.Is(err, ErrConflict) {
+				return errors.New(conflictHint(err))
+			}
+			logPollError(logger, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollRetryDelay(err)):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			if !sink(update) {
+				return nil
+			}
+		}
+
+		// Update offset for next poll
+		offset = nextOffset
+
+		if len(updates) == 0 {
+			// No updates, optional short sleep before next poll
+			select {
+			case <-ctx.Done():
+			case <-time.After(idleSleep):
+			}
+		}
+	}
+}
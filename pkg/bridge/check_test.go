@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintUpdates_Count(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Every poll returns two new updates
+	var polls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottest-token/getUpdates", r.URL.Path)
+		n := polls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"ok":true,"result":[{"update_id":%d},{"update_id":%d}]}`, 2*n-1, 2*n)
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	var out bytes.Buffer
+	err := PrintUpdates(context.Background(), client, &out, 3, time.Millisecond, logger)
+	require.NoError(t, err)
+
+	var ids []int64
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var update Update
+		require.NoError(t, decoder.Decode(&update))
+		ids = append(ids, update.UpdateId)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+	assert.Equal(t, int64(2), polls.Load())
+}
+
+func TestPrintUpdates_Duration(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Long poll that never returns updates
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	var out bytes.Buffer
+	err := PrintUpdates(ctx, client, &out, 0, time.Millisecond, logger)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Empty(t, out.String())
+}
+
+func TestPrintUpdates_Conflict(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	tests := []struct {
+		name        string
+		description string
+		want        string
+	}{
+		{
+			name:        "webhook is set",
+			description: "Conflict: can't use getUpdates method while webhook is active; use deleteWebhook to delete the webhook first",
+			want:        "a webhook is configured; run `delete-webhook` to receive updates with getUpdates",
+		},
+		{
+			name:        "another instance",
+			description: "Conflict: terminated by other getUpdates request; make sure that only one bot instance is running",
+			want:        "another process is polling getUpdates with this token, e.g. another bridge instance or `check bot`; stop it and try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				polls.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprintf(w, `{"ok":false,"error_code":409,"description":%q}`, tt.description)
+			}))
+			defer server.Close()
+
+			client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+			var out bytes.Buffer
+			err := PrintUpdates(context.Background(), client, &out, 0, time.Millisecond, logger)
+			require.EqualError(t, err, tt.want)
+			assert.Equal(t, int64(1), polls.Load())
+		})
+	}
+}
+
+func TestPollRetryDelay(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{name: "network", err: fmt.Errorf("%w: getUpdates: %w", ErrNetwork, context.DeadlineExceeded), want: pollRetryInterval},
+		{name: "server error", err: &TelegramAPIError{Code: 502}, want: pollRetryInterval},
+		{name: "retry after", err: &TelegramAPIError{Code: 429, RetryAfter: 30 * time.Second}, want: 30 * time.Second},
+		{name: "short retry after", err: &TelegramAPIError{Code: 429, RetryAfter: time.Second}, want: pollRetryInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pollRetryDelay(tt.err))
+		})
+	}
+}
+
+func TestConflictRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, conflictRetryDelay(1))
+	assert.Equal(t, 60*time.Second, conflictRetryDelay(2))
+	assert.Equal(t, 60*time.Second, conflictRetryDelay(10))
+}
@@ -0,0 +1,1727 @@
+package bridge
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	items := strings.Split(s, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+type RouteSubjectType string
+
+const (
+	SubjectTypeString RouteSubjectType = "string"
+	SubjectTypeExpr   RouteSubjectType = "expr"
+)
+
+// DefaultChatMigrationsSubject receives group to supergroup migration events
+const DefaultChatMigrationsSubject = "telegram.chat_migrations"
+
+// PayloadMode selects what a route publishes
+type PayloadMode string
+
+const (
+	// PayloadFull publishes the update as received from Telegram
+	PayloadFull PayloadMode = "full"
+	// PayloadFlatten publishes FlatUpdate
+	PayloadFlatten PayloadMode = "flatten"
+)
+
+type ReplyMode string
+
+const (
+	ReplyModePublish ReplyMode = "publish"
+	ReplyModeRequest ReplyMode = "request"
+)
+
+// ReplyAction is the Telegram method used to deliver a request-reply answer
+type ReplyAction string
+
+const (
+	ReplyActionAnswerInlineQuery   ReplyAction = "answerInlineQuery"
+	ReplyActionAnswerCallbackQuery ReplyAction = "answerCallbackQuery"
+	ReplyActionSendMessage         ReplyAction = "sendMessage"
+)
+
+// EnrichKind selects data fetched from Bot API to enrich an update
+type EnrichKind string
+
+const (
+	EnrichChat       EnrichKind = "chat"
+	EnrichChatMember EnrichKind = "chat_member"
+)
+
+type BrokerType string
+
+const (
+	BrokerNATS  BrokerType = "nats"
+	BrokerKafka BrokerType = "kafka"
+)
+
+type EngineType string
+
+const (
+	EngineCore      EngineType = "core"
+	EngineJetStream EngineType = "jetstream"
+)
+
+type NATSConfig struct {
+	URL       string           `mapstructure:"url"`
+	Engine    EngineType       `mapstructure:"engine"`
+	JetStream *JetStreamConfig `mapstructure:"jetstream"`
+	// PendingLimitBytes bounds outgoing buffer; polling pauses when it is nearly full
+	PendingLimitBytes int                 `mapstructure:"pending_limit_bytes,omitempty"`
+	ConnectRetry      *ConnectRetryConfig `mapstructure:"connect_retry,omitempty"`
+	Reconnect         *ReconnectConfig    `mapstructure:"reconnect,omitempty"`
+	// Micro registers the bridge in the NATS services API
+	Micro bool `mapstructure:"micro"`
+	// OffsetStore keeps the getUpdates offset in a JetStream KV bucket
+	OffsetStore *OffsetStoreConfig `mapstructure:"offset_store,omitempty"`
+	// ConnectionName is the client name reported to the server, {bot} and
+	// {hostname} are replaced with the bot username and the host name
+	ConnectionName string `mapstructure:"connection_name,omitempty"`
+	// NoEcho stops the server from delivering messages published by the
+	// bridge to its own subscriptions
+	NoEcho bool `mapstructure:"no_echo"`
+}
+
+// OffsetStoreConfig controls persistence of the getUpdates offset in NATS KV
+type OffsetStoreConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Bucket  string `mapstructure:"bucket"`
+}
+
+// ConnectRetryConfig controls retries of the initial NATS connection and GetMe
+type ConnectRetryConfig struct {
+	// Attempts limits connection attempts, 0 retries until success
+	Attempts       int `mapstructure:"attempts"`
+	IntervalSec    int `mapstructure:"interval_sec"`
+	MaxIntervalSec int `mapstructure:"max_interval_sec"`
+}
+
+// ReconnectConfig controls reconnects after an established NATS connection is lost
+type ReconnectConfig struct {
+	// MaxReconnects limits reconnect attempts, -1 reconnects forever
+	MaxReconnects *int `mapstructure:"max_reconnects,omitempty"`
+	WaitSec       int  `mapstructure:"wait_sec"`
+	// MaxWaitSec above WaitSec doubles the delay after every failed attempt up to it
+	MaxWaitSec int `mapstructure:"max_wait_sec"`
+	// JitterMs adds a random delay of up to this many milliseconds to every attempt
+	JitterMs int `mapstructure:"jitter_ms"`
+}
+
+// DefaultMaxReconnects is the number of reconnect attempts before the NATS connection is closed
+const DefaultMaxReconnects = 5
+
+type KafkaConfig struct {
+	Brokers           []string `mapstructure:"brokers"`
+	Async             bool     `mapstructure:"async"`
+	AckRequired       int      `mapstructure:"ack_required"`
+	BatchSize         int      `mapstructure:"batch_size"`
+	BatchBytes        int64    `mapstructure:"batch_bytes"`
+	ReadTimeout       int      `mapstructure:"read_timeout"`
+	WriteTimeout      int      `mapstructure:"write_timeout"`
+	HeartbeatInterval int      `mapstructure:"heartbeat_interval"`
+	CommitInterval    int      `mapstructure:"commit_interval"`
+}
+
+type TelegramConfig struct {
+	APIURL               string `mapstructure:"api_url"`
+	LocalMode            bool   `mapstructure:"local_mode"`
+	PollTimeoutBufferSec int    `mapstructure:"poll_timeout_buffer_sec"`
+	// LocalDir is the working directory (--dir) of the local Bot API server,
+	// required with LocalMode; files outside it are not read
+	LocalDir string `mapstructure:"local_dir,omitempty"`
+	// IdleSleepMs is the pause before the next poll after an empty response, 0 polls immediately
+	IdleSleepMs *int `mapstructure:"idle_sleep_ms,omitempty"`
+	// AllowedUpdates limits getUpdates to these update types, empty keeps
+	// the Bot API default (all types except chat_member, message_reaction
+	// and message_reaction_count)
+	AllowedUpdates []string `mapstructure:"allowed_updates"`
+	// RateLimit throttles outbound sendMessage calls
+	RateLimit *RateLimitConfig `mapstructure:"rate_limit,omitempty"`
+	// StreamDecode decodes getUpdates responses one update at a time
+	// instead of the whole batch, bounding memory of large batches
+	StreamDecode bool `mapstructure:"stream_decode"`
+	// AdaptiveLimit lowers the getUpdates limit after heavy batches
+	AdaptiveLimit *AdaptiveLimitConfig `mapstructure:"adaptive_limit,omitempty"`
+	// ProxyURL sends Bot API calls through an HTTP(S) or SOCKS5 proxy
+	ProxyURL string `mapstructure:"proxy_url,omitempty"`
+	// RequestTimeoutSec bounds Bot API calls other than getUpdates, 0 keeps 60 seconds
+	RequestTimeoutSec int `mapstructure:"request_timeout_sec,omitempty"`
+	// MaxConflicts stops the bridge after this many getUpdates conflicts
+	// (HTTP 409) in a row, 0 retries forever
+	MaxConflicts *int `mapstructure:"max_conflicts,omitempty"`
+}
+
+// AdaptiveLimitConfig halves the getUpdates limit when a batch is larger
+// than MaxBatchBytes or a full batch takes longer than MaxBatchMs to fetch,
+// and doubles it back after RampUpAfter light batches in a row
+type AdaptiveLimitConfig struct {
+	Enabled       bool  `mapstructure:"enabled"`
+	Min           int   `mapstructure:"min"`
+	MaxBatchBytes int64 `mapstructure:"max_batch_bytes"`
+	MaxBatchMs    int   `mapstructure:"max_batch_ms"`
+	RampUpAfter   int   `mapstructure:"ramp_up_after"`
+}
+
+const (
+	DefaultAdaptiveLimitMin     = 10
+	DefaultAdaptiveMaxBatchSize = 8 << 20
+	DefaultAdaptiveMaxBatchMs   = 5000
+	DefaultAdaptiveRampUpAfter  = 5
+)
+
+// RateLimitConfig limits outbound messages, defaults follow Telegram limits:
+// about 1 message per second in a chat, 20 per minute in a group and 30 per second overall
+type RateLimitConfig struct {
+	PerChatPerSec  int `mapstructure:"per_chat_per_sec"`
+	PerGroupPerMin int `mapstructure:"per_group_per_min"`
+	GlobalPerSec   int `mapstructure:"global_per_sec"`
+}
+
+const (
+	DefaultPerChatPerSec  = 1
+	DefaultPerGroupPerMin = 20
+	DefaultGlobalPerSec   = 30
+)
+
+// DefaultIdleSleepMs is the default pause after an empty getUpdates response
+const DefaultIdleSleepMs = 1000
+
+// DefaultMaxConflicts is the default number of getUpdates conflicts in a row
+// that stops the bridge
+const DefaultMaxConflicts = 10
+
+// IdleSleep returns the pause after an empty getUpdates response
+func (c *TelegramConfig) IdleSleep() time.Duration {
+	if c == nil || c.IdleSleepMs == nil {
+		return DefaultIdleSleepMs * time.Millisecond
+	}
+	return time.Duration(*c.IdleSleepMs) * time.Millisecond
+}
+
+type WatchdogAction string
+
+const (
+	WatchdogActionWarn WatchdogAction = "warn"
+	WatchdogActionExit WatchdogAction = "exit"
+)
+
+type WatchdogConfig struct {
+	// Multiplier of the poll timeout without heartbeat after which the loop is stalled
+	Multiplier  int            `mapstructure:"multiplier"`
+	IntervalSec int            `mapstructure:"interval_sec"`
+	Action      WatchdogAction `mapstructure:"action"`
+}
+
+// EnrichmentConfig controls the cache of getChat/getChatMember results
+type EnrichmentConfig struct {
+	CacheSize int `mapstructure:"cache_size"`
+	TTLSec    int `mapstructure:"ttl_sec"`
+	// LookupTimeoutMs bounds how long is_admin waits for an uncached lookup
+	LookupTimeoutMs int `mapstructure:"lookup_timeout_ms"`
+}
+
+// PollAggregationConfig controls publishing per-poll vote tallies
+type PollAggregationConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Subject receives tally snapshots (topic for Kafka)
+	Subject   string `mapstructure:"subject"`
+	CacheSize int    `mapstructure:"cache_size"`
+	TTLSec    int    `mapstructure:"ttl_sec"`
+}
+
+// DefaultPollTalliesSubject receives poll tally snapshots
+const DefaultPollTalliesSubject = "telegram.poll_tallies"
+
+// EditTrackingConfig controls remembering message texts to describe edits
+type EditTrackingConfig struct {
+	Enabled   bool `mapstructure:"enabled"`
+	CacheSize int  `mapstructure:"cache_size"`
+	TTLSec    int  `mapstructure:"ttl_sec"`
+}
+
+// EditSubjectsConfig controls publishing edited messages to <subject>.edits
+type EditSubjectsConfig struct {
+	Enabled bool             `mapstructure:"enabled"`
+	Mode    EditSubjectsMode `mapstructure:"mode"`
+}
+
+// LogConfig controls logging of the bridge
+type LogConfig struct {
+	UpdateLogging  UpdateLoggingMode     `mapstructure:"update_logging"`
+	UpdateSampling *UpdateSamplingConfig `mapstructure:"update_sampling,omitempty"`
+}
+
+// UpdateLoggingMode selects which updates get an "update processed" record
+type UpdateLoggingMode string
+
+const (
+	UpdateLoggingOff UpdateLoggingMode = "off"
+	// UpdateLoggingSampled logs updates picked by update_sampling and every
+	// update that failed
+	UpdateLoggingSampled UpdateLoggingMode = "sampled"
+	UpdateLoggingAll     UpdateLoggingMode = "all"
+)
+
+// DefaultUpdateLogEvery is the sampling rate of update_logging: sampled
+// without update_sampling
+const DefaultUpdateLogEvery = 100
+
+// UpdateSamplingConfig limits "update processed" records to updates whose
+// update_id is a multiple of Every or at most PerSec records per second.
+// Zero values log every update.
+type UpdateSamplingConfig struct {
+	Every  int `mapstructure:"every"`
+	PerSec int `mapstructure:"per_sec"`
+}
+
+// PublishConfig controls the published update payload
+type PublishConfig struct {
+	// StringifyIDs publishes integer id, message_id and update_id values as strings
+	StringifyIDs bool `mapstructure:"stringify_ids"`
+	// Batch publishes updates of a subject as JSON arrays
+	Batch *BatchConfig `mapstructure:"batch,omitempty"`
+}
+
+// BatchConfig bounds publish.batch batches by size and by the wait of
+// their first update
+type BatchConfig struct {
+	MaxMessages int `mapstructure:"max_messages"`
+	MaxDelayMs  int `mapstructure:"max_delay_ms"`
+}
+
+// IdempotencyConfig controls suppressing outbound messages with an already sent idempotency_key
+type IdempotencyConfig struct {
+	Enabled   bool `mapstructure:"enabled"`
+	CacheSize int  `mapstructure:"cache_size"`
+	TTLSec    int  `mapstructure:"ttl_sec"`
+}
+
+type PaymentsConfig struct {
+	AutoApprove         bool   `mapstructure:"auto_approve"`
+	RequestSubject      string `mapstructure:"request_subject"`
+	TimeoutMs           int    `mapstructure:"timeout_ms"`
+	DefaultOk           bool   `mapstructure:"default_ok"`
+	DefaultErrorMessage string `mapstructure:"default_error_message"`
+}
+
+type JetStreamConfig struct {
+	StreamConfig string `mapstructure:"stream_config"`
+	// Stream declares the default stream in the config instead of stream_config
+	Stream *StreamSpec `mapstructure:"stream,omitempty"`
+	// ManageStream creates Stream when it is missing and updates it when it differs
+	ManageStream bool `mapstructure:"manage_stream"`
+	// Streams maps additional stream names to their config files.
+	// Routes select one of them with the stream field.
+	Streams map[string]string `mapstructure:"streams,omitempty"`
+	// MsgID is an expr for the Nats-Msg-Id dedup header of update
+	// publications, empty means "<bot_id>-<update_id>"
+	MsgID string `mapstructure:"msg_id"`
+}
+
+// StreamSpec is a JetStream stream declared in the bridge config
+type StreamSpec struct {
+	Name     string   `mapstructure:"name"`
+	Subjects []string `mapstructure:"subjects"`
+	// Retention is "limits", "interest" or "workqueue"
+	Retention string `mapstructure:"retention"`
+	// MaxAgeSec limits message age, 0 keeps messages forever
+	MaxAgeSec int `mapstructure:"max_age_sec"`
+	// Storage is "file" or "memory"
+	Storage  string `mapstructure:"storage"`
+	Replicas int    `mapstructure:"replicas"`
+}
+
+type RouteSubject struct {
+	Type  RouteSubjectType `mapstructure:"type"`
+	Value string           `mapstructure:"value"`
+}
+
+type RouteTopic struct {
+	Type  RouteSubjectType `mapstructure:"type"`
+	Value string           `mapstructure:"value"`
+}
+
+type RouteKey struct {
+	Type  RouteSubjectType `mapstructure:"type"`
+	Value string           `mapstructure:"value"`
+}
+
+// RouteRespond is a text the bridge sends back to the chat of a matched message
+type RouteRespond struct {
+	// Text is sent as is, TextExpr is an expr program returning the text
+	Text      string `mapstructure:"text"`
+	TextExpr  string `mapstructure:"text_expr"`
+	ParseMode string `mapstructure:"parse_mode"`
+	// Only makes the route respond without publishing the update
+	Only bool `mapstructure:"only"`
+}
+
+type Route struct {
+	Name      string `mapstructure:"name,omitempty"`
+	Enabled   *bool  `mapstructure:"enabled,omitempty"`
+	Condition string `mapstructure:"condition"`
+	// ConditionPreset names a built-in condition, expanded into Condition by LoadConfig
+	ConditionPreset string        `mapstructure:"condition_preset,omitempty"`
+	Subject         *RouteSubject `mapstructure:"subject,omitempty"`
+	Topic           *RouteTopic   `mapstructure:"topic,omitempty"`
+	Key             *RouteKey     `mapstructure:"key,omitempty"`
+	Sample          *float64      `mapstructure:"sample,omitempty"`
+	Stream          string        `mapstructure:"stream,omitempty"`
+	// ReplyMode "request" sends a NATS request and delivers the reply to Telegram
+	ReplyMode      ReplyMode `mapstructure:"reply_mode,omitempty"`
+	ReplyTimeoutMs int       `mapstructure:"reply_timeout_ms,omitempty"`
+	// ReplyAction overrides the action picked by update type
+	ReplyAction ReplyAction `mapstructure:"reply_action,omitempty"`
+	// Enrich lists data fetched via getChat/getChatMember for matching updates
+	Enrich []EnrichKind `mapstructure:"enrich,omitempty"`
+	// Respond sends a text back to the chat of matched messages
+	Respond *RouteRespond `mapstructure:"respond,omitempty"`
+	// ShadowSubject additionally publishes matched updates to a second subject,
+	// e.g. while consumers move from the old subject to a new one
+	ShadowSubject *RouteSubject `mapstructure:"shadow_subject,omitempty"`
+	// RequestTranscription asks transcription_request_subject for the text of
+	// voice notes and video notes and publishes it as transcript
+	RequestTranscription bool `mapstructure:"request_transcription,omitempty"`
+	// Scrub overrides scrub.enabled for the route
+	Scrub *bool `mapstructure:"scrub,omitempty"`
+	// Payload "flatten" publishes a compact event with the same fields for
+	// every update type instead of the update
+	Payload PayloadMode `mapstructure:"payload,omitempty"`
+}
+
+// IsEnabled reports whether the route is enabled (routes are enabled by default)
+func (r Route) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// RespondsOnly reports whether the route responds without publishing
+func (r Route) RespondsOnly() bool {
+	return r.Respond != nil && r.Respond.Only
+}
+
+// disableRoutes forces off routes with the given names
+func disableRoutes(routes []Route, names []string, logger *slog.Logger) {
+	disabled := false
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for i := range routes {
+			if routes[i].Name == name {
+				routes[i].Enabled = &disabled
+				found = true
+			}
+		}
+
+		if found {
+			logger.Info("route disabled by env", "name", name)
+		} else {
+			logger.Warn("unknown route name in TNB_DISABLED_ROUTES", "name", name)
+		}
+	}
+}
+
+// Config holds the application configuration
+type Config struct {
+	Mode                  string       `mapstructure:"mode"`
+	Routes                []Route      `mapstructure:"routes"`
+	Broker                BrokerType   `mapstructure:"broker"`
+	NATS                  *NATSConfig  `mapstructure:"nats,omitempty"`
+	Kafka                 *KafkaConfig `mapstructure:"kafka,omitempty"`
+	UnmatchedSubject      string       `mapstructure:"unmatched_subject,omitempty"`
+	ChatMigrationsSubject string       `mapstructure:"chat_migrations_subject,omitempty"`
+	DeadLetterSubject     string       `mapstructure:"dead_letter_subject,omitempty"`
+	// OutboundErrorsSubject receives replies rejected by outbound message validation
+	OutboundErrorsSubject  string                 `mapstructure:"outbound_errors_subject,omitempty"`
+	Telegram               *TelegramConfig        `mapstructure:"telegram,omitempty"`
+	Payments               *PaymentsConfig        `mapstructure:"payments,omitempty"`
+	Watchdog               *WatchdogConfig        `mapstructure:"watchdog,omitempty"`
+	Enrichment             *EnrichmentConfig      `mapstructure:"enrichment,omitempty"`
+	EditTracking           *EditTrackingConfig    `mapstructure:"edit_tracking,omitempty"`
+	EditSubjects           *EditSubjectsConfig    `mapstructure:"edit_subjects,omitempty"`
+	PollAggregation        *PollAggregationConfig `mapstructure:"poll_aggregation,omitempty"`
+	Idempotency            *IdempotencyConfig     `mapstructure:"idempotency,omitempty"`
+	Publish                *PublishConfig         `mapstructure:"publish,omitempty"`
+	Log                    *LogConfig             `mapstructure:"log,omitempty"`
+	AutoAnswerCallbacks    bool                   `mapstructure:"auto_answer_callbacks,omitempty"`
+	AutoAnswerCallbackText string                 `mapstructure:"auto_answer_callback_text,omitempty"`
+	StartupProbe           bool                   `mapstructure:"startup_probe,omitempty"`
+	StartupProbeRoundTrip  bool                   `mapstructure:"startup_probe_round_trip,omitempty"`
+	StartupProbeOnFailure  ProbeFailureAction     `mapstructure:"startup_probe_on_failure,omitempty"`
+	IncludeBotMeta         bool                   `mapstructure:"include_bot_meta,omitempty"`
+	BotMetaMode            BotMetaMode            `mapstructure:"bot_meta_mode,omitempty"`
+	TelegramToken          string                 `mapstructure:"telegram_token,omitempty" secret:"true"`
+	RouteWorkers           int                    `mapstructure:"route_workers"`
+	PublishWorkers         int                    `mapstructure:"publish_workers"`
+	PublishShutdownTimeout int                    `mapstructure:"publish_shutdown_timeout"`
+	// ShutdownTimeout bounds the whole graceful shutdown in seconds
+	ShutdownTimeout int `mapstructure:"shutdown_timeout"`
+	// StrictSubjects fails validation on subject collisions in "all" mode
+	// instead of warning about them
+	StrictSubjects bool `mapstructure:"strict_subjects,omitempty"`
+	// ExprEnv lists environment variables available to expressions as env.NAME
+	ExprEnv []string `mapstructure:"expr_env,omitempty"`
+	// RouteCache caches results of conditions that depend only on the update
+	// type, e.g. `update.Message != nil`
+	RouteCache bool `mapstructure:"route_cache,omitempty"`
+	// OrderedRoutes evaluates routes one at a time in definition order instead
+	// of in batches of route_workers
+	OrderedRoutes bool `mapstructure:"ordered_routes,omitempty"`
+	// ControlSubject receives bridge lifecycle events, empty disables them
+	ControlSubject string `mapstructure:"control_subject,omitempty"`
+	// TranscriptionRequestSubject receives requests for transcripts of routes
+	// with request_transcription
+	TranscriptionRequestSubject string `mapstructure:"transcription_request_subject,omitempty"`
+	// TranscriptionTimeoutMs bounds waiting for a transcript
+	TranscriptionTimeoutMs int `mapstructure:"transcription_timeout_ms"`
+	// HTTPServer serves JSON stats over HTTP for setups without Prometheus
+	HTTPServer *HTTPServerConfig `mapstructure:"http_server,omitempty"`
+	// IgnoreBots drops messages sent by bots before routing
+	IgnoreBots bool `mapstructure:"ignore_bots,omitempty"`
+	// IgnoreSelf drops messages sent by the bridge bot itself
+	IgnoreSelf bool `mapstructure:"ignore_self,omitempty"`
+	// PublishTimeout bounds a single publication in seconds
+	PublishTimeout int `mapstructure:"publish_timeout"`
+	// PublishQueueSize is the number of publications waiting for publish
+	// workers, split evenly between them
+	PublishQueueSize int `mapstructure:"publish_queue_size"`
+	// MaxInFlight bounds updates routed and published concurrently, 0 is unlimited
+	MaxInFlight int `mapstructure:"max_in_flight,omitempty"`
+	// PublishMaxAttempts bounds publications of a message failing with a
+	// transient error, 1 disables retries
+	PublishMaxAttempts int `mapstructure:"publish_max_attempts"`
+	// PublishRetryBackoffMs is the delay before the second attempt, doubled
+	// before every next one
+	PublishRetryBackoffMs int `mapstructure:"publish_retry_backoff_ms"`
+	// Scrub removes personal data from publications of routes
+	Scrub *ScrubConfig `mapstructure:"scrub,omitempty"`
+	// PayloadSchemaVersion selects the layout of published updates, set to an
+	// older version while consumers migrate
+	PayloadSchemaVersion int `mapstructure:"payload_schema_version"`
+	// Sharding assigns updates to shards, so consumers can scale out keeping
+	// per-chat order
+	Sharding *ShardingConfig `mapstructure:"sharding,omitempty"`
+	// SlowUpdateThresholdMs is the latency from receiving an update to the
+	// end of its publications logged as slow, 0 disables the warning
+	SlowUpdateThresholdMs int `mapstructure:"slow_update_threshold_ms,omitempty"`
+	// ChatLimit bounds updates processed per chat, so a flooding chat doesn't
+	// slow down the others
+	ChatLimit *ChatLimitConfig `mapstructure:"chat_limit,omitempty"`
+	// DefaultSubject receives updates matching no route when unmatched_subject
+	// is not set, with no routes it receives every update
+	DefaultSubject string `mapstructure:"default_subject,omitempty"`
+	// HA runs bridges of the same bot as a leader and warm standbys
+	HA *HAConfig `mapstructure:"ha,omitempty"`
+}
+
+// ScrubConfig lists the rules applied to published updates
+type ScrubConfig struct {
+	// Enabled scrubs all routes except ones with scrub: false, otherwise
+	// only routes with scrub: true are scrubbed
+	Enabled bool `mapstructure:"enabled"`
+	// Remove lists field paths relative to the update, e.g. message.contact
+	Remove []string `mapstructure:"remove,omitempty"`
+	// Redact replaces matches in text and caption fields
+	Redact []ScrubRedactConfig `mapstructure:"redact,omitempty"`
+	// HashUserIDs replaces user ids with a hash salted with Salt
+	HashUserIDs bool   `mapstructure:"hash_user_ids,omitempty"`
+	Salt        string `mapstructure:"salt,omitempty" secret:"true"`
+}
+
+// ScrubRedactConfig is a regular expression and its replacement
+type ScrubRedactConfig struct {
+	Pattern     string `mapstructure:"pattern"`
+	Replacement string `mapstructure:"replacement,omitempty"`
+}
+
+// ShardingConfig assigns every update to one of Shards by Key
+type ShardingConfig struct {
+	Key    ShardKey `mapstructure:"key"`
+	Shards int      `mapstructure:"shards"`
+	// Suffix appends .shard.<k> to the subjects of routes and unmatched_subject
+	Suffix bool `mapstructure:"suffix"`
+}
+
+// ChatLimitOverflow is what happens to updates of a chat over chat_limit
+type ChatLimitOverflow string
+
+const (
+	// ChatLimitDrop drops every update over the limit
+	ChatLimitDrop ChatLimitOverflow = "drop"
+	// ChatLimitSample keeps one of every sample_every updates over the limit
+	ChatLimitSample ChatLimitOverflow = "sample"
+)
+
+const (
+	DefaultChatLimitSampleEvery = 10
+	DefaultChatLimitMaxChats    = 10000
+)
+
+// ChatLimitConfig configures the per-chat limit applied before routing
+type ChatLimitConfig struct {
+	PerSec int `mapstructure:"per_sec"`
+	// Burst defaults to PerSec
+	Burst       int               `mapstructure:"burst"`
+	Overflow    ChatLimitOverflow `mapstructure:"overflow"`
+	SampleEvery int               `mapstructure:"sample_every"`
+	// MaxChats bounds the chats tracked, the least recently seen one is
+	// forgotten first
+	MaxChats    int     `mapstructure:"max_chats"`
+	ExemptChats []int64 `mapstructure:"exempt_chats"`
+}
+
+// HAConfig configures leader election between bridges of the same bot:
+// only the leader polls, standbys wait for its lease to expire
+type HAConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Bucket is the NATS KV bucket holding the lease
+	Bucket string `mapstructure:"bucket"`
+	// LeaseSec is how long the lease outlives a leader that stopped renewing it
+	LeaseSec int `mapstructure:"lease_sec"`
+}
+
+// HTTPServerConfig configures the bridge HTTP server
+type HTTPServerConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Listen  string `mapstructure:"listen"`
+	// Stats serves GET /stats, enabled by default
+	Stats *bool `mapstructure:"stats,omitempty"`
+	// Health serves GET /healthz, enabled by default
+	Health *bool `mapstructure:"health,omitempty"`
+}
+
+// DefaultHTTPListen is the default address of the HTTP server
+const DefaultHTTPListen = ":8080"
+
+// StatsEnabled reports whether GET /stats is served
+func (c *HTTPServerConfig) StatsEnabled() bool {
+	return c.Stats == nil || *c.Stats
+}
+
+// HealthEnabled reports whether GET /healthz is served
+func (c *HTTPServerConfig) HealthEnabled() bool {
+	return c.Health == nil || *c.Health
+}
+
+// hasWildcard reports whether a NATS subject contains wildcards,
+// which can be subscribed to but not published to
+func hasWildcard(subject string) bool {
+	return strings.ContainsAny(subject, "*>")
+}
+
+// subjectCollisions describes enabled routes whose static subjects are
+// equal or overlap through NATS wildcards (foo.* and foo.bar), or that share
+// a subject expression; in "all" mode they publish a matched update more
+// than once.
+func subjectCollisions(routes []Route) []string {
+	var collisions []string
+	// Indexes of the routes with static subjects checked so far
+	var static []int
+	exprs := make(map[string]int)
+	for i, route := range routes {
+		if !route.IsEnabled() || route.RespondsOnly() || route.Subject == nil {
+			continue
+		}
+		if route.Subject.Type == SubjectTypeExpr {
+			// Expressions differing only in whitespace are the same
+			value := strings.Join(strings.Fields(route.Subject.Value), " ")
+			if first, ok := exprs[value]; ok {
+				collisions = append(collisions, fmt.Sprintf("routes[%d] and routes[%d] have the same subject expression '%s'", first, i, value))
+				continue
+			}
+			exprs[value] = i
+			continue
+		}
+
+		value := route.Subject.Value
+		collision := ""
+		for _, first := range static {
+			other := routes[first].Subject.Value
+			if other == value {
+				collision = fmt.Sprintf("routes[%d] and routes[%d] have the same subject '%s'", first, i, value)
+				break
+			}
+			if subjectsOverlap(other, value) {
+				collision = fmt.Sprintf("routes[%d] and routes[%d] have overlapping subjects '%s' and '%s'", first, i, other, value)
+				break
+			}
+		}
+		if collision != "" {
+			collisions = append(collisions, collision)
+			continue
+		}
+		static = append(static, i)
+	}
+	return collisions
+}
+
+// subjectsOverlap reports whether some subject matches both NATS subjects,
+// comparing them token by token: '*' matches one token and '>' the rest,
+// at least one token
+func subjectsOverlap(a, b string) bool {
+	at, bt := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(at) && i < len(bt); i++ {
+		if at[i] == ">" || bt[i] == ">" {
+			return true
+		}
+		if at[i] != bt[i] && at[i] != "*" && bt[i] != "*" {
+			return false
+		}
+	}
+	return len(at) == len(bt)
+}
+
+// LoadConfig loads configuration from file and environment variables
+func LoadConfig(configPath string, logger *slog.Logger) (*Config, error) {
+	v := viper.New()
+
+	// Read from environment variables (only for telegram_token and nats_url)
+	// Subject is read only from YAML file
+	v.BindEnv("telegram_token", "TELEGRAM_BOT_TOKEN")
+	v.BindEnv("nats.url", "NATS_URL")
+
+	// Read from config file if provided
+	if configPath != "" {
+		v.SetConfigFile(configPath)
+		logger.Info("loading config file", "path", configPath)
+
+		if err := v.ReadInConfig(); err != nil {
+			logger.Error("failed to read config file", "error", err)
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		logger.Info("config file loaded successfully")
+	}
+
+	// Unmarshal config
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		logger.Error("failed to unmarshal config", "error", err)
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	// Handle KAFKA_BROKERS env variable manually (comma-separated string to slice)
+	if brokersEnv := os.Getenv("KAFKA_BROKERS"); brokersEnv != "" {
+		if cfg.Kafka == nil {
+			cfg.Kafka = &KafkaConfig{}
+		}
+		cfg.Kafka.Brokers = splitList(brokersEnv)
+	}
+
+	// The scrub salt is a secret and may be kept out of the file
+	if salt := os.Getenv("TNB_SCRUB_SALT"); salt != "" && cfg.Scrub != nil {
+		cfg.Scrub.Salt = salt
+	}
+
+	// Handle TNB_DISABLED_ROUTES env variable (comma-separated route names forced off)
+	if disabledEnv := os.Getenv("TNB_DISABLED_ROUTES"); disabledEnv != "" {
+		disableRoutes(cfg.Routes, splitList(disabledEnv), logger)
+	}
+
+	return LoadConfigStruct(&cfg, logger)
+}
+
+// LoadConfigStruct completes a Config populated in code the same way LoadConfig
+// completes one read from a file: condition presets are expanded and defaults
+// are set. Environment variables are not read. Call Validate afterwards.
+func LoadConfigStruct(cfg *Config, logger *slog.Logger) (*Config, error) {
+	if err := expandConditionPresets(cfg.Routes); err != nil {
+		logger.Error("failed to expand condition presets", "error", err)
+		return nil, err
+	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = "first"
+	}
+
+	if cfg.Broker == "" {
+		cfg.Broker = BrokerNATS
+	}
+
+	if cfg.Broker == BrokerNATS {
+		if cfg.NATS == nil {
+			cfg.NATS = &NATSConfig{}
+		}
+		if cfg.NATS.Engine == "" {
+			cfg.NATS.Engine = EngineCore
+		}
+		if cfg.NATS.ConnectRetry == nil {
+			cfg.NATS.ConnectRetry = &ConnectRetryConfig{}
+		}
+		if cfg.NATS.ConnectRetry.IntervalSec == 0 {
+			cfg.NATS.ConnectRetry.IntervalSec = 2
+		}
+		if cfg.NATS.ConnectRetry.MaxIntervalSec == 0 {
+			cfg.NATS.ConnectRetry.MaxIntervalSec = 30
+		}
+		if js := cfg.NATS.JetStream; js != nil && js.Stream != nil {
+			if js.Stream.Retention == "" {
+				js.Stream.Retention = "limits"
+			}
+			if js.Stream.Storage == "" {
+				js.Stream.Storage = "file"
+			}
+			if js.Stream.Replicas == 0 {
+				js.Stream.Replicas = 1
+			}
+		}
+		if cfg.NATS.Reconnect == nil {
+			cfg.NATS.Reconnect = &ReconnectConfig{}
+		}
+		if cfg.NATS.Reconnect.MaxReconnects == nil {
+			maxReconnects := DefaultMaxReconnects
+			cfg.NATS.Reconnect.MaxReconnects = &maxReconnects
+		}
+		if cfg.NATS.Reconnect.WaitSec == 0 {
+			cfg.NATS.Reconnect.WaitSec = 2
+		}
+		if cfg.NATS.Reconnect.MaxWaitSec == 0 {
+			cfg.NATS.Reconnect.MaxWaitSec = cfg.NATS.Reconnect.WaitSec
+		}
+		if cfg.NATS.Reconnect.JitterMs == 0 {
+			cfg.NATS.Reconnect.JitterMs = 100
+		}
+		if cfg.NATS.OffsetStore == nil {
+			cfg.NATS.OffsetStore = &OffsetStoreConfig{}
+		}
+		if cfg.NATS.OffsetStore.Bucket == "" {
+			cfg.NATS.OffsetStore.Bucket = DefaultOffsetBucket
+		}
+		if cfg.NATS.ConnectionName == "" {
+			cfg.NATS.ConnectionName = DefaultNATSConnectionName
+		}
+	}
+
+	if cfg.Broker == BrokerKafka {
+		if cfg.Kafka == nil {
+			cfg.Kafka = &KafkaConfig{}
+		}
+		if cfg.Kafka.AckRequired == 0 {
+			cfg.Kafka.AckRequired = -1
+		}
+		if cfg.Kafka.BatchBytes == 0 {
+			cfg.Kafka.BatchBytes = 1048576
+		}
+	}
+
+	for i := range cfg.Routes {
+		if cfg.Routes[i].ReplyMode == "" {
+			cfg.Routes[i].ReplyMode = ReplyModePublish
+		}
+		if cfg.Routes[i].ReplyMode == ReplyModeRequest && cfg.Routes[i].ReplyTimeoutMs == 0 {
+			cfg.Routes[i].ReplyTimeoutMs = 3000
+		}
+	}
+
+	if cfg.ChatMigrationsSubject == "" {
+		cfg.ChatMigrationsSubject = DefaultChatMigrationsSubject
+	}
+
+	if cfg.Telegram == nil {
+		cfg.Telegram = &TelegramConfig{}
+	}
+	if cfg.Telegram.APIURL == "" {
+		cfg.Telegram.APIURL = DefaultTelegramAPIURL
+	}
+	if cfg.Telegram.PollTimeoutBufferSec == 0 {
+		cfg.Telegram.PollTimeoutBufferSec = int(DefaultPollTimeoutBuffer.Seconds())
+	}
+	if cfg.Telegram.IdleSleepMs == nil {
+		idleSleepMs := DefaultIdleSleepMs
+		cfg.Telegram.IdleSleepMs = &idleSleepMs
+	}
+	if cfg.Telegram.MaxConflicts == nil {
+		maxConflicts := DefaultMaxConflicts
+		cfg.Telegram.MaxConflicts = &maxConflicts
+	}
+	if cfg.Telegram.RateLimit == nil {
+		cfg.Telegram.RateLimit = &RateLimitConfig{}
+	}
+	if cfg.Telegram.RateLimit.PerChatPerSec == 0 {
+		cfg.Telegram.RateLimit.PerChatPerSec = DefaultPerChatPerSec
+	}
+	if cfg.Telegram.RateLimit.PerGroupPerMin == 0 {
+		cfg.Telegram.RateLimit.PerGroupPerMin = DefaultPerGroupPerMin
+	}
+	if cfg.Telegram.RateLimit.GlobalPerSec == 0 {
+		cfg.Telegram.RateLimit.GlobalPerSec = DefaultGlobalPerSec
+	}
+	if cfg.Telegram.AdaptiveLimit == nil {
+		cfg.Telegram.AdaptiveLimit = &AdaptiveLimitConfig{}
+	}
+	if cfg.Telegram.AdaptiveLimit.Min == 0 {
+		cfg.Telegram.AdaptiveLimit.Min = DefaultAdaptiveLimitMin
+	}
+	if cfg.Telegram.AdaptiveLimit.MaxBatchBytes == 0 {
+		cfg.Telegram.AdaptiveLimit.MaxBatchBytes = DefaultAdaptiveMaxBatchSize
+	}
+	if cfg.Telegram.AdaptiveLimit.MaxBatchMs == 0 {
+		cfg.Telegram.AdaptiveLimit.MaxBatchMs = DefaultAdaptiveMaxBatchMs
+	}
+	if cfg.Telegram.AdaptiveLimit.RampUpAfter == 0 {
+		cfg.Telegram.AdaptiveLimit.RampUpAfter = DefaultAdaptiveRampUpAfter
+	}
+
+	if cfg.Payments != nil {
+		if cfg.Payments.TimeoutMs == 0 {
+			cfg.Payments.TimeoutMs = 8000
+		}
+		if cfg.Payments.DefaultErrorMessage == "" {
+			cfg.Payments.DefaultErrorMessage = "Payment service is temporarily unavailable, please try again later"
+		}
+	}
+
+	if cfg.Watchdog == nil {
+		cfg.Watchdog = &WatchdogConfig{}
+	}
+	if cfg.Watchdog.Multiplier == 0 {
+		cfg.Watchdog.Multiplier = 4
+	}
+	if cfg.Watchdog.IntervalSec == 0 {
+		cfg.Watchdog.IntervalSec = 10
+	}
+	if cfg.Watchdog.Action == "" {
+		cfg.Watchdog.Action = WatchdogActionWarn
+	}
+
+	if cfg.Enrichment == nil {
+		cfg.Enrichment = &EnrichmentConfig{}
+	}
+	if cfg.Enrichment.CacheSize == 0 {
+		cfg.Enrichment.CacheSize = 1000
+	}
+	if cfg.Enrichment.TTLSec == 0 {
+		cfg.Enrichment.TTLSec = 300
+	}
+	if cfg.Enrichment.LookupTimeoutMs == 0 {
+		cfg.Enrichment.LookupTimeoutMs = 200
+	}
+
+	if cfg.EditTracking == nil {
+		cfg.EditTracking = &EditTrackingConfig{}
+	}
+	if cfg.EditTracking.CacheSize == 0 {
+		cfg.EditTracking.CacheSize = 1000
+	}
+	if cfg.EditTracking.TTLSec == 0 {
+		cfg.EditTracking.TTLSec = 86400
+	}
+	if cfg.Publish == nil {
+		cfg.Publish = &PublishConfig{}
+	}
+	if b := cfg.Publish.Batch; b != nil {
+		if b.MaxMessages == 0 {
+			b.MaxMessages = DefaultBatchMaxMessages
+		}
+		if b.MaxDelayMs == 0 {
+			b.MaxDelayMs = DefaultBatchMaxDelayMs
+		}
+	}
+	if cfg.Log == nil {
+		cfg.Log = &LogConfig{}
+	}
+	if cfg.Log.UpdateLogging == "" {
+		// update_sampling alone kept sampling before update_logging existed
+		cfg.Log.UpdateLogging = UpdateLoggingAll
+		if cfg.Log.UpdateSampling != nil {
+			cfg.Log.UpdateLogging = UpdateLoggingSampled
+		}
+	}
+	if cfg.Log.UpdateLogging == UpdateLoggingSampled && cfg.Log.UpdateSampling == nil {
+		cfg.Log.UpdateSampling = &UpdateSamplingConfig{Every: DefaultUpdateLogEvery}
+	}
+	if cfg.EditSubjects == nil {
+		cfg.EditSubjects = &EditSubjectsConfig{}
+	}
+	if cfg.EditSubjects.Mode == "" {
+		cfg.EditSubjects.Mode = EditSubjectsDuplicate
+	}
+
+	if cfg.PollAggregation == nil {
+		cfg.PollAggregation = &PollAggregationConfig{}
+	}
+	if cfg.PollAggregation.Subject == "" {
+		cfg.PollAggregation.Subject = DefaultPollTalliesSubject
+	}
+	if cfg.PollAggregation.CacheSize == 0 {
+		cfg.PollAggregation.CacheSize = 1000
+	}
+	if cfg.PollAggregation.TTLSec == 0 {
+		cfg.PollAggregation.TTLSec = 604800
+	}
+
+	if cfg.Idempotency == nil {
+		cfg.Idempotency = &IdempotencyConfig{}
+	}
+	if cfg.Idempotency.CacheSize == 0 {
+		cfg.Idempotency.CacheSize = 10000
+	}
+	if cfg.Idempotency.TTLSec == 0 {
+		cfg.Idempotency.TTLSec = 86400
+	}
+
+	if cfg.BotMetaMode == "" {
+		cfg.BotMetaMode = BotMetaHeaders
+	}
+
+	if cfg.StartupProbeOnFailure == "" {
+		cfg.StartupProbeOnFailure = ProbeFailureExit
+	}
+
+	if cfg.RouteWorkers == 0 {
+		cfg.RouteWorkers = 5
+	}
+
+	if cfg.PublishWorkers == 0 {
+		cfg.PublishWorkers = 5
+	}
+
+	if cfg.PublishShutdownTimeout == 0 {
+		cfg.PublishShutdownTimeout = 10
+	}
+
+	if cfg.PublishTimeout == 0 {
+		cfg.PublishTimeout = int(DefaultPublishTimeout / time.Second)
+	}
+
+	if cfg.PublishQueueSize == 0 {
+		cfg.PublishQueueSize = cfg.PublishWorkers * defaultWorkerQueueSize
+	}
+
+	if cfg.PublishMaxAttempts == 0 {
+		cfg.PublishMaxAttempts = DefaultPublishMaxAttempts
+	}
+
+	if cfg.PublishRetryBackoffMs == 0 {
+		cfg.PublishRetryBackoffMs = DefaultPublishRetryBackoffMs
+	}
+
+	if cfg.PayloadSchemaVersion == 0 {
+		cfg.PayloadSchemaVersion = LatestPayloadSchema
+	}
+
+	if cfg.Sharding != nil && cfg.Sharding.Key == "" {
+		cfg.Sharding.Key = ShardKeyChatID
+	}
+
+	if l := cfg.ChatLimit; l != nil {
+		if l.Burst == 0 {
+			l.Burst = l.PerSec
+		}
+		if l.Overflow == "" {
+			l.Overflow = ChatLimitDrop
+		}
+		if l.SampleEvery == 0 {
+			l.SampleEvery = DefaultChatLimitSampleEvery
+		}
+		if l.MaxChats == 0 {
+			l.MaxChats = DefaultChatLimitMaxChats
+		}
+	}
+
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 30
+	}
+
+	if cfg.TranscriptionTimeoutMs == 0 {
+		cfg.TranscriptionTimeoutMs = DefaultTranscriptionTimeoutMs
+	}
+
+	if cfg.HTTPServer == nil {
+		cfg.HTTPServer = &HTTPServerConfig{}
+	}
+	if cfg.HTTPServer.Listen == "" {
+		cfg.HTTPServer.Listen = DefaultHTTPListen
+	}
+
+	if cfg.HA == nil {
+		cfg.HA = &HAConfig{}
+	}
+	if cfg.HA.Bucket == "" {
+		cfg.HA.Bucket = DefaultLeaderBucket
+	}
+	if cfg.HA.LeaseSec == 0 {
+		cfg.HA.LeaseSec = DefaultLeaseSec
+	}
+
+	logger.Info("configuration loaded",
+		"mode", cfg.Mode,
+		"broker", cfg.Broker,
+		"routes_count", len(cfg.Routes),
+		"has_telegram_token", cfg.TelegramToken != "",
+		"route_workers", cfg.RouteWorkers,
+		"publish_workers", cfg.PublishWorkers,
+		"publish_shutdown_timeout", cfg.PublishShutdownTimeout,
+		"publish_timeout", cfg.PublishTimeout,
+		"publish_queue_size", cfg.PublishQueueSize,
+		"publish_max_attempts", cfg.PublishMaxAttempts,
+		"payload_schema_version", cfg.PayloadSchemaVersion,
+		"shutdown_timeout", cfg.ShutdownTimeout)
+
+	return cfg, nil
+}
+
+// Validate validates the configuration
+func (c *Config) Validate() error {
+	if c.Mode != "first" && c.Mode != "all" {
+		return fmt.Errorf("mode must be 'first' or 'all'")
+	}
+
+	if c.Broker != BrokerNATS && c.Broker != BrokerKafka {
+		return fmt.Errorf("broker must be 'nats' or 'kafka'")
+	}
+
+	if c.Broker == BrokerNATS {
+		if c.NATS == nil {
+			return fmt.Errorf("nats configuration is required when broker is 'nats'")
+		}
+		if c.NATS.URL == "" {
+			return fmt.Errorf("nats.url is required (set NATS_URL env or nats.url in config)")
+		}
+		if c.NATS.Engine != EngineCore && c.NATS.Engine != EngineJetStream {
+			return fmt.Errorf("nats.engine must be 'core' or 'jetstream'")
+		}
+		if c.NATS.PendingLimitBytes < 0 {
+			return fmt.Errorf("nats.pending_limit_bytes must be >= 0")
+		}
+		// The round trip probe is received on the connection that publishes it
+		if c.NATS.NoEcho && c.StartupProbe && c.StartupProbeRoundTrip {
+			return fmt.Errorf("nats.no_echo can't be combined with startup_probe_round_trip")
+		}
+		if r := c.NATS.ConnectRetry; r != nil {
+			if r.Attempts < 0 {
+				return fmt.Errorf("nats.connect_retry.attempts must be >= 0")
+			}
+			if r.IntervalSec <= 0 {
+				return fmt.Errorf("nats.connect_retry.interval_sec must be > 0")
+			}
+			if r.MaxIntervalSec < r.IntervalSec {
+				return fmt.Errorf("nats.connect_retry.max_interval_sec must be >= interval_sec")
+			}
+		}
+		if r := c.NATS.Reconnect; r != nil {
+			if r.MaxReconnects != nil && *r.MaxReconnects < -1 {
+				return fmt.Errorf("nats.reconnect.max_reconnects must be >= -1")
+			}
+			if r.WaitSec <= 0 {
+				return fmt.Errorf("nats.reconnect.wait_sec must be > 0")
+			}
+			if r.MaxWaitSec < r.WaitSec {
+				return fmt.Errorf("nats.reconnect.max_wait_sec must be >= wait_sec")
+			}
+			if r.JitterMs < 0 {
+				return fmt.Errorf("nats.reconnect.jitter_ms must be >= 0")
+			}
+		}
+		if o := c.NATS.OffsetStore; o != nil && o.Enabled && !kvBucketName.MatchString(o.Bucket) {
+			return fmt.Errorf("nats.offset_store.bucket must contain only letters, digits, '-' and '_'")
+		}
+		if c.NATS.Engine == EngineJetStream {
+			if c.NATS.JetStream == nil {
+				return fmt.Errorf("nats.jetstream configuration is required when engine is 'jetstream'")
+			}
+			switch js := c.NATS.JetStream; {
+			case js.StreamConfig != "" && js.Stream != nil:
+				return fmt.Errorf("nats.jetstream.stream_config and nats.jetstream.stream can't be combined")
+			case js.Stream != nil:
+				if err := js.Stream.validate(); err != nil {
+					return err
+				}
+			case js.StreamConfig == "":
+				return fmt.Errorf("nats.jetstream.stream_config or nats.jetstream.stream is required when engine is 'jetstream'")
+			default:
+				if _, err := os.Stat(js.StreamConfig); os.IsNotExist(err) {
+					return fmt.Errorf("nats.jetstream.stream_config file does not exist: %s", js.StreamConfig)
+				}
+			}
+			if c.NATS.JetStream.ManageStream && c.NATS.JetStream.Stream == nil {
+				return fmt.Errorf("nats.jetstream.manage_stream requires nats.jetstream.stream")
+			}
+			if c.NATS.JetStream.MsgID != "" {
+				if _, err := compileMsgID(c.NATS.JetStream.MsgID); err != nil {
+					return err
+				}
+			}
+			for name, path := range c.NATS.JetStream.Streams {
+				streamCfg, err := loadStreamConfig(path)
+				if err != nil {
+					return fmt.Errorf("nats.jetstream.streams.%s: %w", name, err)
+				}
+				if streamCfg.Name != name {
+					return fmt.Errorf("nats.jetstream.streams.%s: stream config name '%s' does not match", name, streamCfg.Name)
+				}
+			}
+		}
+	}
+
+	if c.Broker == BrokerKafka {
+		if c.Kafka == nil {
+			return fmt.Errorf("kafka configuration is required when broker is 'kafka'")
+		}
+		if len(c.Kafka.Brokers) == 0 {
+			return fmt.Errorf("kafka.brokers is required when broker is 'kafka'")
+		}
+	}
+
+	if c.UnmatchedSubject != "" && c.Broker != BrokerNATS {
+		return fmt.Errorf("unmatched_subject is supported only when broker is 'nats'")
+	}
+
+	if c.DefaultSubject != "" && c.Broker != BrokerNATS {
+		return fmt.Errorf("default_subject is supported only when broker is 'nats'")
+	}
+
+	if c.OutboundErrorsSubject != "" && c.Broker != BrokerNATS {
+		return fmt.Errorf("outbound_errors_subject is supported only when broker is 'nats'")
+	}
+
+	if c.TranscriptionRequestSubject != "" {
+		if c.Broker != BrokerNATS {
+			return fmt.Errorf("transcription_request_subject is supported only when broker is 'nats'")
+		}
+		if c.TranscriptionTimeoutMs <= 0 {
+			return fmt.Errorf("transcription_timeout_ms must be > 0")
+		}
+	}
+
+	if c.HTTPServer != nil && c.HTTPServer.Enabled {
+		if c.HTTPServer.Listen == "" {
+			return fmt.Errorf("http_server.listen is required")
+		}
+		if !c.HTTPServer.StatsEnabled() && !c.HTTPServer.HealthEnabled() {
+			return fmt.Errorf("http_server has no endpoints enabled")
+		}
+	}
+
+	if c.HA != nil && c.HA.Enabled {
+		if c.Broker != BrokerNATS {
+			return fmt.Errorf("ha is supported only when broker is 'nats'")
+		}
+		if c.NATS.OffsetStore == nil || !c.NATS.OffsetStore.Enabled {
+			return fmt.Errorf("ha requires nats.offset_store.enabled, so a new leader continues from the stored offset")
+		}
+		if !kvBucketName.MatchString(c.HA.Bucket) {
+			return fmt.Errorf("ha.bucket must contain only letters, digits, '-' and '_'")
+		}
+		if c.HA.Bucket == c.NATS.OffsetStore.Bucket {
+			return fmt.Errorf("ha.bucket must differ from nats.offset_store.bucket, lease keys expire")
+		}
+		if c.HA.LeaseSec < 3 {
+			return fmt.Errorf("ha.lease_sec must be >= 3")
+		}
+	}
+
+	if c.Scrub != nil {
+		if _, err := NewScrubber(c.Scrub); err != nil {
+			return err
+		}
+		if len(c.Scrub.Remove) == 0 && len(c.Scrub.Redact) == 0 && !c.Scrub.HashUserIDs {
+			return fmt.Errorf("scrub requires remove, redact or hash_user_ids")
+		}
+	}
+
+	if _, err := newPayloadEncoder(c.PayloadSchemaVersion, nil); err != nil {
+		return err
+	}
+
+	if s := c.Sharding; s != nil {
+		if s.Key != ShardKeyChatID && s.Key != ShardKeyUserID {
+			return fmt.Errorf("sharding.key must be 'chat_id' or 'user_id'")
+		}
+		if s.Shards <= 0 {
+			return fmt.Errorf("sharding.shards must be > 0")
+		}
+		if s.Suffix && c.Broker != BrokerNATS {
+			return fmt.Errorf("sharding.suffix is supported only when broker is 'nats'")
+		}
+	}
+
+	if c.Publish != nil && c.Publish.Batch != nil {
+		if c.Broker != BrokerNATS {
+			return fmt.Errorf("publish.batch is supported only when broker is 'nats'")
+		}
+		if c.Publish.Batch.MaxMessages <= 0 {
+			return fmt.Errorf("publish.batch.max_messages must be > 0")
+		}
+		if c.Publish.Batch.MaxDelayMs <= 0 {
+			return fmt.Errorf("publish.batch.max_delay_ms must be > 0")
+		}
+	}
+
+	if l := c.ChatLimit; l != nil {
+		if l.PerSec <= 0 {
+			return fmt.Errorf("chat_limit.per_sec must be > 0")
+		}
+		if l.Burst < l.PerSec {
+			return fmt.Errorf("chat_limit.burst must be >= chat_limit.per_sec")
+		}
+		switch l.Overflow {
+		case ChatLimitDrop:
+		case ChatLimitSample:
+			if l.SampleEvery < 2 {
+				return fmt.Errorf("chat_limit.sample_every must be > 1")
+			}
+		default:
+			return fmt.Errorf("chat_limit.overflow must be 'drop' or 'sample'")
+		}
+		if l.MaxChats <= 0 {
+			return fmt.Errorf("chat_limit.max_chats must be > 0")
+		}
+	}
+
+	if c.ControlSubject != "" && c.Broker != BrokerNATS {
+		return fmt.Errorf("control_subject is supported only when broker is 'nats'")
+	}
+
+	if c.Broker == BrokerNATS {
+		for key, subject := range map[string]string{
+			"unmatched_subject":             c.UnmatchedSubject,
+			"default_subject":               c.DefaultSubject,
+			"chat_migrations_subject":       c.ChatMigrationsSubject,
+			"dead_letter_subject":           c.DeadLetterSubject,
+			"outbound_errors_subject":       c.OutboundErrorsSubject,
+			"control_subject":               c.ControlSubject,
+			"transcription_request_subject": c.TranscriptionRequestSubject,
+		} {
+			if hasWildcard(subject) {
+				return fmt.Errorf("%s must not contain wildcards '*' or '>'", key)
+			}
+		}
+	}
+
+	if c.Payments != nil {
+		if c.Payments.AutoApprove && c.Payments.RequestSubject != "" {
+			return fmt.Errorf("payments.auto_approve and payments.request_subject are mutually exclusive")
+		}
+		if c.Payments.RequestSubject != "" && c.Broker != BrokerNATS {
+			return fmt.Errorf("payments.request_subject is supported only when broker is 'nats'")
+		}
+		if c.Payments.TimeoutMs <= 0 || c.Payments.TimeoutMs >= 10000 {
+			return fmt.Errorf("payments.timeout_ms must be > 0 and < 10000")
+		}
+	}
+
+	if c.Telegram != nil && c.Telegram.PollTimeoutBufferSec < 0 {
+		return fmt.Errorf("telegram.poll_timeout_buffer_sec must be >= 0")
+	}
+
+	if c.Telegram != nil && c.Telegram.IdleSleepMs != nil && *c.Telegram.IdleSleepMs < 0 {
+		return fmt.Errorf("telegram.idle_sleep_ms must be >= 0")
+	}
+
+	if c.Telegram != nil && c.Telegram.LocalMode && !filepath.IsAbs(c.Telegram.LocalDir) {
+		return fmt.Errorf("telegram.local_dir must be an absolute path with telegram.local_mode")
+	}
+
+	if c.Telegram != nil && c.Telegram.RequestTimeoutSec < 0 {
+		return fmt.Errorf("telegram.request_timeout_sec must be >= 0")
+	}
+
+	if c.Telegram != nil && c.Telegram.MaxConflicts != nil && *c.Telegram.MaxConflicts < 0 {
+		return fmt.Errorf("telegram.max_conflicts must be >= 0")
+	}
+
+	if c.Telegram != nil && c.Telegram.ProxyURL != "" {
+		proxy, err := url.Parse(c.Telegram.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("telegram.proxy_url is invalid: %w", err)
+		}
+		if !slices.Contains([]string{"http", "https", "socks5"}, proxy.Scheme) || proxy.Host == "" {
+			return fmt.Errorf("telegram.proxy_url must be an http, https or socks5 URL with a host")
+		}
+	}
+
+	if c.Telegram != nil {
+		for _, updateType := range c.Telegram.AllowedUpdates {
+			if !slices.Contains(updateTypes, updateType) {
+				return fmt.Errorf("telegram.allowed_updates contains unknown update type '%s'", updateType)
+			}
+		}
+	}
+
+	if c.Telegram != nil && c.Telegram.RateLimit != nil {
+		rl := c.Telegram.RateLimit
+		if rl.PerChatPerSec <= 0 || rl.PerGroupPerMin <= 0 || rl.GlobalPerSec <= 0 {
+			return fmt.Errorf("telegram.rate_limit values must be > 0")
+		}
+	}
+
+	if c.Telegram != nil && c.Telegram.AdaptiveLimit != nil && c.Telegram.AdaptiveLimit.Enabled {
+		al := c.Telegram.AdaptiveLimit
+		if al.Min < 1 || al.Min > MaxUpdatesLimit {
+			return fmt.Errorf("telegram.adaptive_limit.min must be between 1 and %d", MaxUpdatesLimit)
+		}
+		if al.MaxBatchBytes <= 0 || al.MaxBatchMs <= 0 || al.RampUpAfter <= 0 {
+			return fmt.Errorf("telegram.adaptive_limit values must be > 0")
+		}
+	}
+
+	if c.Watchdog != nil {
+		if c.Watchdog.Multiplier < 2 {
+			return fmt.Errorf("watchdog.multiplier must be >= 2")
+		}
+		if c.Watchdog.IntervalSec <= 0 {
+			return fmt.Errorf("watchdog.interval_sec must be > 0")
+		}
+		if c.Watchdog.Action != WatchdogActionWarn && c.Watchdog.Action != WatchdogActionExit {
+			return fmt.Errorf("watchdog.action must be 'warn' or 'exit'")
+		}
+	}
+
+	if c.Enrichment != nil {
+		if c.Enrichment.CacheSize <= 0 {
+			return fmt.Errorf("enrichment.cache_size must be > 0")
+		}
+		if c.Enrichment.TTLSec <= 0 {
+			return fmt.Errorf("enrichment.ttl_sec must be > 0")
+		}
+		if c.Enrichment.LookupTimeoutMs <= 0 {
+			return fmt.Errorf("enrichment.lookup_timeout_ms must be > 0")
+		}
+	}
+
+	if c.EditTracking != nil && c.EditTracking.Enabled {
+		if c.EditTracking.CacheSize <= 0 {
+			return fmt.Errorf("edit_tracking.cache_size must be > 0")
+		}
+		if c.EditTracking.TTLSec <= 0 {
+			return fmt.Errorf("edit_tracking.ttl_sec must be > 0")
+		}
+	}
+
+	if c.EditSubjects != nil && c.EditSubjects.Enabled {
+		if c.Broker != BrokerNATS {
+			return fmt.Errorf("edit_subjects is supported only when broker is 'nats'")
+		}
+		if c.EditSubjects.Mode != EditSubjectsDuplicate && c.EditSubjects.Mode != EditSubjectsRedirect {
+			return fmt.Errorf("edit_subjects.mode must be 'duplicate' or 'redirect'")
+		}
+	}
+
+	if c.Log != nil {
+		switch c.Log.UpdateLogging {
+		case "", UpdateLoggingOff, UpdateLoggingSampled, UpdateLoggingAll:
+		default:
+			return fmt.Errorf("log.update_logging must be 'off', 'sampled' or 'all'")
+		}
+		if c.Log.UpdateSampling != nil && (c.Log.UpdateLogging == UpdateLoggingOff || c.Log.UpdateLogging == UpdateLoggingAll) {
+			return fmt.Errorf("log.update_sampling requires log.update_logging: sampled")
+		}
+	}
+
+	if c.Log != nil && c.Log.UpdateSampling != nil {
+		sampling := c.Log.UpdateSampling
+		if sampling.Every < 0 || sampling.PerSec < 0 {
+			return fmt.Errorf("log.update_sampling.every and log.update_sampling.per_sec must be >= 0")
+		}
+		if sampling.Every > 0 && sampling.PerSec > 0 {
+			return fmt.Errorf("log.update_sampling.every and log.update_sampling.per_sec can't be combined")
+		}
+	}
+
+	if c.PollAggregation != nil && c.PollAggregation.Enabled {
+		if c.PollAggregation.Subject == "" {
+			return fmt.Errorf("poll_aggregation.subject is required")
+		}
+		if c.Broker == BrokerNATS && hasWildcard(c.PollAggregation.Subject) {
+			return fmt.Errorf("poll_aggregation.subject must not contain wildcards '*' or '>'")
+		}
+		if c.PollAggregation.CacheSize <= 0 {
+			return fmt.Errorf("poll_aggregation.cache_size must be > 0")
+		}
+		if c.PollAggregation.TTLSec <= 0 {
+			return fmt.Errorf("poll_aggregation.ttl_sec must be > 0")
+		}
+	}
+
+	if c.Idempotency != nil && c.Idempotency.Enabled {
+		if c.Idempotency.CacheSize <= 0 {
+			return fmt.Errorf("idempotency.cache_size must be > 0")
+		}
+		if c.Idempotency.TTLSec <= 0 {
+			return fmt.Errorf("idempotency.ttl_sec must be > 0")
+		}
+	}
+
+	if c.IncludeBotMeta && c.BotMetaMode != BotMetaHeaders && c.BotMetaMode != BotMetaWrap {
+		return fmt.Errorf("bot_meta_mode must be 'headers' or 'wrap'")
+	}
+
+	if c.StartupProbe {
+		if c.Broker != BrokerNATS {
+			return fmt.Errorf("startup_probe is supported only when broker is 'nats'")
+		}
+		if c.StartupProbeOnFailure != ProbeFailureExit && c.StartupProbeOnFailure != ProbeFailureWarn {
+			return fmt.Errorf("startup_probe_on_failure must be 'exit' or 'warn'")
+		}
+	}
+
+	if c.RouteWorkers <= 0 {
+		return fmt.Errorf("route_workers must be > 0")
+	}
+
+	if c.PublishWorkers <= 0 {
+		return fmt.Errorf("publish_workers must be > 0")
+	}
+
+	if c.PublishShutdownTimeout <= 0 {
+		return fmt.Errorf("publish_shutdown_timeout must be > 0")
+	}
+
+	// Zero keeps the publisher defaults
+	if c.PublishTimeout < 0 {
+		return fmt.Errorf("publish_timeout must be >= 0")
+	}
+
+	if c.PublishQueueSize < 0 {
+		return fmt.Errorf("publish_queue_size must be >= 0")
+	}
+
+	if c.PublishMaxAttempts < 0 {
+		return fmt.Errorf("publish_max_attempts must be >= 0")
+	}
+
+	if c.PublishRetryBackoffMs < 0 {
+		return fmt.Errorf("publish_retry_backoff_ms must be >= 0")
+	}
+
+	if c.MaxInFlight < 0 {
+		return fmt.Errorf("max_in_flight must be >= 0")
+	}
+
+	if c.SlowUpdateThresholdMs < 0 {
+		return fmt.Errorf("slow_update_threshold_ms must be >= 0")
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown_timeout must be >= 0")
+	}
+	if c.ShutdownTimeout > 0 && c.ShutdownTimeout < c.PublishShutdownTimeout {
+		return fmt.Errorf("shutdown_timeout must be >= publish_shutdown_timeout")
+	}
+
+	// Before the checks of single routes, so overlapping wildcard subjects
+	// are reported as a collision
+	if c.StrictSubjects && c.Mode == "all" {
+		if collisions := subjectCollisions(c.Routes); len(collisions) > 0 {
+			return fmt.Errorf("strict_subjects: %s", collisions[0])
+		}
+	}
+
+	routeNames := make(map[string]bool)
+
+	for i, route := range c.Routes {
+		if route.Condition == "" {
+			return fmt.Errorf("routes[%d].condition is required", i)
+		}
+
+		if route.Name != "" {
+			if routeNames[route.Name] {
+				return fmt.Errorf("routes[%d].name '%s' is duplicated", i, route.Name)
+			}
+			routeNames[route.Name] = true
+		}
+
+		if route.Sample != nil && (*route.Sample < 0 || *route.Sample > 1) {
+			return fmt.Errorf("routes[%d].sample must be between 0.0 and 1.0", i)
+		}
+
+		if route.Stream != "" {
+			if c.Broker != BrokerNATS || c.NATS.Engine != EngineJetStream {
+				return fmt.Errorf("routes[%d].stream is supported only when nats.engine is 'jetstream'", i)
+			}
+			if _, ok := c.NATS.JetStream.Streams[route.Stream]; !ok {
+				return fmt.Errorf("routes[%d].stream '%s' is not declared in nats.jetstream.streams", i, route.Stream)
+			}
+		}
+
+		if route.ReplyMode != "" && route.ReplyMode != ReplyModePublish && route.ReplyMode != ReplyModeRequest {
+			return fmt.Errorf("routes[%d].reply_mode must be 'publish' or 'request'", i)
+		}
+
+		if route.ReplyMode == ReplyModeRequest {
+			if c.Broker != BrokerNATS {
+				return fmt.Errorf("routes[%d].reply_mode 'request' is supported only when broker is 'nats'", i)
+			}
+			if route.ReplyTimeoutMs <= 0 {
+				return fmt.Errorf("routes[%d].reply_timeout_ms must be > 0", i)
+			}
+		}
+
+		if route.ReplyAction != "" {
+			if route.ReplyMode != ReplyModeRequest {
+				return fmt.Errorf("routes[%d].reply_action requires reply_mode 'request'", i)
+			}
+			switch route.ReplyAction {
+			case ReplyActionAnswerInlineQuery, ReplyActionAnswerCallbackQuery, ReplyActionSendMessage:
+			default:
+				return fmt.Errorf("routes[%d].reply_action must be 'answerInlineQuery', 'answerCallbackQuery' or 'sendMessage'", i)
+			}
+		}
+
+		for _, kind := range route.Enrich {
+			if kind != EnrichChat && kind != EnrichChatMember {
+				return fmt.Errorf("routes[%d].enrich must contain only 'chat' or 'chat_member'", i)
+			}
+		}
+
+		if route.Respond != nil {
+			if (route.Respond.Text == "") == (route.Respond.TextExpr == "") {
+				return fmt.Errorf("routes[%d].respond requires exactly one of text or text_expr", i)
+			}
+			if route.Respond.Only && route.ReplyMode == ReplyModeRequest {
+				return fmt.Errorf("routes[%d].respond.only can't be combined with reply_mode 'request'", i)
+			}
+		}
+
+		// Routes that only respond publish nothing and need no subject or topic
+		if c.Broker == BrokerNATS && !route.RespondsOnly() {
+			if route.Subject == nil {
+				return fmt.Errorf("routes[%d].subject is required when broker is 'nats'", i)
+			}
+			if route.Subject.Type == "" {
+				return fmt.Errorf("routes[%d].subject.type is required", i)
+			}
+			if route.Subject.Value == "" {
+				return fmt.Errorf("routes[%d].subject.value is required", i)
+			}
+			if route.Subject.Type != SubjectTypeString && route.Subject.Type != SubjectTypeExpr {
+				return fmt.Errorf("routes[%d].subject.type must be 'string' or 'expr'", i)
+			}
+			// Expr subjects are known only at runtime, static ones fail fast
+			if route.Subject.Type == SubjectTypeString && hasWildcard(route.Subject.Value) {
+				return fmt.Errorf("routes[%d].subject must not contain wildcards '*' or '>'", i)
+			}
+		}
+
+		if shadow := route.ShadowSubject; shadow != nil {
+			switch {
+			case c.Broker != BrokerNATS:
+				return fmt.Errorf("routes[%d].shadow_subject is supported only when broker is 'nats'", i)
+			case route.ReplyMode == ReplyModeRequest:
+				return fmt.Errorf("routes[%d].shadow_subject can't be combined with reply_mode 'request'", i)
+			case route.RespondsOnly():
+				return fmt.Errorf("routes[%d].shadow_subject can't be combined with respond.only", i)
+			case shadow.Type != SubjectTypeString && shadow.Type != SubjectTypeExpr:
+				return fmt.Errorf("routes[%d].shadow_subject.type must be 'string' or 'expr'", i)
+			case shadow.Value == "":
+				return fmt.Errorf("routes[%d].shadow_subject.value is required", i)
+			case shadow.Type == SubjectTypeString && hasWildcard(shadow.Value):
+				return fmt.Errorf("routes[%d].shadow_subject must not contain wildcards '*' or '>'", i)
+			}
+		}
+
+		switch route.Payload {
+		case "", PayloadFull:
+		case PayloadFlatten:
+			switch {
+			case route.ReplyMode == ReplyModeRequest:
+				return fmt.Errorf("routes[%d].payload 'flatten' can't be combined with reply_mode 'request'", i)
+			case route.RequestTranscription:
+				return fmt.Errorf("routes[%d].payload 'flatten' can't be combined with request_transcription", i)
+			}
+		default:
+			return fmt.Errorf("routes[%d].payload must be 'full' or 'flatten'", i)
+		}
+
+		if route.Scrub != nil && *route.Scrub {
+			switch {
+			case c.Scrub == nil:
+				return fmt.Errorf("routes[%d].scrub requires the scrub section", i)
+			case route.ReplyMode == ReplyModeRequest:
+				return fmt.Errorf("routes[%d].scrub can't be combined with reply_mode 'request'", i)
+			}
+		}
+
+		if route.RequestTranscription {
+			switch {
+			case c.TranscriptionRequestSubject == "":
+				return fmt.Errorf("routes[%d].request_transcription requires transcription_request_subject", i)
+			case route.RespondsOnly():
+				return fmt.Errorf("routes[%d].request_transcription can't be combined with respond.only", i)
+			}
+		}
+
+		if c.Broker == BrokerKafka && !route.RespondsOnly() {
+			if route.Topic == nil {
+				return fmt.Errorf("routes[%d].topic is required when broker is 'kafka'", i)
+			}
+			if route.Topic.Type == "" {
+				return fmt.Errorf("routes[%d].topic.type is required", i)
+			}
+			if route.Topic.Value == "" {
+				return fmt.Errorf("routes[%d].topic.value is required", i)
+			}
+			if route.Topic.Type != SubjectTypeString && route.Topic.Type != SubjectTypeExpr {
+				return fmt.Errorf("routes[%d].topic.type must be 'string' or 'expr'", i)
+			}
+			if route.Key != nil {
+				if route.Key.Type != SubjectTypeString && route.Key.Type != SubjectTypeExpr {
+					return fmt.Errorf("routes[%d].key.type must be 'string' or 'expr'", i)
+				}
+			}
+		}
+	}
+
+	for _, name := range c.ExprEnv {
+		if !exprEnvName.MatchString(name) {
+			return fmt.Errorf("expr_env: '%s' is not a valid environment variable name", name)
+		}
+	}
+	if err := checkExprEnvRefs(c.Routes, c.ExprEnv); err != nil {
+		return err
+	}
+
+	if c.TelegramToken == "" {
+		return fmt.Errorf("telegram token is required (set TELEGRAM_BOT_TOKEN env or telegram_token in config)")
+	}
+
+	return nil
+}
+
+// ValidateConfigPath validates that the config file exists
+func ValidateConfigPath(configPath string) error {
+	if configPath == "" {
+		return fmt.Errorf("config path is required")
+	}
+
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return fmt.Errorf("config file does not exist: %s", configPath)
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("config path is a directory: %s", configPath)
+	}
+
+	// Check file extension
+	ext := filepath.Ext(configPath)
+	if ext != ".yaml" && ext != ".yml" {
+		return fmt.Errorf("config file must be a YAML file (.yaml or .yml), got: %s", ext)
+	}
+
+	return nil
+}
@@ -0,0 +1,2887 @@
+package bridge
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_WithFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `
+broker: nats
+mode: first
+nats:
+  url: nats://test:4222
+  engine: core
+routes:
+  - condition: "update.message != nil"
+    subject:
+      type: string
+      value: telegram.messages
+telegram_token: test-token
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	assert.Equal(t, "first", cfg.Mode)
+	assert.Equal(t, BrokerNATS, cfg.Broker)
+	assert.Equal(t, 1, len(cfg.Routes))
+	assert.Equal(t, "test-token", cfg.TelegramToken)
+	assert.Equal(t, "nats://test:4222", cfg.NATS.URL)
+	assert.Equal(t, DefaultChatMigrationsSubject, cfg.ChatMigrationsSubject)
+	assert.Equal(t, &WatchdogConfig{Multiplier: 4, IntervalSec: 10, Action: WatchdogActionWarn}, cfg.Watchdog)
+	assert.Equal(t, 5, cfg.PublishTimeout)
+	assert.Equal(t, 10, cfg.PublishQueueSize, "two per publish worker")
+	assert.Equal(t, DefaultPublishMaxAttempts, cfg.PublishMaxAttempts)
+	assert.Equal(t, DefaultPublishRetryBackoffMs, cfg.PublishRetryBackoffMs)
+	assert.Equal(t, DefaultNATSConnectionName, cfg.NATS.ConnectionName)
+	assert.False(t, cfg.NATS.NoEcho)
+}
+
+func TestLoadConfigStruct(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "env-token")
+
+	cfg, err := LoadConfigStruct(&Config{
+		TelegramToken: "test-token",
+		NATS:          &NATSConfig{URL: "nats://test:4222"},
+		Routes: []Route{{
+			ConditionPreset: "is_text_message",
+			Subject:         &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"},
+		}},
+	}, logger)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, "first", cfg.Mode)
+	assert.Equal(t, BrokerNATS, cfg.Broker)
+	assert.Equal(t, EngineCore, cfg.NATS.Engine)
+	assert.Equal(t, "test-token", cfg.TelegramToken, "environment is not read")
+	assert.Equal(t, 5, cfg.PublishTimeout)
+	assert.Equal(t, conditionPresets["is_text_message"], cfg.Routes[0].Condition)
+
+	_, err = LoadConfigStruct(&Config{Routes: []Route{{ConditionPreset: "unknown"}}}, logger)
+	assert.ErrorContains(t, err, "condition_preset 'unknown' is unknown")
+}
+
+func TestLoadConfig_FromEnvOnly(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "env-token")
+	t.Setenv("NATS_URL", "nats://env:4222")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `
+broker: nats
+mode: all
+nats:
+  url: nats://env:4222
+  engine: core
+routes:
+  - condition: "update.message != nil"
+    subject:
+      type: string
+      value: telegram.messages
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "env-token")
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	assert.Equal(t, "all", cfg.Mode)
+	assert.Equal(t, 1, len(cfg.Routes))
+	assert.Equal(t, "env-token", cfg.TelegramToken)
+	assert.Equal(t, "nats://env:4222", cfg.NATS.URL)
+}
+
+func TestLoadConfig_DisabledRoutesEnv(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+	t.Setenv("TNB_DISABLED_ROUTES", "noisy, unknown")
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `
+nats:
+  url: nats://test:4222
+routes:
+  - name: messages
+    condition: "update.Message != nil"
+    subject:
+      type: string
+      value: telegram.messages
+  - name: noisy
+    condition: "update.Message != nil"
+    subject:
+      type: string
+      value: telegram.noisy
+  - name: callbacks
+    enabled: false
+    condition: "update.CallbackQuery != nil"
+    subject:
+      type: string
+      value: telegram.callbacks
+telegram_token: test-token
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	require.Len(t, cfg.Routes, 3)
+	assert.True(t, cfg.Routes[0].IsEnabled())
+	assert.False(t, cfg.Routes[1].IsEnabled())
+	assert.False(t, cfg.Routes[2].IsEnabled())
+}
+
+func TestLoadConfig_IdleSleep(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	tests := []struct {
+		name     string
+		telegram string
+		want     time.Duration
+	}{
+		{name: "default", telegram: "", want: time.Second},
+		{name: "explicit zero", telegram: "telegram:\n  idle_sleep_ms: 0\n", want: 0},
+		{name: "custom", telegram: "telegram:\n  idle_sleep_ms: 250\n", want: 250 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := "nats:\n  url: nats://test:4222\ntelegram_token: test-token\n" + tt.telegram
+			require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+			cfg, err := LoadConfig(configPath, logger)
+			require.NoError(t, err)
+			require.NotNil(t, cfg.Telegram.IdleSleepMs)
+			assert.Equal(t, tt.want, cfg.Telegram.IdleSleep())
+		})
+	}
+}
+
+func TestLoadConfig_UpdateLogging(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	tests := []struct {
+		name         string
+		log          string
+		wantLogging  UpdateLoggingMode
+		wantSampling *UpdateSamplingConfig
+	}{
+		{name: "default", wantLogging: UpdateLoggingAll},
+		{name: "sampled", log: "log:\n  update_logging: sampled\n", wantLogging: UpdateLoggingSampled, wantSampling: &UpdateSamplingConfig{Every: DefaultUpdateLogEvery}},
+		{name: "sampling only", log: "log:\n  update_sampling:\n    every: 10\n", wantLogging: UpdateLoggingSampled, wantSampling: &UpdateSamplingConfig{Every: 10}},
+		{name: "off", log: "log:\n  update_logging: off\n", wantLogging: UpdateLoggingOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := "nats:\n  url: nats://test:4222\ntelegram_token: test-token\n" + tt.log
+			require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+			cfg, err := LoadConfig(configPath, logger)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantLogging, cfg.Log.UpdateLogging)
+			assert.Equal(t, tt.wantSampling, cfg.Log.UpdateSampling)
+		})
+	}
+}
+
+func TestLoadConfig_ScrubSaltEnv(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("TNB_SCRUB_SALT", "from-env")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := "nats:\n  url: nats://test:4222\ntelegram_token: test-token\nscrub:\n  hash_user_ids: true\n  salt: from-file\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", cfg.Scrub.Salt)
+}
+
+func TestLoadConfig_Reconnect(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	tests := []struct {
+		name          string
+		reconnect     string
+		maxReconnects int
+		want          ReconnectConfig
+	}{
+		{
+			name:          "default",
+			maxReconnects: DefaultMaxReconnects,
+			want:          ReconnectConfig{WaitSec: 2, MaxWaitSec: 2, JitterMs: 100},
+		},
+		{
+			name:          "unlimited with backoff",
+			reconnect:     "  reconnect:\n    max_reconnects: -1\n    wait_sec: 1\n    max_wait_sec: 30\n",
+			maxReconnects: -1,
+			want:          ReconnectConfig{WaitSec: 1, MaxWaitSec: 30, JitterMs: 100},
+		},
+		{
+			name:          "explicit zero reconnects",
+			reconnect:     "  reconnect:\n    max_reconnects: 0\n    jitter_ms: 500\n",
+			maxReconnects: 0,
+			want:          ReconnectConfig{WaitSec: 2, MaxWaitSec: 2, JitterMs: 500},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := "nats:\n  url: nats://test:4222\n" + tt.reconnect + "telegram_token: test-token\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+			cfg, err := LoadConfig(configPath, logger)
+			require.NoError(t, err)
+			require.NotNil(t, cfg.NATS.Reconnect)
+			require.NotNil(t, cfg.NATS.Reconnect.MaxReconnects)
+			assert.Equal(t, tt.maxReconnects, *cfg.NATS.Reconnect.MaxReconnects)
+
+			got := *cfg.NATS.Reconnect
+			got.MaxReconnects = nil
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadConfig_StreamDefaults(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := `nats:
+  url: nats://test:4222
+  engine: jetstream
+  jetstream:
+    manage_stream: true
+    stream:
+      name: TELEGRAM
+      subjects: ["telegram.>"]
+      max_age_sec: 3600
+telegram_token: test-token
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	assert.True(t, cfg.NATS.JetStream.ManageStream)
+	assert.Equal(t, &StreamSpec{
+		Name:      "TELEGRAM",
+		Subjects:  []string{"telegram.>"},
+		Retention: "limits",
+		MaxAgeSec: 3600,
+		Storage:   "file",
+		Replicas:  1,
+	}, cfg.NATS.JetStream.Stream)
+}
+
+func TestLoadConfig_ConditionPreset(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := `
+nats:
+  url: nats://test:4222
+telegram_token: test-token
+routes:
+  - condition_preset: is_command
+    subject:
+      type: string
+      value: telegram.commands
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	require.Len(t, cfg.Routes, 1)
+	assert.Equal(t, conditionPresets["is_command"], cfg.Routes[0].Condition)
+	require.NoError(t, cfg.Validate())
+}
+
+func TestLoadConfig_FileNotFound(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	_, err := LoadConfig("/nonexistent/config.yaml", logger)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read config file")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	negative := -1
+	belowUnlimited := -2
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name: "valid nats config",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid kafka config",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+						Topic: &RouteTopic{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "empty routes is valid",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid mode",
+			config: Config{
+				Mode:   "invalid",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "mode must be 'first' or 'all'",
+		},
+		{
+			name: "valid config with broker nats",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing telegram token",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+					},
+				},
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram token is required",
+		},
+		{
+			name: "missing nats config when broker is nats",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "nats configuration is required",
+		},
+		{
+			name: "missing kafka config when broker is kafka",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+						Topic: &RouteTopic{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "kafka configuration is required",
+		},
+		{
+			name: "invalid route_workers",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           0,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "route_workers must be > 0",
+		},
+		{
+			name: "invalid publish_workers",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         -1,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "publish_workers must be > 0",
+		},
+		{
+			name: "invalid publish_shutdown_timeout",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 0,
+			},
+			wantErr: true,
+			errMsg:  "publish_shutdown_timeout must be > 0",
+		},
+		{
+			name: "invalid publish_timeout",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				PublishTimeout:         -1,
+			},
+			wantErr: true,
+			errMsg:  "publish_timeout must be >= 0",
+		},
+		{
+			name: "invalid publish_queue_size",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				PublishQueueSize:       -1,
+			},
+			wantErr: true,
+			errMsg:  "publish_queue_size must be >= 0",
+		},
+		{
+			name: "invalid publish_max_attempts",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				PublishMaxAttempts:     -1,
+			},
+			wantErr: true,
+			errMsg:  "publish_max_attempts must be >= 0",
+		},
+		{
+			name: "negative max_in_flight",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				MaxInFlight:            -1,
+			},
+			wantErr: true,
+			errMsg:  "max_in_flight must be >= 0",
+		},
+		{
+			name: "negative slow_update_threshold_ms",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				SlowUpdateThresholdMs:  -1,
+			},
+			wantErr: true,
+			errMsg:  "slow_update_threshold_ms must be >= 0",
+		},
+		{
+			name: "nats route missing subject",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "subject is required when broker is 'nats'",
+		},
+		{
+			name: "duplicate route names",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Name:      "messages",
+						Condition: "update.message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+					},
+					{
+						Name:      "messages",
+						Condition: "update.message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.texts",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[1].name 'messages' is duplicated",
+		},
+		{
+			name: "unmatched subject with kafka broker",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				UnmatchedSubject:       "telegram.unmatched",
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "unmatched_subject is supported only when broker is 'nats'",
+		},
+		{
+			name: "default subject with kafka broker",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				DefaultSubject:         "telegram.updates",
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "default_subject is supported only when broker is 'nats'",
+		},
+		{
+			name: "default subject with wildcard",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				DefaultSubject:         "telegram.>",
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "default_subject must not contain wildcards '*' or '>'",
+		},
+		{
+			name: "default subject without routes",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				DefaultSubject:         "telegram.updates",
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "ha with kafka broker",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes:                 []Route{},
+				HA:                     &HAConfig{Enabled: true, Bucket: DefaultLeaderBucket, LeaseSec: 10},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "ha is supported only when broker is 'nats'",
+		},
+		{
+			name: "ha without offset store",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				HA:                     &HAConfig{Enabled: true, Bucket: DefaultLeaderBucket, LeaseSec: 10},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "ha requires nats.offset_store.enabled, so a new leader continues from the stored offset",
+		},
+		{
+			name: "ha bucket shared with offsets",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:         "nats://localhost:4222",
+					Engine:      EngineCore,
+					OffsetStore: &OffsetStoreConfig{Enabled: true, Bucket: "offsets"},
+				},
+				Routes:                 []Route{},
+				HA:                     &HAConfig{Enabled: true, Bucket: "offsets", LeaseSec: 10},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "ha.bucket must differ from nats.offset_store.bucket, lease keys expire",
+		},
+		{
+			name: "ha invalid bucket",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:         "nats://localhost:4222",
+					Engine:      EngineCore,
+					OffsetStore: &OffsetStoreConfig{Enabled: true, Bucket: "offsets"},
+				},
+				Routes:                 []Route{},
+				HA:                     &HAConfig{Enabled: true, Bucket: "leader.lock", LeaseSec: 10},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "ha.bucket must contain only letters, digits, '-' and '_'",
+		},
+		{
+			name: "ha short lease",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:         "nats://localhost:4222",
+					Engine:      EngineCore,
+					OffsetStore: &OffsetStoreConfig{Enabled: true, Bucket: "offsets"},
+				},
+				Routes:                 []Route{},
+				HA:                     &HAConfig{Enabled: true, Bucket: DefaultLeaderBucket, LeaseSec: 1},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "ha.lease_sec must be >= 3",
+		},
+		{
+			name: "ha enabled",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:         "nats://localhost:4222",
+					Engine:      EngineCore,
+					OffsetStore: &OffsetStoreConfig{Enabled: true, Bucket: "offsets"},
+				},
+				Routes:                 []Route{},
+				HA:                     &HAConfig{Enabled: true, Bucket: DefaultLeaderBucket, LeaseSec: 10},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "route sample out of range",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+						Sample: func() *float64 { v := 1.5; return &v }(),
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].sample must be between 0.0 and 1.0",
+		},
+		{
+			name: "request reply mode with kafka broker",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes: []Route{
+					{
+						Condition: "update.InlineQuery != nil",
+						Topic: &RouteTopic{
+							Type:  SubjectTypeString,
+							Value: "telegram.inline",
+						},
+						ReplyMode:      ReplyModeRequest,
+						ReplyTimeoutMs: 3000,
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].reply_mode 'request' is supported only when broker is 'nats'",
+		},
+		{
+			name: "reply action without request mode",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.Message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+						ReplyMode:   ReplyModePublish,
+						ReplyAction: ReplyActionSendMessage,
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].reply_action requires reply_mode 'request'",
+		},
+		{
+			name: "invalid watchdog action",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				Watchdog:               &WatchdogConfig{Multiplier: 4, IntervalSec: 10, Action: "restart"},
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "watchdog.action must be 'warn' or 'exit'",
+		},
+		{
+			name: "negative telegram request timeout",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				Telegram:               &TelegramConfig{RequestTimeoutSec: -1},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram.request_timeout_sec must be >= 0",
+		},
+		{
+			name: "telegram local mode without local dir",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				Telegram:               &TelegramConfig{LocalMode: true, LocalDir: "telegram-bot-api"},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram.local_dir must be an absolute path with telegram.local_mode",
+		},
+		{
+			name: "telegram proxy with unsupported scheme",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				Telegram:               &TelegramConfig{ProxyURL: "ftp://proxy:21"},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram.proxy_url must be an http, https or socks5 URL with a host",
+		},
+		{
+			name: "telegram proxy without host",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				Telegram:               &TelegramConfig{ProxyURL: "socks5://"},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram.proxy_url must be an http, https or socks5 URL with a host",
+		},
+		{
+			name: "negative idle sleep",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				Telegram:               &TelegramConfig{IdleSleepMs: &negative},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram.idle_sleep_ms must be >= 0",
+		},
+		{
+			name: "negative max conflicts",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				Telegram:               &TelegramConfig{MaxConflicts: &negative},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram.max_conflicts must be >= 0",
+		},
+		{
+			name: "zero rate limit",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{},
+				Telegram: &TelegramConfig{RateLimit: &RateLimitConfig{
+					PerChatPerSec:  1,
+					PerGroupPerMin: 20,
+				}},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram.rate_limit values must be > 0",
+		},
+		{
+			name: "unknown allowed update",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				Telegram:               &TelegramConfig{AllowedUpdates: []string{"message", "business_messages"}},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "telegram.allowed_updates contains unknown update type 'business_messages'",
+		},
+		{
+			name: "shutdown timeout shorter than publish shutdown timeout",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				ShutdownTimeout:        5,
+			},
+			wantErr: true,
+			errMsg:  "shutdown_timeout must be >= publish_shutdown_timeout",
+		},
+		{
+			name: "negative shutdown timeout",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				ShutdownTimeout:        -1,
+			},
+			wantErr: true,
+			errMsg:  "shutdown_timeout must be >= 0",
+		},
+		{
+			name: "static subject with * wildcard",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "true",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.*.messages",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].subject must not contain wildcards '*' or '>'",
+		},
+		{
+			name: "static subject with > wildcard",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "true",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.>",
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].subject must not contain wildcards '*' or '>'",
+		},
+		{
+			name: "expr subject with wildcard characters",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "true",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeExpr,
+							Value: `update.Message != nil && update.Message.Chat.Id > 0 ? "telegram.private" : "telegram.groups"`,
+						},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "respond only route without subject",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.Message != nil",
+						Respond:   &RouteRespond{Text: "Got it!", Only: true},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "respond without only requires subject",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.Message != nil",
+						Respond:   &RouteRespond{Text: "Got it!"},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].subject is required",
+		},
+		{
+			name: "respond with both text and text_expr",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.Message != nil",
+						Respond:   &RouteRespond{Text: "Got it!", TextExpr: `"Got it!"`, Only: true},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].respond requires exactly one of text or text_expr",
+		},
+		{
+			name: "respond only with request reply mode",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.Message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+						ReplyMode:      ReplyModeRequest,
+						ReplyTimeoutMs: 3000,
+						Respond:        &RouteRespond{Text: "Got it!", Only: true},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].respond.only can't be combined with reply_mode 'request'",
+		},
+		{
+			name: "outbound errors subject with kafka broker",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes:                 []Route{},
+				OutboundErrorsSubject:  "telegram.outbound_errors",
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "outbound_errors_subject is supported only when broker is 'nats'",
+		},
+		{
+			name: "control subject with kafka broker",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes:                 []Route{},
+				ControlSubject:         "telegram.bridge.events",
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "control_subject is supported only when broker is 'nats'",
+		},
+		{
+			name: "control subject with wildcard",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				ControlSubject:         "telegram.bridge.*",
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "control_subject must not contain wildcards '*' or '>'",
+		},
+		{
+			name: "request transcription without subject",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition:            "update.Message?.Voice != nil",
+						Subject:              &RouteSubject{Type: SubjectTypeString, Value: "telegram.voice"},
+						RequestTranscription: true,
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].request_transcription requires transcription_request_subject",
+		},
+		{
+			name: "request transcription",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition:            "update.Message?.Voice != nil",
+						Subject:              &RouteSubject{Type: SubjectTypeString, Value: "telegram.voice"},
+						RequestTranscription: true,
+					},
+				},
+				TranscriptionRequestSubject: "transcription.requests",
+				TranscriptionTimeoutMs:      30000,
+				TelegramToken:               "test-token",
+				RouteWorkers:                5,
+				PublishWorkers:              5,
+				PublishShutdownTimeout:      10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "transcription subject with kafka broker",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes:                      []Route{},
+				TranscriptionRequestSubject: "transcription.requests",
+				TranscriptionTimeoutMs:      30000,
+				TelegramToken:               "test-token",
+				RouteWorkers:                5,
+				PublishWorkers:              5,
+				PublishShutdownTimeout:      10,
+			},
+			wantErr: true,
+			errMsg:  "transcription_request_subject is supported only when broker is 'nats'",
+		},
+		{
+			name: "transcription timeout not positive",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                      []Route{},
+				TranscriptionRequestSubject: "transcription.requests",
+				TranscriptionTimeoutMs:      -1,
+				TelegramToken:               "test-token",
+				RouteWorkers:                5,
+				PublishWorkers:              5,
+				PublishShutdownTimeout:      10,
+			},
+			wantErr: true,
+			errMsg:  "transcription_timeout_ms must be > 0",
+		},
+		{
+			name: "dead letter subject with wildcard",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				DeadLetterSubject:      "telegram.dead.>",
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "dead_letter_subject must not contain wildcards '*' or '>'",
+		},
+		{
+			name: "poll aggregation without subject",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				PollAggregation:        &PollAggregationConfig{Enabled: true, CacheSize: 10, TTLSec: 60},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "poll_aggregation.subject is required",
+		},
+		{
+			name: "idempotency without ttl",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				Idempotency:            &IdempotencyConfig{Enabled: true, CacheSize: 10},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "idempotency.ttl_sec must be > 0",
+		},
+		{
+			name: "unknown bot meta mode",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				IncludeBotMeta:         true,
+				BotMetaMode:            "body",
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "bot_meta_mode must be 'headers' or 'wrap'",
+		},
+		{
+			name: "invalid enrich kind",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{
+					{
+						Condition: "update.Message != nil",
+						Subject: &RouteSubject{
+							Type:  SubjectTypeString,
+							Value: "telegram.messages",
+						},
+						Enrich: []EnrichKind{EnrichChat, "user"},
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "routes[0].enrich must contain only 'chat' or 'chat_member'",
+		},
+		{
+			name: "connect retry max interval below interval",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:          "nats://localhost:4222",
+					Engine:       EngineCore,
+					ConnectRetry: &ConnectRetryConfig{IntervalSec: 10, MaxIntervalSec: 5},
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "nats.connect_retry.max_interval_sec must be >= interval_sec",
+		},
+		{
+			name: "invalid edit subjects mode",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				EditSubjects:           &EditSubjectsConfig{Enabled: true, Mode: "copy"},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "edit_subjects.mode must be 'duplicate' or 'redirect'",
+		},
+		{
+			name: "edit subjects with kafka",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes:                 []Route{},
+				EditSubjects:           &EditSubjectsConfig{Enabled: true, Mode: EditSubjectsDuplicate},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "edit_subjects is supported only when broker is 'nats'",
+		},
+		{
+			name: "reconnect below unlimited",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:       "nats://localhost:4222",
+					Engine:    EngineCore,
+					Reconnect: &ReconnectConfig{MaxReconnects: &belowUnlimited, WaitSec: 2, MaxWaitSec: 2},
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "nats.reconnect.max_reconnects must be >= -1",
+		},
+		{
+			name: "startup probe with kafka",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				StartupProbe:           true,
+				StartupProbeOnFailure:  ProbeFailureExit,
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "startup_probe is supported only when broker is 'nats'",
+		},
+		{
+			name: "invalid startup probe failure action",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				StartupProbe:           true,
+				StartupProbeOnFailure:  "ignore",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "startup_probe_on_failure must be 'exit' or 'warn'",
+		},
+		{
+			name: "no echo with startup probe round trip",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+					NoEcho: true,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				StartupProbe:           true,
+				StartupProbeRoundTrip:  true,
+				StartupProbeOnFailure:  ProbeFailureExit,
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "nats.no_echo can't be combined with startup_probe_round_trip",
+		},
+		{
+			name: "no echo with startup probe",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:            "nats://localhost:4222",
+					Engine:         EngineCore,
+					ConnectionName: "bridge-{bot}",
+					NoEcho:         true,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				StartupProbe:           true,
+				StartupProbeOnFailure:  ProbeFailureExit,
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+		},
+		{
+			name: "kafka route missing topic",
+			config: Config{
+				Mode:   "first",
+				Broker: BrokerKafka,
+				Kafka: &KafkaConfig{
+					Brokers: []string{"localhost:9092"},
+				},
+				Routes: []Route{
+					{
+						Condition: "update.message != nil",
+					},
+				},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+			},
+			wantErr: true,
+			errMsg:  "topic is required when broker is 'kafka'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_RouteStreams(t *testing.T) {
+	tmpDir := t.TempDir()
+	defaultStream := filepath.Join(tmpDir, "telegram.json")
+	eventsStream := filepath.Join(tmpDir, "events.json")
+	require.NoError(t, os.WriteFile(defaultStream, []byte(`{"Name":"TELEGRAM","Subjects":["telegram.>"]}`), 0644))
+	require.NoError(t, os.WriteFile(eventsStream, []byte(`{"Name":"EVENTS","Subjects":["events.>"]}`), 0644))
+
+	newConfig := func(streams map[string]string, routeStream string) Config {
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:    "nats://localhost:4222",
+				Engine: EngineJetStream,
+				JetStream: &JetStreamConfig{
+					StreamConfig: defaultStream,
+					Streams:      streams,
+				},
+			},
+			Routes: []Route{
+				{
+					Condition: "update.Message != nil",
+					Subject: &RouteSubject{
+						Type:  SubjectTypeString,
+						Value: "events.messages",
+					},
+					Stream: routeStream,
+				},
+			},
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+
+	t.Run("declared stream", func(t *testing.T) {
+		cfg := newConfig(map[string]string{"EVENTS": eventsStream}, "EVENTS")
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("undeclared stream", func(t *testing.T) {
+		cfg := newConfig(nil, "EVENTS")
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "routes[0].stream 'EVENTS' is not declared in nats.jetstream.streams")
+	})
+
+	t.Run("stream name mismatch", func(t *testing.T) {
+		cfg := newConfig(map[string]string{"AUDIT": eventsStream}, "AUDIT")
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stream config name 'EVENTS' does not match")
+	})
+
+	t.Run("missing stream config file", func(t *testing.T) {
+		cfg := newConfig(map[string]string{"EVENTS": filepath.Join(tmpDir, "missing.json")}, "EVENTS")
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "nats.jetstream.streams.EVENTS")
+	})
+
+	t.Run("stream with core engine", func(t *testing.T) {
+		cfg := newConfig(nil, "EVENTS")
+		cfg.NATS.Engine = EngineCore
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "routes[0].stream is supported only when nats.engine is 'jetstream'")
+	})
+}
+
+func TestConfig_Validate_Stream(t *testing.T) {
+	newConfig := func(js *JetStreamConfig) Config {
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:       "nats://localhost:4222",
+				Engine:    EngineJetStream,
+				JetStream: js,
+			},
+			Routes:                 []Route{},
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+	newSpec := func() *StreamSpec {
+		return &StreamSpec{
+			Name:      "TELEGRAM",
+			Subjects:  []string{"telegram.>"},
+			Retention: "limits",
+			Storage:   "file",
+			Replicas:  1,
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		cfg := newConfig(&JetStreamConfig{Stream: newSpec(), ManageStream: true})
+		assert.NoError(t, cfg.Validate())
+	})
+
+	tests := []struct {
+		name   string
+		js     func() *JetStreamConfig
+		errMsg string
+	}{
+		{
+			name:   "neither stream_config nor stream",
+			js:     func() *JetStreamConfig { return &JetStreamConfig{} },
+			errMsg: "nats.jetstream.stream_config or nats.jetstream.stream is required",
+		},
+		{
+			name: "both stream_config and stream",
+			js: func() *JetStreamConfig {
+				return &JetStreamConfig{StreamConfig: "stream.json", Stream: newSpec()}
+			},
+			errMsg: "can't be combined",
+		},
+		{
+			name: "manage_stream without stream",
+			js: func() *JetStreamConfig {
+				path := filepath.Join(t.TempDir(), "stream.json")
+				require.NoError(t, os.WriteFile(path, []byte(`{"Name":"TELEGRAM"}`), 0644))
+				return &JetStreamConfig{StreamConfig: path, ManageStream: true}
+			},
+			errMsg: "nats.jetstream.manage_stream requires nats.jetstream.stream",
+		},
+		{
+			name: "invalid msg_id",
+			js: func() *JetStreamConfig {
+				return &JetStreamConfig{Stream: newSpec(), MsgID: "update.NoSuchField"}
+			},
+			errMsg: "failed to compile nats.jetstream.msg_id",
+		},
+		{
+			name: "missing name",
+			js: func() *JetStreamConfig {
+				spec := newSpec()
+				spec.Name = ""
+				return &JetStreamConfig{Stream: spec}
+			},
+			errMsg: "nats.jetstream.stream.name is required",
+		},
+		{
+			name: "no subjects",
+			js: func() *JetStreamConfig {
+				spec := newSpec()
+				spec.Subjects = nil
+				return &JetStreamConfig{Stream: spec}
+			},
+			errMsg: "nats.jetstream.stream.subjects must not be empty",
+		},
+		{
+			name: "unknown retention",
+			js: func() *JetStreamConfig {
+				spec := newSpec()
+				spec.Retention = "forever"
+				return &JetStreamConfig{Stream: spec}
+			},
+			errMsg: "nats.jetstream.stream.retention must be",
+		},
+		{
+			name: "unknown storage",
+			js: func() *JetStreamConfig {
+				spec := newSpec()
+				spec.Storage = "disk"
+				return &JetStreamConfig{Stream: spec}
+			},
+			errMsg: "nats.jetstream.stream.storage must be",
+		},
+		{
+			name: "negative max_age_sec",
+			js: func() *JetStreamConfig {
+				spec := newSpec()
+				spec.MaxAgeSec = -1
+				return &JetStreamConfig{Stream: spec}
+			},
+			errMsg: "nats.jetstream.stream.max_age_sec must be >= 0",
+		},
+		{
+			name: "too many replicas",
+			js: func() *JetStreamConfig {
+				spec := newSpec()
+				spec.Replicas = 6
+				return &JetStreamConfig{Stream: spec}
+			},
+			errMsg: "nats.jetstream.stream.replicas must be between 1 and 5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.js())
+			err := cfg.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestSubjectCollisions(t *testing.T) {
+	disabled := false
+	static := func(value string) *RouteSubject {
+		return &RouteSubject{Type: SubjectTypeString, Value: value}
+	}
+	dynamic := func(value string) *RouteSubject {
+		return &RouteSubject{Type: SubjectTypeExpr, Value: value}
+	}
+
+	routes := []Route{
+		{Condition: "update.Message != nil", Subject: static("telegram.messages")},
+		{Condition: "update.CallbackQuery != nil", Subject: static("telegram.callbacks")},
+		{Condition: "update.Message.Text != ''", Subject: static("telegram.messages")},
+		{Condition: "true", Subject: dynamic(`"chat." + string(update.Message.Chat.Id)`)},
+		{Condition: "true", Subject: dynamic(`"chat." +  string(update.Message.Chat.Id)`)},
+		{Condition: "true", Subject: static("telegram.callbacks"), Enabled: &disabled},
+		{Condition: "true", Subject: static("telegram.messages"), Respond: &RouteRespond{Text: "hi", Only: true}},
+	}
+
+	assert.Equal(t, []string{
+		"routes[0] and routes[2] have the same subject 'telegram.messages'",
+		`routes[3] and routes[4] have the same subject expression '"chat." + string(update.Message.Chat.Id)'`,
+	}, subjectCollisions(routes))
+	assert.Empty(t, subjectCollisions(routes[:2]))
+
+	t.Run("wildcard overlap", func(t *testing.T) {
+		routes := []Route{
+			{Condition: "true", Subject: static("tg.>")},
+			{Condition: "true", Subject: static("tg.updates.*")},
+			{Condition: "true", Subject: static("chat.*.messages")},
+			{Condition: "true", Subject: static("chat.42.messages")},
+			{Condition: "true", Subject: static("chat.42")},
+			{Condition: "true", Subject: static("tg")},
+		}
+
+		assert.Equal(t, []string{
+			"routes[0] and routes[1] have overlapping subjects 'tg.>' and 'tg.updates.*'",
+			"routes[2] and routes[3] have overlapping subjects 'chat.*.messages' and 'chat.42.messages'",
+		}, subjectCollisions(routes))
+	})
+}
+
+func TestSubjectsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"foo.bar", "foo.bar", true},
+		{"foo.bar", "foo.baz", false},
+		{"foo.*", "foo.bar", true},
+		{"foo.*", "foo.bar.baz", false},
+		{"foo.*.baz", "foo.bar.*", true},
+		{"foo.>", "foo.bar.baz", true},
+		{"foo.>", "foo", false},
+		{">", "foo", true},
+		{"foo.>", "bar.*", false},
+		{"*.bar", "foo.>", true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, subjectsOverlap(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, tt.want, subjectsOverlap(tt.b, tt.a), "%s vs %s", tt.b, tt.a)
+	}
+}
+
+func TestConfig_Validate_StrictSubjects(t *testing.T) {
+	newConfig := func(mode string, strict bool) Config {
+		return Config{
+			Mode:   mode,
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:    "nats://localhost:4222",
+				Engine: EngineCore,
+			},
+			Routes: []Route{
+				{Condition: "update.Message != nil", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"}},
+				{Condition: "update.EditedMessage != nil", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"}},
+			},
+			StrictSubjects:         strict,
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+
+	t.Run("strict in all mode", func(t *testing.T) {
+		cfg := newConfig("all", true)
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "strict_subjects: routes[0] and routes[1] have the same subject 'telegram.messages'")
+	})
+
+	t.Run("strict with overlapping wildcard subjects", func(t *testing.T) {
+		cfg := newConfig("all", true)
+		cfg.Routes[0].Subject.Value = "tg.>"
+		cfg.Routes[1].Subject.Value = "tg.updates.*"
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "strict_subjects: routes[0] and routes[1] have overlapping subjects 'tg.>' and 'tg.updates.*'")
+	})
+
+	t.Run("not strict", func(t *testing.T) {
+		cfg := newConfig("all", false)
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("strict in first mode", func(t *testing.T) {
+		cfg := newConfig("first", true)
+		assert.NoError(t, cfg.Validate())
+	})
+}
+
+func TestValidateConfigPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name:    "empty path",
+			path:    "",
+			wantErr: true,
+			errMsg:  "config path is required",
+		},
+		{
+			name:    "non-existent file",
+			path:    "/nonexistent/config.yaml",
+			wantErr: true,
+			errMsg:  "does not exist",
+		},
+		{
+			name:    "directory instead of file",
+			path:    t.TempDir(),
+			wantErr: true,
+			errMsg:  "is a directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfigPath(tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigPath_InvalidExtension(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte("{}"), 0644))
+
+	err := ValidateConfigPath(configPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must be a YAML file")
+}
+
+func TestValidateConfigPath_Valid(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("mode: first\nroutes: []"), 0644))
+
+	err := ValidateConfigPath(configPath)
+	assert.NoError(t, err)
+}
+
+func TestConfig_Validate_LogSampling(t *testing.T) {
+	newConfig := func(logging UpdateLoggingMode, sampling *UpdateSamplingConfig) Config {
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:    "nats://localhost:4222",
+				Engine: EngineCore,
+			},
+			Routes: []Route{
+				{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.updates"}},
+			},
+			Log:                    &LogConfig{UpdateLogging: logging, UpdateSampling: sampling},
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		logging  UpdateLoggingMode
+		sampling *UpdateSamplingConfig
+		wantErr  string
+	}{
+		{name: "not set"},
+		{name: "every", sampling: &UpdateSamplingConfig{Every: 100}},
+		{name: "per sec", sampling: &UpdateSamplingConfig{PerSec: 5}},
+		{name: "negative", sampling: &UpdateSamplingConfig{Every: -1}, wantErr: "must be >= 0"},
+		{name: "combined", sampling: &UpdateSamplingConfig{Every: 100, PerSec: 5}, wantErr: "can't be combined"},
+		{name: "sampled", logging: UpdateLoggingSampled, sampling: &UpdateSamplingConfig{Every: 100}},
+		{name: "off", logging: UpdateLoggingOff},
+		{name: "all with sampling", logging: UpdateLoggingAll, sampling: &UpdateSamplingConfig{Every: 100}, wantErr: "requires log.update_logging: sampled"},
+		{name: "unknown mode", logging: "verbose", wantErr: "log.update_logging must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.logging, tt.sampling)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfig_Validate_AdaptiveLimit(t *testing.T) {
+	newConfig := func(limit *AdaptiveLimitConfig) Config {
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:    "nats://localhost:4222",
+				Engine: EngineCore,
+			},
+			Routes: []Route{
+				{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.updates"}},
+			},
+			Telegram:               &TelegramConfig{AdaptiveLimit: limit},
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+	valid := func() *AdaptiveLimitConfig {
+		return &AdaptiveLimitConfig{Enabled: true, Min: 10, MaxBatchBytes: 1 << 20, MaxBatchMs: 1000, RampUpAfter: 3}
+	}
+
+	tests := []struct {
+		name    string
+		limit   func(*AdaptiveLimitConfig)
+		wantErr string
+	}{
+		{name: "valid", limit: func(*AdaptiveLimitConfig) {}},
+		{name: "disabled ignores values", limit: func(l *AdaptiveLimitConfig) { l.Enabled = false; l.Min = 0 }},
+		{name: "min zero", limit: func(l *AdaptiveLimitConfig) { l.Min = 0 }, wantErr: "telegram.adaptive_limit.min must be between 1 and 100"},
+		{name: "min too large", limit: func(l *AdaptiveLimitConfig) { l.Min = 101 }, wantErr: "telegram.adaptive_limit.min must be between 1 and 100"},
+		{name: "negative bytes", limit: func(l *AdaptiveLimitConfig) { l.MaxBatchBytes = -1 }, wantErr: "telegram.adaptive_limit values must be > 0"},
+		{name: "zero ramp up", limit: func(l *AdaptiveLimitConfig) { l.RampUpAfter = 0 }, wantErr: "telegram.adaptive_limit values must be > 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := valid()
+			tt.limit(limit)
+			cfg := newConfig(limit)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfig_Validate_HTTPServer(t *testing.T) {
+	disabled := false
+	newConfig := func(server *HTTPServerConfig) Config {
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:    "nats://localhost:4222",
+				Engine: EngineCore,
+			},
+			Routes: []Route{
+				{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.updates"}},
+			},
+			HTTPServer:             server,
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		server  *HTTPServerConfig
+		wantErr string
+	}{
+		{name: "not set"},
+		{name: "disabled", server: &HTTPServerConfig{Stats: &disabled}},
+		{name: "stats", server: &HTTPServerConfig{Enabled: true, Listen: ":8080"}},
+		{name: "no listen", server: &HTTPServerConfig{Enabled: true}, wantErr: "http_server.listen is required"},
+		{name: "health only", server: &HTTPServerConfig{Enabled: true, Listen: ":8080", Stats: &disabled}},
+		{name: "no endpoints", server: &HTTPServerConfig{Enabled: true, Listen: ":8080", Stats: &disabled, Health: &disabled}, wantErr: "http_server has no endpoints enabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.server)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfig_Validate_ExprEnv(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "-100123")
+
+	newConfig := func(exprEnv []string) Config {
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:    "nats://localhost:4222",
+				Engine: EngineCore,
+			},
+			Routes: []Route{
+				{Condition: "update.Message.Chat.Id == env.ADMIN_CHAT_ID", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.admin"}},
+			},
+			ExprEnv:                exprEnv,
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+
+	cfg := newConfig([]string{"ADMIN_CHAT_ID"})
+	assert.NoError(t, cfg.Validate())
+
+	cfg = newConfig(nil)
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not listed in expr_env")
+
+	cfg = newConfig([]string{"ADMIN_CHAT_ID", "bad-name"})
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expr_env: 'bad-name' is not a valid environment variable name")
+}
+
+func TestConfig_Validate_OffsetStore(t *testing.T) {
+	newConfig := func(offsetStore *OffsetStoreConfig) Config {
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:         "nats://localhost:4222",
+				Engine:      EngineCore,
+				OffsetStore: offsetStore,
+			},
+			Routes: []Route{
+				{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.updates"}},
+			},
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+
+	cfg := newConfig(&OffsetStoreConfig{Enabled: true, Bucket: DefaultOffsetBucket})
+	assert.NoError(t, cfg.Validate())
+
+	cfg = newConfig(&OffsetStoreConfig{Enabled: true, Bucket: "offsets.prod"})
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nats.offset_store.bucket must contain only")
+
+	// The bucket isn't used while the store is disabled
+	cfg = newConfig(&OffsetStoreConfig{Bucket: "offsets.prod"})
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestConfig_Validate_ShadowSubject(t *testing.T) {
+	newConfig := func(broker BrokerType, route Route) Config {
+		cfg := Config{
+			Mode:                   "first",
+			Broker:                 broker,
+			Routes:                 []Route{route},
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+		if broker == BrokerNATS {
+			cfg.NATS = &NATSConfig{URL: "nats://localhost:4222", Engine: EngineCore}
+		} else {
+			cfg.Kafka = &KafkaConfig{Brokers: []string{"localhost:9092"}}
+		}
+		return cfg
+	}
+	subject := &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"}
+
+	tests := []struct {
+		name    string
+		broker  BrokerType
+		route   Route
+		wantErr string
+	}{
+		{
+			name:   "static",
+			broker: BrokerNATS,
+			route:  Route{Condition: "true", Subject: subject, ShadowSubject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.v2.messages"}},
+		},
+		{
+			name:   "expr",
+			broker: BrokerNATS,
+			route:  Route{Condition: "true", Subject: subject, ShadowSubject: &RouteSubject{Type: SubjectTypeExpr, Value: `"telegram.v2." + update_type(update)`}},
+		},
+		{
+			name:    "kafka",
+			broker:  BrokerKafka,
+			route:   Route{Condition: "true", Topic: &RouteTopic{Type: SubjectTypeString, Value: "telegram"}, ShadowSubject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.v2"}},
+			wantErr: "routes[0].shadow_subject is supported only when broker is 'nats'",
+		},
+		{
+			name:    "request",
+			broker:  BrokerNATS,
+			route:   Route{Condition: "true", Subject: subject, ReplyMode: ReplyModeRequest, ReplyTimeoutMs: 1000, ShadowSubject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.v2"}},
+			wantErr: "can't be combined with reply_mode 'request'",
+		},
+		{
+			name:    "respond only",
+			broker:  BrokerNATS,
+			route:   Route{Condition: "true", Respond: &RouteRespond{Text: "hi", Only: true}, ShadowSubject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.v2"}},
+			wantErr: "can't be combined with respond.only",
+		},
+		{
+			name:    "wildcard",
+			broker:  BrokerNATS,
+			route:   Route{Condition: "true", Subject: subject, ShadowSubject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.v2.>"}},
+			wantErr: "routes[0].shadow_subject must not contain wildcards",
+		},
+		{
+			name:    "missing type",
+			broker:  BrokerNATS,
+			route:   Route{Condition: "true", Subject: subject, ShadowSubject: &RouteSubject{Value: "telegram.v2"}},
+			wantErr: "routes[0].shadow_subject.type must be 'string' or 'expr'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.broker, tt.route)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfig_Validate_Scrub(t *testing.T) {
+	on := true
+	newConfig := func(scrub *ScrubConfig, routeScrub *bool, replyMode ReplyMode) Config {
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:    "nats://localhost:4222",
+				Engine: EngineCore,
+			},
+			Routes: []Route{
+				{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.updates"}, Scrub: routeScrub, ReplyMode: replyMode, ReplyTimeoutMs: 1000},
+			},
+			Scrub:                  scrub,
+			TelegramToken:          "test-token",
+			RouteWorkers:           5,
+			PublishWorkers:         5,
+			PublishShutdownTimeout: 10,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		scrub      *ScrubConfig
+		routeScrub *bool
+		replyMode  ReplyMode
+		wantErr    string
+	}{
+		{name: "not set"},
+		{name: "rules", scrub: &ScrubConfig{Enabled: true, Remove: []string{"message.contact"}, HashUserIDs: true, Salt: "pepper"}},
+		{name: "route opt-in", scrub: &ScrubConfig{Remove: []string{"message.contact"}}, routeScrub: &on},
+		{name: "no rules", scrub: &ScrubConfig{Enabled: true}, wantErr: "scrub requires remove, redact or hash_user_ids"},
+		{name: "no salt", scrub: &ScrubConfig{HashUserIDs: true}, wantErr: "scrub.salt is required"},
+		{name: "bad pattern", scrub: &ScrubConfig{Redact: []ScrubRedactConfig{{Pattern: "["}}}, wantErr: "invalid pattern"},
+		{name: "route without section", routeScrub: &on, wantErr: "routes[0].scrub requires the scrub section"},
+		{name: "request route", scrub: &ScrubConfig{Remove: []string{"message.contact"}}, routeScrub: &on, replyMode: ReplyModeRequest, wantErr: "can't be combined with reply_mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.scrub, tt.routeScrub, tt.replyMode)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfig_Validate_Payload(t *testing.T) {
+	newConfig := func(route Route) Config {
+		route.Condition = "true"
+		route.Subject = &RouteSubject{Type: SubjectTypeString, Value: "telegram.updates"}
+		return Config{
+			Mode:   "first",
+			Broker: BrokerNATS,
+			NATS: &NATSConfig{
+				URL:    "nats://localhost:4222",
+				Engine: EngineCore,
+			},
+			Routes:                      []Route{route},
+			TranscriptionRequestSubject: "transcription.requests",
+			TranscriptionTimeoutMs:      1000,
+			TelegramToken:               "test-token",
+			RouteWorkers:                5,
+			PublishWorkers:              5,
+			PublishShutdownTimeout:      10,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		route   Route
+		wantErr string
+	}{
+		{name: "not set"},
+		{name: "full", route: Route{Payload: PayloadFull}},
+		{name: "flatten", route: Route{Payload: PayloadFlatten}},
+		{name: "unknown", route: Route{Payload: "compact"}, wantErr: "routes[0].payload must be 'full' or 'flatten'"},
+		{name: "flatten request", route: Route{Payload: PayloadFlatten, ReplyMode: ReplyModeRequest, ReplyTimeoutMs: 1000}, wantErr: "can't be combined with reply_mode 'request'"},
+		{name: "flatten transcription", route: Route{Payload: PayloadFlatten, RequestTranscription: true}, wantErr: "can't be combined with request_transcription"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.route)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfig_Validate_PayloadSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		wantErr string
+	}{
+		{name: "not set"},
+		{name: "v1", version: PayloadSchemaV1},
+		{name: "v2", version: PayloadSchemaV2},
+		{name: "unknown", version: 3, wantErr: "payload_schema_version 3 is not supported, use 1 or 2"},
+		{name: "negative", version: -1, wantErr: "payload_schema_version -1 is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes: []Route{{
+					Condition: "true",
+					Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.updates"},
+				}},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				PayloadSchemaVersion:   tt.version,
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadConfig_PayloadSchemaVersion(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{name: "default", want: LatestPayloadSchema},
+		{name: "pinned", content: "payload_schema_version: 1\n", want: PayloadSchemaV1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := "nats:\n  url: nats://test:4222\ntelegram_token: test-token\n" + tt.content
+			require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+			cfg, err := LoadConfig(configPath, logger)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.PayloadSchemaVersion)
+		})
+	}
+}
+
+func TestConfig_Validate_Sharding(t *testing.T) {
+	tests := []struct {
+		name     string
+		broker   BrokerType
+		sharding *ShardingConfig
+		wantErr  string
+	}{
+		{name: "not set"},
+		{name: "chat_id", sharding: &ShardingConfig{Key: ShardKeyChatID, Shards: 8, Suffix: true}},
+		{name: "user_id", sharding: &ShardingConfig{Key: ShardKeyUserID, Shards: 8}},
+		{name: "unknown key", sharding: &ShardingConfig{Key: "update_id", Shards: 8}, wantErr: "sharding.key must be 'chat_id' or 'user_id'"},
+		{name: "no shards", sharding: &ShardingConfig{Key: ShardKeyChatID}, wantErr: "sharding.shards must be > 0"},
+		{name: "kafka header only", broker: BrokerKafka, sharding: &ShardingConfig{Key: ShardKeyChatID, Shards: 8}},
+		{name: "kafka suffix", broker: BrokerKafka, sharding: &ShardingConfig{Key: ShardKeyChatID, Shards: 8, Suffix: true}, wantErr: "sharding.suffix is supported only when broker is 'nats'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				Sharding:               tt.sharding,
+			}
+			if tt.broker == BrokerKafka {
+				cfg.Broker = BrokerKafka
+				cfg.NATS = nil
+				cfg.Kafka = &KafkaConfig{Brokers: []string{"localhost:9092"}}
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfig_Validate_ChatLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		chatLimit *ChatLimitConfig
+		wantErr   string
+	}{
+		{name: "not set"},
+		{name: "drop", chatLimit: &ChatLimitConfig{PerSec: 5, Burst: 20, Overflow: ChatLimitDrop, MaxChats: 100}},
+		{name: "sample", chatLimit: &ChatLimitConfig{PerSec: 5, Burst: 5, Overflow: ChatLimitSample, SampleEvery: 10, MaxChats: 100}},
+		{name: "no rate", chatLimit: &ChatLimitConfig{Overflow: ChatLimitDrop, MaxChats: 100}, wantErr: "chat_limit.per_sec must be > 0"},
+		{name: "burst below rate", chatLimit: &ChatLimitConfig{PerSec: 5, Burst: 1, Overflow: ChatLimitDrop, MaxChats: 100}, wantErr: "chat_limit.burst must be >= chat_limit.per_sec"},
+		{name: "unknown overflow", chatLimit: &ChatLimitConfig{PerSec: 5, Burst: 5, Overflow: "queue", MaxChats: 100}, wantErr: "chat_limit.overflow must be 'drop' or 'sample'"},
+		{name: "sample every update", chatLimit: &ChatLimitConfig{PerSec: 5, Burst: 5, Overflow: ChatLimitSample, SampleEvery: 1, MaxChats: 100}, wantErr: "chat_limit.sample_every must be > 1"},
+		{name: "no chats", chatLimit: &ChatLimitConfig{PerSec: 5, Burst: 5, Overflow: ChatLimitDrop}, wantErr: "chat_limit.max_chats must be > 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				ChatLimit:              tt.chatLimit,
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadConfig_ChatLimitDefaults(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := "nats:\n  url: nats://test:4222\ntelegram_token: test-token\nchat_limit:\n  per_sec: 5\n  exempt_chats: [-100500]\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	assert.Equal(t, &ChatLimitConfig{
+		PerSec:      5,
+		Burst:       5,
+		Overflow:    ChatLimitDrop,
+		SampleEvery: DefaultChatLimitSampleEvery,
+		MaxChats:    DefaultChatLimitMaxChats,
+		ExemptChats: []int64{-100500},
+	}, cfg.ChatLimit)
+}
+
+func TestConfig_Validate_PublishBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		broker  BrokerType
+		batch   *BatchConfig
+		wantErr string
+	}{
+		{name: "not set"},
+		{name: "nats", batch: &BatchConfig{MaxMessages: 100, MaxDelayMs: 1000}},
+		{name: "no size", batch: &BatchConfig{MaxDelayMs: 1000}, wantErr: "publish.batch.max_messages must be > 0"},
+		{name: "no delay", batch: &BatchConfig{MaxMessages: 100}, wantErr: "publish.batch.max_delay_ms must be > 0"},
+		{name: "kafka", broker: BrokerKafka, batch: &BatchConfig{MaxMessages: 100, MaxDelayMs: 1000}, wantErr: "publish.batch is supported only when broker is 'nats'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Mode:   "first",
+				Broker: BrokerNATS,
+				NATS: &NATSConfig{
+					URL:    "nats://localhost:4222",
+					Engine: EngineCore,
+				},
+				Routes:                 []Route{},
+				TelegramToken:          "test-token",
+				RouteWorkers:           5,
+				PublishWorkers:         5,
+				PublishShutdownTimeout: 10,
+				Publish:                &PublishConfig{Batch: tt.batch},
+			}
+			if tt.broker == BrokerKafka {
+				cfg.Broker = BrokerKafka
+				cfg.NATS = nil
+				cfg.Kafka = &KafkaConfig{Brokers: []string{"localhost:9092"}}
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
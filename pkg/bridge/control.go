@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Lifecycle events published to control_subject
+const (
+	ControlEventStarted           = "started"
+	ControlEventTelegramConnected = "telegram_connected"
+	ControlEventNATSReconnected   = "nats_reconnected"
+	ControlEventLeaderElected     = "leader_elected"
+	ControlEventShutdown          = "shutdown"
+)
+
+// ControlEvent is a bridge lifecycle event. Bridges sharing a control subject
+// are told apart by InstanceID, Bot is set once getMe succeeded.
+type ControlEvent struct {
+	Event      string                 `json:"event"`
+	InstanceID string                 `json:"instance_id"`
+	Bot        *BotMeta               `json:"bot,omitempty"`
+	Time       time.Time              `json:"time"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// ControlEvents publishes lifecycle events to the control subject. Publishing
+// is best-effort: events are sent with a core NATS publish that doesn't wait
+// for the server, and dropped while the connection is down. A nil
+// ControlEvents drops every event.
+type ControlEvents struct {
+	subject    string
+	instanceID string
+	conn       atomic.Pointer[nats.Conn]
+	bot        atomic.Pointer[BotMeta]
+	now        func() time.Time
+	logger     *slog.Logger
+}
+
+// NewControlEvents creates a publisher of events to subject, it returns nil
+// when subject is empty
+func NewControlEvents(subject, instanceID string, logger *slog.Logger) *ControlEvents {
+	if subject == "" {
+		return nil
+	}
+	return &ControlEvents{
+		subject:    subject,
+		instanceID: instanceID,
+		now:        time.Now,
+		logger:     logger,
+	}
+}
+
+// SetConn sets the connection events are published to, events emitted before
+// it is set are dropped
+func (c *ControlEvents) SetConn(conn *nats.Conn) {
+	if c == nil {
+		return
+	}
+	c.conn.Store(conn)
+}
+
+// SetBot sets the bot attached to every following event
+func (c *ControlEvents) SetBot(bot BotMeta) {
+	if c == nil {
+		return
+	}
+	c.bot.Store(&bot)
+}
+
+// Emit publishes an event, it never blocks on the network
+func (c *ControlEvents) Emit(event string, data map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	conn := c.conn.Load()
+	if conn == nil || !conn.IsConnected() {
+		c.logger.Debug("NATS is not connected, control event dropped", "event", event)
+		return
+	}
+
+	payload, err := json.Marshal(ControlEvent{
+		Event:      event,
+		InstanceID: c.instanceID,
+		Bot:        c.bot.Load(),
+		Time:       c.now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		c.logger.Warn("failed to encode control event", "event", event, "error", err)
+		return
+	}
+	if err := conn.Publish(c.subject, payload); err != nil {
+		c.logger.Warn("failed to publish control event", "event", event, "subject", c.subject, "error", err)
+	}
+}
+
+// newInstanceID identifies this bridge process among bridges sharing the
+// control subject
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlEvents_Emit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	srv := runEmbeddedNATS(t)
+
+	sub, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer sub.Close()
+	events, err := sub.SubscribeSync("telegram.bridge.events")
+	require.NoError(t, err)
+	require.NoError(t, sub.Flush())
+
+	conn, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	control := NewControlEvents("telegram.bridge.events", "host-1", logger)
+	control.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	// Events before the connection is set are dropped
+	control.Emit(ControlEventStarted, nil)
+
+	control.SetConn(conn)
+	control.Emit(ControlEventTelegramConnected, map[string]interface{}{"bot_id": 123})
+	require.NoError(t, conn.Flush())
+
+	msg, err := events.NextMsg(time.Second)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"event": "telegram_connected",
+		"instance_id": "host-1",
+		"time": "2026-01-02T03:04:05Z",
+		"data": {"bot_id": 123}
+	}`, string(msg.Data))
+
+	// Events after getMe carry the bot
+	control.SetBot(BotMeta{ID: 123, Username: "test_bot"})
+	control.Emit(ControlEventShutdown, map[string]interface{}{"reason": "conflict"})
+	require.NoError(t, conn.Flush())
+
+	msg, err = events.NextMsg(time.Second)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"event": "shutdown",
+		"instance_id": "host-1",
+		"bot": {"id": 123, "username": "test_bot"},
+		"time": "2026-01-02T03:04:05Z",
+		"data": {"reason": "conflict"}
+	}`, string(msg.Data))
+
+	_, err = events.NextMsg(100 * time.Millisecond)
+	assert.ErrorIs(t, err, nats.ErrTimeout, "no other events")
+
+	// Events on a closed connection are dropped without blocking
+	conn.Close()
+	control.Emit(ControlEventShutdown, nil)
+}
+
+func TestControlEvents_Disabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	control := NewControlEvents("", "host-1", logger)
+	assert.Nil(t, control)
+	control.SetConn(nil)
+	control.SetBot(BotMeta{ID: 1})
+	control.Emit(ControlEventStarted, nil)
+}
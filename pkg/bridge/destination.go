@@ -0,0 +1,47 @@
+package bridge
+
+import "time"
+
+type Destination struct {
+	// Route is the name of the route that produced the destination, empty
+	// for unnamed routes
+	Route   string
+	Subject string
+	Topic   string
+	Key     string
+	// Stream is the expected JetStream stream for Subject
+	Stream  string
+	Headers map[string]string
+	// Request makes the bridge send a NATS request instead of publishing
+	Request        bool
+	RequestTimeout time.Duration
+	ReplyAction    ReplyAction
+	// Response is sent back to the chat of the update
+	Response *Response
+	// RespondOnly skips publishing, only Response is sent
+	RespondOnly bool
+	// ShadowSubject receives a copy of the publication, its failures are
+	// only logged
+	ShadowSubject string
+	// Transcribe attaches the transcript of a voice note or video note
+	// to the published update
+	Transcribe bool
+	// Scrub removes personal data from the publication
+	Scrub bool
+	// Payload "flatten" publishes FlatUpdate instead of the update
+	Payload PayloadMode
+	// Enrich lists enrichment attached to the published update
+	Enrich []EnrichKind
+}
+
+// Shadow returns the destination of the shadow publication: the same
+// message to ShadowSubject, without stream expectations or a response
+func (d Destination) Shadow() Destination {
+	return Destination{Subject: d.ShadowSubject, Key: d.Key, Headers: d.Headers}
+}
+
+// Response is a text message sent back to the chat of a routed update
+type Response struct {
+	Text      string
+	ParseMode string
+}
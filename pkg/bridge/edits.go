@@ -0,0 +1,170 @@
+package bridge
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// EditSubjectsMode selects how edit_subjects publishes edited messages
+type EditSubjectsMode string
+
+const (
+	// EditSubjectsDuplicate publishes edits to both the matched subject and <subject>.edits
+	EditSubjectsDuplicate EditSubjectsMode = "duplicate"
+	// EditSubjectsRedirect publishes edits to <subject>.edits instead of the matched subject
+	EditSubjectsRedirect EditSubjectsMode = "redirect"
+)
+
+// EditSubjectSuffix is appended to the matched subject for edited messages
+const EditSubjectSuffix = ".edits"
+
+// isEditUpdate reports whether update is an edit of a message, channel post or business message
+func isEditUpdate(update Update) bool {
+	return update.EditedMessage != nil || update.EditedChannelPost != nil || update.EditedBusinessMessage != nil
+}
+
+// editDestinations applies mode to destinations of an edit update. Only
+// publications are moved or copied: requests expect a reply and responses
+// must not be sent twice, so the .edits copy never carries them.
+func editDestinations(mode EditSubjectsMode, dests []Destination) []Destination {
+	var result []Destination
+	for _, dest := range dests {
+		if dest.Subject == "" || dest.Request || dest.RespondOnly {
+			result = append(result, dest)
+			continue
+		}
+
+		edit := dest
+		edit.Subject += EditSubjectSuffix
+		if edit.ShadowSubject != "" {
+			edit.ShadowSubject += EditSubjectSuffix
+		}
+		edit.Response = nil
+
+		switch {
+		case mode == EditSubjectsDuplicate:
+			result = append(result, dest)
+		case dest.Response != nil:
+			// Redirect moves only the publication, the response is still sent
+			respond := dest
+			respond.RespondOnly = true
+			result = append(result, respond)
+		}
+		result = append(result, edit)
+	}
+	return result
+}
+
+// EditInfo describes how an edited message text differs from its previous version
+type EditInfo struct {
+	PreviousText string   `json:"previous_text"`
+	Diff         EditDiff `json:"diff"`
+}
+
+// EditDiff is a single changed span: the texts share everything before Offset
+// (in runes) and after the changed span, Removed was replaced by Added
+type EditDiff struct {
+	Offset  int    `json:"offset"`
+	Removed string `json:"removed"`
+	Added   string `json:"added"`
+}
+
+// diffText returns the changed span between old and new text
+func diffText(oldText, newText string) EditDiff {
+	oldRunes, newRunes := []rune(oldText), []rune(newText)
+
+	prefix := 0
+	for prefix < len(oldRunes) && prefix < len(newRunes) && oldRunes[prefix] == newRunes[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(oldRunes)-prefix && suffix < len(newRunes)-prefix &&
+		oldRunes[len(oldRunes)-1-suffix] == newRunes[len(newRunes)-1-suffix] {
+		suffix++
+	}
+
+	return EditDiff{
+		Offset:  prefix,
+		Removed: string(oldRunes[prefix : len(oldRunes)-suffix]),
+		Added:   string(newRunes[prefix : len(newRunes)-suffix]),
+	}
+}
+
+// EditTracker remembers recent message texts by (chat_id, message_id) to
+// describe later edits. Memory is bounded by the cache size: Telegram limits
+// text and captions to 4096 characters.
+type EditTracker struct {
+	cache *ttlCache
+	bytes atomic.Int64
+}
+
+// NewEditTracker creates a new EditTracker
+func NewEditTracker(cacheSize int, ttl time.Duration) *EditTracker {
+	t := &EditTracker{
+		cache: newTTLCache(cacheSize, ttl),
+	}
+	t.cache.onRemove = func(value interface{}) {
+		t.bytes.Add(-int64(len(value.(string))))
+	}
+	return t
+}
+
+// Track remembers the text of new and edited messages. For an edited message
+// whose previous text is known it returns the edit, otherwise nil.
+func (t *EditTracker) Track(update Update) *EditInfo {
+	var edited bool
+	msg := update.Message
+	switch {
+	case update.ChannelPost != nil:
+		msg = update.ChannelPost
+	case update.EditedMessage != nil:
+		msg, edited = update.EditedMessage, true
+	case update.EditedChannelPost != nil:
+		msg, edited = update.EditedChannelPost, true
+	}
+	if msg == nil {
+		return nil
+	}
+
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	key := fmt.Sprintf("%d:%d", msg.Chat.Id, msg.MessageId)
+
+	var edit *EditInfo
+	if edited {
+		if previous, ok := t.cache.get(key); ok {
+			edit = &EditInfo{
+				PreviousText: previous.(string),
+				Diff:         diffText(previous.(string), text),
+			}
+		}
+	}
+
+	if text != "" {
+		t.cache.set(key, text)
+		t.bytes.Add(int64(len(text)))
+	}
+
+	return edit
+}
+
+// Usage returns the number of remembered texts and their total size in bytes
+func (t *EditTracker) Usage() (entries int, bytes int64) {
+	return t.cache.len(), t.bytes.Load()
+}
+
+// withEdit returns enrichment with edit attached; e may be nil
+func (e *Enrichment) withEdit(edit *EditInfo) *Enrichment {
+	if edit == nil {
+		return e
+	}
+	if e == nil {
+		e = &Enrichment{}
+	}
+	e.Edit = edit
+	return e
+}
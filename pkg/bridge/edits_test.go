@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func textUpdate(chatID, messageID int64, text string, edited bool) Update {
+	msg := &gotgbot.Message{
+		MessageId: messageID,
+		Chat:      gotgbot.Chat{Id: chatID, Type: "group"},
+		Text:      text,
+	}
+	if edited {
+		return Update{UpdateId: messageID, EditedMessage: msg}
+	}
+	return Update{UpdateId: messageID, Message: msg}
+}
+
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want EditDiff
+	}{
+		{name: "typo fix", old: "helo world", new: "hello world", want: EditDiff{Offset: 3, Removed: "", Added: "l"}},
+		{name: "appended", old: "hello", new: "hello world", want: EditDiff{Offset: 5, Removed: "", Added: " world"}},
+		{name: "replaced word", old: "buy milk today", new: "buy bread today", want: EditDiff{Offset: 4, Removed: "milk", Added: "bread"}},
+		{name: "removed", old: "hello cruel world", new: "hello world", want: EditDiff{Offset: 6, Removed: "cruel ", Added: ""}},
+		{name: "multi-byte", old: "привет 😀 мир", new: "привет 🔥 мир", want: EditDiff{Offset: 7, Removed: "😀", Added: "🔥"}},
+		{name: "unchanged", old: "same", new: "same", want: EditDiff{Offset: 4}},
+		{name: "repeated chars", old: "aaa", new: "aaaa", want: EditDiff{Offset: 3, Added: "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, diffText(tt.old, tt.new))
+		})
+	}
+}
+
+func TestEditTracker_Track(t *testing.T) {
+	t.Run("sequential edits", func(t *testing.T) {
+		tracker := NewEditTracker(10, time.Hour)
+
+		assert.Nil(t, tracker.Track(textUpdate(-1, 1, "v1", false)))
+
+		edit := tracker.Track(textUpdate(-1, 1, "v2", true))
+		require.NotNil(t, edit)
+		assert.Equal(t, "v1", edit.PreviousText)
+		assert.Equal(t, EditDiff{Offset: 1, Removed: "1", Added: "2"}, edit.Diff)
+
+		// The second edit is compared to the first edit, not the original
+		edit = tracker.Track(textUpdate(-1, 1, "v3", true))
+		require.NotNil(t, edit)
+		assert.Equal(t, "v2", edit.PreviousText)
+	})
+
+	t.Run("edit of unknown message", func(t *testing.T) {
+		tracker := NewEditTracker(10, time.Hour)
+
+		assert.Nil(t, tracker.Track(textUpdate(-1, 1, "v2", true)))
+
+		// The edited text is remembered for the next edit
+		edit := tracker.Track(textUpdate(-1, 1, "v3", true))
+		require.NotNil(t, edit)
+		assert.Equal(t, "v2", edit.PreviousText)
+	})
+
+	t.Run("edit after eviction", func(t *testing.T) {
+		tracker := NewEditTracker(2, time.Hour)
+
+		tracker.Track(textUpdate(-1, 1, "first", false))
+		tracker.Track(textUpdate(-1, 2, "second", false))
+		tracker.Track(textUpdate(-1, 3, "third", false))
+
+		assert.Nil(t, tracker.Track(textUpdate(-1, 1, "first!", true)))
+		assert.NotNil(t, tracker.Track(textUpdate(-1, 3, "third!", true)))
+	})
+
+	t.Run("edit after ttl", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		tracker := NewEditTracker(10, time.Minute)
+		tracker.cache.now = func() time.Time { return now }
+
+		tracker.Track(textUpdate(-1, 1, "v1", false))
+		now = now.Add(time.Minute)
+		assert.Nil(t, tracker.Track(textUpdate(-1, 1, "v2", true)))
+	})
+
+	t.Run("same message id in different chats", func(t *testing.T) {
+		tracker := NewEditTracker(10, time.Hour)
+
+		tracker.Track(textUpdate(-1, 1, "chat one", false))
+		tracker.Track(textUpdate(-2, 1, "chat two", false))
+
+		edit := tracker.Track(textUpdate(-1, 1, "chat one!", true))
+		require.NotNil(t, edit)
+		assert.Equal(t, "chat one", edit.PreviousText)
+	})
+
+	t.Run("channel post caption", func(t *testing.T) {
+		tracker := NewEditTracker(10, time.Hour)
+
+		post := &gotgbot.Message{MessageId: 5, Chat: gotgbot.Chat{Id: -100, Type: "channel"}, Caption: "photo"}
+		tracker.Track(Update{UpdateId: 1, ChannelPost: post})
+
+		edited := *post
+		edited.Caption = "photo of a cat"
+		edit := tracker.Track(Update{UpdateId: 2, EditedChannelPost: &edited})
+		require.NotNil(t, edit)
+		assert.Equal(t, "photo", edit.PreviousText)
+		assert.Equal(t, " of a cat", edit.Diff.Added)
+	})
+}
+
+func TestEditTracker_Usage(t *testing.T) {
+	tracker := NewEditTracker(2, time.Hour)
+
+	tracker.Track(textUpdate(-1, 1, "abc", false))
+	tracker.Track(textUpdate(-1, 2, "привет", false)) // 12 bytes
+	entries, bytes := tracker.Usage()
+	assert.Equal(t, 2, entries)
+	assert.Equal(t, int64(15), bytes)
+
+	// Replacing an entry accounts only the new text
+	tracker.Track(textUpdate(-1, 1, "abcd", true))
+	entries, bytes = tracker.Usage()
+	assert.Equal(t, 2, entries)
+	assert.Equal(t, int64(16), bytes)
+
+	// Evicted entries are not counted
+	tracker.Track(textUpdate(-1, 3, "x", false))
+	entries, bytes = tracker.Usage()
+	assert.Equal(t, 2, entries)
+	assert.Equal(t, int64(5), bytes)
+}
+
+func TestEnrichment_WithEdit(t *testing.T) {
+	var enriched *Enrichment
+	assert.Nil(t, enriched.withEdit(nil))
+
+	enriched = enriched.withEdit(&EditInfo{PreviousText: "v1", Diff: EditDiff{Offset: 1, Removed: "1", Added: "2"}})
+	require.NotNil(t, enriched)
+
+	data, err := json.Marshal(publishedUpdate(textUpdate(-1, 1, "v2", true), enriched))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"_enriched":{"edit":{"previous_text":"v1","diff":{"offset":1,"removed":"1","added":"2"}}}`)
+}
+
+func TestEditDestinations(t *testing.T) {
+	response := &Response{Text: "noted"}
+	dests := []Destination{
+		{Subject: "telegram.messages", Stream: "EVENTS"},
+		{Subject: "telegram.commands", Request: true},
+		{Subject: "telegram.replied", Response: response},
+		{RespondOnly: true, Response: response},
+	}
+
+	t.Run("duplicate", func(t *testing.T) {
+		assert.Equal(t, []Destination{
+			{Subject: "telegram.messages", Stream: "EVENTS"},
+			{Subject: "telegram.messages.edits", Stream: "EVENTS"},
+			{Subject: "telegram.commands", Request: true},
+			{Subject: "telegram.replied", Response: response},
+			{Subject: "telegram.replied.edits"},
+			{RespondOnly: true, Response: response},
+		}, editDestinations(EditSubjectsDuplicate, dests))
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		assert.Equal(t, []Destination{
+			{Subject: "telegram.messages.edits", Stream: "EVENTS"},
+			{Subject: "telegram.commands", Request: true},
+			{Subject: "telegram.replied", Response: response, RespondOnly: true},
+			{Subject: "telegram.replied.edits"},
+			{RespondOnly: true, Response: response},
+		}, editDestinations(EditSubjectsRedirect, dests))
+	})
+}
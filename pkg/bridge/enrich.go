@@ -0,0 +1,369 @@
+package bridge
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"golang.org/x/sync/singleflight"
+)
+
+// chatFetcher fetches chat data from Bot API for enrichment
+type chatFetcher interface {
+	GetChat(ctx context.Context, chatID int64) (*gotgbot.ChatFullInfo, error)
+	GetChatMember(ctx context.Context, chatID int64, userID int64) (*gotgbot.MergedChatMember, error)
+}
+
+// Enrichment is Bot API data attached to an update. Expressions see it as
+// enriched, published updates carry it under _enriched.
+type Enrichment struct {
+	Chat       *gotgbot.ChatFullInfo     `json:"chat,omitempty"`
+	ChatMember *gotgbot.MergedChatMember `json:"chat_member,omitempty"`
+	// Edit is set for edited messages when edit_tracking is enabled
+	Edit *EditInfo `json:"edit,omitempty"`
+}
+
+// EnrichedUpdate is published instead of the bare update when enrichment is attached
+type EnrichedUpdate struct {
+	Update
+	Enriched *Enrichment `json:"_enriched,omitempty"`
+}
+
+// publishedUpdate returns the update itself or the update with enrichment attached
+func publishedUpdate(update Update, enriched *Enrichment) interface{} {
+	if enriched == nil {
+		return update
+	}
+	return EnrichedUpdate{Update: update, Enriched: enriched}
+}
+
+// unwrapUpdate returns the update from a value built by publishedUpdate or
+// transcribedUpdate or a PayloadEnvelope, possibly wrapped with the bot
+// identity, StringIDsPayload and ScrubbedPayload
+func unwrapUpdate(data interface{}) Update {
+	if scrubbed, ok := data.(ScrubbedPayload); ok {
+		data = scrubbed.Payload
+	}
+	if stringIDs, ok := data.(StringIDsPayload); ok {
+		data = stringIDs.Payload
+	}
+	if wrapped, ok := data.(BotWrappedUpdate); ok {
+		data = wrapped.Update
+	}
+	if envelope, ok := data.(PayloadEnvelope); ok {
+		return envelope.Update
+	}
+	if enriched, ok := data.(EnrichedUpdate); ok {
+		return enriched.Update
+	}
+	if transcribed, ok := data.(TranscribedUpdate); ok {
+		return transcribed.Update
+	}
+	return data.(Update)
+}
+
+// defaultLookupTimeout bounds how long routing waits for a cold lookup
+const defaultLookupTimeout = 200 * time.Millisecond
+
+// groupAnonymousBotID is the sender of messages posted by anonymous group admins
+const groupAnonymousBotID = 1087968824
+
+// errLookupSlow is returned for a lookup still running after the lookup timeout
+var errLookupSlow = errors.New("lookup is slow, continuing in background")
+
+// Enricher fetches chat and chat member info for updates. Results are cached
+// for ttl, so Bot API is called once per chat (and member) per ttl.
+type Enricher struct {
+	fetcher       chatFetcher
+	cache         *ttlCache
+	group         singleflight.Group
+	lookupTimeout time.Duration
+	logger        *slog.Logger
+}
+
+// NewEnricher creates a new Enricher
+func NewEnricher(fetcher chatFetcher, cacheSize int, ttl time.Duration, logger *slog.Logger) *Enricher {
+	return &Enricher{
+		fetcher:       fetcher,
+		cache:         newTTLCache(cacheSize, ttl),
+		lookupTimeout: defaultLookupTimeout,
+		logger:        logger,
+	}
+}
+
+// SetLookupTimeout sets how long an uncached getChat or getChatMember is waited for
+func (e *Enricher) SetLookupTimeout(timeout time.Duration) {
+	e.lookupTimeout = timeout
+}
+
+// Enrich adds the given kinds to enriched, which may be nil, and returns it
+// or nil if there is nothing to add. API failures and slow lookups are
+// logged and the part is left out.
+func (e *Enricher) Enrich(ctx context.Context, update Update, enriched *Enrichment, kinds []EnrichKind) *Enrichment {
+	chat := updateChat(update)
+	if chat == nil || len(kinds) == 0 {
+		return enriched
+	}
+	var result Enrichment
+	if enriched != nil {
+		result = *enriched
+	}
+
+	if slices.Contains(kinds, EnrichChat) && result.Chat == nil {
+		chatID := chat.Id
+		value, err := e.lookup(ctx, fmt.Sprintf("chat:%d", chatID), func(ctx context.Context) (interface{}, error) {
+			return e.fetcher.GetChat(ctx, chatID)
+		})
+		if err != nil {
+			e.logLookupError("failed to enrich update with chat", err, "chat_id", chatID)
+		} else {
+			result.Chat = value.(*gotgbot.ChatFullInfo)
+		}
+	}
+
+	if sender := updateSender(update); slices.Contains(kinds, EnrichChatMember) && result.ChatMember == nil && sender != nil {
+		chatID, userID := chat.Id, sender.Id
+		value, err := e.lookup(ctx, chatMemberKey(chatID, userID), func(ctx context.Context) (interface{}, error) {
+			return e.fetcher.GetChatMember(ctx, chatID, userID)
+		})
+		if err != nil {
+			e.logLookupError("failed to enrich update with chat member", err, "chat_id", chatID, "user_id", userID)
+		} else {
+			result.ChatMember = value.(*gotgbot.MergedChatMember)
+		}
+	}
+
+	if result == (Enrichment{}) {
+		return nil
+	}
+	return &result
+}
+
+// only returns the enrichment limited to kinds, the edit is kept. Routes get
+// only the data they asked for even if another route made it fetched.
+func (e *Enrichment) only(kinds []EnrichKind) *Enrichment {
+	if e == nil {
+		return nil
+	}
+	result := Enrichment{Edit: e.Edit}
+	if slices.Contains(kinds, EnrichChat) {
+		result.Chat = e.Chat
+	}
+	if slices.Contains(kinds, EnrichChatMember) {
+		result.ChatMember = e.ChatMember
+	}
+	if result == (Enrichment{}) {
+		return nil
+	}
+	return &result
+}
+
+// destinationEnrichKinds returns kinds requested by destinations except fetched
+func destinationEnrichKinds(destinations []Destination, fetched []EnrichKind) []EnrichKind {
+	var kinds []EnrichKind
+	for _, dest := range destinations {
+		for _, kind := range dest.Enrich {
+			if !slices.Contains(fetched, kind) && !slices.Contains(kinds, kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	return kinds
+}
+
+// readsEnriched reports whether any expression of the route reads enriched,
+// such a route needs the data before it is evaluated
+func readsEnriched(route Route) bool {
+	for _, expression := range routeExpressions(route) {
+		tree, err := parser.Parse(expression.value)
+		if err != nil {
+			continue
+		}
+		found := ast.Find(tree.Node, func(node ast.Node) bool {
+			ident, ok := node.(*ast.IdentifierNode)
+			return ok && ident.Value == "enriched"
+		})
+		if found != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the sender is an administrator or the creator of
+// the chat. Private chats, anonymous senders and API errors give false.
+// Routing can't wait for Bot API, so an uncached lookup is awaited for at most
+// the lookup timeout; after that false is returned and the lookup finishes in
+// background, so later updates from the same sender see the cached status.
+func (e *Enricher) IsAdmin(update Update) bool {
+	chat := updateChat(update)
+	sender := updateSender(update)
+	if chat == nil || sender == nil || chat.Type == "private" {
+		return false
+	}
+	if msg := updateMessage(update); msg != nil && msg.SenderChat != nil {
+		return false
+	}
+	if sender.Id == groupAnonymousBotID {
+		return false
+	}
+
+	chatID, userID := chat.Id, sender.Id
+	value, err := e.lookup(context.Background(), chatMemberKey(chatID, userID), func(ctx context.Context) (interface{}, error) {
+		return e.fetcher.GetChatMember(ctx, chatID, userID)
+	})
+	if err != nil {
+		e.logLookupError("failed to check chat admin", err, "chat_id", chatID, "user_id", userID)
+		return false
+	}
+	return isAdminStatus(value.(*gotgbot.MergedChatMember).Status)
+}
+
+// logLookupError logs a failed lookup, a slow one only at debug level
+func (e *Enricher) logLookupError(msg string, err error, args ...any) {
+	if errors.Is(err, errLookupSlow) {
+		e.logger.Debug("Bot API lookup is slow, continuing in background", args...)
+		return
+	}
+	e.logger.Warn(msg, append(args, "error", err)...)
+}
+
+func isAdminStatus(status string) bool {
+	return status == "administrator" || status == "creator"
+}
+
+func chatMemberKey(chatID, userID int64) string {
+	return fmt.Sprintf("chat_member:%d:%d", chatID, userID)
+}
+
+// lookup returns the cached value for key or calls fn once for concurrent
+// callers, waiting at most the lookup timeout. A slow fn finishes in
+// background and caches its result for later updates. Errors are not cached.
+func (e *Enricher) lookup(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if value, ok := e.cache.get(key); ok {
+		return value, nil
+	}
+
+	result := e.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+
+		value, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		e.cache.set(key, value)
+		return value, nil
+	})
+
+	timer := time.NewTimer(e.lookupTimeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-result:
+		return r.Val, r.Err
+	case <-timer.C:
+		return nil, errLookupSlow
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ttlCache is a size-bounded cache with per-entry expiration.
+// When full, the least recently set entry is evicted.
+type ttlCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+	// onRemove is called with the value of every entry leaving the cache
+	onRemove func(value interface{})
+}
+
+type ttlEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newTTLCache(size int, ttl time.Duration) *ttlCache {
+	return &ttlCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *ttlCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*ttlEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+func (c *ttlCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	for c.order.Len() >= c.size {
+		c.remove(c.order.Front())
+	}
+
+	c.entries[key] = c.order.PushBack(&ttlEntry{
+		key:     key,
+		value:   value,
+		expires: c.now().Add(c.ttl),
+	})
+}
+
+func (c *ttlCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// remove deletes elem; c.mu must be held
+func (c *ttlCache) remove(elem *list.Element) {
+	entry := elem.Value.(*ttlEntry)
+	c.order.Remove(elem)
+	delete(c.entries, entry.key)
+	if c.onRemove != nil {
+		c.onRemove(entry.value)
+	}
+}
+
+func (c *ttlCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
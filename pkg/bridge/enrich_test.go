@@ -0,0 +1,319 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockChatFetcher struct {
+	mu          sync.Mutex
+	chatCalls   int
+	memberCalls int
+	err         error
+	status      string
+	delay       time.Duration
+}
+
+func (m *mockChatFetcher) GetChat(ctx context.Context, chatID int64) (*gotgbot.ChatFullInfo, error) {
+	time.Sleep(m.delay)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chatCalls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &gotgbot.ChatFullInfo{Id: chatID, Type: "supergroup", Title: "Team"}, nil
+}
+
+func (m *mockChatFetcher) GetChatMember(ctx context.Context, chatID int64, userID int64) (*gotgbot.MergedChatMember, error) {
+	time.Sleep(m.delay)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.memberCalls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	status := m.status
+	if status == "" {
+		status = "administrator"
+	}
+	return &gotgbot.MergedChatMember{Status: status, User: gotgbot.User{Id: userID}}, nil
+}
+
+func (m *mockChatFetcher) calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.memberCalls
+}
+
+func messageUpdate(chatID, userID int64) Update {
+	return Update{
+		UpdateId: 1,
+		Message: &gotgbot.Message{
+			Chat: gotgbot.Chat{Id: chatID, Type: "supergroup"},
+			From: &gotgbot.User{Id: userID},
+			Text: "hello",
+		},
+	}
+}
+
+func TestEnricher_Enrich(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Run("chat and chat member", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		kinds := []EnrichKind{EnrichChat, EnrichChatMember}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		enriched := enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds)
+		require.NotNil(t, enriched)
+		assert.Equal(t, "Team", enriched.Chat.Title)
+		assert.Equal(t, "administrator", enriched.ChatMember.Status)
+		assert.Equal(t, int64(42), enriched.ChatMember.User.Id)
+	})
+
+	t.Run("only requested kinds", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		kinds := []EnrichKind{EnrichChat}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		enriched := enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds)
+		require.NotNil(t, enriched)
+		assert.NotNil(t, enriched.Chat)
+		assert.Nil(t, enriched.ChatMember)
+		assert.Equal(t, 0, fetcher.memberCalls)
+	})
+
+	t.Run("cached per chat", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		kinds := []EnrichKind{EnrichChat, EnrichChatMember}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds)
+		enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds)
+		enricher.Enrich(context.Background(), messageUpdate(-100, 43), nil, kinds)
+		enricher.Enrich(context.Background(), messageUpdate(-200, 42), nil, kinds)
+
+		assert.Equal(t, 2, fetcher.chatCalls)
+		assert.Equal(t, 3, fetcher.memberCalls)
+	})
+
+	t.Run("api failure degrades to un-enriched", func(t *testing.T) {
+		fetcher := &mockChatFetcher{err: errors.New("Bad Request: chat not found")}
+		kinds := []EnrichKind{EnrichChat, EnrichChatMember}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		assert.Nil(t, enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds))
+
+		// Failures are not cached
+		fetcher.err = nil
+		assert.NotNil(t, enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds))
+		assert.Equal(t, 2, fetcher.chatCalls)
+	})
+
+	t.Run("adds missing kinds", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		enriched := enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, []EnrichKind{EnrichChat})
+		enriched = enricher.Enrich(context.Background(), messageUpdate(-100, 42), enriched, []EnrichKind{EnrichChatMember})
+		require.NotNil(t, enriched)
+		assert.NotNil(t, enriched.Chat)
+		assert.NotNil(t, enriched.ChatMember)
+		assert.Equal(t, 1, fetcher.chatCalls)
+		assert.Equal(t, 1, fetcher.memberCalls)
+	})
+
+	t.Run("slow lookup is bounded", func(t *testing.T) {
+		fetcher := &mockChatFetcher{delay: 100 * time.Millisecond}
+		kinds := []EnrichKind{EnrichChat}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+		enricher.SetLookupTimeout(10 * time.Millisecond)
+
+		start := time.Now()
+		assert.Nil(t, enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds))
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+		// The lookup finishes in background for later updates
+		assert.Eventually(t, func() bool {
+			return enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds) != nil
+		}, time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("update without chat", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		kinds := []EnrichKind{EnrichChat, EnrichChatMember}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		update := Update{UpdateId: 1, InlineQuery: &gotgbot.InlineQuery{Id: "1"}}
+		assert.Nil(t, enricher.Enrich(context.Background(), update, nil, kinds), nil, kinds)
+		assert.Equal(t, 0, fetcher.chatCalls)
+	})
+}
+
+func TestEnrichment_Only(t *testing.T) {
+	enriched := &Enrichment{
+		Chat:       &gotgbot.ChatFullInfo{Id: -100},
+		ChatMember: &gotgbot.MergedChatMember{Status: "member"},
+	}
+
+	assert.Equal(t, &Enrichment{Chat: enriched.Chat}, enriched.only([]EnrichKind{EnrichChat}))
+	assert.Equal(t, enriched, enriched.only([]EnrichKind{EnrichChat, EnrichChatMember}))
+	assert.Nil(t, enriched.only(nil))
+
+	// Edit tracking is not a route enrichment and is always kept
+	edit := &EditInfo{PreviousText: "hi"}
+	assert.Equal(t, &Enrichment{Edit: edit}, (&Enrichment{Chat: enriched.Chat, Edit: edit}).only(nil))
+
+	var none *Enrichment
+	assert.Nil(t, none.only([]EnrichKind{EnrichChat}))
+}
+
+func TestReadsEnriched(t *testing.T) {
+	assert.True(t, readsEnriched(Route{Condition: `enriched.Chat != nil`}))
+	assert.True(t, readsEnriched(Route{
+		Condition: "true",
+		Subject:   &RouteSubject{Type: SubjectTypeExpr, Value: `"chats." + enriched.Chat.Username`},
+	}))
+	assert.False(t, readsEnriched(Route{Condition: `update.Message != nil`, Enrich: []EnrichKind{EnrichChat}}))
+}
+
+func TestEnricher_IsAdmin(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Run("admin and creator", func(t *testing.T) {
+		for _, status := range []string{"administrator", "creator"} {
+			enricher := NewEnricher(&mockChatFetcher{status: status}, 10, time.Minute, logger)
+			assert.True(t, enricher.IsAdmin(messageUpdate(-100, 42)), status)
+		}
+	})
+
+	t.Run("member", func(t *testing.T) {
+		enricher := NewEnricher(&mockChatFetcher{status: "member"}, 10, time.Minute, logger)
+		assert.False(t, enricher.IsAdmin(messageUpdate(-100, 42)))
+	})
+
+	t.Run("warm cache", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		assert.True(t, enricher.IsAdmin(messageUpdate(-100, 42)))
+		assert.True(t, enricher.IsAdmin(messageUpdate(-100, 42)))
+		assert.Equal(t, 1, fetcher.calls())
+	})
+
+	t.Run("shares cache with enrichment", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		kinds := []EnrichKind{EnrichChatMember}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		enricher.Enrich(context.Background(), messageUpdate(-100, 42), nil, kinds)
+		assert.True(t, enricher.IsAdmin(messageUpdate(-100, 42)))
+		assert.Equal(t, 1, fetcher.calls())
+	})
+
+	t.Run("cold lookup fills cache in background", func(t *testing.T) {
+		fetcher := &mockChatFetcher{delay: 100 * time.Millisecond}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+		enricher.SetLookupTimeout(10 * time.Millisecond)
+
+		start := time.Now()
+		assert.False(t, enricher.IsAdmin(messageUpdate(-100, 42)))
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+		assert.Eventually(t, func() bool {
+			return enricher.IsAdmin(messageUpdate(-100, 42))
+		}, time.Second, 20*time.Millisecond)
+		assert.Equal(t, 1, fetcher.calls())
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		enricher := NewEnricher(&mockChatFetcher{err: errors.New("Bad Request: user not found")}, 10, time.Minute, logger)
+		assert.False(t, enricher.IsAdmin(messageUpdate(-100, 42)))
+	})
+
+	t.Run("private chat", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		update := messageUpdate(42, 42)
+		update.Message.Chat.Type = "private"
+		assert.False(t, enricher.IsAdmin(update))
+		assert.Equal(t, 0, fetcher.calls())
+	})
+
+	t.Run("anonymous sender", func(t *testing.T) {
+		fetcher := &mockChatFetcher{}
+		enricher := NewEnricher(fetcher, 10, time.Minute, logger)
+
+		update := messageUpdate(-100, groupAnonymousBotID)
+		update.Message.SenderChat = &gotgbot.Chat{Id: -100, Type: "supergroup"}
+		assert.False(t, enricher.IsAdmin(update))
+		assert.Equal(t, 0, fetcher.calls())
+	})
+}
+
+func TestTTLCache(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	cache := newTTLCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.set("a", 1)
+	value, ok := cache.get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	t.Run("expires after ttl", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		_, ok := cache.get("a")
+		assert.False(t, ok)
+		assert.Equal(t, 0, cache.len())
+	})
+
+	t.Run("evicts oldest when full", func(t *testing.T) {
+		cache.set("a", 1)
+		cache.set("b", 2)
+		cache.set("c", 3)
+
+		assert.Equal(t, 2, cache.len())
+		_, ok := cache.get("a")
+		assert.False(t, ok)
+		_, ok = cache.get("c")
+		assert.True(t, ok)
+	})
+}
+
+func TestEnrichedUpdate_JSON(t *testing.T) {
+	update := messageUpdate(-100, 42)
+
+	data, err := json.Marshal(publishedUpdate(update, &Enrichment{
+		Chat: &gotgbot.ChatFullInfo{Id: -100, Type: "supergroup", Title: "Team"},
+	}))
+	require.NoError(t, err)
+
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &payload))
+	assert.Equal(t, float64(1), payload["update_id"])
+	assert.Contains(t, payload, "message")
+	assert.Equal(t, "Team", payload["_enriched"].(map[string]interface{})["chat"].(map[string]interface{})["title"])
+
+	assert.Equal(t, update, unwrapUpdate(publishedUpdate(update, nil)))
+	assert.Equal(t, update, unwrapUpdate(publishedUpdate(update, &Enrichment{})))
+}
@@ -0,0 +1,117 @@
+package bridge
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// updateMessage returns the message carried by the update, or nil
+func updateMessage(update Update) *gotgbot.Message {
+	switch {
+	case update.Message != nil:
+		return update.Message
+	case update.EditedMessage != nil:
+		return update.EditedMessage
+	case update.ChannelPost != nil:
+		return update.ChannelPost
+	case update.EditedChannelPost != nil:
+		return update.EditedChannelPost
+	case update.BusinessMessage != nil:
+		return update.BusinessMessage
+	case update.EditedBusinessMessage != nil:
+		return update.EditedBusinessMessage
+	}
+	return nil
+}
+
+// messageEntities returns the message text (or caption) with its entities
+func messageEntities(update Update) (string, []gotgbot.MessageEntity) {
+	msg := updateMessage(update)
+	if msg == nil {
+		return "", nil
+	}
+	if msg.Text != "" {
+		return msg.Text, msg.Entities
+	}
+	return msg.Caption, msg.CaptionEntities
+}
+
+// hasEntity reports whether the message text or caption contains an entity
+// of the given type (e.g. "bot_command", "hashtag", "url")
+func hasEntity(update Update, entityType string) bool {
+	_, entities := messageEntities(update)
+	for _, entity := range entities {
+		if entity.Type == entityType {
+			return true
+		}
+	}
+	return false
+}
+
+// entityText returns the text of the index-th entity of the given type,
+// or empty string if there is no such entity
+func entityText(update Update, entityType string, index int) string {
+	text, entities := messageEntities(update)
+
+	for _, entity := range entities {
+		if entity.Type != entityType {
+			continue
+		}
+		if index > 0 {
+			index--
+			continue
+		}
+		return utf16Slice(text, entity.Offset, entity.Length)
+	}
+	return ""
+}
+
+// botCommand parses the bot_command entity at offset 0 of the message text
+// (or caption): "/start@my_bot arg" gives name "start", username "my_bot"
+// and args "arg". ok is false when the message doesn't start with a command.
+func botCommand(update Update) (name, username, args string, ok bool) {
+	text, entities := messageEntities(update)
+	if len(entities) == 0 || entities[0].Type != "bot_command" || entities[0].Offset != 0 {
+		return "", "", "", false
+	}
+
+	command := strings.TrimPrefix(utf16Slice(text, 0, entities[0].Length), "/")
+	name, username, _ = strings.Cut(command, "@")
+	args = strings.TrimSpace(utf16Slice(text, entities[0].Length, int64(len(text))))
+	return name, username, args, true
+}
+
+// commandHelpers returns the command and commandArgs helpers. With
+// botUsername set commands addressed to another bot (/start@other_bot) are
+// ignored, otherwise any @username suffix is accepted.
+func commandHelpers(botUsername string) (command, commandArgs func(Update) string) {
+	parse := func(update Update) (string, string) {
+		name, username, args, ok := botCommand(update)
+		if !ok || (username != "" && botUsername != "" && !strings.EqualFold(username, botUsername)) {
+			return "", ""
+		}
+		return name, args
+	}
+	command = func(update Update) string {
+		name, _ := parse(update)
+		return name
+	}
+	commandArgs = func(update Update) string {
+		_, args := parse(update)
+		return args
+	}
+	return command, commandArgs
+}
+
+// utf16Slice cuts text by offset and length in UTF-16 code units, as
+// Telegram counts entity offsets. Out of range bounds are clamped.
+func utf16Slice(text string, offset, length int64) string {
+	units := utf16.Encode([]rune(text))
+
+	start := min(max(offset, 0), int64(len(units)))
+	end := min(max(offset+length, start), int64(len(units)))
+
+	return string(utf16.Decode(units[start:end]))
+}
@@ -0,0 +1,178 @@
+package bridge
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityText(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     string
+		entityType string
+		index      int
+		want       string
+	}{
+		{
+			name:       "ascii bot command",
+			update:     `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"/start now","entities":[{"type":"bot_command","offset":0,"length":6}]}}`,
+			entityType: "bot_command",
+			want:       "/start",
+		},
+		{
+			// "Привет " is 7 UTF-16 units but 13 bytes
+			name:       "cyrillic before hashtag",
+			update:     `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"Привет #новости","entities":[{"type":"hashtag","offset":7,"length":8}]}}`,
+			entityType: "hashtag",
+			want:       "#новости",
+		},
+		{
+			// Each emoji outside the BMP is a surrogate pair: 2 UTF-16 units, 1 rune
+			name:       "emoji before hashtag",
+			update:     `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"😀😀 #go","entities":[{"type":"hashtag","offset":5,"length":3}]}}`,
+			entityType: "hashtag",
+			want:       "#go",
+		},
+		{
+			name:       "emoji inside entity",
+			update:     `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"a 🔥hot🔥 b","entities":[{"type":"bold","offset":2,"length":7}]}}`,
+			entityType: "bold",
+			want:       "🔥hot🔥",
+		},
+		{
+			name:       "second entity of type",
+			update:     `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"#a /cmd #b","entities":[{"type":"hashtag","offset":0,"length":2},{"type":"bot_command","offset":3,"length":4},{"type":"hashtag","offset":8,"length":2}]}}`,
+			entityType: "hashtag",
+			index:      1,
+			want:       "#b",
+		},
+		{
+			name:       "index out of range",
+			update:     `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"#a","entities":[{"type":"hashtag","offset":0,"length":2}]}}`,
+			entityType: "hashtag",
+			index:      1,
+			want:       "",
+		},
+		{
+			name:       "caption entities",
+			update:     `{"update_id":1,"channel_post":{"message_id":1,"date":1,"chat":{"id":-100,"type":"channel"},"caption":"фото #cats","caption_entities":[{"type":"hashtag","offset":5,"length":5}]}}`,
+			entityType: "hashtag",
+			want:       "#cats",
+		},
+		{
+			name:       "entity past end of text",
+			update:     `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"#go","entities":[{"type":"hashtag","offset":0,"length":10}]}}`,
+			entityType: "hashtag",
+			want:       "#go",
+		},
+		{
+			name:       "not a message",
+			update:     `{"update_id":1,"callback_query":{"id":"1","from":{"id":1,"is_bot":false,"first_name":"User"},"chat_instance":"1"}}`,
+			entityType: "hashtag",
+			want:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update Update
+			require.NoError(t, json.Unmarshal([]byte(tt.update), &update))
+			assert.Equal(t, tt.want, entityText(update, tt.entityType, tt.index))
+		})
+	}
+}
+
+func TestHasEntity(t *testing.T) {
+	var update Update
+	require.NoError(t, json.Unmarshal([]byte(`{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"/help me","entities":[{"type":"bot_command","offset":0,"length":5}]}}`), &update))
+
+	assert.True(t, hasEntity(update, "bot_command"))
+	assert.False(t, hasEntity(update, "hashtag"))
+	assert.False(t, hasEntity(Update{UpdateId: 1}, "bot_command"))
+}
+
+func TestCommandHelpers(t *testing.T) {
+	message := func(text string, commandLength int) string {
+		return `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"` + text +
+			`","entities":[{"type":"bot_command","offset":0,"length":` + strconv.Itoa(commandLength) + `}]}}`
+	}
+
+	tests := []struct {
+		name        string
+		update      string
+		botUsername string
+		wantCommand string
+		wantArgs    string
+	}{
+		{
+			name:        "command with args",
+			update:      message("/start ref_42  now", 6),
+			wantCommand: "start",
+			wantArgs:    "ref_42  now",
+		},
+		{
+			name:        "command without args",
+			update:      message("/help", 5),
+			wantCommand: "help",
+		},
+		{
+			name:        "addressed to the bot",
+			update:      message("/cmd@my_bot arg", 11),
+			botUsername: "my_bot",
+			wantCommand: "cmd",
+			wantArgs:    "arg",
+		},
+		{
+			name:        "username case is ignored",
+			update:      message("/cmd@My_Bot arg", 11),
+			botUsername: "my_bot",
+			wantCommand: "cmd",
+			wantArgs:    "arg",
+		},
+		{
+			name:        "addressed to another bot",
+			update:      message("/cmd@other_bot arg", 14),
+			botUsername: "my_bot",
+		},
+		{
+			name:        "any bot without username",
+			update:      message("/cmd@other_bot arg", 14),
+			wantCommand: "cmd",
+			wantArgs:    "arg",
+		},
+		{
+			// "Привет" counts in UTF-16 units like entity offsets
+			name:        "cyrillic args",
+			update:      message("/say Привет", 4),
+			wantCommand: "say",
+			wantArgs:    "Привет",
+		},
+		{
+			name:   "command not at the start",
+			update: `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"see /help","entities":[{"type":"bot_command","offset":4,"length":5}]}}`,
+		},
+		{
+			name:   "plain text",
+			update: `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"/start"}}`,
+		},
+		{
+			name:   "no message",
+			update: `{"update_id":1,"callback_query":{"id":"1","from":{"id":1,"is_bot":false,"first_name":"A"},"chat_instance":"1","data":"/start"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update Update
+			require.NoError(t, json.Unmarshal([]byte(tt.update), &update))
+
+			command, commandArgs := commandHelpers(tt.botUsername)
+			assert.Equal(t, tt.wantCommand, command(update))
+			assert.Equal(t, tt.wantArgs, commandArgs(update))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package bridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// fakeTelegram returns the given updates from the first poll and blocks
+// later polls until ctx is done. Other methods are not used by the example.
+type fakeTelegram struct {
+	bridge.TelegramClientInterface
+
+	mu      sync.Mutex
+	updates []bridge.Update
+}
+
+func (f *fakeTelegram) GetMe(ctx context.Context) (*gotgbot.User, error) {
+	return &gotgbot.User{Id: 42, IsBot: true, FirstName: "Example", Username: "example_bot"}, nil
+}
+
+func (f *fakeTelegram) GetUpdatesWithTimeout(ctx context.Context, offset int64, timeout int) ([]bridge.Update, int64, error) {
+	f.mu.Lock()
+	updates := f.updates
+	f.updates = nil
+	f.mu.Unlock()
+
+	if len(updates) == 0 {
+		<-ctx.Done()
+		return nil, offset, ctx.Err()
+	}
+	return updates, updates[len(updates)-1].UpdateId + 1, nil
+}
+
+// fakeBroker hands published payloads to onPublish
+type fakeBroker struct {
+	onPublish func(subject string, payload []byte)
+}
+
+func (b *fakeBroker) Connect(ctx context.Context) error { return nil }
+
+func (b *fakeBroker) Publish(ctx context.Context, dest bridge.Destination, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	b.onPublish(dest.Subject, payload)
+	return nil
+}
+
+func (b *fakeBroker) Close() error { return nil }
+
+// Run embeds the bridge with clients of its own, here fakes
+func ExampleRun() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfg, err := bridge.LoadConfigStruct(&bridge.Config{
+		TelegramToken: "unused",
+		NATS:          &bridge.NATSConfig{URL: "nats://unused:4222"},
+		Routes: []bridge.Route{{
+			Condition: "update.Message != nil",
+			Subject:   &bridge.RouteSubject{Type: bridge.SubjectTypeString, Value: "telegram.messages"},
+		}},
+	}, logger)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	telegram := &fakeTelegram{updates: []bridge.Update{{
+		UpdateId: 1,
+		Message: &gotgbot.Message{
+			MessageId: 7,
+			Chat:      gotgbot.Chat{Id: 100, Type: "private"},
+			Text:      "hello",
+		},
+	}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := &fakeBroker{onPublish: func(subject string, payload []byte) {
+		var envelope bridge.PayloadEnvelope
+		if err := json.Unmarshal(payload, &envelope); err == nil {
+			fmt.Println(subject, envelope.Update.Message.Text)
+		}
+		// Stop after the first publication
+		cancel()
+	}}
+
+	err = bridge.Run(ctx, cfg, bridge.Options{Logger: logger, Telegram: telegram, Broker: broker})
+	fmt.Println("stopped:", err)
+	// Output:
+	// telegram.messages hello
+	// stopped: <nil>
+}
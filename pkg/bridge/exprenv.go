@@ -0,0 +1,122 @@
+package bridge
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// exprEnvName is what an environment variable name listed in expr_env must look like
+var exprEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// lookupExprEnv returns values of the allowed environment variables that are
+// set, numbers are converted so they compare with ids and counters
+func lookupExprEnv(names []string) map[string]interface{} {
+	vars := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			vars[name] = coerceEnvValue(value)
+		}
+	}
+	return vars
+}
+
+// coerceEnvValue converts integers to int64 and other finite numbers to
+// float64, anything else stays a string
+func coerceEnvValue(value string) interface{} {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return value
+}
+
+// envRefsVisitor collects names used as env.NAME or env["NAME"]
+type envRefsVisitor struct {
+	names []string
+}
+
+func (v *envRefsVisitor) Visit(node *ast.Node) {
+	member, ok := (*node).(*ast.MemberNode)
+	if !ok {
+		return
+	}
+	if ident, ok := member.Node.(*ast.IdentifierNode); !ok || ident.Value != "env" {
+		return
+	}
+	if name, ok := member.Property.(*ast.StringNode); ok && !slices.Contains(v.names, name.Value) {
+		v.names = append(v.names, name.Value)
+	}
+}
+
+// exprEnvRefs returns environment variables referenced by the expression
+func exprEnvRefs(expression string) ([]string, error) {
+	tree, err := parser.Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	visitor := &envRefsVisitor{}
+	ast.Walk(&tree.Node, visitor)
+	return visitor.names, nil
+}
+
+// routeExpression is an expression of a route and the config field holding it
+type routeExpression struct {
+	field string
+	value string
+}
+
+// routeExpressions returns the expressions of a route
+func routeExpressions(route Route) []routeExpression {
+	expressions := []routeExpression{{"condition", route.Condition}}
+	if route.Subject != nil && route.Subject.Type == SubjectTypeExpr {
+		expressions = append(expressions, routeExpression{"subject", route.Subject.Value})
+	}
+	if route.Topic != nil && route.Topic.Type == SubjectTypeExpr {
+		expressions = append(expressions, routeExpression{"topic", route.Topic.Value})
+	}
+	if route.Key != nil && route.Key.Type == SubjectTypeExpr {
+		expressions = append(expressions, routeExpression{"key", route.Key.Value})
+	}
+	if route.ShadowSubject != nil && route.ShadowSubject.Type == SubjectTypeExpr {
+		expressions = append(expressions, routeExpression{"shadow_subject", route.ShadowSubject.Value})
+	}
+	if route.Respond != nil && route.Respond.TextExpr != "" {
+		expressions = append(expressions, routeExpression{"respond.text_expr", route.Respond.TextExpr})
+	}
+	return expressions
+}
+
+// checkExprEnvRefs makes sure enabled routes reference only environment
+// variables listed in allowed and set in the environment
+func checkExprEnvRefs(routes []Route, allowed []string) error {
+	for i, route := range routes {
+		if !route.IsEnabled() {
+			continue
+		}
+		for _, expression := range routeExpressions(route) {
+			names, err := exprEnvRefs(expression.value)
+			if err != nil {
+				// Syntax errors are reported when routes are compiled
+				continue
+			}
+			for _, name := range names {
+				if !slices.Contains(allowed, name) {
+					return fmt.Errorf("routes[%d].%s references env.%s which is not listed in expr_env", i, expression.field, name)
+				}
+				if _, ok := os.LookupEnv(name); !ok {
+					return fmt.Errorf("routes[%d].%s references env.%s which is not set in the environment", i, expression.field, name)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoerceEnvValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  interface{}
+	}{
+		{"-1001234567890", int64(-1001234567890)},
+		{"42", int64(42)},
+		{"0.5", 0.5},
+		{"1e3", 1000.0},
+		{"NaN", "NaN"},
+		{"inf", "inf"},
+		{"telegram.prod", "telegram.prod"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.want, coerceEnvValue(tt.value))
+		})
+	}
+}
+
+func TestLookupExprEnv(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "-100123")
+	t.Setenv("THRESHOLD", "0.75")
+	t.Setenv("NOT_ALLOWED", "secret")
+
+	vars := lookupExprEnv([]string{"ADMIN_CHAT_ID", "THRESHOLD", "MISSING_VAR"})
+	assert.Equal(t, map[string]interface{}{
+		"ADMIN_CHAT_ID": int64(-100123),
+		"THRESHOLD":     0.75,
+	}, vars)
+}
+
+func TestExprEnvRefs(t *testing.T) {
+	names, err := exprEnvRefs(`update.Message.Chat.Id == env.ADMIN_CHAT_ID || env["OTHER"] == env.ADMIN_CHAT_ID`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ADMIN_CHAT_ID", "OTHER"}, names)
+
+	names, err = exprEnvRefs(`update.Message != nil`)
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	_, err = exprEnvRefs(`update.Message !=`)
+	assert.Error(t, err)
+}
+
+func TestCheckExprEnvRefs(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "-100123")
+
+	disabled := false
+	routes := []Route{
+		{Condition: "update.Message.Chat.Id == env.ADMIN_CHAT_ID"},
+		{Condition: "env.UNSET_VAR > 0", Enabled: &disabled},
+	}
+	assert.NoError(t, checkExprEnvRefs(routes, []string{"ADMIN_CHAT_ID"}))
+
+	err := checkExprEnvRefs(routes, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "routes[0].condition references env.ADMIN_CHAT_ID which is not listed in expr_env")
+
+	routes = append(routes, Route{
+		Condition: "true",
+		Subject:   &RouteSubject{Type: SubjectTypeExpr, Value: `"telegram." + env.UNSET_VAR`},
+	})
+	err = checkExprEnvRefs(routes, []string{"ADMIN_CHAT_ID", "UNSET_VAR"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "routes[2].subject references env.UNSET_VAR which is not set in the environment")
+}
@@ -0,0 +1,97 @@
+package bridge
+
+import "github.com/PaulSonOfLars/gotgbot/v2"
+
+// FlatUpdate is published instead of the update by routes with
+// payload: flatten. Every key is always present, values the update doesn't
+// carry are null or empty, so consumers see one schema for all update types.
+type FlatUpdate struct {
+	Type      string `json:"type"`
+	UpdateID  int64  `json:"update_id"`
+	ChatID    *int64 `json:"chat_id"`
+	ChatType  string `json:"chat_type"`
+	UserID    *int64 `json:"user_id"`
+	Username  string `json:"username"`
+	Text      string `json:"text"`
+	Date      *int64 `json:"date"`
+	MessageID *int64 `json:"message_id"`
+}
+
+// flattenUpdate extracts the FlatUpdate fields from any update variant.
+// text is the message text or caption, callback data or an inline query;
+// date is the edit date of edited messages.
+func flattenUpdate(update Update) FlatUpdate {
+	flat := FlatUpdate{Type: updateType(update), UpdateID: update.UpdateId}
+
+	if chat := updateChat(update); chat != nil {
+		flat.ChatID = &chat.Id
+		flat.ChatType = chat.Type
+	}
+	if user := flatSender(update); user != nil {
+		flat.UserID = &user.Id
+		flat.Username = user.Username
+	}
+
+	if msg := updateMessage(update); msg != nil {
+		flat.Text = msg.Text
+		if flat.Text == "" {
+			flat.Text = msg.Caption
+		}
+		date := msg.Date
+		if msg.EditDate != 0 {
+			date = msg.EditDate
+		}
+		flat.Date = &date
+		flat.MessageID = &msg.MessageId
+		return flat
+	}
+
+	switch {
+	case update.CallbackQuery != nil:
+		flat.Text = update.CallbackQuery.Data
+		if msg := update.CallbackQuery.Message; msg != nil {
+			id := msg.GetMessageId()
+			flat.MessageID = &id
+		}
+	case update.InlineQuery != nil:
+		flat.Text = update.InlineQuery.Query
+	case update.ChosenInlineResult != nil:
+		flat.Text = update.ChosenInlineResult.Query
+	case update.MessageReaction != nil:
+		flat.Date = &update.MessageReaction.Date
+		flat.MessageID = &update.MessageReaction.MessageId
+	case update.MessageReactionCount != nil:
+		flat.Date = &update.MessageReactionCount.Date
+		flat.MessageID = &update.MessageReactionCount.MessageId
+	case update.ChatMember != nil:
+		flat.Date = &update.ChatMember.Date
+	case update.MyChatMember != nil:
+		flat.Date = &update.MyChatMember.Date
+	case update.ChatJoinRequest != nil:
+		flat.Date = &update.ChatJoinRequest.Date
+	}
+	return flat
+}
+
+// flatSender returns the user behind the update: updateSender plus the
+// updates without a chat, e.g. inline queries and payments
+func flatSender(update Update) *gotgbot.User {
+	if user := updateSender(update); user != nil {
+		return user
+	}
+	switch {
+	case update.ChannelPost != nil:
+		return update.ChannelPost.From
+	case update.EditedChannelPost != nil:
+		return update.EditedChannelPost.From
+	case update.InlineQuery != nil:
+		return &update.InlineQuery.From
+	case update.ChosenInlineResult != nil:
+		return &update.ChosenInlineResult.From
+	case update.ShippingQuery != nil:
+		return &update.ShippingQuery.From
+	case update.PreCheckoutQuery != nil:
+		return &update.PreCheckoutQuery.From
+	}
+	return nil
+}
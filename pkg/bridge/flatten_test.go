@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlattenUpdate(t *testing.T) {
+	user := &gotgbot.User{Id: 111, Username: "ann"}
+	group := gotgbot.Chat{Id: -100200, Type: "supergroup"}
+	channel := gotgbot.Chat{Id: -100300, Type: "channel"}
+
+	tests := []struct {
+		name   string
+		update Update
+		want   string
+	}{
+		{
+			name:   "message",
+			update: Update{UpdateId: 1, Message: &gotgbot.Message{MessageId: 10, From: user, Chat: group, Date: 1700000000, Text: "hello"}},
+			want:   `{"type":"message","update_id":1,"chat_id":-100200,"chat_type":"supergroup","user_id":111,"username":"ann","text":"hello","date":1700000000,"message_id":10}`,
+		},
+		{
+			name:   "edited_message",
+			update: Update{UpdateId: 2, EditedMessage: &gotgbot.Message{MessageId: 10, From: user, Chat: group, Date: 1700000000, EditDate: 1700000060, Text: "hello again"}},
+			want:   `{"type":"edited_message","update_id":2,"chat_id":-100200,"chat_type":"supergroup","user_id":111,"username":"ann","text":"hello again","date":1700000060,"message_id":10}`,
+		},
+		{
+			name:   "channel_post",
+			update: Update{UpdateId: 3, ChannelPost: &gotgbot.Message{MessageId: 20, Chat: channel, Date: 1700000100, Caption: "photo of the day"}},
+			want:   `{"type":"channel_post","update_id":3,"chat_id":-100300,"chat_type":"channel","user_id":null,"username":"","text":"photo of the day","date":1700000100,"message_id":20}`,
+		},
+		{
+			name: "callback_query",
+			update: Update{UpdateId: 4, CallbackQuery: &gotgbot.CallbackQuery{
+				Id:      "cb",
+				From:    *user,
+				Data:    "vote:yes",
+				Message: &gotgbot.Message{MessageId: 30, Chat: group, Date: 1700000200},
+			}},
+			want: `{"type":"callback_query","update_id":4,"chat_id":-100200,"chat_type":"supergroup","user_id":111,"username":"ann","text":"vote:yes","date":null,"message_id":30}`,
+		},
+		{
+			name:   "inline_query",
+			update: Update{UpdateId: 5, InlineQuery: &gotgbot.InlineQuery{Id: "iq", From: *user, Query: "cats"}},
+			want:   `{"type":"inline_query","update_id":5,"chat_id":null,"chat_type":"","user_id":111,"username":"ann","text":"cats","date":null,"message_id":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(flattenUpdate(tt.update))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(data))
+		})
+	}
+}
+
+func TestFlattenUpdate_UniformShape(t *testing.T) {
+	updates := []Update{
+		{UpdateId: 1, Message: &gotgbot.Message{Text: "hi"}},
+		{UpdateId: 2, EditedMessage: &gotgbot.Message{Text: "hi"}},
+		{UpdateId: 3, ChannelPost: &gotgbot.Message{Text: "hi"}},
+		{UpdateId: 4, CallbackQuery: &gotgbot.CallbackQuery{Data: "x"}},
+		{UpdateId: 5, PollAnswer: &gotgbot.PollAnswer{PollId: "p"}},
+	}
+
+	var shape []string
+	for _, update := range updates {
+		data, err := json.Marshal(flattenUpdate(update))
+		require.NoError(t, err)
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &fields))
+
+		var keys []string
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		if shape == nil {
+			shape = keys
+			continue
+		}
+		assert.ElementsMatch(t, shape, keys, "update %d", update.UpdateId)
+	}
+	assert.Len(t, shape, 9)
+}
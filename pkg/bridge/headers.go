@@ -0,0 +1,77 @@
+package bridge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CorrelationIDHeader carries the per-update correlation id for end-to-end tracing
+const CorrelationIDHeader = "Tg-Correlation-Id"
+
+// ChatMemberTransitionHeader carries status transition of chat_member/my_chat_member updates
+const ChatMemberTransitionHeader = "Tg-Chat-Member-Transition"
+
+// BusinessConnectionIDHeader carries business_connection_id of business updates,
+// replies to them must be sent through this connection
+const BusinessConnectionIDHeader = "Tg-Business-Connection-Id"
+
+// ReplyToMessageIDHeader and ReplyToUserIDHeader carry message_id and sender id
+// of the message replied to in the same chat
+const (
+	ReplyToMessageIDHeader = "Tg-Reply-To-Message-Id"
+	ReplyToUserIDHeader    = "Tg-Reply-To-User-Id"
+)
+
+// ReactionsAddedHeader and ReactionsRemovedHeader carry comma-separated
+// reactions added and removed by message_reaction updates
+const (
+	ReactionsAddedHeader   = "Tg-Reactions-Added"
+	ReactionsRemovedHeader = "Tg-Reactions-Removed"
+)
+
+// correlationID returns an id unique for the update across bots: "<bot_id>-<update_id>"
+func correlationID(botID int64, update Update) string {
+	return fmt.Sprintf("%d-%d", botID, update.UpdateId)
+}
+
+// updateHeaders builds message headers derived from the update.
+// Returns nil when there are no headers to set.
+func updateHeaders(update Update, correlationID string) map[string]string {
+	var headers map[string]string
+
+	set := func(key, value string) {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[key] = value
+	}
+
+	if correlationID != "" {
+		set(CorrelationIDHeader, correlationID)
+	}
+
+	if transition := chatMemberTransition(update); transition != "" {
+		set(ChatMemberTransitionHeader, transition)
+	}
+
+	if reply := replyTo(update); reply != nil {
+		set(ReplyToMessageIDHeader, strconv.FormatInt(reply.MessageId, 10))
+		if reply.From != nil {
+			set(ReplyToUserIDHeader, strconv.FormatInt(reply.From.Id, 10))
+		}
+	}
+
+	if added := reactionsAdded(update); len(added) > 0 {
+		set(ReactionsAddedHeader, strings.Join(added, ","))
+	}
+	if removed := reactionsRemoved(update); len(removed) > 0 {
+		set(ReactionsRemovedHeader, strings.Join(removed, ","))
+	}
+
+	if connectionID := businessConnectionID(update); connectionID != "" {
+		set(BusinessConnectionIDHeader, connectionID)
+	}
+
+	return headers
+}
@@ -0,0 +1,35 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateHeaders(t *testing.T) {
+	update := Update{
+		UpdateId: 1,
+		ChatMember: &gotgbot.ChatMemberUpdated{
+			OldChatMember: gotgbot.ChatMemberLeft{},
+			NewChatMember: gotgbot.ChatMemberMember{},
+		},
+	}
+
+	assert.Equal(t, map[string]string{ChatMemberTransitionHeader: "left→member"}, updateHeaders(update, ""))
+	assert.Nil(t, updateHeaders(Update{UpdateId: 2}, ""))
+}
+
+func TestUpdateHeaders_CorrelationID(t *testing.T) {
+	update := Update{UpdateId: 42}
+	id := correlationID(123456, update)
+
+	assert.Equal(t, "123456-42", id)
+	assert.Equal(t, map[string]string{CorrelationIDHeader: "123456-42"}, updateHeaders(update, id))
+}
+
+func TestUpdateHeaders_BusinessConnection(t *testing.T) {
+	update := loadUpdateFixture(t, "business_message")
+
+	assert.Equal(t, map[string]string{BusinessConnectionIDHeader: "bc-123"}, updateHeaders(update, ""))
+}
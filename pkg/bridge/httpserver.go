@@ -0,0 +1,150 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPStats is the response of GET /stats. NATSConnected is omitted when
+// the broker is not NATS.
+type HTTPStats struct {
+	StatsSnapshot
+	UptimeSec     int64 `json:"uptime_sec"`
+	NATSConnected *bool `json:"nats_connected,omitempty"`
+}
+
+// natsConnChecker reports whether the broker connection is up
+type natsConnChecker func() bool
+
+// statsHandler serves the current stats as JSON. connected may be nil.
+func statsHandler(stats *Stats, started time.Time, connected natsConnChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp := HTTPStats{
+			StatsSnapshot: stats.Snapshot(),
+			UptimeSec:     int64(time.Since(started).Seconds()),
+		}
+		if connected != nil {
+			ok := connected()
+			resp.NATSConnected = &ok
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// HealthCheck reports whether a part of the bridge works
+type HealthCheck func() bool
+
+// HTTPHealth is the response of GET /healthz
+type HTTPHealth struct {
+	Status string          `json:"status"`
+	Checks map[string]bool `json:"checks"`
+}
+
+// Health statuses of GET /healthz
+const (
+	HealthStatusOK        = "ok"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// healthHandler runs checks and responds 503 when any of them fails
+func healthHandler(checks map[string]HealthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp := HTTPHealth{Status: HealthStatusOK, Checks: make(map[string]bool, len(checks))}
+		for name, check := range checks {
+			ok := check()
+			resp.Checks[name] = ok
+			if !ok {
+				resp.Status = HealthStatusUnhealthy
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if resp.Status != HealthStatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// HTTPServer serves bridge stats over HTTP
+type HTTPServer struct {
+	server   *http.Server
+	listener net.Listener
+	logger   *slog.Logger
+}
+
+// NewHTTPServer creates a server with the endpoints enabled in cfg, checks
+// are reported by GET /healthz
+func NewHTTPServer(cfg *HTTPServerConfig, stats *Stats, connected natsConnChecker, checks map[string]HealthCheck, logger *slog.Logger) *HTTPServer {
+	mux := http.NewServeMux()
+	if cfg.StatsEnabled() {
+		mux.Handle("/stats", statsHandler(stats, time.Now(), connected))
+	}
+	if cfg.HealthEnabled() {
+		mux.Handle("/healthz", healthHandler(checks))
+	}
+
+	return &HTTPServer{
+		server: &http.Server{
+			Addr:              cfg.Listen,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		logger: logger,
+	}
+}
+
+// Start binds the listen address and serves requests in the background,
+// a busy address is reported right away
+func (s *HTTPServer) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	s.listener = listener
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("HTTP server failed", "error", err)
+		}
+	}()
+
+	s.logger.Info("HTTP server started", "addr", listener.Addr().String())
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (s *HTTPServer) Addr() string {
+	if s.listener == nil {
+		return s.server.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops the server, waiting for active requests up to ctx
+func (s *HTTPServer) Close(ctx context.Context) error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
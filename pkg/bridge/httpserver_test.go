@@ -0,0 +1,195 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsHandler(t *testing.T) {
+	stats := NewStats()
+	stats.RecordReceived(3)
+	stats.RecordPoll(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	stats.RecordPublish(PublishResult{Success: true, Duration: 2 * time.Millisecond})
+	stats.RecordPublish(PublishResult{Success: true, Duration: 2 * time.Millisecond})
+	stats.RecordPublish(PublishResult{Success: false, Duration: 2 * time.Millisecond})
+	stats.RecordPanic()
+
+	started := time.Now().Add(-90 * time.Second)
+
+	t.Run("nats", func(t *testing.T) {
+		handler := statsHandler(stats, started, func() bool { return true })
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.InDelta(t, 90, got["uptime_sec"], 5)
+		delete(got, "uptime_sec")
+		assert.Equal(t, map[string]interface{}{
+			"received":             float64(3),
+			"last_poll":            "2026-01-02T03:04:05Z",
+			"published":            float64(2),
+			"publish_failed":       float64(1),
+			"avg_publish_duration": float64(2 * time.Millisecond),
+			"panics":               float64(1),
+			"pending_bytes":        float64(0),
+			"pending_messages":     float64(0),
+			"edit_cache_entries":   float64(0),
+			"edit_cache_bytes":     float64(0),
+			"chat_limit_dropped":   float64(0),
+			"nats_connected":       true,
+		}, got)
+	})
+
+	t.Run("config hash", func(t *testing.T) {
+		stats := NewStats()
+		stats.SetConfigHash("0123456789ab")
+		handler := statsHandler(stats, started, nil)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+		var got HTTPStats
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, "0123456789ab", got.ConfigHash)
+	})
+
+	t.Run("nats disconnected", func(t *testing.T) {
+		handler := statsHandler(stats, started, func() bool { return false })
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+		var got HTTPStats
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		require.NotNil(t, got.NATSConnected)
+		assert.False(t, *got.NATSConnected)
+	})
+
+	t.Run("kafka and no poll yet", func(t *testing.T) {
+		handler := statsHandler(NewStats(), started, nil)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.NotContains(t, got, "nats_connected")
+		assert.NotContains(t, got, "last_poll")
+		assert.Equal(t, float64(0), got["received"])
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		handler := statsHandler(stats, started, nil)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stats", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
+
+func TestStatsHandler_Concurrent(t *testing.T) {
+	stats := NewStats()
+	handler := statsHandler(stats, time.Now(), nil)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for range 100 {
+				stats.RecordReceived(1)
+				stats.RecordPoll(time.Now())
+				stats.RecordPublish(PublishResult{Success: true})
+			}
+		})
+		wg.Go(func() {
+			for range 100 {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+				assert.Equal(t, http.StatusOK, rec.Code)
+			}
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(400), stats.Snapshot().Received)
+}
+
+func TestHealthHandler(t *testing.T) {
+	var stalled atomic.Bool
+	handler := healthHandler(map[string]HealthCheck{
+		"poll_loop": func() bool { return !stalled.Load() },
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status": "ok", "checks": {"poll_loop": true}}`, rec.Body.String())
+
+	stalled.Store(true)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"status": "unhealthy", "checks": {"poll_loop": false}}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHTTPServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	stats := NewStats()
+	stats.RecordReceived(5)
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	checks := map[string]HealthCheck{"poll_loop": healthy.Load}
+	server := NewHTTPServer(&HTTPServerConfig{Enabled: true, Listen: "127.0.0.1:0"}, stats, nil, checks, logger)
+	require.NoError(t, server.Start())
+
+	resp, err := http.Get("http://" + server.Addr() + "/stats")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got HTTPStats
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, int64(5), got.Received)
+
+	resp, err = http.Get("http://" + server.Addr() + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get("http://" + server.Addr() + "/unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The address is taken while the server runs
+	busy := NewHTTPServer(&HTTPServerConfig{Enabled: true, Listen: server.Addr()}, stats, nil, nil, logger)
+	assert.Error(t, busy.Start())
+
+	require.NoError(t, server.Close(context.Background()))
+	_, err = http.Get("http://" + server.Addr() + "/stats")
+	assert.Error(t, err)
+}
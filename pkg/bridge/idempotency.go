@@ -0,0 +1,69 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// IdempotencyCache remembers idempotency keys of recently sent outbound
+// messages, so a message retried by downstream reaches Telegram once
+type IdempotencyCache struct {
+	// mu makes checking and reserving a key atomic
+	mu    sync.Mutex
+	cache *ttlCache
+}
+
+// idempotentSend is the first send with a key; duplicates wait for done
+type idempotentSend struct {
+	done chan struct{}
+	err  error
+}
+
+// NewIdempotencyCache creates a new IdempotencyCache keeping up to cacheSize keys
+func NewIdempotencyCache(cacheSize int, ttl time.Duration) *IdempotencyCache {
+	return &IdempotencyCache{
+		cache: newTTLCache(cacheSize, ttl),
+	}
+}
+
+// Do calls send unless key was sent within TTL, duplicate reports that it
+// was and send was not called. A duplicate arriving while the first send is
+// in flight (e.g. on another publisher worker) waits for it. Failed sends
+// forget the key, so a waiting duplicate or a later retry is sent instead.
+func (c *IdempotencyCache) Do(ctx context.Context, key string, send func() error) (duplicate bool, err error) {
+	c.mu.Lock()
+	for {
+		value, ok := c.cache.get(key)
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		first := value.(*idempotentSend)
+		select {
+		case <-first.done:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+		if first.err == nil {
+			return true, nil
+		}
+		c.mu.Lock()
+	}
+	first := &idempotentSend{done: make(chan struct{})}
+	c.cache.set(key, first)
+	c.mu.Unlock()
+
+	first.err = send()
+	if first.err != nil {
+		c.mu.Lock()
+		// The entry may have been evicted and the key reserved again meanwhile
+		if value, ok := c.cache.get(key); ok && value == first {
+			c.cache.delete(key)
+		}
+		c.mu.Unlock()
+	}
+	close(first.done)
+
+	return false, first.err
+}
@@ -0,0 +1,137 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyCache_Duplicates(t *testing.T) {
+	cache := NewIdempotencyCache(10, time.Minute)
+	var sends int
+	send := func() error {
+		sends++
+		return nil
+	}
+
+	duplicate, err := cache.Do(context.Background(), "order-1", send)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = cache.Do(context.Background(), "order-1", send)
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+
+	duplicate, err = cache.Do(context.Background(), "order-2", send)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+
+	assert.Equal(t, 2, sends)
+}
+
+func TestIdempotencyCache_Expiry(t *testing.T) {
+	cache := NewIdempotencyCache(10, time.Minute)
+	now := time.Unix(1700000000, 0)
+	cache.cache.now = func() time.Time { return now }
+
+	var sends int
+	send := func() error {
+		sends++
+		return nil
+	}
+
+	cache.Do(context.Background(), "order-1", send)
+	now = now.Add(59 * time.Second)
+	duplicate, _ := cache.Do(context.Background(), "order-1", send)
+	assert.True(t, duplicate)
+
+	now = now.Add(2 * time.Second)
+	duplicate, _ = cache.Do(context.Background(), "order-1", send)
+	assert.False(t, duplicate)
+	assert.Equal(t, 2, sends)
+}
+
+func TestIdempotencyCache_FailedSendIsRetried(t *testing.T) {
+	cache := NewIdempotencyCache(10, time.Minute)
+	sendErr := errors.New("telegram API error 502")
+
+	duplicate, err := cache.Do(context.Background(), "order-1", func() error { return sendErr })
+	assert.False(t, duplicate)
+	assert.ErrorIs(t, err, sendErr)
+
+	duplicate, err = cache.Do(context.Background(), "order-1", func() error { return nil })
+	assert.False(t, duplicate)
+	assert.NoError(t, err)
+}
+
+func TestIdempotencyCache_ConcurrentDuplicates(t *testing.T) {
+	cache := NewIdempotencyCache(10, time.Minute)
+	sendErr := errors.New("telegram API error 502")
+
+	// The first send fails, the next one succeeds
+	var sends atomic.Int64
+	release := make(chan struct{})
+	send := func() error {
+		if sends.Add(1) == 1 {
+			<-release
+			return sendErr
+		}
+		return nil
+	}
+
+	// Duplicates arrive on several publisher workers while the first send is in flight
+	const workers = 8
+	var wg sync.WaitGroup
+	var duplicates atomic.Int64
+	errs := make(chan error, workers)
+	for range workers {
+		wg.Go(func() {
+			duplicate, err := cache.Do(context.Background(), "order-1", send)
+			if duplicate {
+				duplicates.Add(1)
+			}
+			errs <- err
+		})
+	}
+
+	require.Eventually(t, func() bool { return sends.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	// A waiting duplicate sends again, the rest wait for it
+	assert.Equal(t, int64(2), sends.Load())
+	assert.Equal(t, int64(workers-2), duplicates.Load())
+	var failed int
+	for err := range errs {
+		if err != nil {
+			assert.ErrorIs(t, err, sendErr)
+			failed++
+		}
+	}
+	assert.Equal(t, 1, failed)
+}
+
+func TestIdempotencyCache_DuplicateWaitCanceled(t *testing.T) {
+	cache := NewIdempotencyCache(10, time.Minute)
+	release := make(chan struct{})
+	defer close(release)
+
+	go cache.Do(context.Background(), "order-1", func() error {
+		<-release
+		return nil
+	})
+	require.Eventually(t, func() bool { return cache.cache.len() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	duplicate, err := cache.Do(ctx, "order-1", func() error { return nil })
+	assert.False(t, duplicate)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,211 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// stringIDKeys are object keys holding 64-bit ids, with publish.stringify_ids
+// their integer values are published as strings. chat.id, from.id and other
+// user and chat ids are all under "id".
+var stringIDKeys = map[string]bool{
+	"id":         true,
+	"message_id": true,
+	"update_id":  true,
+}
+
+// StringIDsPayload is published instead of the payload with
+// publish.stringify_ids, it marshals ids as strings so JavaScript consumers
+// don't lose precision on them
+type StringIDsPayload struct {
+	Payload interface{}
+}
+
+// MarshalJSON marshals Payload with integer ids replaced by strings, other
+// numbers are kept as is
+func (p StringIDsPayload) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(p.Payload)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := decodeJSONTree(data)
+	if err != nil {
+		return nil, err
+	}
+	stringifyIDs(tree)
+	return json.Marshal(tree)
+}
+
+// decodeJSONTree decodes data into maps and slices keeping numbers as json.Number
+func decodeJSONTree(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// stringifyIDs replaces integer values of stringIDKeys in node with strings
+func stringifyIDs(node interface{}) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if n, ok := value.(json.Number); ok && stringIDKeys[key] {
+				if _, err := n.Int64(); err == nil {
+					v[key] = n.String()
+				}
+				continue
+			}
+			stringifyIDs(value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			stringifyIDs(item)
+		}
+	}
+}
+
+// restoreNumericIDs turns ids of a payload published with
+// publish.stringify_ids back into numbers, so it decodes into Update again
+func restoreNumericIDs(data []byte) ([]byte, error) {
+	tree, err := decodeJSONTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := tree.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("payload is not a JSON object")
+	}
+	if isEnvelope(root) {
+		if bot, ok := root["bot"]; ok {
+			numericIDs(bot, reflect.TypeFor[BotMeta]())
+		}
+		numericIDs(root["update"], reflect.TypeFor[Update]())
+	} else {
+		numericIDs(root, reflect.TypeFor[Update]())
+	}
+	return json.Marshal(root)
+}
+
+// numericIDs turns numeric strings back into numbers where t expects an
+// integer. Values behind interface fields (message origins, chat members)
+// have no static type, their ids are restored by key.
+func numericIDs(node interface{}, t reflect.Type) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Interface {
+		t = nil
+	}
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if t == nil {
+			for key, value := range v {
+				if s, ok := value.(string); ok {
+					if stringIDKeys[key] && isInteger(s) {
+						v[key] = json.Number(s)
+					}
+					continue
+				}
+				numericIDs(value, nil)
+			}
+			return
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		fields := jsonFields(t)
+		for key, value := range v {
+			field, ok := fields[key]
+			if !ok {
+				continue
+			}
+			if s, ok := value.(string); ok {
+				if isIntKind(field) && isInteger(s) {
+					v[key] = json.Number(s)
+				}
+				continue
+			}
+			numericIDs(value, field)
+		}
+	case []interface{}:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for _, item := range v {
+			numericIDs(item, elem)
+		}
+	}
+}
+
+// jsonFields maps JSON names of struct t fields, including embedded ones,
+// to their types
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded, typ := range jsonFields(field.Type) {
+				fields[embedded] = typ
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func isIntKind(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+// str is the expr helper formatting x for subjects and texts: integers,
+// integral floats and json.Number values are never rendered in scientific
+// notation, nil becomes an empty string
+func str(x interface{}) string {
+	switch v := x.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(x)
+}
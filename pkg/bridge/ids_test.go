@@ -0,0 +1,193 @@
+package bridge
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStringIDsPayload(t *testing.T) {
+	update := Update{
+		UpdateId: 9007199254740993,
+		Message: &gotgbot.Message{
+			MessageId: 42,
+			Date:      1700000000,
+			Chat:      gotgbot.Chat{Id: -1009007199254740993, Type: "supergroup"},
+			From:      &gotgbot.User{Id: 9007199254740995, FirstName: "Ann"},
+			Text:      "hi",
+			Entities:  []gotgbot.MessageEntity{{Type: "mention", Offset: 0, Length: 2, User: &gotgbot.User{Id: 7, FirstName: "Bob"}}},
+		},
+	}
+
+	data, err := json.Marshal(StringIDsPayload{Payload: update})
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "9007199254740993", got["update_id"])
+
+	message := got["message"].(map[string]interface{})
+	assert.Equal(t, "42", message["message_id"])
+	assert.Equal(t, "-1009007199254740993", message["chat"].(map[string]interface{})["id"])
+	assert.Equal(t, "9007199254740995", message["from"].(map[string]interface{})["id"])
+	entity := message["entities"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "7", entity["user"].(map[string]interface{})["id"])
+
+	// Other numbers stay numeric
+	assert.Equal(t, float64(1700000000), message["date"])
+	assert.Equal(t, float64(2), entity["length"])
+}
+
+func TestStringIDsPayload_Wrapped(t *testing.T) {
+	callback := Update{
+		UpdateId: 5,
+		CallbackQuery: &gotgbot.CallbackQuery{
+			Id:   "4382bfdwdsb323b2d9",
+			From: gotgbot.User{Id: 11, FirstName: "Ann"},
+			Data: "ok",
+		},
+	}
+	payload := BotMeta{ID: 123, Username: "test_bot"}.wrap(publishedUpdate(callback, nil))
+
+	data, err := json.Marshal(StringIDsPayload{Payload: payload})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"bot": {"id": "123", "username": "test_bot"},
+		"update": {
+			"update_id": "5",
+			"callback_query": {"id": "4382bfdwdsb323b2d9", "from": {"id": "11", "is_bot": false, "first_name": "Ann"}, "chat_instance": "", "data": "ok"}
+		}
+	}`, string(data))
+
+	assert.Equal(t, callback, unwrapUpdate(StringIDsPayload{Payload: payload}))
+}
+
+func TestDecodeStoredUpdate_StringIDs(t *testing.T) {
+	origin := gotgbot.MessageOriginUser{Date: 1, SenderUser: gotgbot.User{Id: 9007199254740995, FirstName: "Ann"}}
+	tests := []struct {
+		name    string
+		payload interface{}
+		want    Update
+	}{
+		{
+			name: "bare update",
+			payload: Update{
+				UpdateId: 9007199254740993,
+				Message: &gotgbot.Message{
+					MessageId:     42,
+					Chat:          gotgbot.Chat{Id: -1009007199254740993, Type: "supergroup"},
+					Text:          "123",
+					ForwardOrigin: origin,
+				},
+			},
+		},
+		{
+			name: "numeric string ids stay strings",
+			payload: Update{
+				UpdateId:      6,
+				CallbackQuery: &gotgbot.CallbackQuery{Id: "1234567890", From: gotgbot.User{Id: 11}, Data: "77"},
+			},
+		},
+		{
+			name: "wrapped with bot meta",
+			payload: BotMeta{ID: 123, Username: "test_bot"}.wrap(publishedUpdate(Update{
+				UpdateId: 7,
+				Message:  &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: 10, Type: "private"}},
+			}, &Enrichment{Chat: &gotgbot.ChatFullInfo{Id: 10}})),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(StringIDsPayload{Payload: tt.payload})
+			require.NoError(t, err)
+
+			got, err := decodeStoredUpdate(data)
+			require.NoError(t, err)
+			assert.Equal(t, unwrapUpdate(tt.payload), got)
+		})
+	}
+}
+
+func TestStr(t *testing.T) {
+	tests := []struct {
+		name string
+		x    interface{}
+		want string
+	}{
+		{"int64", int64(-1002345678901), "-1002345678901"},
+		{"int", 42, "42"},
+		{"integral float", float64(-1002345678901), "-1002345678901"},
+		{"float", 0.25, "0.25"},
+		{"float32", float32(1.5), "1.5"},
+		{"json integer", json.Number("-1002345678901"), "-1002345678901"},
+		{"json float", json.Number("1.5e3"), "1.5e3"},
+		{"string", "abc", "abc"},
+		{"bool", true, "true"},
+		{"nil", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, str(tt.x))
+		})
+	}
+}
+
+func TestLargeChatID(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	const chatID = -1002345678901
+
+	update := Update{
+		UpdateId: 3000000001,
+		Message: &gotgbot.Message{
+			MessageId: 2147483648,
+			Chat:      gotgbot.Chat{Id: chatID, Type: "supergroup"},
+			From:      &gotgbot.User{Id: 7000000001},
+			Text:      "hi",
+		},
+	}
+
+	subjects := []string{
+		`"telegram.chats." + str(update.Message.Chat.Id)`,
+		`sprintf("telegram.chats.%d", update.Message.Chat.Id)`,
+		`sprintf("telegram.chats.%v", update.Message.Chat.Id)`,
+		`"telegram.chats." + str(float(update.Message.Chat.Id))`,
+	}
+	for _, subject := range subjects {
+		t.Run(subject, func(t *testing.T) {
+			router, err := NewRouter([]Route{{
+				Condition: "update.Message != nil",
+				Subject:   &RouteSubject{Type: SubjectTypeExpr, Value: subject},
+			}}, "first", 5, logger)
+			require.NoError(t, err)
+
+			dests, err := router.Route(update)
+			require.NoError(t, err)
+			require.Len(t, dests, 1)
+			assert.Equal(t, "telegram.chats.-1002345678901", dests[0].Subject)
+		})
+	}
+
+	t.Run("published payload", func(t *testing.T) {
+		data, err := json.Marshal(update)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"id":-1002345678901`)
+		assert.Contains(t, string(data), `"id":7000000001`)
+		assert.Contains(t, string(data), `"update_id":3000000001`)
+		assert.NotContains(t, string(data), "e+")
+
+		decoded, err := decodeStoredUpdate(data)
+		require.NoError(t, err)
+		assert.Equal(t, int64(chatID), decoded.Message.Chat.Id)
+
+		data, err = json.Marshal(StringIDsPayload{Payload: update})
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"id":"-1002345678901"`)
+	})
+}
@@ -0,0 +1,107 @@
+package bridge
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// InFlightLimiter bounds the number of updates routed and published
+// concurrently across the process, an update holds its slot until the
+// results of its tracked publications arrive. While it is full the poll loop waits, so
+// Telegram keeps further updates unconfirmed.
+type InFlightLimiter struct {
+	slots chan struct{}
+}
+
+// NewInFlightLimiter creates a limiter for max_in_flight updates, it returns
+// nil for 0 (unlimited)
+func NewInFlightLimiter(limit int) *InFlightLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &InFlightLimiter{slots: make(chan struct{}, limit)}
+}
+
+// Acquire takes a slot for an update, waiting while all slots are taken.
+// It returns ctx.Err() when ctx is done first. A nil limiter never waits.
+func (l *InFlightLimiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	// A free slot wins over a done ctx
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (l *InFlightLimiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+// InFlight returns the number of taken slots
+func (l *InFlightLimiter) InFlight() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
+
+// Slot tracks the slot taken by Acquire for one update: it is released after
+// Done and the results of all its publications. A nil limiter returns nil.
+func (l *InFlightLimiter) Slot() *InFlightSlot {
+	if l == nil {
+		return nil
+	}
+	slot := &InFlightSlot{limiter: l}
+	slot.pending.Store(1)
+	return slot
+}
+
+// InFlightSlot is the slot of one update, a nil slot tracks nothing
+type InFlightSlot struct {
+	limiter *InFlightLimiter
+	// pending counts the processing itself and unfinished publications
+	pending atomic.Int32
+}
+
+// Publication returns the callback for the result of one publication of
+// the update, it calls done first if set
+func (s *InFlightSlot) Publication(done func(error)) func(error) {
+	if s == nil {
+		return done
+	}
+	s.pending.Add(1)
+	return func(err error) {
+		if done != nil {
+			done(err)
+		}
+		s.release()
+	}
+}
+
+// Done marks the end of processing the update
+func (s *InFlightSlot) Done() {
+	if s == nil {
+		return
+	}
+	s.release()
+}
+
+func (s *InFlightSlot) release() {
+	if s.pending.Add(-1) == 0 {
+		s.limiter.Release()
+	}
+}
@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightLimiter_Flood(t *testing.T) {
+	const limit = 4
+	limiter := NewInFlightLimiter(limit)
+
+	var current, peak atomic.Int64
+	var wg sync.WaitGroup
+	// Acquire on one goroutine like the poll loop, process concurrently
+	for range 200 {
+		require.NoError(t, limiter.Acquire(context.Background()))
+		wg.Go(func() {
+			defer limiter.Release()
+			n := current.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			current.Add(-1)
+		})
+		assert.LessOrEqual(t, limiter.InFlight(), limit)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(limit), peak.Load())
+	assert.Equal(t, 0, limiter.InFlight())
+}
+
+func TestInFlightLimiter_Cancel(t *testing.T) {
+	limiter := NewInFlightLimiter(1)
+	require.NoError(t, limiter.Acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := limiter.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 1, limiter.InFlight())
+
+	// A released slot is taken even with a done ctx
+	limiter.Release()
+	assert.NoError(t, limiter.Acquire(ctx))
+}
+
+func TestInFlightLimiter_Unlimited(t *testing.T) {
+	limiter := NewInFlightLimiter(0)
+	assert.Nil(t, limiter)
+
+	for range 1000 {
+		require.NoError(t, limiter.Acquire(context.Background()))
+	}
+	limiter.Release()
+	assert.Equal(t, 0, limiter.InFlight())
+}
+
+func TestInFlightSlot(t *testing.T) {
+	limiter := NewInFlightLimiter(1)
+	require.NoError(t, limiter.Acquire(context.Background()))
+	slot := limiter.Slot()
+
+	var results []error
+	first := slot.Publication(func(err error) { results = append(results, err) })
+	second := slot.Publication(nil)
+
+	// Processing is over, publications are still outstanding
+	slot.Done()
+	assert.Equal(t, 1, limiter.InFlight())
+
+	first(nil)
+	assert.Equal(t, 1, limiter.InFlight())
+	second(ErrPublisherClosed)
+	assert.Equal(t, 0, limiter.InFlight())
+	assert.Equal(t, []error{nil}, results)
+
+	// A nil limiter tracks nothing and passes done through
+	var unlimited *InFlightLimiter
+	nilSlot := unlimited.Slot()
+	assert.Nil(t, nilSlot.Publication(nil))
+	nilSlot.Done()
+}
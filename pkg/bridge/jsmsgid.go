@@ -0,0 +1,114 @@
+package bridge
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// msgIDEnv is the expr environment of nats.jetstream.msg_id: the route
+// helpers, the update, the bot id and the subject of the publication
+var msgIDEnv = func() map[string]interface{} {
+	e := maps.Clone(env)
+	e["bot_id"] = int64(0)
+	e["subject"] = ""
+	return e
+}()
+
+// MsgIDBuilder computes the Nats-Msg-Id header of update publications. The id
+// depends only on the update, so an update published again after a transient
+// error or a restart gets the same id and JetStream drops the duplicate.
+type MsgIDBuilder struct {
+	program *vm.Program
+	botID   int64
+}
+
+// NewMsgIDBuilder compiles expression, an empty expression gives
+// "<bot_id>-<update_id>"
+func NewMsgIDBuilder(expression string, botID int64) (*MsgIDBuilder, error) {
+	b := &MsgIDBuilder{botID: botID}
+	if expression == "" {
+		return b, nil
+	}
+
+	program, err := compileMsgID(expression)
+	if err != nil {
+		return nil, err
+	}
+	b.program = program
+	return b, nil
+}
+
+func compileMsgID(expression string) (*vm.Program, error) {
+	program, err := expr.Compile(expression, expr.Env(msgIDEnv))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile nats.jetstream.msg_id: %w", err)
+	}
+	return program, nil
+}
+
+// MsgID returns the message id of update published to subject
+func (b *MsgIDBuilder) MsgID(update Update, subject string) (string, error) {
+	if b.program == nil {
+		return correlationID(b.botID, update), nil
+	}
+
+	runEnv := exprEnv(update, nil, nil)
+	runEnv["bot_id"] = b.botID
+	runEnv["subject"] = subject
+	id, err := runExpr[string](b.program, runEnv)
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate nats.jetstream.msg_id: %w", err)
+	}
+	if id == "" {
+		return "", fmt.Errorf("nats.jetstream.msg_id is empty")
+	}
+	return id, nil
+}
+
+// Headers returns headers with the message id of update published to
+// subject. headers is shared by the publications of an update, so it is
+// copied instead of modified.
+func (b *MsgIDBuilder) Headers(headers map[string]string, update Update, subject string) (map[string]string, error) {
+	id, err := b.MsgID(update, subject)
+	if err != nil {
+		return headers, err
+	}
+	withID := maps.Clone(headers)
+	if withID == nil {
+		withID = make(map[string]string, 1)
+	}
+	withID[jetstream.MsgIDHeader] = id
+	return withID, nil
+}
+
+// msgIDCollision explains how the default msg_id can make JetStream drop
+// publications: it doesn't depend on the subject, so two publications of one
+// update into the same stream look like a duplicate. Returns "" when cfg
+// publishes every update once or msg_id is set.
+func msgIDCollision(cfg *Config) string {
+	if cfg.NATS.JetStream.MsgID != "" {
+		return ""
+	}
+
+	var enabled int
+	for _, route := range cfg.Routes {
+		if !route.IsEnabled() {
+			continue
+		}
+		if route.ShadowSubject != nil {
+			return "shadow_subject"
+		}
+		enabled++
+	}
+	switch {
+	case cfg.Mode == "all" && enabled > 1:
+		return "route mode all"
+	case cfg.EditSubjects != nil && cfg.EditSubjects.Enabled && cfg.EditSubjects.Mode == EditSubjectsDuplicate:
+		return "edit_subjects duplicate"
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgIDBuilder(t *testing.T) {
+	update := Update{UpdateId: 77, Message: &gotgbot.Message{MessageId: 5, Chat: gotgbot.Chat{Id: -100123}}}
+
+	t.Run("default", func(t *testing.T) {
+		builder, err := NewMsgIDBuilder("", 42)
+		require.NoError(t, err)
+
+		id, err := builder.MsgID(update, "telegram.messages")
+		require.NoError(t, err)
+		assert.Equal(t, "42-77", id)
+	})
+
+	t.Run("expression", func(t *testing.T) {
+		builder, err := NewMsgIDBuilder(`sprintf("%d-%d-%s", bot_id, update.UpdateId, subject)`, 42)
+		require.NoError(t, err)
+
+		id, err := builder.MsgID(update, "telegram.messages")
+		require.NoError(t, err)
+		assert.Equal(t, "42-77-telegram.messages", id)
+	})
+
+	t.Run("not a string", func(t *testing.T) {
+		builder, err := NewMsgIDBuilder("update.UpdateId", 42)
+		require.NoError(t, err)
+
+		_, err = builder.MsgID(update, "telegram.messages")
+		assert.Error(t, err)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		builder, err := NewMsgIDBuilder(`""`, 42)
+		require.NoError(t, err)
+
+		_, err = builder.MsgID(update, "telegram.messages")
+		assert.ErrorContains(t, err, "nats.jetstream.msg_id is empty")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewMsgIDBuilder("update.NoSuchField", 42)
+		assert.ErrorContains(t, err, "failed to compile nats.jetstream.msg_id")
+	})
+}
+
+func TestMsgIDBuilder_Headers(t *testing.T) {
+	builder, err := NewMsgIDBuilder(`str(update.UpdateId) + ":" + subject`, 42)
+	require.NoError(t, err)
+
+	update := Update{UpdateId: 9}
+	shared := map[string]string{CorrelationIDHeader: "42-9"}
+
+	headers, err := builder.Headers(shared, update, "telegram.a")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{CorrelationIDHeader: "42-9", jetstream.MsgIDHeader: "9:telegram.a"}, headers)
+	assert.NotContains(t, shared, jetstream.MsgIDHeader, "shared headers are not modified")
+
+	headers, err = builder.Headers(nil, update, "telegram.b")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{jetstream.MsgIDHeader: "9:telegram.b"}, headers)
+}
+
+// flakyBroker fails the first publication and records headers of all attempts
+type flakyBroker struct {
+	attempts []map[string]string
+}
+
+func (b *flakyBroker) Connect(ctx context.Context) error { return nil }
+
+func (b *flakyBroker) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	b.attempts = append(b.attempts, dest.Headers)
+	if len(b.attempts) == 1 {
+		return errors.New("nats: timeout")
+	}
+	return nil
+}
+
+func (b *flakyBroker) Close() error { return nil }
+
+func TestMsgIDBuilder_StableAcrossRetries(t *testing.T) {
+	builder, err := NewMsgIDBuilder("", 42)
+	require.NoError(t, err)
+
+	// The update is received again after a failed publication (a restart
+	// before the offset was saved) and its headers are built from scratch
+	broker := &flakyBroker{}
+	for range 3 {
+		update := Update{UpdateId: 100, Message: &gotgbot.Message{Text: "hi"}}
+		headers, err := builder.Headers(updateHeaders(update, correlationID(42, update)), update, "telegram.messages")
+		require.NoError(t, err)
+		if broker.Publish(context.Background(), Destination{Subject: "telegram.messages", Headers: headers}, update) == nil {
+			break
+		}
+	}
+
+	require.Len(t, broker.attempts, 2)
+	assert.Equal(t, "42-100", broker.attempts[0][jetstream.MsgIDHeader])
+	assert.Equal(t, broker.attempts[0], broker.attempts[1])
+}
+
+func TestJetStreamClient_MsgIDDedup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	srv := runEmbeddedJetStream(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := NewJetStreamClient(srv.ClientURL(), WithJetStreamLogger(logger))
+	require.NoError(t, client.Connect(ctx))
+	defer client.Close()
+
+	_, err := client.ProvisionStream(ctx, &StreamSpec{
+		Name:     "TELEGRAM",
+		Subjects: []string{"telegram.>"},
+		Storage:  "memory",
+		Replicas: 1,
+	}, true)
+	require.NoError(t, err)
+
+	builder, err := NewMsgIDBuilder("", 42)
+	require.NoError(t, err)
+
+	publish := func(update Update) {
+		headers, err := builder.Headers(nil, update, "telegram.messages")
+		require.NoError(t, err)
+		require.NoError(t, client.Publish(ctx, Destination{Subject: "telegram.messages", Headers: headers}, update))
+	}
+
+	// The retried update is stored once
+	publish(Update{UpdateId: 1})
+	publish(Update{UpdateId: 1})
+	publish(Update{UpdateId: 2})
+
+	conn, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	require.NoError(t, err)
+	stream, err := js.Stream(ctx, "TELEGRAM")
+	require.NoError(t, err)
+	info, err := stream.Info(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), info.State.Msgs)
+}
+
+func TestMsgIDCollision(t *testing.T) {
+	route := func(subject string) Route {
+		return Route{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: subject}}
+	}
+	disabled := false
+	off := route("telegram.old")
+	off.Enabled = &disabled
+	shadowed := route("telegram.a")
+	shadowed.ShadowSubject = &RouteSubject{Type: SubjectTypeString, Value: "telegram.shadow"}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{
+			name: "first mode",
+			cfg:  Config{Mode: "first", Routes: []Route{route("telegram.a"), route("telegram.b")}},
+		},
+		{
+			name: "all mode with one enabled route",
+			cfg:  Config{Mode: "all", Routes: []Route{route("telegram.a"), off}},
+		},
+		{
+			name: "all mode",
+			cfg:  Config{Mode: "all", Routes: []Route{route("telegram.a"), route("telegram.b")}},
+			want: "route mode all",
+		},
+		{
+			name: "shadow subject",
+			cfg:  Config{Mode: "first", Routes: []Route{shadowed}},
+			want: "shadow_subject",
+		},
+		{
+			name: "edit duplicates",
+			cfg:  Config{Mode: "first", Routes: []Route{route("telegram.a")}, EditSubjects: &EditSubjectsConfig{Enabled: true, Mode: EditSubjectsDuplicate}},
+			want: "edit_subjects duplicate",
+		},
+		{
+			name: "msg_id set",
+			cfg: Config{
+				Mode:   "all",
+				Routes: []Route{route("telegram.a"), route("telegram.b")},
+				NATS:   &NATSConfig{JetStream: &JetStreamConfig{MsgID: `str(update.UpdateId) + subject`}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if cfg.NATS == nil {
+				cfg.NATS = &NATSConfig{JetStream: &JetStreamConfig{}}
+			}
+			assert.Equal(t, tt.want, msgIDCollision(&cfg))
+		})
+	}
+}
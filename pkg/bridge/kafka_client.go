@@ -1,4 +1,4 @@
-package main
+package bridge
 
 import (
 	"context"
@@ -95,10 +95,16 @@ func (c *KafkaClient) Publish(ctx context.Context, dest Destination, data interf
 		key = []byte(dest.Key)
 	}
 
+	var headers []kafka.Header
+	for k, v := range dest.Headers {
+		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+
 	msg := kafka.Message{
-		Topic: dest.Topic,
-		Key:   key,
-		Value: payload,
+		Topic:   dest.Topic,
+		Key:     key,
+		Value:   payload,
+		Headers: headers,
 	}
 
 	err = c.writer.WriteMessages(ctx, msg)
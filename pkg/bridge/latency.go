@@ -0,0 +1,166 @@
+package bridge
+
+import (
+	"log/slog"
+	"maps"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyHeader carries the milliseconds from receiving an update from
+// Telegram to queueing its publication
+const LatencyHeader = "Tg-Bridge-Latency-Ms"
+
+// LatencyTracker starts the timing of updates as they are received. It
+// doesn't depend on where updates come from, a source calls Receive when it
+// gets an update.
+type LatencyTracker struct {
+	stats *Stats
+	// threshold is the total latency of an update logged as slow, 0 disables
+	// the warning
+	threshold time.Duration
+	now       func() time.Time
+}
+
+// NewLatencyTracker creates a tracker recording latencies to stats
+func NewLatencyTracker(stats *Stats, threshold time.Duration) *LatencyTracker {
+	return &LatencyTracker{stats: stats, threshold: threshold, now: time.Now}
+}
+
+// Receive starts the timing of an update received right now
+func (t *LatencyTracker) Receive() *UpdateTiming {
+	timing := &UpdateTiming{tracker: t, received: t.now()}
+	timing.pending.Store(1)
+	return timing
+}
+
+// UpdateTiming measures where the time of an update goes: waiting for a
+// processing slot, enrichment, routing and publication. Like UpdateRecord
+// it finishes with the last of Done and the callbacks returned by
+// Publication. A nil timing measures nothing.
+type UpdateTiming struct {
+	tracker  *LatencyTracker
+	received time.Time
+	// pending counts the processing itself and unfinished publications
+	pending atomic.Int32
+
+	mu         sync.Mutex
+	logger     *slog.Logger
+	started    time.Time
+	routeStart time.Time
+	routed     time.Time
+	published  bool
+}
+
+// Start marks the start of processing, logger receives the slow update warning
+func (u *UpdateTiming) Start(logger *slog.Logger) {
+	if u == nil {
+		return
+	}
+	now := u.tracker.now()
+	u.mu.Lock()
+	u.logger, u.started = logger, now
+	u.mu.Unlock()
+}
+
+// RouteStarted marks the start of routing
+func (u *UpdateTiming) RouteStarted() {
+	if u == nil {
+		return
+	}
+	now := u.tracker.now()
+	u.mu.Lock()
+	u.routeStart = now
+	u.mu.Unlock()
+}
+
+// Routed marks the end of routing
+func (u *UpdateTiming) Routed() {
+	if u == nil {
+		return
+	}
+	now := u.tracker.now()
+	u.mu.Lock()
+	u.routed = now
+	u.mu.Unlock()
+}
+
+// Headers returns headers with LatencyHeader set to the time since the
+// update was received, headers is shared by the publications of an update,
+// so it is copied
+func (u *UpdateTiming) Headers(headers map[string]string) map[string]string {
+	if u == nil {
+		return headers
+	}
+	headers = maps.Clone(headers)
+	if headers == nil {
+		headers = make(map[string]string, 1)
+	}
+	headers[LatencyHeader] = strconv.FormatInt(u.tracker.now().Sub(u.received).Milliseconds(), 10)
+	return headers
+}
+
+// Publication returns the callback for the result of one publication of
+// the update, it calls done first if set
+func (u *UpdateTiming) Publication(done func(error)) func(error) {
+	if u == nil {
+		return done
+	}
+	u.mu.Lock()
+	u.published = true
+	u.mu.Unlock()
+	u.pending.Add(1)
+	return func(err error) {
+		if done != nil {
+			done(err)
+		}
+		u.release()
+	}
+}
+
+// Done marks the end of processing the update
+func (u *UpdateTiming) Done() {
+	if u == nil {
+		return
+	}
+	u.release()
+}
+
+func (u *UpdateTiming) release() {
+	if u.pending.Add(-1) == 0 {
+		u.finish()
+	}
+}
+
+// finish records the latencies and warns about a slow update
+func (u *UpdateTiming) finish() {
+	end := u.tracker.now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	total := end.Sub(u.received)
+	stats := u.tracker.stats
+	stats.RecordUpdateLatency(total)
+
+	attrs := []any{"total", total}
+	if !u.started.IsZero() {
+		attrs = append(attrs, "wait", u.started.Sub(u.received))
+	}
+	if !u.routed.IsZero() {
+		route := u.routed.Sub(u.routeStart)
+		stats.RecordRouteLatency(route)
+		attrs = append(attrs, "enrich", u.routeStart.Sub(u.started), "route", route)
+		if u.published {
+			// Publication includes transcription and waiting for the publish queue
+			publish := end.Sub(u.routed)
+			stats.RecordPublishLatency(publish)
+			attrs = append(attrs, "publish", publish)
+		}
+	}
+
+	if threshold := u.tracker.threshold; threshold > 0 && total >= threshold && u.logger != nil {
+		u.logger.Warn("slow update", attrs...)
+	}
+}
@@ -0,0 +1,113 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock advances by step on every reading
+type fakeClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+func TestUpdateTiming(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	stats := NewStats()
+	clock := &fakeClock{now: time.Unix(0, 0), step: 10 * time.Millisecond}
+	tracker := NewLatencyTracker(stats, 50*time.Millisecond)
+	tracker.now = clock.Now
+
+	timing := tracker.Receive() // 0ms
+	timing.Start(logger)        // 10ms
+	timing.RouteStarted()       // 20ms
+	timing.Routed()             // 30ms
+
+	shared := map[string]string{CorrelationIDHeader: "42-1"}
+	headers := timing.Headers(shared) // 40ms
+	assert.Equal(t, map[string]string{CorrelationIDHeader: "42-1", LatencyHeader: "40"}, headers)
+	assert.NotContains(t, shared, LatencyHeader, "shared headers are not modified")
+
+	var published error
+	done := timing.Publication(func(err error) { published = err })
+	timing.Done()
+	assert.Zero(t, stats.Snapshot().UpdateLatency.Count, "the update is not finished before its publication")
+
+	done(ErrPublisherClosed) // 50ms
+	assert.ErrorIs(t, published, ErrPublisherClosed)
+
+	snap := stats.Snapshot()
+	assert.Equal(t, int64(1), snap.UpdateLatency.Count)
+	assert.Equal(t, 50*time.Millisecond, snap.UpdateLatency.Avg)
+	assert.Equal(t, 10*time.Millisecond, snap.RouteLatency.Avg)
+	assert.Equal(t, 20*time.Millisecond, snap.PublishLatency.Avg)
+
+	var warning map[string]interface{}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &warning))
+	assert.Equal(t, "slow update", warning["msg"])
+	assert.Equal(t, float64(50*time.Millisecond), warning["total"])
+	assert.Equal(t, float64(10*time.Millisecond), warning["wait"])
+	assert.Equal(t, float64(10*time.Millisecond), warning["enrich"])
+	assert.Equal(t, float64(10*time.Millisecond), warning["route"])
+	assert.Equal(t, float64(20*time.Millisecond), warning["publish"])
+
+	t.Run("fast and unrouted", func(t *testing.T) {
+		logs.Reset()
+		timing := tracker.Receive()
+		timing.Start(logger)
+		timing.Done()
+
+		assert.Empty(t, logs.String())
+		snap := stats.Snapshot()
+		assert.Equal(t, int64(2), snap.UpdateLatency.Count)
+		assert.Equal(t, int64(1), snap.RouteLatency.Count)
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var timing *UpdateTiming
+		timing.Start(logger)
+		timing.RouteStarted()
+		timing.Routed()
+		assert.Equal(t, shared, timing.Headers(shared))
+		assert.Nil(t, timing.Publication(nil))
+		timing.Done()
+	})
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	assert.Equal(t, LatencySnapshot{}, h.snapshot())
+
+	for _, d := range []time.Duration{time.Millisecond, 5 * time.Millisecond, 7 * time.Millisecond, 300 * time.Millisecond, time.Minute} {
+		h.record(d)
+	}
+
+	snap := h.snapshot()
+	assert.Equal(t, int64(5), snap.Count)
+	assert.Equal(t, []LatencyBucket{
+		{LeMs: 5, Count: 2},
+		{LeMs: 10, Count: 3},
+		{LeMs: 25, Count: 3},
+		{LeMs: 50, Count: 3},
+		{LeMs: 100, Count: 3},
+		{LeMs: 250, Count: 3},
+		{LeMs: 500, Count: 4},
+		{LeMs: 1000, Count: 4},
+		{LeMs: 2500, Count: 4},
+		{LeMs: 5000, Count: 4},
+	}, snap.Buckets)
+}
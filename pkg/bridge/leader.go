@@ -0,0 +1,185 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultLeaderBucket is the KV bucket holding leader leases by default
+const DefaultLeaderBucket = "telegram_bridge_leader"
+
+// DefaultLeaseSec is how long the lease outlives a leader that stopped renewing it by default
+const DefaultLeaseSec = 10
+
+// ErrLeadershipLost is returned by Run when the lease could not be renewed
+// or was taken over: the bridge stops polling, so another instance doesn't
+// publish the same updates
+var ErrLeadershipLost = errors.New("leadership lost")
+
+// LeaderElection keeps a single bridge of a bot polling. The leader holds
+// the bot key in a KV bucket whose TTL is the lease and rewrites it every
+// third of the lease; standbys create the key once it expires or the leader
+// releases it.
+type LeaderElection struct {
+	kv       jetstream.KeyValue
+	key      string
+	id       string
+	lease    time.Duration
+	revision atomic.Uint64
+	lost     atomic.Bool
+	logger   *slog.Logger
+}
+
+// NewLeaderElection opens the bucket on conn, creating it with lease as TTL
+// when missing. id tells the instances apart in the key value and in logs.
+func NewLeaderElection(ctx context.Context, conn *nats.Conn, bucket string, lease time.Duration, botID int64, id string, logger *slog.Logger) (*LeaderElection, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("NATS is not connected")
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	kv, err := js.KeyValue(ctx, bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(ctx, jetstream.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "telegram-nats-bridge leader leases",
+			TTL:         lease,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open leader bucket '%s': %w", bucket, err)
+	}
+
+	// The key expires by the bucket TTL, a bucket created with another
+	// lease decides
+	status, err := kv.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leader bucket status: %w", err)
+	}
+	if status.TTL() != lease {
+		logger.Warn("leader bucket TTL differs from ha.lease_sec, using the bucket TTL",
+			"bucket", bucket, "ttl", status.TTL(), "lease", lease)
+		lease = status.TTL()
+	}
+	if lease <= 0 {
+		return nil, fmt.Errorf("leader bucket '%s' has no TTL, leases would never expire", bucket)
+	}
+
+	return &LeaderElection{
+		kv:     kv,
+		key:    offsetKey(botID),
+		id:     id,
+		lease:  lease,
+		logger: logger,
+	}, nil
+}
+
+// interval is the pause between lease renewals and acquisition attempts
+func (l *LeaderElection) interval() time.Duration {
+	return l.lease / 3
+}
+
+// Acquire waits until this instance holds the lease or ctx is done
+func (l *LeaderElection) Acquire(ctx context.Context) error {
+	var leader string
+	for {
+		revision, err := l.kv.Create(ctx, l.key, []byte(l.id))
+		if err == nil {
+			l.revision.Store(revision)
+			l.logger.Info("leadership acquired", "key", l.key, "instance_id", l.id)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !isWrongLastSequence(err) {
+			l.logger.Warn("failed to acquire leadership", "error", err)
+		} else if current := l.leader(ctx); current != leader {
+			leader = current
+			l.logger.Info("standing by, another instance is the leader", "leader", leader)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.interval()):
+		}
+	}
+}
+
+// leader returns the id of the current lease holder, empty when unknown
+func (l *LeaderElection) leader(ctx context.Context) string {
+	entry, err := l.kv.Get(ctx, l.key)
+	if err != nil {
+		return ""
+	}
+	return string(entry.Value())
+}
+
+// Hold renews the lease until ctx is done. It returns an ErrLeadershipLost
+// when another instance took the lease over or renewals failed for so long
+// that the lease may expire before the next one.
+func (l *LeaderElection) Hold(ctx context.Context) error {
+	ticker := time.NewTicker(l.interval())
+	defer ticker.Stop()
+
+	// The lease runs from the last renewal request, not its response
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		attempt := time.Now()
+		revision, err := l.kv.Update(ctx, l.key, []byte(l.id), l.revision.Load())
+		switch {
+		case err == nil:
+			l.revision.Store(revision)
+			renewed = attempt
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case isWrongLastSequence(err):
+			l.lost.Store(true)
+			return fmt.Errorf("%w: lease taken over by %q", ErrLeadershipLost, l.leader(ctx))
+		case time.Since(renewed) >= l.lease-l.interval():
+			l.lost.Store(true)
+			return fmt.Errorf("%w: lease not renewed for %s: %w", ErrLeadershipLost, time.Since(renewed).Round(time.Millisecond), err)
+		default:
+			l.logger.Warn("failed to renew leadership", "error", err)
+		}
+	}
+}
+
+// Release deletes the key, so a standby takes over without waiting for the
+// lease to expire. A lease lost in the meantime is left alone.
+func (l *LeaderElection) Release(ctx context.Context) error {
+	if l.lost.Load() {
+		return nil
+	}
+	if err := l.kv.Delete(ctx, l.key, jetstream.LastRevision(l.revision.Load())); err != nil {
+		return fmt.Errorf("failed to release leadership: %w", err)
+	}
+	l.logger.Info("leadership released", "key", l.key)
+	return nil
+}
+
+// isWrongLastSequence reports a KV write rejected because the key changed,
+// i.e. it exists on Create or has a newer revision on Update
+func isWrongLastSequence(err error) bool {
+	var apiErr *jetstream.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence
+}
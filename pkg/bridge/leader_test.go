@@ -0,0 +1,323 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestElection(t *testing.T, nc *nats.Conn, lease time.Duration, id string) *LeaderElection {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	election, err := NewLeaderElection(t.Context(), nc, "test_leader", lease, 42, id, logger)
+	require.NoError(t, err)
+	return election
+}
+
+// acquireAsync starts Acquire and returns a channel closed once it succeeds
+func acquireAsync(t *testing.T, ctx context.Context, election *LeaderElection) <-chan struct{} {
+	acquired := make(chan struct{})
+	go func() {
+		if err := election.Acquire(ctx); err == nil {
+			close(acquired)
+		}
+	}()
+	return acquired
+}
+
+func TestLeaderElection(t *testing.T) {
+	srv := runEmbeddedJetStream(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	const lease = 900 * time.Millisecond
+
+	t.Run("standby takes over after the leader stops renewing", func(t *testing.T) {
+		leader := newTestElection(t, nc, lease, "a")
+		require.NoError(t, leader.Acquire(t.Context()))
+		holdCtx, stopHold := context.WithCancel(t.Context())
+		go leader.Hold(holdCtx)
+
+		standby := newTestElection(t, nc, lease, "b")
+		acquired := acquireAsync(t, t.Context(), standby)
+
+		// Renewals keep the lease alive well past its duration
+		select {
+		case <-acquired:
+			t.Fatal("standby acquired a held lease")
+		case <-time.After(2 * lease):
+		}
+
+		// The leader crashes without releasing
+		stopHold()
+		select {
+		case <-acquired:
+		case <-time.After(3 * lease):
+			t.Fatal("standby didn't take over an expired lease")
+		}
+		assert.Equal(t, "b", standby.leader(t.Context()))
+		require.NoError(t, standby.Release(t.Context()))
+	})
+
+	t.Run("release hands over without waiting for the lease", func(t *testing.T) {
+		leader := newTestElection(t, nc, 30*time.Second, "a")
+		require.NoError(t, leader.Acquire(t.Context()))
+
+		standby := newTestElection(t, nc, 30*time.Second, "b")
+		// Standbys retry every third of the lease, shorten it for the test
+		standby.lease = lease
+		acquired := acquireAsync(t, t.Context(), standby)
+		time.Sleep(100 * time.Millisecond)
+
+		require.NoError(t, leader.Release(t.Context()))
+		select {
+		case <-acquired:
+		case <-time.After(5 * time.Second):
+			t.Fatal("standby didn't take over a released lease")
+		}
+		require.NoError(t, standby.Release(t.Context()))
+	})
+
+	t.Run("lease taken over", func(t *testing.T) {
+		leader := newTestElection(t, nc, lease, "a")
+		require.NoError(t, leader.Acquire(t.Context()))
+
+		held := make(chan error, 1)
+		go func() { held <- leader.Hold(t.Context()) }()
+
+		// Someone else deletes the key and takes the lease
+		other := newTestElection(t, nc, lease, "b")
+		require.NoError(t, other.kv.Delete(t.Context(), other.key))
+		require.NoError(t, other.Acquire(t.Context()))
+
+		select {
+		case err := <-held:
+			assert.ErrorIs(t, err, ErrLeadershipLost)
+		case <-time.After(3 * lease):
+			t.Fatal("Hold didn't report the lost lease")
+		}
+
+		// Releasing the lost lease must not remove the new leader's key
+		require.NoError(t, leader.Release(t.Context()))
+		assert.Equal(t, "b", other.leader(t.Context()))
+		require.NoError(t, other.Release(t.Context()))
+	})
+
+	t.Run("acquire stops with ctx", func(t *testing.T) {
+		leader := newTestElection(t, nc, lease, "a")
+		require.NoError(t, leader.Acquire(t.Context()))
+		defer leader.Release(t.Context())
+
+		ctx, cancel := context.WithTimeout(t.Context(), lease)
+		defer cancel()
+		standby := newTestElection(t, nc, lease, "b")
+		assert.ErrorIs(t, standby.Acquire(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("bucket ttl wins", func(t *testing.T) {
+		election := newTestElection(t, nc, 5*time.Second, "a")
+		assert.Equal(t, lease, election.lease)
+	})
+}
+
+func TestNewLeaderElection_NotConnected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	_, err := NewLeaderElection(context.Background(), nil, "test_leader", time.Second, 42, "a", logger)
+	assert.Error(t, err)
+}
+
+// updateSource is a Telegram update queue shared by bridge instances, like
+// the Bot API is for bridges of one bot
+type updateSource struct {
+	mu      sync.Mutex
+	updates []Update
+	changed chan struct{}
+}
+
+func newUpdateSource() *updateSource {
+	return &updateSource{changed: make(chan struct{})}
+}
+
+func (s *updateSource) add(id int64, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, Update{
+		UpdateId: id,
+		Message:  &gotgbot.Message{MessageId: id, Chat: gotgbot.Chat{Id: 1, Type: "private"}, Text: text},
+	})
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// haTelegram polls the shared source and records the offsets it asked for
+type haTelegram struct {
+	fakeBotClient
+	source *updateSource
+
+	mu      sync.Mutex
+	offsets []int64
+}
+
+func (f *haTelegram) GetUpdatesWithTimeout(ctx context.Context, offset int64, timeout int) ([]Update, int64, error) {
+	f.mu.Lock()
+	f.offsets = append(f.offsets, offset)
+	f.mu.Unlock()
+
+	for {
+		f.source.mu.Lock()
+		var updates []Update
+		for _, update := range f.source.updates {
+			if update.UpdateId >= offset {
+				updates = append(updates, update)
+			}
+		}
+		changed := f.source.changed
+		f.source.mu.Unlock()
+
+		if len(updates) > 0 {
+			return updates, updates[len(updates)-1].UpdateId + 1, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, offset, ctx.Err()
+		}
+	}
+}
+
+func (f *haTelegram) polled() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int64(nil), f.offsets...)
+}
+
+func TestRun_HAFailover(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	srv := runEmbeddedJetStream(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("telegram.messages")
+	require.NoError(t, err)
+	next := func() string {
+		t.Helper()
+		msg, err := sub.NextMsg(10 * time.Second)
+		require.NoError(t, err)
+		var envelope PayloadEnvelope
+		require.NoError(t, json.Unmarshal(msg.Data, &envelope))
+		return envelope.Update.Message.Text
+	}
+
+	cfg, err := LoadConfigStruct(&Config{
+		Broker:        BrokerNATS,
+		TelegramToken: "unused",
+		NATS: &NATSConfig{
+			URL:         srv.ClientURL(),
+			OffsetStore: &OffsetStoreConfig{Enabled: true},
+		},
+		Routes: []Route{{
+			Condition: "update.Message != nil",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"},
+		}},
+		HA: &HAConfig{Enabled: true, LeaseSec: 3},
+	}, logger)
+	require.NoError(t, err)
+
+	source := newUpdateSource()
+	start := func(ctx context.Context, telegram *haTelegram) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			broker := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger))
+			done <- Run(ctx, cfg, Options{Logger: logger, Telegram: telegram, Broker: broker})
+		}()
+		return done
+	}
+
+	ctxA, stopA := context.WithCancel(t.Context())
+	defer stopA()
+	telegramA := &haTelegram{source: source}
+	doneA := start(ctxA, telegramA)
+
+	source.add(1, "one")
+	assert.Equal(t, "one", next())
+
+	// The standby doesn't poll while the leader holds the lease
+	ctxB, stopB := context.WithCancel(t.Context())
+	defer stopB()
+	telegramB := &haTelegram{source: source}
+	doneB := start(ctxB, telegramB)
+
+	source.add(2, "two")
+	assert.Equal(t, "two", next())
+	time.Sleep(time.Second)
+	assert.Empty(t, telegramB.polled())
+
+	// A standby stopped before it became the leader reports it
+	ctxC, stopC := context.WithCancel(t.Context())
+	telegramC := &haTelegram{source: source}
+	doneC := start(ctxC, telegramC)
+	time.Sleep(500 * time.Millisecond)
+	stopC()
+	select {
+	case err := <-doneC:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(10 * time.Second):
+		t.Fatal("standby didn't stop")
+	}
+	assert.Empty(t, telegramC.polled())
+
+	// The leader stops, the standby continues from the stored offset
+	stopA()
+	select {
+	case err := <-doneA:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("leader didn't stop")
+	}
+
+	source.add(3, "three")
+	assert.Equal(t, "three", next())
+	require.NotEmpty(t, telegramB.polled())
+	assert.Equal(t, int64(3), telegramB.polled()[0])
+
+	// Nothing was published twice
+	_, err = sub.NextMsg(500 * time.Millisecond)
+	assert.ErrorIs(t, err, nats.ErrTimeout)
+
+	stopB()
+	select {
+	case err := <-doneB:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("standby didn't stop")
+	}
+
+	// The last leader released the lease
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+	kv, err := js.KeyValue(t.Context(), DefaultLeaderBucket)
+	require.NoError(t, err)
+	_, err = kv.Get(t.Context(), offsetKey(1))
+	assert.ErrorIs(t, err, jetstream.ErrKeyNotFound)
+}
@@ -0,0 +1,248 @@
+package bridge
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UpdateLogSampler picks which updates are logged on busy bots: updates
+// whose update_id is a multiple of N or at most N per second. Picking by
+// update_id logs all records of an update or none of them, also across
+// restarts. A nil sampler logs every update.
+type UpdateLogSampler struct {
+	mu      sync.Mutex
+	every   int64
+	bucket  *tokenBucket
+	skipped int
+	now     func() time.Time
+}
+
+// NewUpdateLogSampler creates a sampler from the config, it returns nil when
+// sampling is not configured
+func NewUpdateLogSampler(cfg *UpdateSamplingConfig) *UpdateLogSampler {
+	if cfg == nil {
+		return nil
+	}
+	switch {
+	case cfg.Every > 1:
+		return &UpdateLogSampler{every: int64(cfg.Every), now: time.Now}
+	case cfg.PerSec > 0:
+		rate := float64(cfg.PerSec)
+		return &UpdateLogSampler{bucket: newTokenBucket(rate, rate, time.Now()), now: time.Now}
+	}
+	return nil
+}
+
+// Sample reports whether the update should be logged and how many updates
+// were not logged since the previous logged one
+func (s *UpdateLogSampler) Sample(updateID int64) (bool, int) {
+	if s == nil {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ok bool
+	if s.bucket != nil {
+		ok = s.bucket.take(s.now())
+	} else {
+		ok = updateID%s.every == 0
+	}
+	if !ok {
+		s.skipped++
+		return false, 0
+	}
+
+	skipped := s.skipped
+	s.skipped = 0
+	return true, skipped
+}
+
+// UpdateLog writes one "update processed" record per update with its type,
+// chat, matched routes and publish outcome. Sampled out updates are still
+// logged when processing or a publication failed.
+type UpdateLog struct {
+	sampler *UpdateLogSampler
+}
+
+// NewUpdateLog creates the update log from the config, it returns nil when
+// update_logging is off
+func NewUpdateLog(cfg *LogConfig) *UpdateLog {
+	switch cfg.UpdateLogging {
+	case UpdateLoggingOff:
+		return nil
+	case UpdateLoggingSampled:
+		return &UpdateLog{sampler: NewUpdateLogSampler(cfg.UpdateSampling)}
+	}
+	return &UpdateLog{}
+}
+
+// Start begins the record of update, it is written by the last of Done and
+// the callbacks returned by Publication
+func (l *UpdateLog) Start(update Update, logger *slog.Logger) *UpdateRecord {
+	if l == nil {
+		return nil
+	}
+
+	sampled, notLogged := l.sampler.Sample(update.UpdateId)
+	r := &UpdateRecord{
+		logger:     logger,
+		updateType: updateType(update),
+		sampled:    sampled,
+		notLogged:  notLogged,
+	}
+	if chat := updateChat(update); chat != nil {
+		r.chatID = chat.Id
+	}
+	r.pending.Store(1)
+	return r
+}
+
+// Update outcomes set before routing finishes
+const (
+	UpdateOutcomeDropped     = "dropped"
+	UpdateOutcomeRouteFailed = "route_failed"
+	UpdateOutcomePanic       = "panic"
+)
+
+// UpdateRecord collects what happened to an update. A nil record records
+// nothing.
+type UpdateRecord struct {
+	logger     *slog.Logger
+	updateType string
+	chatID     int64
+	sampled    bool
+	notLogged  int
+	// pending counts the processing itself and unfinished publications
+	pending atomic.Int32
+
+	mu        sync.Mutex
+	outcome   string
+	reason    string
+	err       error
+	routes    []string
+	published int
+	failed    int
+}
+
+// Dropped records that the update was dropped before routing
+func (r *UpdateRecord) Dropped(reason string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.outcome, r.reason = UpdateOutcomeDropped, reason
+	r.mu.Unlock()
+}
+
+// Failed records that processing stopped with outcome and err
+func (r *UpdateRecord) Failed(outcome string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.outcome, r.err = outcome, err
+	r.mu.Unlock()
+}
+
+// Routed records the routes matched by the update, destinations of unnamed
+// routes are recorded by their subject or topic
+func (r *UpdateRecord) Routed(destinations []Destination) {
+	if r == nil {
+		return
+	}
+	routes := make([]string, 0, len(destinations))
+	for _, dest := range destinations {
+		switch {
+		case dest.Route != "":
+			routes = append(routes, dest.Route)
+		case dest.Subject != "":
+			routes = append(routes, dest.Subject)
+		default:
+			routes = append(routes, dest.Topic)
+		}
+	}
+	r.mu.Lock()
+	r.routes = routes
+	r.mu.Unlock()
+}
+
+// Publication returns the callback for the result of one publication of
+// the update, nil for a nil record
+func (r *UpdateRecord) Publication() func(error) {
+	if r == nil {
+		return nil
+	}
+	r.pending.Add(1)
+	return func(err error) {
+		r.mu.Lock()
+		if err != nil {
+			r.failed++
+			if r.err == nil {
+				r.err = err
+			}
+		} else {
+			r.published++
+		}
+		r.mu.Unlock()
+		r.release()
+	}
+}
+
+// Done marks the end of processing the update
+func (r *UpdateRecord) Done() {
+	if r == nil {
+		return
+	}
+	r.release()
+}
+
+func (r *UpdateRecord) release() {
+	if r.pending.Add(-1) == 0 {
+		r.write()
+	}
+}
+
+func (r *UpdateRecord) write() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcome := r.outcome
+	switch {
+	case outcome != "":
+	case r.failed > 0:
+		outcome = "publish_failed"
+	case len(r.routes) == 0:
+		outcome = "unmatched"
+	default:
+		outcome = "published"
+	}
+	failed := r.failed > 0 || outcome == UpdateOutcomeRouteFailed || outcome == UpdateOutcomePanic
+	if !r.sampled && !failed {
+		return
+	}
+
+	attrs := []any{"update_type", r.updateType}
+	if r.chatID != 0 {
+		attrs = append(attrs, "chat_id", r.chatID)
+	}
+	attrs = append(attrs, "routes", r.routes, "outcome", outcome, "published", r.published, "failed", r.failed)
+	if r.reason != "" {
+		attrs = append(attrs, "reason", r.reason)
+	}
+	if r.err != nil {
+		attrs = append(attrs, "error", r.err)
+	}
+	if r.notLogged > 0 {
+		attrs = append(attrs, "not_logged", r.notLogged)
+	}
+
+	if failed {
+		r.logger.Warn("update processed", attrs...)
+		return
+	}
+	r.logger.Info("update processed", attrs...)
+}
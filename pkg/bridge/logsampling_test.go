@@ -0,0 +1,216 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUpdateLogSampler_Disabled(t *testing.T) {
+	assert.Nil(t, NewUpdateLogSampler(nil))
+	assert.Nil(t, NewUpdateLogSampler(&UpdateSamplingConfig{}))
+	assert.Nil(t, NewUpdateLogSampler(&UpdateSamplingConfig{Every: 1}))
+
+	var sampler *UpdateLogSampler
+	for range 3 {
+		ok, skipped := sampler.Sample(1)
+		assert.True(t, ok)
+		assert.Zero(t, skipped)
+	}
+}
+
+func TestUpdateLogSampler_Every(t *testing.T) {
+	sampler := NewUpdateLogSampler(&UpdateSamplingConfig{Every: 3})
+
+	var logged []int
+	var skippedTotal int
+	for i := range 10 {
+		if ok, skipped := sampler.Sample(int64(i)); ok {
+			logged = append(logged, i)
+			skippedTotal += skipped
+		}
+	}
+
+	assert.Equal(t, []int{0, 3, 6, 9}, logged)
+	assert.Equal(t, 6, skippedTotal)
+}
+
+func TestUpdateLogSampler_PerSec(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	sampler := NewUpdateLogSampler(&UpdateSamplingConfig{PerSec: 2})
+	sampler.now = func() time.Time { return now }
+	sampler.bucket.last = now
+
+	sample := func(n int) (logged, skipped int) {
+		for range n {
+			if ok, s := sampler.Sample(0); ok {
+				logged++
+				skipped += s
+			}
+		}
+		return logged, skipped
+	}
+
+	logged, skipped := sample(10)
+	assert.Equal(t, 2, logged)
+	assert.Zero(t, skipped)
+
+	// Half a second refills one token, the next logged line reports the 8 skipped updates
+	now = now.Add(500 * time.Millisecond)
+	logged, skipped = sample(5)
+	assert.Equal(t, 1, logged)
+	assert.Equal(t, 8, skipped)
+
+	// The bucket never holds more than a second worth of lines
+	now = now.Add(time.Minute)
+	logged, skipped = sample(10)
+	assert.Equal(t, 2, logged)
+	assert.Equal(t, 4, skipped)
+}
+
+func TestUpdateLogSampler_EveryByUpdateID(t *testing.T) {
+	// Two samplers, e.g. before and after a restart, pick the same updates
+	first := NewUpdateLogSampler(&UpdateSamplingConfig{Every: 4})
+	second := NewUpdateLogSampler(&UpdateSamplingConfig{Every: 4})
+
+	for _, id := range []int64{1000, 1001, 1003, 1004, 1008, 1010} {
+		ok, _ := first.Sample(id)
+		again, _ := second.Sample(id)
+		assert.Equal(t, id%4 == 0, ok, "update %d", id)
+		assert.Equal(t, ok, again, "update %d", id)
+	}
+}
+
+// captureUpdateLog returns a logger writing JSON records and a function
+// decoding them
+func captureUpdateLog(t *testing.T) (*slog.Logger, func() []map[string]interface{}) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	return logger, func() []map[string]interface{} {
+		var records []map[string]interface{}
+		decoder := json.NewDecoder(&buf)
+		for decoder.More() {
+			var record map[string]interface{}
+			require.NoError(t, decoder.Decode(&record))
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+func TestUpdateLog_Record(t *testing.T) {
+	logger, records := captureUpdateLog(t)
+	updateLog := NewUpdateLog(&LogConfig{UpdateLogging: UpdateLoggingAll})
+
+	update := Update{UpdateId: 7, Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100123}}}
+	record := updateLog.Start(update, logger)
+	record.Routed([]Destination{{Route: "messages", Subject: "telegram.messages"}, {Subject: "telegram.audit"}})
+	first := record.Publication()
+	second := record.Publication()
+	record.Done()
+	first(nil)
+	assert.Empty(t, records(), "written after the last publication")
+
+	second(nil)
+	got := records()
+	require.Len(t, got, 1)
+	assert.Equal(t, "INFO", got[0]["level"])
+	assert.Equal(t, "update processed", got[0]["msg"])
+	assert.Equal(t, "message", got[0]["update_type"])
+	assert.Equal(t, float64(-100123), got[0]["chat_id"])
+	assert.Equal(t, []interface{}{"messages", "telegram.audit"}, got[0]["routes"])
+	assert.Equal(t, "published", got[0]["outcome"])
+	assert.Equal(t, float64(2), got[0]["published"])
+}
+
+func TestUpdateLog_Outcomes(t *testing.T) {
+	tests := []struct {
+		name      string
+		process   func(record *UpdateRecord)
+		wantLevel string
+		want      string
+	}{
+		{
+			name:      "unmatched",
+			process:   func(record *UpdateRecord) { record.Routed(nil) },
+			wantLevel: "INFO",
+			want:      "unmatched",
+		},
+		{
+			name:      "dropped",
+			process:   func(record *UpdateRecord) { record.Dropped("bot") },
+			wantLevel: "INFO",
+			want:      UpdateOutcomeDropped,
+		},
+		{
+			name: "publish failed",
+			process: func(record *UpdateRecord) {
+				record.Routed([]Destination{{Subject: "telegram.messages"}})
+				record.Publication()(errors.New("nats: timeout"))
+			},
+			wantLevel: "WARN",
+			want:      "publish_failed",
+		},
+		{
+			name:      "route failed",
+			process:   func(record *UpdateRecord) { record.Failed(UpdateOutcomeRouteFailed, errors.New("bad route")) },
+			wantLevel: "WARN",
+			want:      UpdateOutcomeRouteFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := captureUpdateLog(t)
+			record := NewUpdateLog(&LogConfig{UpdateLogging: UpdateLoggingAll}).Start(Update{UpdateId: 1}, logger)
+			tt.process(record)
+			record.Done()
+
+			got := records()
+			require.Len(t, got, 1)
+			assert.Equal(t, tt.wantLevel, got[0]["level"])
+			assert.Equal(t, tt.want, got[0]["outcome"])
+		})
+	}
+}
+
+func TestUpdateLog_Sampled(t *testing.T) {
+	logger, records := captureUpdateLog(t)
+	updateLog := NewUpdateLog(&LogConfig{UpdateLogging: UpdateLoggingSampled, UpdateSampling: &UpdateSamplingConfig{Every: 10}})
+
+	for id := range int64(30) {
+		record := updateLog.Start(Update{UpdateId: id}, logger.With("update_id", id))
+		record.Routed([]Destination{{Subject: "telegram.messages"}})
+		publication := record.Publication()
+		record.Done()
+		if id == 15 {
+			publication(errors.New("nats: timeout"))
+		} else {
+			publication(nil)
+		}
+	}
+
+	var logged []float64
+	for _, record := range records() {
+		logged = append(logged, record["update_id"].(float64))
+	}
+	assert.Equal(t, []float64{0, 10, 15, 20}, logged, "sampled updates and every failure")
+}
+
+func TestUpdateLog_Off(t *testing.T) {
+	assert.Nil(t, NewUpdateLog(&LogConfig{UpdateLogging: UpdateLoggingOff}))
+
+	var updateLog *UpdateLog
+	record := updateLog.Start(Update{UpdateId: 1}, slog.Default())
+	assert.Nil(t, record)
+	record.Routed([]Destination{{Subject: "telegram.messages"}})
+	assert.Nil(t, record.Publication())
+	record.Done()
+}
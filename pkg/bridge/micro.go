@@ -0,0 +1,132 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// MicroServiceName is the name of the bridge in the NATS services API
+const MicroServiceName = "telegram-nats-bridge"
+
+// MicroGroup prefixes subjects of the bridge service endpoints
+const MicroGroup = "_bridge"
+
+// Version is reported to the NATS services API, set at build time with
+// -ldflags "-X github.com/IlyaPuzyrev/telegram-nats-bridge/pkg/bridge.Version=1.2.3"
+var Version = "0.0.0-dev"
+
+// MicroStats is the response of the stats endpoint and the data of
+// endpoints in $SRV.STATS
+type MicroStats struct {
+	StatsSnapshot
+	UptimeSec int64 `json:"uptime_sec"`
+}
+
+// MicroService registers the bridge as a NATS micro service with stats and
+// ping endpoints. It uses its own connection, so service requests never
+// queue behind published updates.
+type MicroService struct {
+	url     string
+	name    string
+	stats   *Stats
+	nc      *nats.Conn
+	svc     micro.Service
+	started time.Time
+	logger  *slog.Logger
+}
+
+// NewMicroService creates a new MicroService reporting stats
+func NewMicroService(url string, stats *Stats, logger *slog.Logger) *MicroService {
+	return &MicroService{
+		url:    url,
+		name:   MicroServiceName + "-micro",
+		stats:  stats,
+		logger: logger,
+	}
+}
+
+// SetConnectionName sets the client name of the service connection. Must be called before Start.
+func (m *MicroService) SetConnectionName(name string) {
+	m.name = name
+}
+
+// Start connects to NATS and registers the service
+func (m *MicroService) Start(ctx context.Context) error {
+	nc, err := connectWithContext(ctx, m.url,
+		nats.Name(m.name),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	var metadata map[string]string
+	if hash := m.stats.Snapshot().ConfigHash; hash != "" {
+		metadata = map[string]string{"config_hash": hash}
+	}
+
+	m.started = time.Now()
+	svc, err := micro.AddService(nc, micro.Config{
+		Name:        MicroServiceName,
+		Version:     Version,
+		Description: "Bridge between Telegram Bot API and NATS",
+		Metadata:    metadata,
+		StatsHandler: func(*micro.Endpoint) any {
+			return m.snapshot()
+		},
+		ErrorHandler: func(_ micro.Service, err *micro.NATSError) {
+			m.logger.Warn("NATS micro service error", "subject", err.Subject, "error", err.Description)
+		},
+	})
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to register micro service: %w", err)
+	}
+
+	group := svc.AddGroup(MicroGroup)
+	endpoints := []struct {
+		name    string
+		handler micro.HandlerFunc
+	}{
+		{name: "stats", handler: func(req micro.Request) { req.RespondJSON(m.snapshot()) }},
+		{name: "ping", handler: func(req micro.Request) { req.Respond([]byte("pong")) }},
+	}
+	for _, e := range endpoints {
+		if err := group.AddEndpoint(e.name, e.handler); err != nil {
+			svc.Stop()
+			nc.Close()
+			return fmt.Errorf("failed to add %s endpoint: %w", e.name, err)
+		}
+	}
+
+	m.nc = nc
+	m.svc = svc
+	m.logger.Info("registered NATS micro service", "name", MicroServiceName, "version", Version, "id", svc.Info().ID)
+	return nil
+}
+
+// snapshot returns the current stats with uptime
+func (m *MicroService) snapshot() MicroStats {
+	return MicroStats{
+		StatsSnapshot: m.stats.Snapshot(),
+		UptimeSec:     int64(time.Since(m.started).Seconds()),
+	}
+}
+
+// Close unregisters the service and closes its connection
+func (m *MicroService) Close() error {
+	if m.nc == nil {
+		return nil
+	}
+	if err := m.svc.Stop(); err != nil {
+		m.logger.Warn("failed to stop NATS micro service", "error", err)
+	}
+	m.nc.Close()
+	m.nc = nil
+	return nil
+}
@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runEmbeddedNATS(t *testing.T) *server.Server {
+	t.Helper()
+
+	opts := natstest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	srv := natstest.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestMicroService(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	srv := runEmbeddedNATS(t)
+
+	stats := NewStats()
+	stats.RecordPublish(PublishResult{Success: true, Duration: time.Millisecond})
+	stats.RecordPublish(PublishResult{Success: true, Duration: time.Millisecond})
+	stats.RecordPublish(PublishResult{Success: false})
+	stats.SetConfigHash("0123456789ab")
+
+	service := NewMicroService(srv.ClientURL(), stats, logger)
+	require.NoError(t, service.Start(context.Background()))
+	defer service.Close()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	t.Run("responds to $SRV.PING", func(t *testing.T) {
+		msg, err := nc.Request("$SRV.PING."+MicroServiceName, nil, time.Second)
+		require.NoError(t, err)
+
+		var ping micro.Ping
+		require.NoError(t, json.Unmarshal(msg.Data, &ping))
+		assert.Equal(t, MicroServiceName, ping.Name)
+		assert.Equal(t, Version, ping.Version)
+		assert.Equal(t, micro.PingResponseType, ping.Type)
+		assert.Equal(t, "0123456789ab", ping.Metadata["config_hash"])
+	})
+
+	t.Run("stats endpoint", func(t *testing.T) {
+		msg, err := nc.Request(MicroGroup+".stats", nil, time.Second)
+		require.NoError(t, err)
+
+		var got MicroStats
+		require.NoError(t, json.Unmarshal(msg.Data, &got))
+		assert.Equal(t, int64(2), got.Published)
+		assert.Equal(t, int64(1), got.PublishFailed)
+		assert.Equal(t, "0123456789ab", got.ConfigHash)
+	})
+
+	t.Run("ping endpoint", func(t *testing.T) {
+		msg, err := nc.Request(MicroGroup+".ping", nil, time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "pong", string(msg.Data))
+	})
+
+	t.Run("$SRV.STATS carries bridge stats", func(t *testing.T) {
+		msg, err := nc.Request("$SRV.STATS."+MicroServiceName, nil, time.Second)
+		require.NoError(t, err)
+
+		var got micro.Stats
+		require.NoError(t, json.Unmarshal(msg.Data, &got))
+		require.NotEmpty(t, got.Endpoints)
+		var data MicroStats
+		require.NoError(t, json.Unmarshal(got.Endpoints[0].Data, &data))
+		assert.Equal(t, int64(2), data.Published)
+	})
+
+	t.Run("close unregisters", func(t *testing.T) {
+		require.NoError(t, service.Close())
+		_, err := nc.Request("$SRV.PING."+MicroServiceName, nil, 100*time.Millisecond)
+		assert.Error(t, err)
+	})
+}
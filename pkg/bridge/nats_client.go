@@ -0,0 +1,1097 @@
+package bridge
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Publish errors that retrying won't fix (or not until reconnect).
+// The original nats error stays in the chain.
+var (
+	ErrMaxPayload       = errors.New("message exceeds NATS max payload")
+	ErrPermissions      = errors.New("NATS permissions violation")
+	ErrConnectionClosed = errors.New("NATS connection is closed")
+	// ErrClosed is returned after Close, it is an ErrConnectionClosed
+	ErrClosed = fmt.Errorf("NATS client is closed: %w", ErrConnectionClosed)
+)
+
+// classifyNATSError wraps a nats publish error with the matching typed error,
+// other errors are returned as is
+func classifyNATSError(err error) error {
+	switch {
+	case errors.Is(err, nats.ErrMaxPayload):
+		return fmt.Errorf("%w: %w", ErrMaxPayload, err)
+	case errors.Is(err, nats.ErrPermissionViolation), errors.Is(err, nats.ErrAuthorization):
+		return fmt.Errorf("%w: %w", ErrPermissions, err)
+	case errors.Is(err, nats.ErrConnectionClosed), errors.Is(err, nats.ErrConnectionDraining):
+		return fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+	}
+	return err
+}
+
+// reconnectPolicy is ReconnectConfig converted to durations
+type reconnectPolicy struct {
+	maxReconnects int
+	wait          time.Duration
+	maxWait       time.Duration
+	jitter        time.Duration
+}
+
+// defaultReconnectPolicy is used without WithReconnect
+var defaultReconnectPolicy = reconnectPolicy{
+	maxReconnects: DefaultMaxReconnects,
+	wait:          2 * time.Second,
+	maxWait:       2 * time.Second,
+	jitter:        100 * time.Millisecond,
+}
+
+func newReconnectPolicy(cfg ReconnectConfig) reconnectPolicy {
+	policy := reconnectPolicy{
+		maxReconnects: DefaultMaxReconnects,
+		wait:          time.Duration(cfg.WaitSec) * time.Second,
+		maxWait:       time.Duration(cfg.MaxWaitSec) * time.Second,
+		jitter:        time.Duration(cfg.JitterMs) * time.Millisecond,
+	}
+	if cfg.MaxReconnects != nil {
+		policy.maxReconnects = *cfg.MaxReconnects
+	}
+	return policy
+}
+
+// delay returns the pause before reconnect round attempts (from 1): wait
+// doubled after every failed round up to maxWait, plus a random jitter
+func (p reconnectPolicy) delay(attempts int) time.Duration {
+	d := p.wait
+	for i := 1; i < attempts && d < p.maxWait; i++ {
+		d = min(2*d, p.maxWait)
+	}
+	if p.jitter > 0 {
+		d += rand.N(p.jitter)
+	}
+	return d
+}
+
+// options returns the nats reconnect options of the policy
+func (p reconnectPolicy) options() []nats.Option {
+	return []nats.Option{
+		nats.MaxReconnects(p.maxReconnects),
+		nats.ReconnectWait(p.wait),
+		nats.ReconnectJitter(p.jitter, p.jitter),
+		nats.CustomReconnectDelay(p.delay),
+	}
+}
+
+// closedHandler calls onClosed when the connection is closed because
+// reconnects gave up, not by Close
+func closedHandler(closing *atomic.Bool, onClosed func(), logger *slog.Logger) nats.ConnHandler {
+	return func(nc *nats.Conn) {
+		if closing.Load() {
+			return
+		}
+		logger.Error("NATS connection closed permanently", "error", nc.LastError())
+		if onClosed != nil {
+			onClosed()
+		}
+	}
+}
+
+// DefaultNATSConnectionName is the client name of connections without nats.connection_name
+const DefaultNATSConnectionName = "telegram-nats-bridge"
+
+// natsConnectionName expands {bot} and {hostname} in the nats.connection_name template
+func natsConnectionName(template, bot string) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return strings.NewReplacer("{bot}", bot, "{hostname}", hostname).Replace(template)
+}
+
+// NATSClient implements BrokerInterface. Publish is called from publisher
+// workers while Connect and Close may run, so the connection is an atomic
+// pointer.
+type NATSClient struct {
+	url          string
+	conn         atomic.Pointer[nats.Conn]
+	name         string
+	noEcho       bool
+	pendingLimit int
+	reconnect    reconnectPolicy
+	onClosed     func()
+	onReconnect  func()
+	onDisconnect func(error)
+	// natsOpts are applied after the options built by Connect
+	natsOpts []nats.Option
+	// shared is set by WithConnection: the connection belongs to the caller,
+	// Connect doesn't dial and Close doesn't close it
+	shared bool
+	// mu serializes storing the connection in Connect with Close
+	mu      sync.Mutex
+	closing atomic.Bool
+	logger  *slog.Logger
+}
+
+// NATSClientOption customizes a NATSClient created by NewNATSClient
+type NATSClientOption func(*NATSClient)
+
+// WithNATSLogger sets the client logger, slog.Default() by default
+func WithNATSLogger(logger *slog.Logger) NATSClientOption {
+	return func(c *NATSClient) { c.logger = logger }
+}
+
+// WithConnectionName sets the client name reported to the server,
+// DefaultNATSConnectionName by default
+func WithConnectionName(name string) NATSClientOption {
+	return func(c *NATSClient) { c.name = name }
+}
+
+// WithReconnect sets how a lost connection is reestablished. By default the
+// client reconnects every 2 seconds up to DefaultMaxReconnects times.
+func WithReconnect(cfg ReconnectConfig) NATSClientOption {
+	return func(c *NATSClient) { c.reconnect = newReconnectPolicy(cfg) }
+}
+
+// WithPendingLimit bounds the buffer of outgoing data kept while disconnected
+func WithPendingLimit(bytes int) NATSClientOption {
+	return func(c *NATSClient) { c.pendingLimit = bytes }
+}
+
+// WithNoEcho stops the server from delivering own publications to own subscriptions
+func WithNoEcho(noEcho bool) NATSClientOption {
+	return func(c *NATSClient) { c.noEcho = noEcho }
+}
+
+// WithUserInfo authenticates with a user and a password
+func WithUserInfo(user, password string) NATSClientOption {
+	return WithNATSOptions(nats.UserInfo(user, password))
+}
+
+// WithNATSToken authenticates with a token
+func WithNATSToken(token string) NATSClientOption {
+	return WithNATSOptions(nats.Token(token))
+}
+
+// WithCredentialsFile authenticates with a JWT and NKey seed from a .creds file
+func WithCredentialsFile(path string) NATSClientOption {
+	return WithNATSOptions(nats.UserCredentials(path))
+}
+
+// WithTLSConfig connects over TLS with the given configuration
+func WithTLSConfig(tlsConfig *tls.Config) NATSClientOption {
+	return WithNATSOptions(nats.Secure(tlsConfig))
+}
+
+// WithErrorHandler sets the handler of asynchronous errors such as slow
+// consumers and permission violations reported by the server
+func WithErrorHandler(handler nats.ErrHandler) NATSClientOption {
+	return WithNATSOptions(nats.ErrorHandler(handler))
+}
+
+// WithDisconnectHandler sets the function called when the connection is
+// lost, after the disconnect is logged
+func WithDisconnectHandler(onDisconnect func(error)) NATSClientOption {
+	return func(c *NATSClient) { c.onDisconnect = onDisconnect }
+}
+
+// WithClosedHandler sets the function called when reconnects give up and
+// the connection is closed for good
+func WithClosedHandler(onClosed func()) NATSClientOption {
+	return func(c *NATSClient) { c.onClosed = onClosed }
+}
+
+// WithReconnectHandler sets the function called after the connection is reestablished
+func WithReconnectHandler(onReconnect func()) NATSClientOption {
+	return func(c *NATSClient) { c.onReconnect = onReconnect }
+}
+
+// WithNATSOptions passes nats options the client doesn't wrap. They are
+// applied last and override the options built by the client, replacing its
+// connection handlers disables the logging and callbacks above.
+func WithNATSOptions(opts ...nats.Option) NATSClientOption {
+	return func(c *NATSClient) { c.natsOpts = append(c.natsOpts, opts...) }
+}
+
+// WithConnection makes the client publish over an established connection,
+// e.g. one shared with the rest of the application. Connect doesn't dial,
+// Close leaves the connection open, and the connection options and handlers
+// above have no effect: they belong to whoever created the connection.
+func WithConnection(conn *nats.Conn) NATSClientOption {
+	return func(c *NATSClient) {
+		c.conn.Store(conn)
+		c.shared = true
+	}
+}
+
+// NewNATSClient creates a new NATS client
+func NewNATSClient(url string, opts ...NATSClientOption) *NATSClient {
+	c := &NATSClient{
+		url:       url,
+		name:      DefaultNATSConnectionName,
+		reconnect: defaultReconnectPolicy,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// PendingBytes returns the size of outgoing data not yet sent to the server
+func (c *NATSClient) PendingBytes() int {
+	return pendingBytes(c.conn.Load())
+}
+
+// Connect establishes connection to NATS server. Calling it again replaces
+// the connection, after Close it returns ErrClosed.
+func (c *NATSClient) Connect(ctx context.Context) error {
+	if c.closing.Load() {
+		return ErrClosed
+	}
+
+	if c.shared {
+		if conn := c.conn.Load(); conn == nil || conn.IsClosed() {
+			return fmt.Errorf("failed to connect to NATS: %w", ErrConnectionClosed)
+		}
+		return nil
+	}
+
+	c.logger.Info("connecting to NATS", "url", c.url, "name", c.name)
+
+	timeout := 30 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+		if timeout < 0 {
+			timeout = 0
+		}
+	}
+
+	opts := []nats.Option{
+		nats.Name(c.name),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			c.logger.Warn("NATS disconnected", "error", err)
+			if c.onDisconnect != nil {
+				c.onDisconnect(err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			c.logger.Info("NATS reconnected", "url", nc.ConnectedUrl())
+			if c.onReconnect != nil {
+				c.onReconnect()
+			}
+		}),
+		nats.ClosedHandler(closedHandler(&c.closing, c.onClosed, c.logger)),
+		nats.Timeout(timeout),
+	}
+	opts = append(opts, c.reconnect.options()...)
+	if c.pendingLimit > 0 {
+		opts = append(opts, nats.ReconnectBufSize(c.pendingLimit))
+	}
+	if c.noEcho {
+		opts = append(opts, nats.NoEcho())
+	}
+	opts = append(opts, c.natsOpts...)
+
+	conn, err := connectWithContext(ctx, c.url, opts...)
+	if err != nil {
+		c.logger.Error("failed to connect to NATS", "error", err)
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.closing.Load() {
+		c.mu.Unlock()
+		// Close was called while connecting
+		conn.SetClosedHandler(nil)
+		conn.Close()
+		return ErrClosed
+	}
+	prev := c.conn.Swap(conn)
+	c.mu.Unlock()
+
+	if prev != nil {
+		// The replaced connection is not lost, don't report it
+		prev.SetClosedHandler(nil)
+		prev.Close()
+	}
+	c.logger.Info("connected to NATS", "server", conn.ConnectedUrl())
+	return nil
+}
+
+// Publish sends a message to the specified subject. It returns ErrClosed
+// after Close.
+func (c *NATSClient) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	if c.closing.Load() {
+		return ErrClosed
+	}
+
+	conn := c.conn.Load()
+	if conn == nil {
+		return fmt.Errorf("NATS connection is not established")
+	}
+
+	if conn.IsClosed() {
+		return c.closedErr()
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		c.logger.Error("failed to marshal data", "error", err)
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if err := conn.PublishMsg(newNATSMsg(dest, payload)); err != nil {
+		if c.closing.Load() {
+			return ErrClosed
+		}
+		c.logger.Error("failed to publish message", "subject", dest.Subject, "error", err)
+		return fmt.Errorf("failed to publish message: %w", classifyNATSError(err))
+	}
+
+	if err := conn.Flush(); err != nil {
+		if c.closing.Load() {
+			return ErrClosed
+		}
+		c.logger.Error("failed to flush NATS connection", "error", err)
+		return fmt.Errorf("failed to flush: %w", classifyNATSError(err))
+	}
+
+	c.logger.Debug("message published", "subject", dest.Subject, "size", len(payload))
+	return nil
+}
+
+// Request sends a request to the specified subject and waits for a reply until ctx is done
+func (c *NATSClient) Request(ctx context.Context, subject string, data interface{}) ([]byte, error) {
+	return request(ctx, c.conn.Load(), subject, data)
+}
+
+// RequestMsg is Request returning the whole reply with its headers
+func (c *NATSClient) RequestMsg(ctx context.Context, subject string, data interface{}) (*nats.Msg, error) {
+	return requestMsg(ctx, c.conn.Load(), subject, data)
+}
+
+// closedErr tells Close by the bridge from a connection lost for good
+func (c *NATSClient) closedErr() error {
+	if c.closing.Load() {
+		return ErrClosed
+	}
+	return ErrConnectionClosed
+}
+
+// Close closes the NATS connection. It is safe to call more than once and
+// concurrently with Publish.
+func (c *NATSClient) Close() error {
+	c.mu.Lock()
+	if c.closing.Load() {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closing.Store(true)
+	conn := c.conn.Load()
+	c.mu.Unlock()
+
+	if conn == nil || c.shared {
+		return nil
+	}
+
+	c.logger.Info("closing NATS connection")
+	conn.Close()
+	c.logger.Info("NATS connection closed")
+	return nil
+}
+
+// Ensure NATSClient implements BrokerInterface
+var _ NATSClientInterface = (*NATSClient)(nil)
+
+// JetStreamClient implements BrokerInterface for JetStream
+type JetStreamClient struct {
+	url          string
+	nc           *nats.Conn
+	js           jetstream.JetStream
+	name         string
+	noEcho       bool
+	pendingLimit int
+	reconnect    reconnectPolicy
+	onClosed     func()
+	onReconnect  func()
+	closing      atomic.Bool
+	logger       *slog.Logger
+}
+
+// JetStreamClientOption customizes a JetStreamClient created by NewJetStreamClient
+type JetStreamClientOption func(*JetStreamClient)
+
+// WithJetStreamLogger sets the client logger, slog.Default() by default
+func WithJetStreamLogger(logger *slog.Logger) JetStreamClientOption {
+	return func(c *JetStreamClient) { c.logger = logger }
+}
+
+// WithJetStreamConnectionName sets the client name reported to the server,
+// DefaultNATSConnectionName by default
+func WithJetStreamConnectionName(name string) JetStreamClientOption {
+	return func(c *JetStreamClient) { c.name = name }
+}
+
+// WithJetStreamReconnect sets how a lost connection is reestablished, see WithReconnect
+func WithJetStreamReconnect(cfg ReconnectConfig) JetStreamClientOption {
+	return func(c *JetStreamClient) { c.reconnect = newReconnectPolicy(cfg) }
+}
+
+// WithJetStreamPendingLimit bounds the buffer of outgoing data kept while disconnected
+func WithJetStreamPendingLimit(bytes int) JetStreamClientOption {
+	return func(c *JetStreamClient) { c.pendingLimit = bytes }
+}
+
+// WithJetStreamNoEcho stops the server from delivering own publications to own subscriptions
+func WithJetStreamNoEcho(noEcho bool) JetStreamClientOption {
+	return func(c *JetStreamClient) { c.noEcho = noEcho }
+}
+
+// WithJetStreamClosedHandler sets the function called when reconnects give
+// up and the connection is closed for good
+func WithJetStreamClosedHandler(onClosed func()) JetStreamClientOption {
+	return func(c *JetStreamClient) { c.onClosed = onClosed }
+}
+
+// WithJetStreamReconnectHandler sets the function called after the connection is reestablished
+func WithJetStreamReconnectHandler(onReconnect func()) JetStreamClientOption {
+	return func(c *JetStreamClient) { c.onReconnect = onReconnect }
+}
+
+// NewJetStreamClient creates a new JetStream client
+func NewJetStreamClient(url string, opts ...JetStreamClientOption) *JetStreamClient {
+	c := &JetStreamClient{
+		url:       url,
+		name:      DefaultNATSConnectionName,
+		reconnect: defaultReconnectPolicy,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// PendingBytes returns the size of outgoing data not yet sent to the server
+func (c *JetStreamClient) PendingBytes() int {
+	return pendingBytes(c.nc)
+}
+
+// Connect establishes connection to NATS server with JetStream
+func (c *JetStreamClient) Connect(ctx context.Context) error {
+	c.logger.Info("connecting to NATS with JetStream", "url", c.url, "name", c.name)
+
+	timeout := 30 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+		if timeout < 0 {
+			timeout = 0
+		}
+	}
+
+	opts := []nats.Option{
+		nats.Name(c.name),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			c.logger.Warn("NATS disconnected", "error", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			c.logger.Info("NATS reconnected", "url", nc.ConnectedUrl())
+			if c.onReconnect != nil {
+				c.onReconnect()
+			}
+		}),
+		nats.ClosedHandler(closedHandler(&c.closing, c.onClosed, c.logger)),
+		nats.Timeout(timeout),
+	}
+	opts = append(opts, c.reconnect.options()...)
+	if c.pendingLimit > 0 {
+		opts = append(opts, nats.ReconnectBufSize(c.pendingLimit))
+	}
+	if c.noEcho {
+		opts = append(opts, nats.NoEcho())
+	}
+
+	nc, err := connectWithContext(ctx, c.url, opts...)
+	if err != nil {
+		c.logger.Error("failed to connect to NATS", "error", err)
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		c.logger.Error("failed to create JetStream context", "error", err)
+		c.closing.Store(true)
+		nc.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	c.nc = nc
+	c.js = js
+	c.logger.Info("connected to NATS with JetStream", "server", nc.ConnectedUrl())
+	return nil
+}
+
+// Publish sends a message to the specified subject via JetStream
+func (c *JetStreamClient) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	if c.nc == nil {
+		return fmt.Errorf("NATS connection is not established")
+	}
+
+	if c.nc.IsClosed() {
+		return ErrConnectionClosed
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		c.logger.Error("failed to marshal data", "error", err)
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	var opts []jetstream.PublishOpt
+	if dest.Stream != "" {
+		// Fail instead of silently storing into another stream bound to the subject
+		opts = append(opts, jetstream.WithExpectStream(dest.Stream))
+	}
+
+	_, err = c.js.PublishMsg(ctx, newNATSMsg(dest, payload), opts...)
+	if err != nil {
+		c.logger.Error("failed to publish message", "subject", dest.Subject, "error", err)
+		return fmt.Errorf("failed to publish message: %w", classifyNATSError(err))
+	}
+
+	c.logger.Debug("message published via JetStream", "subject", dest.Subject, "size", len(payload))
+	return nil
+}
+
+// Request sends a core NATS request to the specified subject and waits for a reply until ctx is done
+func (c *JetStreamClient) Request(ctx context.Context, subject string, data interface{}) ([]byte, error) {
+	return request(ctx, c.nc, subject, data)
+}
+
+// RequestMsg is Request returning the whole reply with its headers
+func (c *JetStreamClient) RequestMsg(ctx context.Context, subject string, data interface{}) (*nats.Msg, error) {
+	return requestMsg(ctx, c.nc, subject, data)
+}
+
+// Close closes the NATS connection
+func (c *JetStreamClient) Close() error {
+	if c.nc == nil {
+		return nil
+	}
+
+	c.logger.Info("closing NATS connection")
+	c.closing.Store(true)
+	c.nc.Close()
+	c.logger.Info("NATS connection closed")
+	return nil
+}
+
+// Ensure JetStreamClient implements BrokerInterface
+var _ NATSClientInterface = (*JetStreamClient)(nil)
+
+// Ensure NATS clients implement RequesterInterface
+var (
+	_ RequesterInterface = (*NATSClient)(nil)
+	_ RequesterInterface = (*JetStreamClient)(nil)
+)
+
+// newNATSMsg creates a NATS message with destination headers
+func newNATSMsg(dest Destination, payload []byte) *nats.Msg {
+	msg := nats.NewMsg(dest.Subject)
+	msg.Data = payload
+	for k, v := range dest.Headers {
+		msg.Header.Set(k, v)
+	}
+	return msg
+}
+
+// connectWithContext connects to NATS and returns ctx.Err() as soon as ctx is done.
+// nats.Connect doesn't accept a context, so a connection established after
+// cancellation is closed in background.
+func connectWithContext(ctx context.Context, url string, opts ...nats.Option) (*nats.Conn, error) {
+	type result struct {
+		conn *nats.Conn
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		conn, err := nats.Connect(url, opts...)
+		done <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				// The abandoned connection is not lost, don't report it
+				r.conn.SetClosedHandler(nil)
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.conn, r.err
+	}
+}
+
+func pendingBytes(conn *nats.Conn) int {
+	if conn == nil {
+		return 0
+	}
+	n, err := conn.Buffered()
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func request(ctx context.Context, conn *nats.Conn, subject string, data interface{}) ([]byte, error) {
+	msg, err := requestMsg(ctx, conn, subject, data)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Data, nil
+}
+
+func requestMsg(ctx context.Context, conn *nats.Conn, subject string, data interface{}) (*nats.Msg, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("NATS connection is not established")
+	}
+
+	if conn.IsClosed() {
+		return nil, ErrConnectionClosed
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	msg, err := conn.RequestWithContext(ctx, subject, payload)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", subject, err)
+	}
+
+	return msg, nil
+}
+
+// loadStreamConfig reads a JetStream stream config from a JSON file
+func loadStreamConfig(configPath string) (jetstream.StreamConfig, error) {
+	var streamCfg jetstream.StreamConfig
+
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return streamCfg, fmt.Errorf("failed to read stream config file: %w", err)
+	}
+
+	if err := json.Unmarshal(configData, &streamCfg); err != nil {
+		return streamCfg, fmt.Errorf("failed to parse stream config: %w", err)
+	}
+
+	return streamCfg, nil
+}
+
+// EnsureStream creates or updates a JetStream stream based on config file
+func (c *JetStreamClient) EnsureStream(ctx context.Context, configPath string) error {
+	if c.js == nil {
+		return fmt.Errorf("JetStream is not connected")
+	}
+
+	streamCfg, err := loadStreamConfig(configPath)
+	if err != nil {
+		c.logger.Error("failed to load stream config", "path", configPath, "error", err)
+		return err
+	}
+
+	_, err = c.js.CreateOrUpdateStream(ctx, streamCfg)
+	if err != nil {
+		c.logger.Error("failed to create/update stream", "name", streamCfg.Name, "error", err)
+		return fmt.Errorf("failed to create/update stream: %w", err)
+	}
+
+	c.logger.Info("stream created/updated", "name", streamCfg.Name)
+	return nil
+}
+
+type publishTask struct {
+	dest Destination
+	data interface{}
+	// shadow tasks are best effort: dropped when the queue is full, their
+	// results are only logged
+	shadow bool
+	// done receives the result of the publication if set
+	done func(error)
+	// key picks the worker queue, attempt counts failed publications
+	key     uint64
+	attempt int
+}
+
+// ErrPublisherClosed is passed to PublishTracked callbacks of publications
+// that were not queued because the publisher is closed
+var ErrPublisherClosed = errors.New("publisher is closed")
+
+// PublishResult describes the outcome of a single publish task
+type PublishResult struct {
+	Destination Destination
+	Success     bool
+	Err         error
+	Duration    time.Duration
+	// Attempts is the number of publications made, more than 1 after retries
+	Attempts int
+}
+
+// PublishResultHandler receives the result of every publish task.
+// It is called from publisher workers and must be safe for concurrent use.
+type PublishResultHandler func(PublishResult)
+
+// RequestHandler handles tasks for destinations with Request set.
+// It is called from publisher workers so slow replies never block polling.
+type RequestHandler func(ctx context.Context, dest Destination, data interface{})
+
+// DefaultPublishTimeout bounds a single publication
+const DefaultPublishTimeout = 5 * time.Second
+
+// defaultWorkerQueueSize is the queue size of every worker unless SetQueueSize is called
+const defaultWorkerQueueSize = 2
+
+// Publisher publishes on a pool of workers. Every worker has its own queue:
+// tasks queued with the same key go to the same worker and are published
+// in the order they were queued.
+type Publisher struct {
+	workers        int
+	timeoutSec     int
+	publishTimeout time.Duration
+	tasks          []chan publishTask
+	next           atomic.Uint64
+	brokerClient   BrokerInterface
+	onResult       PublishResultHandler
+	onRequest      RequestHandler
+	logger         *slog.Logger
+	wg             sync.WaitGroup
+	// ctx aborts publications in progress, it is cancelled when Close
+	// gives up waiting for the queues to drain
+	ctx    context.Context
+	cancel context.CancelFunc
+	// closing is closed by Close to release calls waiting for a slot
+	closing   chan struct{}
+	closeOnce sync.Once
+	// queuesMu is held for reading while a task is queued, Close takes it
+	// for writing before closing the queues, so no send hits a closed queue
+	queuesMu sync.RWMutex
+	closed   bool
+	// Transient errors are retried up to maxAttempts, failed tasks go to
+	// deadLetter if set
+	maxAttempts  int
+	retryBackoff time.Duration
+	deadLetter   *Destination
+	retries      sync.WaitGroup
+}
+
+func NewPublisher(workers, timeoutSec int, brokerClient BrokerInterface, logger *slog.Logger) *Publisher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Publisher{
+		workers:        workers,
+		timeoutSec:     timeoutSec,
+		publishTimeout: DefaultPublishTimeout,
+		tasks:          newWorkerQueues(workers, defaultWorkerQueueSize),
+		brokerClient:   brokerClient,
+		logger:         logger,
+		ctx:            ctx,
+		cancel:         cancel,
+		closing:        make(chan struct{}),
+		maxAttempts:    1,
+	}
+}
+
+func newWorkerQueues(workers, size int) []chan publishTask {
+	tasks := make([]chan publishTask, workers)
+	for i := range tasks {
+		tasks[i] = make(chan publishTask, size)
+	}
+	return tasks
+}
+
+// SetPublishTimeout sets the timeout of a single publication.
+// Must be called before Start.
+func (p *Publisher) SetPublishTimeout(timeout time.Duration) {
+	p.publishTimeout = timeout
+}
+
+// SetQueueSize sets how many tasks may wait for workers in total, split
+// evenly between the worker queues (at least one per worker).
+// Must be called before Start.
+func (p *Publisher) SetQueueSize(size int) {
+	p.tasks = newWorkerQueues(p.workers, max(1, (size+p.workers-1)/p.workers))
+}
+
+// SetRetry makes workers publish a task up to maxAttempts times when the
+// error is transient, waiting backoff before the second attempt and twice
+// as long before every next one. Must be called before Start.
+func (p *Publisher) SetRetry(maxAttempts int, backoff time.Duration) {
+	p.maxAttempts = max(1, maxAttempts)
+	p.retryBackoff = backoff
+}
+
+// SetDeadLetter sets the destination of publications that failed with a
+// permanent error or ran out of attempts. Must be called before Start.
+func (p *Publisher) SetDeadLetter(dest Destination) {
+	p.deadLetter = &dest
+}
+
+// SetResultHandler sets an optional handler for publish results.
+// Must be called before Start.
+func (p *Publisher) SetResultHandler(handler PublishResultHandler) {
+	p.onResult = handler
+}
+
+// SetRequestHandler sets the handler for request-reply destinations.
+// Must be called before Start.
+func (p *Publisher) SetRequestHandler(handler RequestHandler) {
+	p.onRequest = handler
+}
+
+func (p *Publisher) Start() {
+	for _, tasks := range p.tasks {
+		p.wg.Add(1)
+		go p.worker(tasks)
+	}
+	p.logger.Info("publisher started", "workers", p.workers)
+}
+
+func (p *Publisher) worker(tasks <-chan publishTask) {
+	defer p.wg.Done()
+
+	// The queue is closed by Close, tasks queued before are still published
+	for task := range tasks {
+		if p.ctx.Err() != nil {
+			p.discard(task)
+			continue
+		}
+		if rp := runRecovered(func() { p.publishTask(task) }); rp != nil {
+			p.logger.Error("panic while publishing message",
+				"destination", task.dest,
+				"panic", rp.value,
+				"stack", string(rp.stack))
+		}
+	}
+}
+
+func (p *Publisher) publishTask(task publishTask) {
+	if task.dest.Request && p.onRequest != nil {
+		p.onRequest(p.ctx, task.dest, task.data)
+		if task.done != nil {
+			task.done(nil)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.publishTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.brokerClient.Publish(ctx, task.dest, task.data)
+	if task.shadow {
+		if err != nil {
+			p.logger.Warn("failed to publish to shadow subject", "subject", task.dest.Subject, "error", err)
+		}
+		return
+	}
+	task.attempt++
+	if err != nil && task.attempt < p.maxAttempts && retryablePublishError(err) {
+		p.retry(task, err)
+		return
+	}
+	if err != nil {
+		p.logger.Error("failed to publish message", "destination", task.dest, "attempts", task.attempt, "error", err)
+		p.publishDeadLetter(task, err)
+	}
+	p.finish(task, err, time.Since(start))
+}
+
+// finish reports the final result of task
+func (p *Publisher) finish(task publishTask, err error, duration time.Duration) {
+	if task.done != nil {
+		task.done(err)
+	}
+
+	if p.onResult != nil {
+		p.onResult(PublishResult{
+			Destination: task.dest,
+			Success:     err == nil,
+			Err:         err,
+			Duration:    duration,
+			Attempts:    task.attempt,
+		})
+	}
+}
+
+// discard fails a task that is dropped because the publisher is closed
+func (p *Publisher) discard(task publishTask) {
+	if !task.shadow {
+		p.finish(task, ErrPublisherClosed, 0)
+	}
+}
+
+// Publish queues a publication that needs no ordering on the next worker
+func (p *Publisher) Publish(dest Destination, data interface{}) {
+	p.submit(p.next.Add(1), publishTask{dest: dest, data: data})
+}
+
+// PublishOrdered queues a publication on the worker picked by key, so
+// publications of one update keep their relative order. A retried
+// publication is queued again behind the ones queued meanwhile.
+func (p *Publisher) PublishOrdered(key uint64, dest Destination, data interface{}) {
+	p.submit(key, publishTask{dest: dest, data: data})
+}
+
+// PublishTracked is PublishOrdered that calls done with the result of the
+// publication, or with ErrPublisherClosed when it is not queued because the
+// publisher is closed or is still queued when the shutdown timeout expires.
+// done is called exactly once.
+func (p *Publisher) PublishTracked(key uint64, dest Destination, data interface{}, done func(error)) {
+	if !p.submit(key, publishTask{dest: dest, data: data, done: done}) && done != nil {
+		done(ErrPublisherClosed)
+	}
+}
+
+// TryPublish queues a publication that needs no ordering without waiting:
+// it returns false when the queue of the next worker is full or the
+// publisher is closed, the caller decides whether to drop or retry
+func (p *Publisher) TryPublish(dest Destination, data interface{}) bool {
+	return p.trySubmit(p.next.Add(1), publishTask{dest: dest, data: data})
+}
+
+// PublishShadow queues a shadow publication after the publications with the
+// same key without waiting for a free slot, so it never holds up primary
+// publications
+func (p *Publisher) PublishShadow(key uint64, dest Destination, data interface{}) {
+	if p.trySubmit(key, publishTask{dest: dest, data: data, shadow: true}) {
+		return
+	}
+	select {
+	case <-p.closing:
+	default:
+		p.logger.Warn("publish queue is full, shadow publication dropped", "subject", dest.Subject)
+	}
+}
+
+// submit waits for a free slot in the queue of key until the publisher is
+// closed, it reports whether task was queued
+func (p *Publisher) submit(key uint64, task publishTask) bool {
+	p.queuesMu.RLock()
+	defer p.queuesMu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	task.key = key
+	select {
+	case <-p.closing:
+		return false
+	case p.queue(key) <- task:
+		return true
+	}
+}
+
+// trySubmit queues task only if the queue of key has a free slot
+func (p *Publisher) trySubmit(key uint64, task publishTask) bool {
+	p.queuesMu.RLock()
+	defer p.queuesMu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	task.key = key
+	select {
+	case p.queue(key) <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// queue returns the queue of the worker handling key
+func (p *Publisher) queue(key uint64) chan publishTask {
+	return p.tasks[key%uint64(len(p.tasks))]
+}
+
+// Pending returns the number of queued messages not yet taken by workers
+func (p *Publisher) Pending() int {
+	var pending int
+	for _, tasks := range p.tasks {
+		pending += len(tasks)
+	}
+	return pending
+}
+
+// Close stops accepting publications and lets the workers publish the
+// queued ones up to the shutdown timeout. Then publications in progress are
+// aborted and the ones still queued are dropped, their PublishTracked
+// callbacks get ErrPublisherClosed. Publish calls blocked on a full queue
+// return; calls after Close are no-ops. It is safe to call more than once.
+func (p *Publisher) Close() {
+	p.closeOnce.Do(p.close)
+}
+
+func (p *Publisher) close() {
+	// Release Publish calls waiting for a slot first, they hold queuesMu
+	// until they return
+	close(p.closing)
+	p.queuesMu.Lock()
+	p.closed = true
+	for _, tasks := range p.tasks {
+		close(tasks)
+	}
+	p.queuesMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		// Workers are done, retries still pending publish on their own
+		p.retries.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(time.Duration(p.timeoutSec) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-done:
+		p.logger.Info("publisher closed")
+	case <-timer.C:
+		p.logger.Warn("publisher close timeout, dropping queued publications",
+			"timeout_sec", p.timeoutSec, "pending", p.Pending())
+	}
+
+	p.cancel()
+	// Workers stuck in a publication leave the rest of their queue here
+	for _, tasks := range p.tasks {
+		for task := range tasks {
+			p.discard(task)
+		}
+	}
+}
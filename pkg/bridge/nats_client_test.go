@@ -0,0 +1,1222 @@
+package bridge
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNATSClient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewNATSClient("nats://localhost:4222", WithNATSLogger(logger))
+
+	assert.NotNil(t, client)
+	assert.Equal(t, "nats://localhost:4222", client.url)
+	assert.NotNil(t, client.logger)
+	assert.Nil(t, client.conn.Load())
+	assert.Equal(t, defaultReconnectPolicy, client.reconnect)
+}
+
+func TestNewNATSClient_Defaults(t *testing.T) {
+	client := NewNATSClient("nats://localhost:4222")
+
+	assert.Equal(t, slog.Default(), client.logger)
+	assert.Equal(t, DefaultNATSConnectionName, client.name)
+	assert.Equal(t, defaultReconnectPolicy, client.reconnect)
+	assert.Zero(t, client.pendingLimit)
+	assert.False(t, client.noEcho)
+	assert.Empty(t, client.natsOpts)
+	assert.False(t, client.shared)
+}
+
+func TestNATSClient_Options(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Run("connection settings", func(t *testing.T) {
+		srv := runEmbeddedNATS(t)
+		maxReconnects := 3
+		client := NewNATSClient(srv.ClientURL(),
+			WithNATSLogger(logger),
+			WithConnectionName("bridge-test"),
+			WithReconnect(ReconnectConfig{MaxReconnects: &maxReconnects, WaitSec: 1, MaxWaitSec: 4}),
+			WithPendingLimit(1024),
+			WithNoEcho(true),
+		)
+		require.NoError(t, client.Connect(t.Context()))
+		defer client.Close()
+
+		opts := client.NATSConn().Opts
+		assert.Equal(t, "bridge-test", opts.Name)
+		assert.Equal(t, 3, opts.MaxReconnect)
+		assert.Equal(t, time.Second, opts.ReconnectWait)
+		assert.Equal(t, 1024, opts.ReconnectBufSize)
+		assert.True(t, opts.NoEcho)
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		client := NewNATSClient("nats://localhost:4222", WithUserInfo("user", "secret"), WithNATSToken("token"))
+		require.Len(t, client.natsOpts, 2)
+
+		var opts nats.Options
+		for _, opt := range client.natsOpts {
+			require.NoError(t, opt(&opts))
+		}
+		assert.Equal(t, "user", opts.User)
+		assert.Equal(t, "secret", opts.Password)
+		assert.Equal(t, "token", opts.Token)
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		tlsConfig := &tls.Config{ServerName: "nats.example.com"}
+		client := NewNATSClient("nats://localhost:4222", WithTLSConfig(tlsConfig))
+
+		var opts nats.Options
+		for _, opt := range client.natsOpts {
+			require.NoError(t, opt(&opts))
+		}
+		assert.True(t, opts.Secure)
+		assert.Same(t, tlsConfig, opts.TLSConfig)
+	})
+
+	t.Run("nats options override", func(t *testing.T) {
+		srv := runEmbeddedNATS(t)
+		client := NewNATSClient(srv.ClientURL(),
+			WithNATSLogger(logger),
+			WithConnectionName("bridge-test"),
+			WithNATSOptions(nats.Name("custom"), nats.MaxReconnects(7)),
+		)
+		require.NoError(t, client.Connect(t.Context()))
+		defer client.Close()
+
+		opts := client.NATSConn().Opts
+		assert.Equal(t, "custom", opts.Name)
+		assert.Equal(t, 7, opts.MaxReconnect)
+	})
+
+	t.Run("disconnect handler", func(t *testing.T) {
+		srv := runEmbeddedNATS(t)
+		disconnected := make(chan error, 1)
+		client := NewNATSClient(srv.ClientURL(),
+			WithNATSLogger(logger),
+			WithDisconnectHandler(func(err error) {
+				select {
+				case disconnected <- err:
+				default:
+				}
+			}),
+		)
+		require.NoError(t, client.Connect(t.Context()))
+		defer client.Close()
+
+		srv.Shutdown()
+		select {
+		case <-disconnected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("disconnect handler not called")
+		}
+	})
+
+	t.Run("shared connection", func(t *testing.T) {
+		srv := runEmbeddedNATS(t)
+		conn, err := nats.Connect(srv.ClientURL())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		sub, err := conn.SubscribeSync("test.subject")
+		require.NoError(t, err)
+
+		// The URL is never dialed
+		client := NewNATSClient("nats://invalid:4222", WithNATSLogger(logger), WithConnection(conn))
+		require.NoError(t, client.Connect(t.Context()))
+		assert.Same(t, conn, client.NATSConn())
+
+		require.NoError(t, client.Publish(t.Context(), Destination{Subject: "test.subject"}, "data"))
+		_, err = sub.NextMsg(time.Second)
+		require.NoError(t, err)
+
+		require.NoError(t, client.Close())
+		assert.False(t, conn.IsClosed())
+	})
+
+	t.Run("closed shared connection", func(t *testing.T) {
+		srv := runEmbeddedNATS(t)
+		conn, err := nats.Connect(srv.ClientURL())
+		require.NoError(t, err)
+		conn.Close()
+
+		client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger), WithConnection(conn))
+		assert.ErrorIs(t, client.Connect(t.Context()), ErrConnectionClosed)
+	})
+}
+
+func TestNATSClient_Connect_NotStarted(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewNATSClient("nats://invalid:4222", WithNATSLogger(logger))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := client.Connect(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to NATS")
+}
+
+// blackholeListener accepts TCP connections and never answers,
+// so the NATS handshake hangs until the client gives up
+func blackholeListener(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	return "nats://" + ln.Addr().String()
+}
+
+func TestNATSClient_Connect_HonorsContextDeadline(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	url := blackholeListener(t)
+
+	t.Run("core", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := NewNATSClient(url, WithNATSLogger(logger)).Connect(ctx)
+
+		// Either ctx or the dial timeout derived from it fires first
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("jetstream", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := NewJetStreamClient(url, WithJetStreamLogger(logger)).Connect(ctx)
+
+		// Either ctx or the dial timeout derived from it fires first
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		err := NewNATSClient(url, WithNATSLogger(logger)).Connect(ctx)
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestNATSClient_Publish_NotConnected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewNATSClient("nats://localhost:4222", WithNATSLogger(logger))
+
+	ctx := context.Background()
+	data := map[string]string{"test": "data"}
+	dest := Destination{Subject: "test.subject"}
+
+	err := client.Publish(ctx, dest, data)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not established")
+}
+
+func TestClassifyNATSError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{err: nats.ErrMaxPayload, want: ErrMaxPayload},
+		{err: nats.ErrPermissionViolation, want: ErrPermissions},
+		{err: nats.ErrAuthorization, want: ErrPermissions},
+		{err: nats.ErrConnectionClosed, want: ErrConnectionClosed},
+		{err: nats.ErrConnectionDraining, want: ErrConnectionClosed},
+		{err: fmt.Errorf("flush: %w", nats.ErrMaxPayload), want: ErrMaxPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			err := classifyNATSError(tt.err)
+			assert.ErrorIs(t, err, tt.want)
+			// The original error is kept for logs and errors.Is
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	t.Run("other errors unchanged", func(t *testing.T) {
+		err := classifyNATSError(nats.ErrTimeout)
+		assert.Equal(t, nats.ErrTimeout, err)
+		for _, typed := range []error{ErrMaxPayload, ErrPermissions, ErrConnectionClosed} {
+			assert.NotErrorIs(t, err, typed)
+		}
+	})
+}
+
+func TestReconnectPolicy_Options(t *testing.T) {
+	unlimited := -1
+	policy := newReconnectPolicy(ReconnectConfig{MaxReconnects: &unlimited, WaitSec: 1, MaxWaitSec: 30, JitterMs: 250})
+
+	opts := nats.GetDefaultOptions()
+	for _, opt := range policy.options() {
+		require.NoError(t, opt(&opts))
+	}
+
+	assert.Equal(t, -1, opts.MaxReconnect)
+	assert.Equal(t, time.Second, opts.ReconnectWait)
+	assert.Equal(t, 250*time.Millisecond, opts.ReconnectJitter)
+	assert.Equal(t, 250*time.Millisecond, opts.ReconnectJitterTLS)
+	require.NotNil(t, opts.CustomReconnectDelayCB)
+
+	delay := opts.CustomReconnectDelayCB(3)
+	assert.GreaterOrEqual(t, delay, 4*time.Second)
+	assert.Less(t, delay, 4*time.Second+250*time.Millisecond)
+}
+
+func TestReconnectPolicy_Delay(t *testing.T) {
+	policy := reconnectPolicy{wait: time.Second, maxWait: 10 * time.Second}
+
+	var delays []time.Duration
+	for attempts := 1; attempts <= 6; attempts++ {
+		delays = append(delays, policy.delay(attempts))
+	}
+	assert.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+	}, delays)
+
+	t.Run("constant without max wait", func(t *testing.T) {
+		constant := reconnectPolicy{wait: 2 * time.Second, maxWait: 2 * time.Second}
+		assert.Equal(t, 2*time.Second, constant.delay(5))
+	})
+}
+
+func TestNATSConnectionName(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultNATSConnectionName, natsConnectionName(DefaultNATSConnectionName, "my_bot"))
+	assert.Equal(t, "bridge-my_bot@"+hostname, natsConnectionName("bridge-{bot}@{hostname}", "my_bot"))
+}
+
+func TestNATSClients_ConnectionOptions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	srv := runEmbeddedJetStream(t)
+
+	tests := []struct {
+		name    string
+		connect func(t *testing.T, name string, noEcho bool) *nats.Conn
+	}{
+		{
+			name: "core",
+			connect: func(t *testing.T, name string, noEcho bool) *nats.Conn {
+				client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger), WithConnectionName(name), WithNoEcho(noEcho))
+				require.NoError(t, client.Connect(context.Background()))
+				t.Cleanup(func() { client.Close() })
+				return client.conn.Load()
+			},
+		},
+		{
+			name: "jetstream",
+			connect: func(t *testing.T, name string, noEcho bool) *nats.Conn {
+				client := NewJetStreamClient(srv.ClientURL(), WithJetStreamLogger(logger), WithJetStreamConnectionName(name), WithJetStreamNoEcho(noEcho))
+				require.NoError(t, client.Connect(context.Background()))
+				t.Cleanup(func() { client.Close() })
+				return client.nc
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, noEcho := range []bool{false, true} {
+				name := fmt.Sprintf("bridge-%s-%t", tt.name, noEcho)
+				conn := tt.connect(t, name, noEcho)
+				assert.Equal(t, name, conn.Opts.Name)
+				assert.Equal(t, noEcho, conn.Opts.NoEcho)
+
+				// The server lists the connection under its name
+				connz, err := srv.Connz(&server.ConnzOptions{})
+				require.NoError(t, err)
+				var names []string
+				for _, info := range connz.Conns {
+					names = append(names, info.Name)
+				}
+				assert.Contains(t, names, name)
+
+				// Own publications reach own subscriptions only without no_echo
+				sub, err := conn.SubscribeSync("echo." + name)
+				require.NoError(t, err)
+				require.NoError(t, conn.Publish("echo."+name, []byte("ping")))
+				require.NoError(t, conn.Flush())
+				_, err = sub.NextMsg(100 * time.Millisecond)
+				if noEcho {
+					assert.ErrorIs(t, err, nats.ErrTimeout)
+				} else {
+					assert.NoError(t, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClosedHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	var closing atomic.Bool
+	var calls int
+	handler := closedHandler(&closing, func() { calls++ }, logger)
+
+	handler(nil)
+	assert.Equal(t, 1, calls)
+
+	// Close by the bridge itself is not a lost connection
+	closing.Store(true)
+	handler(nil)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNATSClient_Publish_TypedErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	srv := runEmbeddedNATS(t)
+	client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger))
+	require.NoError(t, client.Connect(context.Background()))
+
+	dest := Destination{Subject: "test.subject"}
+
+	// The embedded server announces the default max_payload of 1 MiB
+	err := client.Publish(context.Background(), dest, map[string]string{"text": strings.Repeat("a", 2<<20)})
+	assert.ErrorIs(t, err, ErrMaxPayload)
+
+	client.Close()
+	err = client.Publish(context.Background(), dest, map[string]string{"test": "data"})
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+}
+
+func TestNATSClient_Close_NotConnected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewNATSClient("nats://localhost:4222", WithNATSLogger(logger))
+
+	err := client.Close()
+	assert.NoError(t, err)
+}
+
+func TestNATSClient_Publish_MarshalError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewNATSClient("nats://localhost:4222", WithNATSLogger(logger))
+
+	badData := make(chan int)
+
+	_ = badData
+	_ = client
+}
+
+func TestNATSClient_Publish_ContextCancelled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewNATSClient("nats://localhost:4222", WithNATSLogger(logger))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	data := map[string]string{"test": "data"}
+	dest := Destination{Subject: "test.subject"}
+
+	err := client.Publish(ctx, dest, data)
+	assert.Error(t, err)
+}
+
+func TestNewJetStreamClient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewJetStreamClient("nats://localhost:4222", WithJetStreamLogger(logger))
+
+	assert.NotNil(t, client)
+	assert.Equal(t, "nats://localhost:4222", client.url)
+	assert.NotNil(t, client.logger)
+	assert.Nil(t, client.nc)
+}
+
+func TestNewJetStreamClient_Options(t *testing.T) {
+	maxReconnects := -1
+	onClosed := func() {}
+	client := NewJetStreamClient("nats://localhost:4222",
+		WithJetStreamConnectionName("bridge"),
+		WithJetStreamPendingLimit(1024),
+		WithJetStreamNoEcho(true),
+		WithJetStreamReconnect(ReconnectConfig{MaxReconnects: &maxReconnects, WaitSec: 1}),
+		WithJetStreamClosedHandler(onClosed),
+	)
+
+	assert.Equal(t, "bridge", client.name)
+	assert.Equal(t, 1024, client.pendingLimit)
+	assert.True(t, client.noEcho)
+	assert.Equal(t, -1, client.reconnect.maxReconnects)
+	assert.Equal(t, time.Second, client.reconnect.wait)
+	assert.NotNil(t, client.onClosed)
+	assert.Equal(t, slog.Default(), client.logger)
+}
+
+func TestJetStreamClient_Connect_NotStarted(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewJetStreamClient("nats://invalid:4222", WithJetStreamLogger(logger))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := client.Connect(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to NATS")
+}
+
+func TestJetStreamClient_Publish_NotConnected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewJetStreamClient("nats://localhost:4222", WithJetStreamLogger(logger))
+
+	ctx := context.Background()
+	data := map[string]string{"test": "data"}
+	dest := Destination{Subject: "test.subject"}
+
+	err := client.Publish(ctx, dest, data)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not established")
+}
+
+func TestJetStreamClient_Close_NotConnected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewJetStreamClient("nats://localhost:4222", WithJetStreamLogger(logger))
+
+	err := client.Close()
+	assert.NoError(t, err)
+}
+
+func TestJetStreamClient_EnsureStream_InvalidJSON(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	tmpDir := t.TempDir()
+	configPath := tmpDir + "/invalid.json"
+	err := os.WriteFile(configPath, []byte("invalid json"), 0644)
+	assert.NoError(t, err)
+
+	client := NewJetStreamClient("nats://localhost:4222", WithJetStreamLogger(logger))
+
+	ctx := context.Background()
+	err = client.EnsureStream(ctx, configPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "JetStream is not connected")
+}
+
+func TestJetStreamClient_EnsureStream_FileNotFound_NotConnected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewJetStreamClient("nats://localhost:4222", WithJetStreamLogger(logger))
+
+	ctx := context.Background()
+	err := client.EnsureStream(ctx, "/nonexistent/path/config.json")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "JetStream is not connected")
+}
+
+func TestJetStreamClient_Publish_ContextCancelled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewJetStreamClient("nats://localhost:4222", WithJetStreamLogger(logger))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	data := map[string]string{"test": "data"}
+	dest := Destination{Subject: "test.subject"}
+
+	err := client.Publish(ctx, dest, data)
+	assert.Error(t, err)
+}
+
+type mockBroker struct {
+	publishErr error
+}
+
+func (m *mockBroker) Connect(ctx context.Context) error { return nil }
+
+func (m *mockBroker) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	return m.publishErr
+}
+
+func (m *mockBroker) Close() error { return nil }
+
+func TestPublisher_ResultHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Run("success", func(t *testing.T) {
+		results := make(chan PublishResult, 1)
+
+		publisher := NewPublisher(1, 5, &mockBroker{}, logger)
+		publisher.SetResultHandler(func(r PublishResult) { results <- r })
+		publisher.Start()
+		defer publisher.Close()
+
+		publisher.Publish(Destination{Subject: "test.subject"}, map[string]string{"test": "data"})
+
+		select {
+		case r := <-results:
+			assert.True(t, r.Success)
+			assert.NoError(t, r.Err)
+			assert.Equal(t, "test.subject", r.Destination.Subject)
+		case <-time.After(2 * time.Second):
+			t.Fatal("result handler was not called")
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		results := make(chan PublishResult, 1)
+
+		publisher := NewPublisher(1, 5, &mockBroker{publishErr: errors.New("boom")}, logger)
+		publisher.SetResultHandler(func(r PublishResult) { results <- r })
+		publisher.Start()
+		defer publisher.Close()
+
+		publisher.Publish(Destination{Subject: "test.subject"}, map[string]string{"test": "data"})
+
+		select {
+		case r := <-results:
+			assert.False(t, r.Success)
+			assert.EqualError(t, r.Err, "boom")
+			assert.Equal(t, "test.subject", r.Destination.Subject)
+		case <-time.After(2 * time.Second):
+			t.Fatal("result handler was not called")
+		}
+	})
+}
+
+func TestPublisher_PublishTracked(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	publishErr := errors.New("nats: timeout")
+	publisher := NewPublisher(1, 5, &mockBroker{publishErr: publishErr}, logger)
+	publisher.Start()
+
+	done := make(chan error, 1)
+	publisher.PublishTracked(1, Destination{Subject: "test.subject"}, "data", func(err error) { done <- err })
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, publishErr)
+	case <-time.After(time.Second):
+		t.Fatal("done was not called")
+	}
+
+	publisher.Close()
+	publisher.PublishTracked(1, Destination{Subject: "test.subject"}, "data", func(err error) { done <- err })
+	assert.ErrorIs(t, <-done, ErrPublisherClosed)
+}
+
+func TestPublisher_RequestHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	requests := make(chan Destination, 1)
+	results := make(chan PublishResult, 1)
+
+	publisher := NewPublisher(1, 5, &mockBroker{}, logger)
+	publisher.SetResultHandler(func(r PublishResult) { results <- r })
+	publisher.SetRequestHandler(func(ctx context.Context, dest Destination, data interface{}) { requests <- dest })
+	publisher.Start()
+	defer publisher.Close()
+
+	publisher.Publish(Destination{Subject: "test.request", Request: true}, map[string]string{"test": "data"})
+
+	select {
+	case dest := <-requests:
+		assert.Equal(t, "test.request", dest.Subject)
+	case <-time.After(2 * time.Second):
+		t.Fatal("request handler was not called")
+	}
+
+	publisher.Publish(Destination{Subject: "test.subject"}, map[string]string{"test": "data"})
+
+	select {
+	case r := <-results:
+		assert.Equal(t, "test.subject", r.Destination.Subject)
+	case <-time.After(2 * time.Second):
+		t.Fatal("result handler was not called")
+	}
+}
+
+func TestNewNATSMsg_Headers(t *testing.T) {
+	dest := Destination{
+		Subject: "telegram.messages",
+		Headers: updateHeaders(Update{UpdateId: 42}, "123456-42"),
+	}
+
+	msg := newNATSMsg(dest, []byte(`{}`))
+
+	assert.Equal(t, "telegram.messages", msg.Subject)
+	assert.Equal(t, "123456-42", msg.Header.Get(CorrelationIDHeader))
+}
+
+type panickingBroker struct {
+	mockBroker
+}
+
+func (m *panickingBroker) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	panic("encoder bug")
+}
+
+func TestPublisher_RecoversFromPanic(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	requests := make(chan Destination, 1)
+
+	publisher := NewPublisher(1, 5, &panickingBroker{}, logger)
+	publisher.SetRequestHandler(func(ctx context.Context, dest Destination, data interface{}) { requests <- dest })
+	publisher.Start()
+	defer publisher.Close()
+
+	publisher.Publish(Destination{Subject: "test.subject"}, map[string]string{"test": "data"})
+	publisher.Publish(Destination{Subject: "test.request", Request: true}, map[string]string{"test": "data"})
+
+	select {
+	case dest := <-requests:
+		assert.Equal(t, "test.request", dest.Subject)
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker did not survive panic")
+	}
+}
+
+func TestPublisher_Shadow(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	srv := runEmbeddedNATS(t)
+	sub, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer sub.Close()
+
+	received := make(chan *nats.Msg, 2)
+	for _, subject := range []string{"telegram.messages", "telegram.v2.messages"} {
+		_, err := sub.ChanSubscribe(subject, received)
+		require.NoError(t, err)
+	}
+	require.NoError(t, sub.Flush())
+
+	client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger))
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	publisher := NewPublisher(1, 5, client, logger)
+	publisher.Start()
+	defer publisher.Close()
+
+	dest := Destination{
+		Subject:       "telegram.messages",
+		ShadowSubject: "telegram.v2.messages",
+		Headers:       map[string]string{CorrelationIDHeader: "1-42"},
+	}
+	payload := Update{UpdateId: 42}
+	publisher.PublishOrdered(42, dest, payload)
+	publisher.PublishShadow(42, dest.Shadow(), payload)
+
+	got := map[string]string{}
+	for range 2 {
+		select {
+		case msg := <-received:
+			got[msg.Subject] = string(msg.Data)
+			assert.Equal(t, "1-42", msg.Header.Get(CorrelationIDHeader))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected messages on both subjects, got %v", got)
+		}
+	}
+	assert.JSONEq(t, `{"update_id":42}`, got["telegram.messages"])
+	assert.Equal(t, got["telegram.messages"], got["telegram.v2.messages"])
+}
+
+// subjectFailBroker fails publications to one subject
+type subjectFailBroker struct {
+	mockBroker
+	failSubject string
+}
+
+func (m *subjectFailBroker) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	if dest.Subject == m.failSubject {
+		return errors.New("no responders")
+	}
+	return nil
+}
+
+func TestPublisher_ShadowFailure(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	results := make(chan PublishResult, 2)
+	publisher := NewPublisher(1, 5, &subjectFailBroker{failSubject: "telegram.v2.messages"}, logger)
+	publisher.SetResultHandler(func(r PublishResult) { results <- r })
+	publisher.Start()
+	defer publisher.Close()
+
+	dest := Destination{Subject: "telegram.messages", ShadowSubject: "telegram.v2.messages"}
+	publisher.PublishShadow(1, dest.Shadow(), Update{UpdateId: 1})
+	publisher.PublishOrdered(1, dest, Update{UpdateId: 1})
+
+	// Only the primary publication is reported, the failed shadow one is logged
+	select {
+	case r := <-results:
+		assert.True(t, r.Success)
+		assert.Equal(t, "telegram.messages", r.Destination.Subject)
+	case <-time.After(2 * time.Second):
+		t.Fatal("result handler was not called")
+	}
+	select {
+	case r := <-results:
+		t.Fatalf("unexpected result for %s", r.Destination.Subject)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPublisher_ShadowQueueFull(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Without started workers the queue of 2 tasks fills up
+	publisher := NewPublisher(1, 5, &mockBroker{}, logger)
+	defer publisher.Close()
+
+	publisher.Publish(Destination{Subject: "telegram.messages"}, Update{UpdateId: 1})
+	publisher.Publish(Destination{Subject: "telegram.messages"}, Update{UpdateId: 2})
+
+	done := make(chan struct{})
+	go func() {
+		publisher.PublishShadow(0, Destination{Subject: "telegram.v2.messages"}, Update{UpdateId: 2})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shadow publication blocked on a full queue")
+	}
+	assert.Equal(t, 2, publisher.Pending())
+}
+
+// recordingBroker records published subjects per update
+type recordingBroker struct {
+	mockBroker
+	mu       sync.Mutex
+	subjects map[int64][]string
+}
+
+func (m *recordingBroker) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	// Uneven publish times shuffle workers against each other
+	time.Sleep(time.Duration(rand.IntN(200)) * time.Microsecond)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := data.(Update).UpdateId
+	m.subjects[id] = append(m.subjects[id], dest.Subject)
+	return nil
+}
+
+func TestPublisher_PublishOrdered(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	subjects := []string{"telegram.firehose", "telegram.chats.1", "telegram.chats.1.edits", "telegram.audit"}
+
+	for run := range 20 {
+		broker := &recordingBroker{subjects: make(map[int64][]string)}
+		publisher := NewPublisher(4, 5, broker, logger)
+		publisher.Start()
+
+		var wg sync.WaitGroup
+		for id := range int64(50) {
+			wg.Go(func() {
+				for _, subject := range subjects {
+					publisher.PublishOrdered(uint64(id), Destination{Subject: subject}, Update{UpdateId: id})
+				}
+			})
+		}
+		wg.Wait()
+
+		require.Eventually(t, func() bool {
+			broker.mu.Lock()
+			defer broker.mu.Unlock()
+			var published int
+			for _, s := range broker.subjects {
+				published += len(s)
+			}
+			return published == 50*len(subjects)
+		}, 5*time.Second, 10*time.Millisecond)
+		publisher.Close()
+
+		for id, got := range broker.subjects {
+			assert.Equal(t, subjects, got, "run %d, update %d", run, id)
+		}
+	}
+}
+
+func TestNATSClient_ReconnectHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	opts := natstest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	srv := natstest.RunServer(&opts)
+	url := srv.ClientURL()
+	port := srv.Addr().(*net.TCPAddr).Port
+
+	reconnected := make(chan struct{}, 1)
+	client := NewNATSClient(url, WithNATSLogger(logger), WithReconnectHandler(func() { reconnected <- struct{}{} }))
+	// Sub-second waits can't be configured through ReconnectConfig
+	client.reconnect = reconnectPolicy{maxReconnects: -1, wait: 50 * time.Millisecond, maxWait: 50 * time.Millisecond}
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	// Restart the server on the same port
+	srv.Shutdown()
+	restarted := opts
+	restarted.Port = port
+	srv = natstest.RunServer(&restarted)
+	defer srv.Shutdown()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconnect handler was not called")
+	}
+}
+
+func TestNATSClient_Close_Idempotent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	srv := runEmbeddedNATS(t)
+	client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger))
+	require.NoError(t, client.Connect(context.Background()))
+
+	require.NoError(t, client.Close())
+	require.NoError(t, client.Close())
+
+	err := client.Publish(context.Background(), Destination{Subject: "test.subject"}, "data")
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+
+	assert.ErrorIs(t, client.Connect(context.Background()), ErrClosed)
+}
+
+func TestNATSClient_ConcurrentPublishConnectClose(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	srv := runEmbeddedNATS(t)
+	client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger))
+	require.NoError(t, client.Connect(context.Background()))
+
+	var published atomic.Int64
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 8 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				err := client.Publish(context.Background(), Destination{Subject: "test.subject"}, "data")
+				if err == nil {
+					published.Add(1)
+					continue
+				}
+				// A replaced or closed connection is the only expected failure
+				if !assert.ErrorIs(t, err, ErrConnectionClosed) {
+					return
+				}
+			}
+		})
+	}
+
+	// Reconnect a few times under load, then close from two goroutines
+	for range 3 {
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, client.Connect(context.Background()))
+	}
+	time.Sleep(10 * time.Millisecond)
+	var closers sync.WaitGroup
+	for range 2 {
+		closers.Go(func() { assert.NoError(t, client.Close()) })
+	}
+	closers.Wait()
+
+	err := client.Publish(context.Background(), Destination{Subject: "test.subject"}, "data")
+	assert.ErrorIs(t, err, ErrClosed)
+
+	close(stop)
+	wg.Wait()
+	assert.Positive(t, published.Load())
+	assert.True(t, client.NATSConn().IsClosed())
+}
+
+// blockingBroker blocks every publication until ctx is done
+type blockingBroker struct{}
+
+func (b *blockingBroker) Connect(ctx context.Context) error { return nil }
+
+func (b *blockingBroker) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *blockingBroker) Close() error { return nil }
+
+func TestPublisher_PublishTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	results := make(chan PublishResult, 1)
+	publisher := NewPublisher(1, 5, &blockingBroker{}, logger)
+	publisher.SetPublishTimeout(50 * time.Millisecond)
+	publisher.SetResultHandler(func(r PublishResult) { results <- r })
+	publisher.Start()
+	defer publisher.Close()
+
+	publisher.Publish(Destination{Subject: "test.subject"}, "data")
+
+	select {
+	case r := <-results:
+		assert.ErrorIs(t, r.Err, context.DeadlineExceeded)
+		assert.Less(t, r.Duration, time.Second)
+	case <-time.After(2 * time.Second):
+		t.Fatal("publication did not time out")
+	}
+}
+
+func TestPublisher_TryPublish(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Workers are not started, so queued tasks stay in the queues
+	publisher := NewPublisher(2, 1, &mockBroker{}, logger)
+	publisher.SetQueueSize(6)
+
+	for range 6 {
+		assert.True(t, publisher.TryPublish(Destination{Subject: "test.subject"}, "data"))
+	}
+	assert.False(t, publisher.TryPublish(Destination{Subject: "test.subject"}, "data"), "queue is full")
+	assert.Equal(t, 6, publisher.Pending())
+
+	publisher.Close()
+	assert.False(t, publisher.TryPublish(Destination{Subject: "test.subject"}, "data"), "publisher is closed")
+}
+
+func TestPublisher_SetQueueSize(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	publisher := NewPublisher(4, 1, &mockBroker{}, logger)
+	assert.Equal(t, 2, cap(publisher.tasks[0]), "default")
+
+	publisher.SetQueueSize(10)
+	assert.Equal(t, 3, cap(publisher.tasks[0]), "rounded up per worker")
+
+	publisher.SetQueueSize(1)
+	assert.Equal(t, 1, cap(publisher.tasks[3]), "at least one per worker")
+}
+
+func TestPublisher_CloseWithBlockedPublish(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	for range 20 {
+		// No shutdown timeout, Close aborts the blocked publications at once
+		publisher := NewPublisher(2, 0, &blockingBroker{}, logger)
+		publisher.SetQueueSize(2)
+		publisher.Start()
+
+		// Fill the workers and the queues, the rest block in Publish
+		var wg sync.WaitGroup
+		for i := range 16 {
+			wg.Go(func() {
+				publisher.PublishOrdered(uint64(i), Destination{Subject: "test.subject"}, "data")
+				publisher.Publish(Destination{Subject: "test.subject"}, "data")
+				publisher.PublishShadow(uint64(i), Destination{Subject: "test.shadow"}, "data")
+				publisher.TryPublish(Destination{Subject: "test.subject"}, "data")
+			})
+		}
+
+		time.Sleep(time.Millisecond)
+		var closers sync.WaitGroup
+		for range 2 {
+			closers.Go(publisher.Close)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			closers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Publish calls were not released by Close")
+		}
+	}
+}
+
+// delayedBroker takes delay to publish and counts publications
+type delayedBroker struct {
+	delay     time.Duration
+	published atomic.Int32
+}
+
+func (b *delayedBroker) Connect(ctx context.Context) error { return nil }
+
+func (b *delayedBroker) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	select {
+	case <-time.After(b.delay):
+		b.published.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *delayedBroker) Close() error { return nil }
+
+func TestPublisher_CloseDrainsQueue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	broker := &delayedBroker{delay: 20 * time.Millisecond}
+	publisher := NewPublisher(1, 5, broker, logger)
+	publisher.SetQueueSize(6)
+	publisher.Start()
+
+	results := make(chan error, 6)
+	for i := range 6 {
+		publisher.PublishTracked(uint64(i), Destination{Subject: "test.subject"}, "data", func(err error) { results <- err })
+	}
+	publisher.Close()
+
+	assert.Equal(t, int32(6), broker.published.Load())
+	require.Len(t, results, 6)
+	for range 6 {
+		assert.NoError(t, <-results)
+	}
+}
+
+func TestPublisher_CloseTimeoutDropsQueued(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	publisher := NewPublisher(1, 0, &blockingBroker{}, logger)
+	publisher.SetQueueSize(4)
+	publisher.Start()
+
+	results := make(chan error, 5)
+	for i := range 5 {
+		publisher.PublishTracked(uint64(i), Destination{Subject: "test.subject"}, "data", func(err error) { results <- err })
+	}
+	publisher.Close()
+
+	// The publication in progress is aborted, the queued ones are dropped,
+	// every callback is called once
+	require.Eventually(t, func() bool { return len(results) == 5 }, time.Second, 10*time.Millisecond)
+	var dropped int
+	for range 5 {
+		if errors.Is(<-results, ErrPublisherClosed) {
+			dropped++
+		}
+	}
+	assert.GreaterOrEqual(t, dropped, 4)
+}
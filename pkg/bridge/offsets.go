@@ -0,0 +1,103 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultOffsetBucket is the KV bucket offsets are stored in by default
+const DefaultOffsetBucket = "telegram_bridge_offsets"
+
+// kvBucketName is what a NATS KV bucket name must look like
+var kvBucketName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// OffsetStore persists the getUpdates offset, so a restarted bridge continues
+// after the last update it received
+type OffsetStore interface {
+	// Load returns the stored offset, 0 when nothing is stored yet
+	Load(ctx context.Context) (int64, error)
+	// Save stores the offset of the next update to receive
+	Save(ctx context.Context, offset int64) error
+}
+
+// NATSConnProvider is implemented by broker clients that share their NATS connection
+type NATSConnProvider interface {
+	NATSConn() *nats.Conn
+}
+
+// NATSConn returns the connection used for publishing, nil before Connect
+func (c *NATSClient) NATSConn() *nats.Conn {
+	return c.conn.Load()
+}
+
+// NATSConn returns the connection used for publishing, nil before Connect
+func (c *JetStreamClient) NATSConn() *nats.Conn {
+	return c.nc
+}
+
+// KVOffsetStore keeps offsets in a NATS JetStream Key-Value bucket, one key per bot
+type KVOffsetStore struct {
+	kv  jetstream.KeyValue
+	key string
+}
+
+// offsetKey returns the KV key holding the offset of the bot
+func offsetKey(botID int64) string {
+	return "bot_" + strconv.FormatInt(botID, 10)
+}
+
+// NewKVOffsetStore opens the bucket on conn, creating it when missing
+func NewKVOffsetStore(ctx context.Context, conn *nats.Conn, bucket string, botID int64) (*KVOffsetStore, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("NATS is not connected")
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	kv, err := js.KeyValue(ctx, bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(ctx, jetstream.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "telegram-nats-bridge getUpdates offsets",
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open offset bucket '%s': %w", bucket, err)
+	}
+
+	return &KVOffsetStore{kv: kv, key: offsetKey(botID)}, nil
+}
+
+// Load returns the stored offset, 0 when the key doesn't exist
+func (s *KVOffsetStore) Load(ctx context.Context) (int64, error) {
+	entry, err := s.kv.Get(ctx, s.key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load offset: %w", err)
+	}
+
+	offset, err := strconv.ParseInt(string(entry.Value()), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset '%s' stored under %s: %w", entry.Value(), s.key, err)
+	}
+	return offset, nil
+}
+
+// Save stores the offset
+func (s *KVOffsetStore) Save(ctx context.Context, offset int64) error {
+	if _, err := s.kv.Put(ctx, s.key, []byte(strconv.FormatInt(offset, 10))); err != nil {
+		return fmt.Errorf("failed to save offset: %w", err)
+	}
+	return nil
+}
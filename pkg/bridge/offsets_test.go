@@ -0,0 +1,91 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVOffsetStore_RoundTrip(t *testing.T) {
+	srv := runEmbeddedJetStream(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	ctx := context.Background()
+	store, err := NewKVOffsetStore(ctx, nc, "test_offsets", 123456)
+	require.NoError(t, err)
+
+	// Nothing stored yet
+	offset, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, offset)
+
+	require.NoError(t, store.Save(ctx, 1001))
+	require.NoError(t, store.Save(ctx, 1002))
+	offset, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1002), offset)
+
+	// A restarted bridge opens the existing bucket and sees the offset
+	restarted, err := NewKVOffsetStore(ctx, nc, "test_offsets", 123456)
+	require.NoError(t, err)
+	offset, err = restarted.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1002), offset)
+
+	// Every bot has its own key
+	other, err := NewKVOffsetStore(ctx, nc, "test_offsets", 654321)
+	require.NoError(t, err)
+	offset, err = other.Load(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, offset)
+}
+
+func TestKVOffsetStore_InvalidValue(t *testing.T) {
+	srv := runEmbeddedJetStream(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	ctx := context.Background()
+	store, err := NewKVOffsetStore(ctx, nc, "test_offsets", 1)
+	require.NoError(t, err)
+
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+	kv, err := js.KeyValue(ctx, "test_offsets")
+	require.NoError(t, err)
+	_, err = kv.Put(ctx, offsetKey(1), []byte("not a number"))
+	require.NoError(t, err)
+
+	_, err = store.Load(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid offset")
+}
+
+func TestNewKVOffsetStore_NotConnected(t *testing.T) {
+	_, err := NewKVOffsetStore(context.Background(), nil, "test_offsets", 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NATS is not connected")
+}
+
+func TestJetStreamClient_NATSConn(t *testing.T) {
+	srv := runEmbeddedJetStream(t)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	client := NewJetStreamClient(srv.ClientURL(), WithJetStreamLogger(logger))
+	assert.Nil(t, client.NATSConn())
+
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	store, err := NewKVOffsetStore(context.Background(), client.NATSConn(), DefaultOffsetBucket, 42)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(context.Background(), 7))
+}
@@ -0,0 +1,214 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Reasons of OutboundValidationError, stable for machine consumers
+const (
+	OutboundReasonInvalidJSON        = "invalid_json"
+	OutboundReasonUnsupportedField   = "unsupported_field"
+	OutboundReasonMissingContent     = "missing_content"
+	OutboundReasonInvalidContent     = "invalid_content"
+	OutboundReasonInvalidParseMode   = "invalid_parse_mode"
+	OutboundReasonInvalidReplyMarkup = "invalid_reply_markup"
+	OutboundReasonInvalidIdempotency = "invalid_idempotency_key"
+)
+
+// The outbound message schema. Both validateOutboundMessage and
+// OutboundMessageSchema are built from these, keep them the only source.
+// It describes what sendMessage replies actually send: text to the chat
+// and topic of the update.
+var (
+	// outboundFields are the fields of an outbound message, others are rejected
+	outboundFields     = []string{"text", "parse_mode", "reply_markup", "idempotency_key"}
+	outboundParseModes = []string{"HTML", "MarkdownV2", "Markdown"}
+	// outboundKeyboards are reply_markup kinds holding rows of buttons with text
+	outboundKeyboards = []string{"inline_keyboard", "keyboard"}
+	// outboundMarkupFlags are reply_markup kinds that must be true
+	outboundMarkupFlags = []string{"remove_keyboard", "force_reply"}
+)
+
+// OutboundValidationError describes why an outbound payload was not sent to Telegram
+type OutboundValidationError struct {
+	Reason      string `json:"reason"`
+	Field       string `json:"field,omitempty"`
+	Message     string `json:"message"`
+	PayloadHash string `json:"payload_hash"`
+}
+
+func (e *OutboundValidationError) Error() string {
+	return fmt.Sprintf("invalid outbound message (%s): %s", e.Reason, e.Message)
+}
+
+// payloadHash returns the hex SHA-256 of payload, used to find the offending
+// message without copying it into error reports
+func payloadHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// validateOutboundMessage checks payload against the outbound message schema
+// before it reaches Telegram
+func validateOutboundMessage(payload []byte) *OutboundValidationError {
+	fail := func(reason, field, format string, args ...any) *OutboundValidationError {
+		return &OutboundValidationError{
+			Reason:      reason,
+			Field:       field,
+			Message:     fmt.Sprintf(format, args...),
+			PayloadHash: payloadHash(payload),
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil || fields == nil {
+		return fail(OutboundReasonInvalidJSON, "", "payload must be a JSON object")
+	}
+
+	// Fields the sender would silently drop, such as chat_id or photo
+	names := slices.Sorted(maps.Keys(fields))
+	for _, name := range names {
+		if !slices.Contains(outboundFields, name) {
+			return fail(OutboundReasonUnsupportedField, name, "%s is not supported, replies are sent as text to the chat of the update", name)
+		}
+	}
+
+	raw, ok := fields["text"]
+	if !ok {
+		return fail(OutboundReasonMissingContent, "text", "text is required")
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil || text == "" {
+		return fail(OutboundReasonInvalidContent, "text", "text must be a non-empty string")
+	}
+
+	if raw, ok := fields["parse_mode"]; ok {
+		var mode string
+		if err := json.Unmarshal(raw, &mode); err != nil || !slices.Contains(outboundParseModes, mode) {
+			return fail(OutboundReasonInvalidParseMode, "parse_mode", "parse_mode must be one of %s", strings.Join(outboundParseModes, ", "))
+		}
+	}
+
+	if raw, ok := fields["idempotency_key"]; ok {
+		var key string
+		if err := json.Unmarshal(raw, &key); err != nil || key == "" {
+			return fail(OutboundReasonInvalidIdempotency, "idempotency_key", "idempotency_key must be a non-empty string")
+		}
+	}
+
+	if raw, ok := fields["reply_markup"]; ok {
+		if msg := replyMarkupProblem(raw); msg != "" {
+			return fail(OutboundReasonInvalidReplyMarkup, "reply_markup", "%s", msg)
+		}
+	}
+
+	return nil
+}
+
+// replyMarkupProblem returns what is wrong with the reply_markup shape or
+// empty string. Buttons are checked for text only, Telegram checks the rest.
+func replyMarkupProblem(raw json.RawMessage) string {
+	var markup map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &markup); err != nil || markup == nil {
+		return "reply_markup must be an object"
+	}
+
+	kinds := append(slices.Clone(outboundKeyboards), outboundMarkupFlags...)
+	var found []string
+	for _, kind := range kinds {
+		if _, ok := markup[kind]; ok {
+			found = append(found, kind)
+		}
+	}
+	if len(found) != 1 {
+		return fmt.Sprintf("reply_markup must contain exactly one of %s", strings.Join(kinds, ", "))
+	}
+
+	kind := found[0]
+	if slices.Contains(outboundMarkupFlags, kind) {
+		var flag bool
+		if err := json.Unmarshal(markup[kind], &flag); err != nil || !flag {
+			return fmt.Sprintf("reply_markup.%s must be true", kind)
+		}
+		return ""
+	}
+
+	var rows [][]struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(markup[kind], &rows); err != nil || len(rows) == 0 {
+		return fmt.Sprintf("reply_markup.%s must be a non-empty array of button rows", kind)
+	}
+	for i, row := range rows {
+		for j, button := range row {
+			if button.Text == "" {
+				return fmt.Sprintf("reply_markup.%s[%d][%d].text is required", kind, i, j)
+			}
+		}
+	}
+	return ""
+}
+
+// OutboundMessageSchema returns the JSON Schema of outbound messages
+func OutboundMessageSchema() map[string]any {
+	properties := map[string]any{
+		"text":            map[string]any{"type": "string", "minLength": 1},
+		"parse_mode":      map[string]any{"enum": outboundParseModes},
+		"idempotency_key": map[string]any{"type": "string", "minLength": 1},
+	}
+
+	buttonRows := map[string]any{
+		"type":     "array",
+		"minItems": 1,
+		"items": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type":     "object",
+				"required": []string{"text"},
+				"properties": map[string]any{
+					"text": map[string]any{"type": "string", "minLength": 1},
+				},
+			},
+		},
+	}
+
+	// Exactly one reply_markup kind: every variant forbids the others
+	var markups []any
+	kinds := append(slices.Clone(outboundKeyboards), outboundMarkupFlags...)
+	for _, kind := range kinds {
+		value := buttonRows
+		if slices.Contains(outboundMarkupFlags, kind) {
+			value = map[string]any{"const": true}
+		}
+		var others []any
+		for _, other := range kinds {
+			if other != kind {
+				others = append(others, map[string]any{"required": []string{other}})
+			}
+		}
+		markups = append(markups, map[string]any{
+			"required":   []string{kind},
+			"properties": map[string]any{kind: value},
+			"not":        map[string]any{"anyOf": others},
+		})
+	}
+	properties["reply_markup"] = map[string]any{
+		"type":  "object",
+		"oneOf": markups,
+	}
+
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "Outbound Telegram message",
+		"type":                 "object",
+		"required":             []string{"text"},
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,89 @@
+package bridge
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOutboundMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		reason  string
+		field   string
+	}{
+		{name: "text message", payload: `{"text": "hi", "parse_mode": "HTML"}`},
+		{
+			name:    "inline keyboard",
+			payload: `{"text": "pick", "reply_markup": {"inline_keyboard": [[{"text": "A", "callback_data": "a"}]]}}`,
+		},
+		{name: "remove keyboard", payload: `{"text": "ok", "reply_markup": {"remove_keyboard": true}}`},
+		{name: "not an object", payload: `[1, 2]`, reason: OutboundReasonInvalidJSON},
+		{name: "broken json", payload: `{"text":`, reason: OutboundReasonInvalidJSON},
+		{name: "no content", payload: `{"parse_mode": "HTML"}`, reason: OutboundReasonMissingContent, field: "text"},
+		{name: "chat id", payload: `{"chat_id": 100, "text": "hi"}`, reason: OutboundReasonUnsupportedField, field: "chat_id"},
+		{name: "photo", payload: `{"photo": "file-1"}`, reason: OutboundReasonUnsupportedField, field: "photo"},
+		{name: "thread id", payload: `{"text": "hi", "message_thread_id": 5}`, reason: OutboundReasonUnsupportedField, field: "message_thread_id"},
+		{name: "empty text", payload: `{"text": ""}`, reason: OutboundReasonInvalidContent, field: "text"},
+		{name: "object text", payload: `{"text": {"id": 1}}`, reason: OutboundReasonInvalidContent, field: "text"},
+		{name: "unknown parse mode", payload: `{"text": "hi", "parse_mode": "html"}`, reason: OutboundReasonInvalidParseMode, field: "parse_mode"},
+		{
+			name:    "markup with two kinds",
+			payload: `{"text": "hi", "reply_markup": {"keyboard": [[{"text": "A"}]], "remove_keyboard": true}}`,
+			reason:  OutboundReasonInvalidReplyMarkup,
+			field:   "reply_markup",
+		},
+		{
+			name:    "button without text",
+			payload: `{"text": "hi", "reply_markup": {"inline_keyboard": [[{"url": "https://example.com"}]]}}`,
+			reason:  OutboundReasonInvalidReplyMarkup,
+			field:   "reply_markup",
+		},
+		{name: "idempotency key", payload: `{"text": "hi", "idempotency_key": "order-42"}`},
+		{name: "empty idempotency key", payload: `{"text": "hi", "idempotency_key": ""}`, reason: OutboundReasonInvalidIdempotency, field: "idempotency_key"},
+		{
+			name:    "force reply false",
+			payload: `{"text": "hi", "reply_markup": {"force_reply": false}}`,
+			reason:  OutboundReasonInvalidReplyMarkup,
+			field:   "reply_markup",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verr := validateOutboundMessage([]byte(tt.payload))
+			if tt.reason == "" {
+				assert.Nil(t, verr)
+				return
+			}
+			require.NotNil(t, verr)
+			assert.Equal(t, tt.reason, verr.Reason)
+			assert.Equal(t, tt.field, verr.Field)
+			assert.Equal(t, payloadHash([]byte(tt.payload)), verr.PayloadHash)
+			assert.NotEmpty(t, verr.Message)
+		})
+	}
+}
+
+func TestOutboundMessageSchema(t *testing.T) {
+	schema := OutboundMessageSchema()
+
+	properties := schema["properties"].(map[string]any)
+	assert.ElementsMatch(t, outboundFields, slices.Collect(maps.Keys(properties)))
+	assert.Equal(t, false, schema["additionalProperties"])
+	assert.Equal(t, map[string]any{"enum": outboundParseModes}, properties["parse_mode"])
+
+	// The committed document must be regenerated when the schema changes
+	generated, err := json.MarshalIndent(schema, "", "  ")
+	require.NoError(t, err)
+	committed, err := os.ReadFile("outbound_message.schema.json")
+	require.NoError(t, err)
+	assert.JSONEq(t, string(generated), string(committed),
+		"outbound_message.schema.json is stale, run: go run ./cmd/telegram-nats-bridge schema outbound > pkg/bridge/outbound_message.schema.json")
+}
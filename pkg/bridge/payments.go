@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// paymentAnswerer answers payment queries via Telegram Bot API
+type paymentAnswerer interface {
+	AnswerPreCheckoutQuery(ctx context.Context, queryID string, ok bool, errorMessage string) error
+	AnswerShippingQuery(ctx context.Context, queryID string, ok bool, options []gotgbot.ShippingOption, errorMessage string) error
+}
+
+// PaymentReply is the expected reply on the payments request subject
+type PaymentReply struct {
+	Ok              bool                     `json:"ok"`
+	ErrorMessage    string                   `json:"error_message,omitempty"`
+	ShippingOptions []gotgbot.ShippingOption `json:"shipping_options,omitempty"`
+}
+
+// PaymentHandler answers shipping and pre-checkout queries within Telegram's 10-second deadline
+type PaymentHandler struct {
+	cfg       *PaymentsConfig
+	answerer  paymentAnswerer
+	requester RequesterInterface
+	logger    *slog.Logger
+}
+
+// NewPaymentHandler creates a new PaymentHandler.
+// requester is required only when request_subject is configured.
+func NewPaymentHandler(cfg *PaymentsConfig, answerer paymentAnswerer, requester RequesterInterface, logger *slog.Logger) *PaymentHandler {
+	return &PaymentHandler{
+		cfg:       cfg,
+		answerer:  answerer,
+		requester: requester,
+		logger:    logger,
+	}
+}
+
+// Handle answers the update if it is a payment query
+func (h *PaymentHandler) Handle(ctx context.Context, update Update) {
+	switch {
+	case update.PreCheckoutQuery != nil:
+		h.handlePreCheckoutQuery(ctx, update)
+	case update.ShippingQuery != nil:
+		h.handleShippingQuery(ctx, update)
+	}
+}
+
+func (h *PaymentHandler) handlePreCheckoutQuery(ctx context.Context, update Update) {
+	queryID := update.PreCheckoutQuery.Id
+
+	reply := PaymentReply{Ok: h.cfg.DefaultOk, ErrorMessage: h.cfg.DefaultErrorMessage}
+
+	switch {
+	case h.cfg.AutoApprove:
+		reply = PaymentReply{Ok: true}
+	case h.cfg.RequestSubject != "":
+		if r, err := h.request(ctx, update); err != nil {
+			h.logger.Warn("payment request failed, using default answer",
+				"pre_checkout_query_id", queryID,
+				"default_ok", reply.Ok,
+				"error", err)
+		} else {
+			reply = *r
+		}
+	default:
+		return
+	}
+
+	if !reply.Ok && reply.ErrorMessage == "" {
+		reply.ErrorMessage = h.cfg.DefaultErrorMessage
+	}
+
+	if err := h.answerer.AnswerPreCheckoutQuery(ctx, queryID, reply.Ok, reply.ErrorMessage); err != nil {
+		h.logger.Error("failed to answer pre-checkout query", "pre_checkout_query_id", queryID, "error", err)
+		return
+	}
+
+	h.logger.Debug("pre-checkout query answered", "pre_checkout_query_id", queryID, "ok", reply.Ok)
+}
+
+func (h *PaymentHandler) handleShippingQuery(ctx context.Context, update Update) {
+	// Shipping queries can't be approved without options, so they are
+	// answered only via request subject
+	if h.cfg.RequestSubject == "" {
+		return
+	}
+
+	queryID := update.ShippingQuery.Id
+
+	reply, err := h.request(ctx, update)
+	if err != nil {
+		h.logger.Warn("shipping request failed, declining query",
+			"shipping_query_id", queryID,
+			"error", err)
+		reply = &PaymentReply{Ok: false}
+	}
+
+	if reply.Ok && len(reply.ShippingOptions) == 0 {
+		h.logger.Warn("shipping reply has no shipping options, declining query", "shipping_query_id", queryID)
+		reply = &PaymentReply{Ok: false}
+	}
+
+	if !reply.Ok && reply.ErrorMessage == "" {
+		reply.ErrorMessage = h.cfg.DefaultErrorMessage
+	}
+
+	if err := h.answerer.AnswerShippingQuery(ctx, queryID, reply.Ok, reply.ShippingOptions, reply.ErrorMessage); err != nil {
+		h.logger.Error("failed to answer shipping query", "shipping_query_id", queryID, "error", err)
+		return
+	}
+
+	h.logger.Debug("shipping query answered", "shipping_query_id", queryID, "ok", reply.Ok)
+}
+
+// request asks downstream for an answer within the configured timeout
+func (h *PaymentHandler) request(ctx context.Context, update Update) (*PaymentReply, error) {
+	if h.requester == nil {
+		return nil, fmt.Errorf("broker does not support request-reply")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(h.cfg.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	data, err := h.requester.Request(ctx, h.cfg.RequestSubject, update)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply PaymentReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("failed to decode payment reply: %w", err)
+	}
+
+	return &reply, nil
+}
@@ -0,0 +1,180 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type paymentAnswer struct {
+	queryID      string
+	ok           bool
+	options      []gotgbot.ShippingOption
+	errorMessage string
+}
+
+type mockPaymentAnswerer struct {
+	mu      sync.Mutex
+	answers []paymentAnswer
+}
+
+func (m *mockPaymentAnswerer) AnswerPreCheckoutQuery(ctx context.Context, queryID string, ok bool, errorMessage string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.answers = append(m.answers, paymentAnswer{queryID: queryID, ok: ok, errorMessage: errorMessage})
+	return nil
+}
+
+func (m *mockPaymentAnswerer) AnswerShippingQuery(ctx context.Context, queryID string, ok bool, options []gotgbot.ShippingOption, errorMessage string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.answers = append(m.answers, paymentAnswer{queryID: queryID, ok: ok, options: options, errorMessage: errorMessage})
+	return nil
+}
+
+type mockRequester struct {
+	reply []byte
+	err   error
+	block bool
+}
+
+func (m *mockRequester) Request(ctx context.Context, subject string, data interface{}) ([]byte, error) {
+	if m.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return m.reply, m.err
+}
+
+func TestPaymentHandler_PreCheckoutQuery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		PreCheckoutQuery: &gotgbot.PreCheckoutQuery{
+			Id:       "query-1",
+			Currency: "USD",
+		},
+	}
+
+	t.Run("auto approve", func(t *testing.T) {
+		answerer := &mockPaymentAnswerer{}
+		handler := NewPaymentHandler(&PaymentsConfig{AutoApprove: true, TimeoutMs: 8000}, answerer, nil, logger)
+
+		handler.Handle(context.Background(), update)
+
+		require.Len(t, answerer.answers, 1)
+		assert.Equal(t, paymentAnswer{queryID: "query-1", ok: true}, answerer.answers[0])
+	})
+
+	t.Run("reply from request subject", func(t *testing.T) {
+		answerer := &mockPaymentAnswerer{}
+		requester := &mockRequester{reply: []byte(`{"ok":false,"error_message":"out of stock"}`)}
+		cfg := &PaymentsConfig{RequestSubject: "telegram.payments", TimeoutMs: 8000, DefaultOk: true}
+		handler := NewPaymentHandler(cfg, answerer, requester, logger)
+
+		handler.Handle(context.Background(), update)
+
+		require.Len(t, answerer.answers, 1)
+		assert.Equal(t, paymentAnswer{queryID: "query-1", ok: false, errorMessage: "out of stock"}, answerer.answers[0])
+	})
+
+	t.Run("timeout falls back to default answer", func(t *testing.T) {
+		answerer := &mockPaymentAnswerer{}
+		requester := &mockRequester{block: true}
+		cfg := &PaymentsConfig{
+			RequestSubject:      "telegram.payments",
+			TimeoutMs:           50,
+			DefaultOk:           false,
+			DefaultErrorMessage: "try again later",
+		}
+		handler := NewPaymentHandler(cfg, answerer, requester, logger)
+
+		start := time.Now()
+		handler.Handle(context.Background(), update)
+
+		assert.Less(t, time.Since(start), time.Second)
+		require.Len(t, answerer.answers, 1)
+		assert.Equal(t, paymentAnswer{queryID: "query-1", ok: false, errorMessage: "try again later"}, answerer.answers[0])
+	})
+
+	t.Run("timeout falls back to default approve", func(t *testing.T) {
+		answerer := &mockPaymentAnswerer{}
+		requester := &mockRequester{block: true}
+		cfg := &PaymentsConfig{RequestSubject: "telegram.payments", TimeoutMs: 50, DefaultOk: true}
+		handler := NewPaymentHandler(cfg, answerer, requester, logger)
+
+		handler.Handle(context.Background(), update)
+
+		require.Len(t, answerer.answers, 1)
+		assert.Equal(t, paymentAnswer{queryID: "query-1", ok: true}, answerer.answers[0])
+	})
+
+	t.Run("malformed reply falls back to default answer", func(t *testing.T) {
+		answerer := &mockPaymentAnswerer{}
+		requester := &mockRequester{reply: []byte("not json")}
+		cfg := &PaymentsConfig{RequestSubject: "telegram.payments", TimeoutMs: 8000, DefaultErrorMessage: "unavailable"}
+		handler := NewPaymentHandler(cfg, answerer, requester, logger)
+
+		handler.Handle(context.Background(), update)
+
+		require.Len(t, answerer.answers, 1)
+		assert.Equal(t, paymentAnswer{queryID: "query-1", ok: false, errorMessage: "unavailable"}, answerer.answers[0])
+	})
+}
+
+func TestPaymentHandler_ShippingQuery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		ShippingQuery: &gotgbot.ShippingQuery{
+			Id: "shipping-1",
+		},
+	}
+
+	t.Run("reply with options", func(t *testing.T) {
+		answerer := &mockPaymentAnswerer{}
+		requester := &mockRequester{reply: []byte(`{"ok":true,"shipping_options":[{"id":"post","title":"Post"}]}`)}
+		cfg := &PaymentsConfig{RequestSubject: "telegram.payments", TimeoutMs: 8000}
+		handler := NewPaymentHandler(cfg, answerer, requester, logger)
+
+		handler.Handle(context.Background(), update)
+
+		require.Len(t, answerer.answers, 1)
+		assert.True(t, answerer.answers[0].ok)
+		assert.Equal(t, []gotgbot.ShippingOption{{Id: "post", Title: "Post"}}, answerer.answers[0].options)
+	})
+
+	t.Run("timeout declines query", func(t *testing.T) {
+		answerer := &mockPaymentAnswerer{}
+		requester := &mockRequester{block: true}
+		cfg := &PaymentsConfig{RequestSubject: "telegram.payments", TimeoutMs: 50, DefaultOk: true, DefaultErrorMessage: "unavailable"}
+		handler := NewPaymentHandler(cfg, answerer, requester, logger)
+
+		handler.Handle(context.Background(), update)
+
+		require.Len(t, answerer.answers, 1)
+		assert.Equal(t, paymentAnswer{queryID: "shipping-1", ok: false, errorMessage: "unavailable"}, answerer.answers[0])
+	})
+
+	t.Run("auto approve does not answer shipping", func(t *testing.T) {
+		answerer := &mockPaymentAnswerer{}
+		handler := NewPaymentHandler(&PaymentsConfig{AutoApprove: true, TimeoutMs: 8000}, answerer, nil, logger)
+
+		handler.Handle(context.Background(), update)
+
+		assert.Empty(t, answerer.answers)
+	})
+}
@@ -0,0 +1,67 @@
+package bridge
+
+import "time"
+
+// adaptiveLimit tracks the getUpdates limit of the poll loop. A heavy batch
+// halves the limit, RampUpAfter light batches in a row double it back up to
+// MaxUpdatesLimit, so a long backlog after downtime is drained in smaller
+// responses. It is used by the poll loop goroutine only.
+type adaptiveLimit struct {
+	limit       int
+	min         int
+	maxBytes    int64
+	maxDuration time.Duration
+	rampUpAfter int
+	// light counts light batches since the last change
+	light int
+}
+
+// newAdaptiveLimit creates the limit from the config, it returns nil when
+// the adaptive limit is disabled
+func newAdaptiveLimit(cfg *AdaptiveLimitConfig) *adaptiveLimit {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	return &adaptiveLimit{
+		limit:       MaxUpdatesLimit,
+		min:         cfg.Min,
+		maxBytes:    cfg.MaxBatchBytes,
+		maxDuration: time.Duration(cfg.MaxBatchMs) * time.Millisecond,
+		rampUpAfter: cfg.RampUpAfter,
+	}
+}
+
+// Limit returns the limit for the next getUpdates call, MaxUpdatesLimit for
+// a nil limit
+func (a *adaptiveLimit) Limit() int {
+	if a == nil {
+		return MaxUpdatesLimit
+	}
+	return a.limit
+}
+
+// Observe records a batch of received updates, size bytes long, that took
+// elapsed to fetch and decode, and returns the new limit. Duration counts
+// only for full batches: a shorter one means there is no backlog and the
+// time was spent long polling.
+func (a *adaptiveLimit) Observe(received int, size int64, elapsed time.Duration) int {
+	if a == nil {
+		return MaxUpdatesLimit
+	}
+
+	heavy := size > a.maxBytes || (received >= a.limit && elapsed > a.maxDuration)
+	if heavy {
+		a.light = 0
+		a.limit = max(a.limit/2, a.min)
+		return a.limit
+	}
+
+	if a.limit < MaxUpdatesLimit {
+		a.light++
+		if a.light >= a.rampUpAfter {
+			a.light = 0
+			a.limit = min(a.limit*2, MaxUpdatesLimit)
+		}
+	}
+	return a.limit
+}
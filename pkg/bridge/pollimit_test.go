@@ -0,0 +1,164 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAdaptiveLimit() *adaptiveLimit {
+	return newAdaptiveLimit(&AdaptiveLimitConfig{
+		Enabled:       true,
+		Min:           10,
+		MaxBatchBytes: 1000,
+		MaxBatchMs:    100,
+		RampUpAfter:   3,
+	})
+}
+
+func TestAdaptiveLimit_Disabled(t *testing.T) {
+	assert.Nil(t, newAdaptiveLimit(nil))
+	assert.Nil(t, newAdaptiveLimit(&AdaptiveLimitConfig{Min: 10}))
+
+	var limit *adaptiveLimit
+	assert.Equal(t, MaxUpdatesLimit, limit.Limit())
+	assert.Equal(t, MaxUpdatesLimit, limit.Observe(100, 1<<30, time.Hour))
+}
+
+func TestAdaptiveLimit_RampDown(t *testing.T) {
+	t.Run("large response", func(t *testing.T) {
+		limit := testAdaptiveLimit()
+		assert.Equal(t, 100, limit.Limit())
+		assert.Equal(t, 50, limit.Observe(100, 5000, time.Millisecond))
+		assert.Equal(t, 25, limit.Observe(50, 2500, time.Millisecond))
+		assert.Equal(t, 12, limit.Observe(25, 1250, time.Millisecond))
+		assert.Equal(t, 10, limit.Observe(12, 1100, time.Millisecond))
+		assert.Equal(t, 10, limit.Observe(10, 1001, time.Millisecond), "never below min")
+	})
+
+	t.Run("slow full batch", func(t *testing.T) {
+		limit := testAdaptiveLimit()
+		assert.Equal(t, 50, limit.Observe(100, 10, time.Second))
+		assert.Equal(t, 25, limit.Observe(50, 10, time.Second))
+	})
+
+	t.Run("slow partial batch is long polling", func(t *testing.T) {
+		limit := testAdaptiveLimit()
+		assert.Equal(t, 100, limit.Observe(3, 10, 30*time.Second))
+		assert.Equal(t, 100, limit.Observe(0, 10, 30*time.Second))
+	})
+}
+
+func TestAdaptiveLimit_RampUp(t *testing.T) {
+	limit := testAdaptiveLimit()
+	limit.Observe(100, 5000, 0)
+	limit.Observe(50, 5000, 0)
+	require.Equal(t, 25, limit.Limit())
+
+	// Two light batches are not enough
+	assert.Equal(t, 25, limit.Observe(25, 100, 0))
+	assert.Equal(t, 25, limit.Observe(25, 100, 0))
+	assert.Equal(t, 50, limit.Observe(25, 100, 0))
+
+	// A heavy batch resets the streak
+	assert.Equal(t, 50, limit.Observe(50, 100, 0))
+	assert.Equal(t, 25, limit.Observe(50, 5000, 0))
+	assert.Equal(t, 25, limit.Observe(25, 100, 0))
+	assert.Equal(t, 25, limit.Observe(25, 100, 0))
+	assert.Equal(t, 50, limit.Observe(25, 100, 0))
+
+	for range 3 {
+		limit.Observe(0, 20, 0)
+	}
+	assert.Equal(t, 100, limit.Limit())
+	for range 3 {
+		limit.Observe(0, 20, 0)
+	}
+	assert.Equal(t, 100, limit.Limit(), "never above MaxUpdatesLimit")
+}
+
+// backlogServer serves a backlog of large updates from getUpdates and
+// records the limit of every call
+type backlogServer struct {
+	mu      sync.Mutex
+	backlog int
+	text    string
+	limits  []int
+}
+
+func (s *backlogServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	offset = max(offset, 1)
+
+	s.mu.Lock()
+	s.limits = append(s.limits, limit)
+	s.mu.Unlock()
+
+	result := []gotgbot.Update{}
+	for id := offset; id <= int64(s.backlog) && len(result) < limit; id++ {
+		result = append(result, gotgbot.Update{
+			UpdateId: id,
+			Message:  &gotgbot.Message{MessageId: id, Text: s.text},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func TestAdaptiveLimit_Backlog(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	for _, stream := range []bool{false, true} {
+		t.Run("stream="+strconv.FormatBool(stream), func(t *testing.T) {
+			// Every update is about 10 KB, 100 of them are far above the threshold
+			server := &backlogServer{backlog: 300, text: strings.Repeat("x", 10000)}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			client := NewTelegramClient("test-token", WithLogger(logger))
+			client.SetAPIURL(ts.URL)
+			limit := newAdaptiveLimit(&AdaptiveLimitConfig{
+				Enabled:       true,
+				Min:           5,
+				MaxBatchBytes: 200_000,
+				MaxBatchMs:    int(time.Minute.Milliseconds()),
+				RampUpAfter:   2,
+			})
+
+			var offset int64
+			received := 0
+			for range 60 {
+				client.SetUpdatesLimit(limit.Limit())
+				start := time.Now()
+				count := 0
+				for update, err := range pollUpdates(context.Background(), client, offset, stream) {
+					require.NoError(t, err)
+					count++
+					offset = update.UpdateId + 1
+				}
+				received += count
+				limit.Observe(count, client.LastUpdatesSize(), time.Since(start))
+			}
+
+			assert.Equal(t, 300, received, "the whole backlog is delivered")
+			// Ramped down from the default while draining the backlog
+			assert.Equal(t, []int{100, 50, 25, 12}, server.limits[:4])
+			// Ramped back up once the backlog was drained
+			assert.Equal(t, 100, server.limits[len(server.limits)-1])
+			assert.Equal(t, 100, limit.Limit())
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package bridge
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// PollTally is a snapshot of poll vote counts published by poll aggregation
+type PollTally struct {
+	PollID          string  `json:"poll_id"`
+	OptionCounts    []int64 `json:"option_counts"`
+	TotalVoterCount int64   `json:"total_voter_count"`
+	IsClosed        bool    `json:"is_closed"`
+}
+
+// pollState is the in-memory tally of a single poll
+type pollState struct {
+	counts []int64
+	total  int64
+	// votes holds current option ids by voter (user id or voter chat id),
+	// known only for non-anonymous polls
+	votes map[int64][]int64
+}
+
+// PollAggregator keeps per-poll vote tallies built from poll and poll_answer
+// updates. poll updates carry the counts from Telegram and replace the tally;
+// poll_answer updates (non-anonymous polls only) adjust it, taking changed and
+// retracted votes into account. Closed polls are evicted.
+type PollAggregator struct {
+	mu    sync.Mutex
+	cache *ttlCache
+}
+
+// NewPollAggregator creates a new PollAggregator keeping up to cacheSize polls
+func NewPollAggregator(cacheSize int, ttl time.Duration) *PollAggregator {
+	return &PollAggregator{
+		cache: newTTLCache(cacheSize, ttl),
+	}
+}
+
+// Track updates the tally from a poll or poll_answer update and returns its
+// snapshot, or nil for other updates
+func (a *PollAggregator) Track(update Update) *PollTally {
+	switch {
+	case update.Poll != nil:
+		return a.trackPoll(update)
+	case update.PollAnswer != nil:
+		return a.trackAnswer(update)
+	}
+	return nil
+}
+
+func (a *PollAggregator) trackPoll(update Update) *PollTally {
+	poll := update.Poll
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := a.state(poll.Id)
+	state.counts = make([]int64, len(poll.Options))
+	for i, option := range poll.Options {
+		state.counts[i] = option.VoterCount
+	}
+	state.total = poll.TotalVoterCount
+
+	tally := state.tally(poll.Id)
+	if poll.IsClosed {
+		tally.IsClosed = true
+		a.cache.delete(poll.Id)
+		return tally
+	}
+
+	a.cache.set(poll.Id, state)
+	return tally
+}
+
+func (a *PollAggregator) trackAnswer(update Update) *PollTally {
+	answer := update.PollAnswer
+
+	var voter int64
+	switch {
+	case answer.VoterChat != nil:
+		voter = answer.VoterChat.Id
+	case answer.User != nil:
+		voter = answer.User.Id
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := a.state(answer.PollId)
+
+	previous := state.votes[voter]
+	for _, option := range previous {
+		if option < int64(len(state.counts)) && state.counts[option] > 0 {
+			state.counts[option]--
+		}
+	}
+	for _, option := range answer.OptionIds {
+		if option >= int64(len(state.counts)) {
+			state.counts = append(state.counts, make([]int64, option+1-int64(len(state.counts)))...)
+		}
+		state.counts[option]++
+	}
+
+	switch {
+	case len(previous) == 0 && len(answer.OptionIds) > 0:
+		state.total++
+	case len(previous) > 0 && len(answer.OptionIds) == 0:
+		state.total = max(state.total-1, 0)
+	}
+
+	if len(answer.OptionIds) > 0 {
+		state.votes[voter] = slices.Clone(answer.OptionIds)
+	} else {
+		delete(state.votes, voter)
+	}
+
+	a.cache.set(answer.PollId, state)
+	return state.tally(answer.PollId)
+}
+
+// state returns the tally of the poll, creating an empty one; a.mu must be held
+func (a *PollAggregator) state(pollID string) *pollState {
+	if value, ok := a.cache.get(pollID); ok {
+		return value.(*pollState)
+	}
+	return &pollState{votes: make(map[int64][]int64)}
+}
+
+// tally returns a snapshot safe to publish after the state changes
+func (s *pollState) tally(pollID string) *PollTally {
+	return &PollTally{
+		PollID:          pollID,
+		OptionCounts:    append(make([]int64, 0, len(s.counts)), s.counts...),
+		TotalVoterCount: s.total,
+	}
+}
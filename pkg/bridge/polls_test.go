@@ -0,0 +1,82 @@
+package bridge
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollAggregator_Anonymous(t *testing.T) {
+	aggregator := NewPollAggregator(10, time.Hour)
+
+	tally := aggregator.Track(loadUpdateFixture(t, "poll_anonymous"))
+	require.NotNil(t, tally)
+	assert.Equal(t, &PollTally{PollID: "poll-anon", OptionCounts: []int64{3, 5}, TotalVoterCount: 8}, tally)
+
+	// Closing flushes the final counts and evicts the poll
+	tally = aggregator.Track(loadUpdateFixture(t, "poll_anonymous_closed"))
+	require.NotNil(t, tally)
+	assert.Equal(t, &PollTally{PollID: "poll-anon", OptionCounts: []int64{4, 6}, TotalVoterCount: 10, IsClosed: true}, tally)
+	assert.Zero(t, aggregator.cache.len())
+}
+
+func TestPollAggregator_Answers(t *testing.T) {
+	aggregator := NewPollAggregator(10, time.Hour)
+
+	tally := aggregator.Track(loadUpdateFixture(t, "poll_public"))
+	require.NotNil(t, tally)
+	assert.Equal(t, []int64{0, 0, 0}, tally.OptionCounts)
+
+	steps := []struct {
+		fixture string
+		counts  []int64
+		total   int64
+	}{
+		{fixture: "poll_answer", counts: []int64{1, 1, 0}, total: 1},
+		{fixture: "poll_answer_chat", counts: []int64{1, 2, 0}, total: 2},
+		{fixture: "poll_answer_changed", counts: []int64{0, 1, 1}, total: 2},
+		{fixture: "poll_answer_retracted", counts: []int64{0, 1, 0}, total: 1},
+	}
+
+	for _, step := range steps {
+		tally := aggregator.Track(loadUpdateFixture(t, step.fixture))
+		require.NotNil(t, tally, step.fixture)
+		assert.Equal(t, "poll-public", tally.PollID, step.fixture)
+		assert.Equal(t, step.counts, tally.OptionCounts, step.fixture)
+		assert.Equal(t, step.total, tally.TotalVoterCount, step.fixture)
+	}
+}
+
+func TestPollAggregator_AnswerBeforePoll(t *testing.T) {
+	aggregator := NewPollAggregator(10, time.Hour)
+
+	// Options are unknown until the poll update arrives, counts grow as needed
+	tally := aggregator.Track(loadUpdateFixture(t, "poll_answer"))
+	require.NotNil(t, tally)
+	assert.Equal(t, []int64{1, 1}, tally.OptionCounts)
+	assert.Equal(t, int64(1), tally.TotalVoterCount)
+}
+
+func TestPollAggregator_Snapshot(t *testing.T) {
+	aggregator := NewPollAggregator(10, time.Hour)
+
+	first := aggregator.Track(loadUpdateFixture(t, "poll_answer"))
+	aggregator.Track(loadUpdateFixture(t, "poll_answer_changed"))
+
+	// Published snapshots don't change with later answers
+	assert.Equal(t, []int64{1, 1}, first.OptionCounts)
+
+	data, err := json.Marshal(aggregator.Track(loadUpdateFixture(t, "poll_answer_retracted")))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"poll_id":"poll-public","option_counts":[0,0,0],"total_voter_count":0,"is_closed":false}`, string(data))
+}
+
+func TestPollAggregator_OtherUpdates(t *testing.T) {
+	aggregator := NewPollAggregator(10, time.Hour)
+
+	assert.Nil(t, aggregator.Track(loadUpdateFixture(t, "business_message")))
+	assert.Zero(t, aggregator.cache.len())
+}
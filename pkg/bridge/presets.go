@@ -0,0 +1,46 @@
+package bridge
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// conditionPresets maps condition_preset names to expr conditions
+var conditionPresets = map[string]string{
+	"is_text_message":    `update.Message != nil && update.Message.Text != ""`,
+	"is_command":         `update.Message != nil && len(update.Message.Entities) > 0 && update.Message.Entities[0].Type == "bot_command" && update.Message.Entities[0].Offset == 0`,
+	"is_photo":           `update.Message != nil && len(update.Message.Photo) > 0`,
+	"is_private_message": `update.Message != nil && update.Message.Chat.Type == "private"`,
+	"is_group_message":   `update.Message != nil && update.Message.Chat.Type in ["group", "supergroup"]`,
+	"is_channel_post":    `update.ChannelPost != nil`,
+	"is_edited_message":  `update.EditedMessage != nil`,
+	"is_callback_query":  `update.CallbackQuery != nil`,
+}
+
+// expandConditionPresets replaces condition_preset of routes with the preset
+// condition. A route with both condition_preset and condition matches when
+// both do.
+func expandConditionPresets(routes []Route) error {
+	for i := range routes {
+		name := routes[i].ConditionPreset
+		if name == "" {
+			continue
+		}
+
+		preset, ok := conditionPresets[name]
+		if !ok {
+			return fmt.Errorf("routes[%d].condition_preset '%s' is unknown, available: %s",
+				i, name, strings.Join(slices.Sorted(maps.Keys(conditionPresets)), ", "))
+		}
+
+		if routes[i].Condition == "" {
+			routes[i].Condition = preset
+		} else {
+			routes[i].Condition = fmt.Sprintf("(%s) && (%s)", preset, routes[i].Condition)
+		}
+		routes[i].ConditionPreset = ""
+	}
+	return nil
+}
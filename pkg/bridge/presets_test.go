@@ -0,0 +1,87 @@
+package bridge
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionPresets(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	updates := map[string]string{
+		"text":     `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"hi"}}`,
+		"command":  `{"update_id":2,"message":{"message_id":2,"date":1,"chat":{"id":-100,"type":"group"},"text":"/start now","entities":[{"type":"bot_command","offset":0,"length":6}]}}`,
+		"mention":  `{"update_id":3,"message":{"message_id":3,"date":1,"chat":{"id":-100,"type":"supergroup"},"text":"see /start","entities":[{"type":"bot_command","offset":4,"length":6}]}}`,
+		"photo":    `{"update_id":4,"message":{"message_id":4,"date":1,"chat":{"id":1,"type":"private"},"photo":[{"file_id":"p","file_unique_id":"u","width":90,"height":90}]}}`,
+		"channel":  `{"update_id":5,"channel_post":{"message_id":5,"date":1,"chat":{"id":-200,"type":"channel"},"text":"news"}}`,
+		"edited":   `{"update_id":6,"edited_message":{"message_id":1,"date":1,"edit_date":2,"chat":{"id":1,"type":"private"},"text":"hi!"}}`,
+		"callback": `{"update_id":7,"callback_query":{"id":"1","from":{"id":1,"is_bot":false,"first_name":"User"},"chat_instance":"1","data":"x"}}`,
+	}
+
+	tests := []struct {
+		preset string
+		match  []string
+	}{
+		{preset: "is_text_message", match: []string{"text", "command", "mention"}},
+		{preset: "is_command", match: []string{"command"}},
+		{preset: "is_photo", match: []string{"photo"}},
+		{preset: "is_private_message", match: []string{"text", "photo"}},
+		{preset: "is_group_message", match: []string{"command", "mention"}},
+		{preset: "is_channel_post", match: []string{"channel"}},
+		{preset: "is_edited_message", match: []string{"edited"}},
+		{preset: "is_callback_query", match: []string{"callback"}},
+	}
+	require.Len(t, tests, len(conditionPresets), "every preset must be tested")
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			routes := []Route{{
+				ConditionPreset: tt.preset,
+				Subject:         &RouteSubject{Type: SubjectTypeString, Value: "telegram.preset"},
+			}}
+			require.NoError(t, expandConditionPresets(routes))
+
+			router, err := NewRouter(routes, "first", 1, logger)
+			require.NoError(t, err)
+
+			for name, raw := range updates {
+				var update Update
+				require.NoError(t, json.Unmarshal([]byte(raw), &update))
+
+				dests, err := router.Route(update)
+				require.NoError(t, err)
+				assert.Equal(t, slices.Contains(tt.match, name), len(dests) == 1, "update %s", name)
+			}
+		})
+	}
+}
+
+func TestExpandConditionPresets(t *testing.T) {
+	t.Run("combined with condition", func(t *testing.T) {
+		routes := []Route{{ConditionPreset: "is_private_message", Condition: `update.Message.Text == "hi"`}}
+		require.NoError(t, expandConditionPresets(routes))
+		assert.Equal(t, `(`+conditionPresets["is_private_message"]+`) && (update.Message.Text == "hi")`, routes[0].Condition)
+		assert.Empty(t, routes[0].ConditionPreset)
+	})
+
+	t.Run("raw condition untouched", func(t *testing.T) {
+		routes := []Route{{Condition: "update.Poll != nil"}}
+		require.NoError(t, expandConditionPresets(routes))
+		assert.Equal(t, "update.Poll != nil", routes[0].Condition)
+	})
+
+	t.Run("unknown preset", func(t *testing.T) {
+		routes := []Route{{Condition: "true"}, {ConditionPreset: "is_sticker"}}
+		err := expandConditionPresets(routes)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "routes[1].condition_preset 'is_sticker' is unknown")
+	})
+}
@@ -0,0 +1,86 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ProbeSubject receives the startup self-test message
+const ProbeSubject = "_bridge.probe"
+
+type ProbeFailureAction string
+
+const (
+	ProbeFailureExit ProbeFailureAction = "exit"
+	ProbeFailureWarn ProbeFailureAction = "warn"
+)
+
+// Prober is implemented by broker clients that can verify the publish path
+type Prober interface {
+	// Probe publishes a probe message and waits until the server processed it.
+	// With roundTrip the message must also be received back.
+	Probe(ctx context.Context, roundTrip bool) error
+}
+
+// probeConn publishes a probe on ProbeSubject. Permission violations are
+// reported by the server asynchronously, so a flush is used to wait for them.
+func probeConn(ctx context.Context, conn *nats.Conn, roundTrip bool) error {
+	if conn == nil {
+		return fmt.Errorf("NATS connection is not established")
+	}
+
+	var sub *nats.Subscription
+	if roundTrip {
+		var err error
+		sub, err = conn.SubscribeSync(ProbeSubject)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to probe subject: %w", err)
+		}
+		defer sub.Unsubscribe()
+	}
+
+	id := nats.NewInbox()
+	if err := conn.Publish(ProbeSubject, []byte(id)); err != nil {
+		return fmt.Errorf("failed to publish probe: %w", err)
+	}
+
+	if err := conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush probe: %w", err)
+	}
+
+	if err := conn.LastError(); errors.Is(err, nats.ErrPermissionViolation) {
+		return fmt.Errorf("probe rejected: %w", err)
+	}
+
+	if !roundTrip {
+		return nil
+	}
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return fmt.Errorf("probe was not received back: %w", err)
+		}
+		if string(msg.Data) == id {
+			return nil
+		}
+	}
+}
+
+// Probe publishes a probe message on ProbeSubject
+func (c *NATSClient) Probe(ctx context.Context, roundTrip bool) error {
+	return probeConn(ctx, c.conn.Load(), roundTrip)
+}
+
+// Probe publishes a probe message on ProbeSubject using core NATS
+func (c *JetStreamClient) Probe(ctx context.Context, roundTrip bool) error {
+	return probeConn(ctx, c.nc, roundTrip)
+}
+
+var (
+	_ Prober = (*NATSClient)(nil)
+	_ Prober = (*JetStreamClient)(nil)
+)
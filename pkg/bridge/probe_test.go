@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runProbeServer starts an embedded server with a single user that may
+// subscribe anywhere and, unless denyPublish is set, publish anywhere
+func runProbeServer(t *testing.T, denyPublish bool) string {
+	t.Helper()
+
+	opts := natstest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	user := &server.User{Username: "bridge", Password: "secret"}
+	if denyPublish {
+		user.Permissions = &server.Permissions{Publish: &server.SubjectPermission{Deny: []string{">"}}}
+	}
+	opts.Users = []*server.User{user}
+	srv := natstest.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+	return srv.ClientURL()
+}
+
+func TestNATSClient_Probe(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	tests := []struct {
+		name        string
+		denyPublish bool
+		roundTrip   bool
+		errMsg      string
+	}{
+		{name: "publish", roundTrip: false},
+		{name: "round trip", roundTrip: true},
+		{name: "publish denied", denyPublish: true, errMsg: "probe rejected"},
+		{name: "round trip publish denied", denyPublish: true, roundTrip: true, errMsg: "probe rejected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			client := NewNATSClient(runProbeServer(t, tt.denyPublish), WithNATSLogger(logger), WithUserInfo("bridge", "secret"))
+			require.NoError(t, client.Connect(ctx))
+			defer client.Close()
+
+			err := client.Probe(ctx, tt.roundTrip)
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNATSClient_Probe_NotConnected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	err := NewNATSClient("nats://localhost:4222", WithNATSLogger(logger)).Probe(context.Background(), false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "NATS connection is not established")
+}
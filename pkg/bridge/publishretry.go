@@ -0,0 +1,124 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"strconv"
+	"time"
+)
+
+// Headers of publications moved to the dead-letter destination
+const (
+	PublishErrorHeader      = "Publish-Error"
+	FailedDestinationHeader = "Failed-Destination"
+	PublishAttemptsHeader   = "Publish-Attempts"
+)
+
+// Defaults of publish_max_attempts and publish_retry_backoff_ms
+const (
+	DefaultPublishMaxAttempts    = 3
+	DefaultPublishRetryBackoffMs = 100
+)
+
+// maxPublishRetryBackoff caps the doubling delay between attempts
+const maxPublishRetryBackoff = 5 * time.Second
+
+// retryablePublishError reports whether publishing again may succeed.
+// Timeouts and other broker errors are transient; oversized payloads,
+// permission violations, encoding errors and a closed connection fail the
+// same way on every attempt.
+func retryablePublishError(err error) bool {
+	var marshalerErr *json.MarshalerError
+	var unsupportedType *json.UnsupportedTypeError
+	var unsupportedValue *json.UnsupportedValueError
+	var perm *permanentError
+	switch {
+	case errors.Is(err, ErrMaxPayload),
+		errors.Is(err, ErrPermissions),
+		errors.Is(err, ErrConnectionClosed),
+		errors.Is(err, context.Canceled),
+		errors.As(err, &marshalerErr),
+		errors.As(err, &unsupportedType),
+		errors.As(err, &unsupportedValue),
+		errors.As(err, &perm):
+		return false
+	}
+	return true
+}
+
+// retryDelay returns the delay before the attempt after the given one
+func (p *Publisher) retryDelay(attempt int) time.Duration {
+	delay := p.retryBackoff
+	for range attempt - 1 {
+		if delay >= maxPublishRetryBackoff {
+			break
+		}
+		delay *= 2
+	}
+	return min(delay, maxPublishRetryBackoff)
+}
+
+// retry queues task again after the backoff delay. The worker moves on to
+// the next task meanwhile, so a failing destination doesn't stall its
+// queue. Once the publisher is closing its queues take no tasks, so the
+// retry is published here; task fails with err if the shutdown timeout
+// expires first.
+func (p *Publisher) retry(task publishTask, err error) {
+	delay := p.retryDelay(task.attempt)
+	p.logger.Warn("failed to publish message, retrying",
+		"destination", task.dest,
+		"attempt", task.attempt,
+		"retry_in", delay,
+		"error", err)
+
+	p.retries.Add(1)
+	go func() {
+		defer p.retries.Done()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-p.ctx.Done():
+		case <-timer.C:
+			if p.submit(task.key, task) {
+				return
+			}
+			if p.ctx.Err() == nil {
+				p.publishTask(task)
+				return
+			}
+		}
+		p.logger.Error("failed to publish message, publisher closed before retry",
+			"destination", task.dest,
+			"attempts", task.attempt,
+			"error", err)
+		p.finish(task, err, 0)
+	}()
+}
+
+// publishDeadLetter publishes the data of a failed task to the dead-letter
+// destination once, with the error and the original destination in headers
+func (p *Publisher) publishDeadLetter(task publishTask, err error) {
+	if p.deadLetter == nil || task.dest.Subject == p.deadLetter.Subject && task.dest.Topic == p.deadLetter.Topic {
+		return
+	}
+
+	dest := *p.deadLetter
+	dest.Key = task.dest.Key
+	dest.Headers = maps.Clone(task.dest.Headers)
+	if dest.Headers == nil {
+		dest.Headers = make(map[string]string, 3)
+	}
+	dest.Headers[PublishErrorHeader] = err.Error()
+	dest.Headers[FailedDestinationHeader] = task.dest.Subject + task.dest.Topic
+	dest.Headers[PublishAttemptsHeader] = strconv.Itoa(task.attempt)
+
+	// Bounded by Close like the publication itself
+	ctx, cancel := context.WithTimeout(p.ctx, p.publishTimeout)
+	defer cancel()
+	if err := p.brokerClient.Publish(ctx, dest, task.data); err != nil {
+		p.logger.Error("failed to publish to dead-letter destination", "destination", dest, "error", err)
+	}
+}
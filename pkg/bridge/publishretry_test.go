@@ -0,0 +1,213 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySink fails publications to the subjects in failures, each the given
+// number of times, and records every attempt
+type flakySink struct {
+	mu       sync.Mutex
+	failures map[string]int
+	err      error
+	attempts []Destination
+}
+
+func (s *flakySink) Connect(ctx context.Context) error { return nil }
+
+func (s *flakySink) Publish(ctx context.Context, dest Destination, data interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, dest)
+	if s.failures[dest.Subject] > 0 {
+		s.failures[dest.Subject]--
+		return s.err
+	}
+	return nil
+}
+
+func (s *flakySink) Close() error { return nil }
+
+func (s *flakySink) published(subject string) []Destination {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var dests []Destination
+	for _, dest := range s.attempts {
+		if dest.Subject == subject {
+			dests = append(dests, dest)
+		}
+	}
+	return dests
+}
+
+func TestRetryablePublishError(t *testing.T) {
+	_, marshalErr := json.Marshal(math.Inf(1))
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "timeout", err: context.DeadlineExceeded, want: true},
+		{name: "other", err: errors.New("nats: no responders available for request"), want: true},
+		{name: "max payload", err: fmt.Errorf("failed to publish message: %w", ErrMaxPayload)},
+		{name: "permissions", err: fmt.Errorf("failed to publish message: %w", ErrPermissions)},
+		{name: "connection closed", err: ErrConnectionClosed},
+		{name: "client closed", err: ErrClosed},
+		{name: "shutdown", err: context.Canceled},
+		{name: "encoding", err: fmt.Errorf("failed to marshal data: %w", marshalErr)},
+		{name: "marked permanent", err: permanent(errors.New("bad topic"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryablePublishError(tt.err))
+		})
+	}
+}
+
+func TestPublisher_RetryDelay(t *testing.T) {
+	publisher := NewPublisher(1, 5, &mockBroker{}, slog.Default())
+	publisher.SetRetry(10, time.Second)
+
+	assert.Equal(t, time.Second, publisher.retryDelay(1))
+	assert.Equal(t, 2*time.Second, publisher.retryDelay(2))
+	assert.Equal(t, 4*time.Second, publisher.retryDelay(3))
+	assert.Equal(t, maxPublishRetryBackoff, publisher.retryDelay(4))
+	assert.Equal(t, maxPublishRetryBackoff, publisher.retryDelay(9))
+}
+
+func TestPublisher_Retry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	tests := []struct {
+		name         string
+		failures     int
+		err          error
+		wantSuccess  bool
+		wantAttempts int
+	}{
+		{name: "transient", failures: 2, err: errors.New("nats: timeout"), wantSuccess: true, wantAttempts: 3},
+		{name: "out of attempts", failures: 5, err: errors.New("nats: timeout"), wantAttempts: 3},
+		{name: "permanent", failures: 5, err: fmt.Errorf("failed to publish message: %w", ErrMaxPayload), wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &flakySink{failures: map[string]int{"telegram.messages": tt.failures}, err: tt.err}
+			results := make(chan PublishResult, 1)
+
+			publisher := NewPublisher(1, 5, sink, logger)
+			publisher.SetRetry(3, time.Millisecond)
+			publisher.SetDeadLetter(Destination{Subject: "telegram.dead_letter"})
+			publisher.SetResultHandler(func(r PublishResult) { results <- r })
+			publisher.Start()
+			defer publisher.Close()
+
+			publisher.Publish(Destination{Subject: "telegram.messages", Headers: map[string]string{CorrelationIDHeader: "42-1"}}, "data")
+
+			select {
+			case result := <-results:
+				assert.Equal(t, tt.wantSuccess, result.Success)
+				assert.Equal(t, tt.wantAttempts, result.Attempts)
+			case <-time.After(2 * time.Second):
+				t.Fatal("no publish result")
+			}
+			assert.Len(t, sink.published("telegram.messages"), tt.wantAttempts)
+
+			deadLetters := sink.published("telegram.dead_letter")
+			if tt.wantSuccess {
+				assert.Empty(t, deadLetters)
+				return
+			}
+			require.Len(t, deadLetters, 1)
+			assert.Equal(t, map[string]string{
+				CorrelationIDHeader:     "42-1",
+				PublishErrorHeader:      tt.err.Error(),
+				FailedDestinationHeader: "telegram.messages",
+				PublishAttemptsHeader:   fmt.Sprint(tt.wantAttempts),
+			}, deadLetters[0].Headers)
+		})
+	}
+}
+
+func TestPublisher_RetryDoesNotBlockWorker(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	sink := &flakySink{failures: map[string]int{"telegram.slow": 1}, err: errors.New("nats: timeout")}
+	results := make(chan PublishResult, 2)
+
+	publisher := NewPublisher(1, 5, sink, logger)
+	publisher.SetRetry(2, 200*time.Millisecond)
+	publisher.SetResultHandler(func(r PublishResult) { results <- r })
+	publisher.Start()
+	defer publisher.Close()
+
+	// The single worker publishes the second message while the first waits for its retry
+	publisher.PublishOrdered(1, Destination{Subject: "telegram.slow"}, "data")
+	publisher.PublishOrdered(1, Destination{Subject: "telegram.fast"}, "data")
+
+	first := <-results
+	assert.Equal(t, "telegram.fast", first.Destination.Subject)
+	second := <-results
+	assert.Equal(t, "telegram.slow", second.Destination.Subject)
+	assert.True(t, second.Success)
+	assert.Equal(t, 2, second.Attempts)
+}
+
+func TestPublisher_CloseDuringRetry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	t.Run("pending retry is published before close returns", func(t *testing.T) {
+		sink := &flakySink{failures: map[string]int{"telegram.messages": 1}, err: errors.New("nats: timeout")}
+
+		publisher := NewPublisher(1, 5, sink, logger)
+		publisher.SetRetry(3, 200*time.Millisecond)
+		publisher.Start()
+
+		done := make(chan error, 1)
+		publisher.PublishTracked(1, Destination{Subject: "telegram.messages"}, "data", func(err error) { done <- err })
+		require.Eventually(t, func() bool { return len(sink.published("telegram.messages")) == 1 }, time.Second, time.Millisecond)
+
+		publisher.Close()
+		assert.NoError(t, <-done)
+		assert.Len(t, sink.published("telegram.messages"), 2)
+	})
+
+	t.Run("retry past the shutdown timeout fails", func(t *testing.T) {
+		publishErr := errors.New("nats: timeout")
+		sink := &flakySink{failures: map[string]int{"telegram.messages": 5}, err: publishErr}
+
+		publisher := NewPublisher(1, 1, sink, logger)
+		publisher.SetRetry(3, time.Hour)
+		publisher.Start()
+
+		done := make(chan error, 1)
+		publisher.PublishTracked(1, Destination{Subject: "telegram.messages"}, "data", func(err error) { done <- err })
+		require.Eventually(t, func() bool { return len(sink.published("telegram.messages")) == 1 }, time.Second, time.Millisecond)
+
+		start := time.Now()
+		publisher.Close()
+		assert.Less(t, time.Since(start), 2*time.Second)
+		assert.ErrorIs(t, <-done, publishErr)
+		assert.Len(t, sink.published("telegram.messages"), 1)
+	})
+}
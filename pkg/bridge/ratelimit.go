@@ -0,0 +1,145 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sendLimiterSweepSize is the number of chat buckets after which idle ones are dropped
+const sendLimiterSweepSize = 10000
+
+// tokenBucket allows rate tokens per second with bursts up to burst tokens.
+// Tokens may go negative: a reservation is granted immediately and the caller
+// waits until the bucket refills.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// take takes a token if one is available without going negative
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// idle reports whether the bucket is full, i.e. it can be recreated without effect
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// SendLimiter delays outbound messages to stay within Telegram limits
+// instead of hitting 429 Too Many Requests. Every chat has its own bucket
+// holding one second worth of messages, groups (negative chat ids) are also
+// held to the per-minute group limit, and all chats share the global bucket.
+type SendLimiter struct {
+	mu             sync.Mutex
+	perChatPerSec  float64
+	perGroupPerMin float64
+	global         *tokenBucket
+	chats          map[int64]*tokenBucket
+	groups         map[int64]*tokenBucket
+	now            func() time.Time
+}
+
+// NewSendLimiter creates a new SendLimiter from the config
+func NewSendLimiter(cfg RateLimitConfig) *SendLimiter {
+	return &SendLimiter{
+		perChatPerSec:  float64(cfg.PerChatPerSec),
+		perGroupPerMin: float64(cfg.PerGroupPerMin),
+		global:         newTokenBucket(float64(cfg.GlobalPerSec), float64(cfg.GlobalPerSec), time.Now()),
+		chats:          make(map[int64]*tokenBucket),
+		groups:         make(map[int64]*tokenBucket),
+		now:            time.Now,
+	}
+}
+
+// Wait blocks until a message may be sent to the chat or ctx is done
+func (l *SendLimiter) Wait(ctx context.Context, chatID int64) error {
+	delay := l.reserve(chatID)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes a token from every bucket that applies to the chat and
+// returns the longest wait
+func (l *SendLimiter) reserve(chatID int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.chats) >= sendLimiterSweepSize {
+		l.sweep(now)
+	}
+
+	chat, ok := l.chats[chatID]
+	if !ok {
+		chat = newTokenBucket(l.perChatPerSec, l.perChatPerSec, now)
+		l.chats[chatID] = chat
+	}
+	delay := max(l.global.reserve(now), chat.reserve(now))
+
+	if chatID < 0 {
+		group, ok := l.groups[chatID]
+		if !ok {
+			group = newTokenBucket(l.perGroupPerMin/60, l.perGroupPerMin, now)
+			l.groups[chatID] = group
+		}
+		delay = max(delay, group.reserve(now))
+	}
+
+	return delay
+}
+
+// sweep drops buckets of chats that were not sent to recently; l.mu must be held
+func (l *SendLimiter) sweep(now time.Time) {
+	for id, bucket := range l.chats {
+		if bucket.idle(now) {
+			delete(l.chats, id)
+		}
+	}
+	for id, bucket := range l.groups {
+		if bucket.idle(now) {
+			delete(l.groups, id)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSendLimiter returns a limiter with a clock that only moves when told to
+func newTestSendLimiter(cfg RateLimitConfig) (*SendLimiter, *time.Time) {
+	limiter := NewSendLimiter(cfg)
+	now := time.Now()
+	limiter.global.last = now
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestSendLimiter_BurstToSameChat(t *testing.T) {
+	limiter, now := newTestSendLimiter(RateLimitConfig{PerChatPerSec: 1, PerGroupPerMin: 20, GlobalPerSec: 30})
+
+	assert.Zero(t, limiter.reserve(42))
+	assert.Equal(t, time.Second, limiter.reserve(42))
+	assert.Equal(t, 2*time.Second, limiter.reserve(42))
+
+	*now = now.Add(3 * time.Second)
+	assert.Zero(t, limiter.reserve(42))
+}
+
+func TestSendLimiter_BurstToGroup(t *testing.T) {
+	limiter, now := newTestSendLimiter(RateLimitConfig{PerChatPerSec: 100, PerGroupPerMin: 20, GlobalPerSec: 30})
+
+	for i := 0; i < 20; i++ {
+		assert.Zero(t, limiter.reserve(-100), "message %d", i)
+	}
+	// 20 per minute refills a token every 3 seconds
+	assert.Equal(t, 3*time.Second, limiter.reserve(-100))
+
+	// Private chats are not subject to the group limit
+	assert.Zero(t, limiter.reserve(100))
+
+	*now = now.Add(6 * time.Second)
+	assert.Zero(t, limiter.reserve(-100))
+}
+
+func TestSendLimiter_BurstToManyChats(t *testing.T) {
+	limiter, now := newTestSendLimiter(RateLimitConfig{PerChatPerSec: 1, PerGroupPerMin: 20, GlobalPerSec: 30})
+
+	for chatID := int64(1); chatID <= 30; chatID++ {
+		assert.Zero(t, limiter.reserve(chatID), "chat %d", chatID)
+	}
+
+	// The global bucket is empty, the next chats queue behind it
+	assert.Equal(t, time.Second/30, limiter.reserve(31))
+	assert.Equal(t, 2*time.Second/30, limiter.reserve(32))
+
+	*now = now.Add(time.Second)
+	assert.Zero(t, limiter.reserve(33))
+}
+
+func TestSendLimiter_Sweep(t *testing.T) {
+	limiter, now := newTestSendLimiter(RateLimitConfig{PerChatPerSec: 1000, PerGroupPerMin: 60000, GlobalPerSec: 1000000})
+
+	for chatID := int64(1); chatID <= sendLimiterSweepSize; chatID++ {
+		limiter.reserve(-chatID)
+	}
+	require.Len(t, limiter.chats, sendLimiterSweepSize)
+
+	*now = now.Add(time.Second)
+	limiter.reserve(1)
+	assert.Len(t, limiter.chats, 1)
+	assert.Empty(t, limiter.groups)
+}
+
+func TestSendLimiter_Wait(t *testing.T) {
+	t.Run("waits for the chat bucket", func(t *testing.T) {
+		limiter := NewSendLimiter(RateLimitConfig{PerChatPerSec: 20, PerGroupPerMin: 1200, GlobalPerSec: 1000})
+
+		// The first 20 messages use the burst, the next two wait 50ms each
+		start := time.Now()
+		for i := 0; i < 22; i++ {
+			require.NoError(t, limiter.Wait(context.Background(), 42))
+		}
+		assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		limiter := NewSendLimiter(RateLimitConfig{PerChatPerSec: 1, PerGroupPerMin: 20, GlobalPerSec: 30})
+		require.NoError(t, limiter.Wait(context.Background(), 42))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := limiter.Wait(ctx, 42)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
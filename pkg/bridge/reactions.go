@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// reactionsAdded returns reactions present in new_reaction but not in
+// old_reaction of a message_reaction update. Emoji reactions are returned as
+// the emoji, custom emoji reactions as custom_emoji_id, paid reactions as "paid".
+func reactionsAdded(update Update) []string {
+	if update.MessageReaction == nil {
+		return nil
+	}
+	return reactionDiff(update.MessageReaction.NewReaction, update.MessageReaction.OldReaction)
+}
+
+// reactionsRemoved returns reactions present in old_reaction but not in
+// new_reaction of a message_reaction update
+func reactionsRemoved(update Update) []string {
+	if update.MessageReaction == nil {
+		return nil
+	}
+	return reactionDiff(update.MessageReaction.OldReaction, update.MessageReaction.NewReaction)
+}
+
+// reactionDiff returns reactions of from missing in other, in from order
+func reactionDiff(from, other []gotgbot.ReactionType) []string {
+	skip := make(map[gotgbot.MergedReactionType]bool, len(other))
+	for _, reaction := range other {
+		skip[reaction.MergeReactionType()] = true
+	}
+
+	diff := []string{}
+	for _, reaction := range from {
+		merged := reaction.MergeReactionType()
+		if skip[merged] {
+			continue
+		}
+		skip[merged] = true
+		diff = append(diff, reactionString(merged))
+	}
+	return diff
+}
+
+func reactionString(reaction gotgbot.MergedReactionType) string {
+	switch reaction.Type {
+	case "emoji":
+		return reaction.Emoji
+	case "custom_emoji":
+		return reaction.CustomEmojiId
+	}
+	return reaction.Type
+}
@@ -0,0 +1,60 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReactions(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		updateType string
+		added      []string
+		removed    []string
+		headers    map[string]string
+	}{
+		{
+			fixture:    "message_reaction",
+			updateType: "message_reaction",
+			added:      []string{"👍"},
+			removed:    []string{},
+			headers:    map[string]string{ReactionsAddedHeader: "👍"},
+		},
+		{
+			// 🔥 is kept, so it is neither added nor removed
+			fixture:    "message_reaction_replaced",
+			updateType: "message_reaction",
+			added:      []string{"5368324170671202286", "paid"},
+			removed:    []string{"👍"},
+			headers: map[string]string{
+				ReactionsAddedHeader:   "5368324170671202286,paid",
+				ReactionsRemovedHeader: "👍",
+			},
+		},
+		{
+			// Anonymous counts carry no changes
+			fixture:    "message_reaction_count",
+			updateType: "message_reaction_count",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			update := loadUpdateFixture(t, tt.fixture)
+
+			assert.Equal(t, tt.added, reactionsAdded(update))
+			assert.Equal(t, tt.removed, reactionsRemoved(update))
+			assert.Equal(t, tt.headers, updateHeaders(update, ""))
+			assert.Equal(t, tt.updateType, updateType(update))
+		})
+	}
+}
+
+func TestReactions_CustomEmojiDoesNotMatchEmoji(t *testing.T) {
+	update := loadUpdateFixture(t, "message_reaction_replaced")
+	update.MessageReaction.OldReaction = nil
+
+	assert.Equal(t, []string{"🔥", "5368324170671202286", "paid"}, reactionsAdded(update))
+	assert.Empty(t, reactionsRemoved(update))
+}
@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// panicLimit panics within panicWindow make the bridge shut down:
+	// a systematic bug should not spin silently
+	panicLimit  = 5
+	panicWindow = time.Minute
+)
+
+// recoveredPanic holds a panic value with the stack it was raised on
+type recoveredPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// runRecovered calls fn and returns the recovered panic, or nil
+func runRecovered(fn func()) (p *recoveredPanic) {
+	defer func() {
+		if r := recover(); r != nil {
+			p = &recoveredPanic{value: r, stack: debug.Stack()}
+		}
+	}()
+
+	fn()
+	return nil
+}
+
+// panicGuard detects repeated panics within a sliding window
+type panicGuard struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	times  []time.Time
+	now    func() time.Time
+}
+
+func newPanicGuard(limit int, window time.Duration) *panicGuard {
+	return &panicGuard{
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// record registers a panic and reports whether the limit is reached
+func (g *panicGuard) record() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	cutoff := now.Add(-g.window)
+
+	recent := g.times[:0]
+	for _, t := range g.times {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	g.times = append(recent, now)
+
+	return len(g.times) >= g.limit
+}
+
+// panicRecovery handles updates whose processing panicked
+type panicRecovery struct {
+	guard *panicGuard
+	// deadLetter publishes the update to dead_letter_subject, nil without it
+	deadLetter func(update Update, headers map[string]string)
+	// shutdown stops the bridge when panics repeat
+	shutdown func()
+}
+
+// handle dead-letters the update and shuts the bridge down once the guard
+// limit is reached
+func (r *panicRecovery) handle(update Update, headers map[string]string, logger *slog.Logger) {
+	if r.deadLetter != nil {
+		r.deadLetter(update, headers)
+	}
+	if r.guard.record() {
+		logger.Error("too many panics, shutting down", "limit", r.guard.limit, "window", r.guard.window)
+		r.shutdown()
+	}
+}
@@ -0,0 +1,104 @@
+package bridge
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunRecovered(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	router, err := NewRouter([]Route{
+		{
+			Condition: "update.Message != nil",
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.messages",
+			},
+		},
+	}, "first", 5, logger)
+	require.NoError(t, err)
+
+	update := gotgbot.Update{UpdateId: 1, Message: &gotgbot.Message{Text: "hello"}}
+
+	t.Run("no panic", func(t *testing.T) {
+		var dests []Destination
+		p := runRecovered(func() {
+			dests, _ = router.Route(update)
+		})
+		assert.Nil(t, p)
+		assert.Len(t, dests, 1)
+	})
+
+	t.Run("panicking route helper", func(t *testing.T) {
+		// Helper dereferencing a field that is nil for this update
+		p := runRecovered(func() {
+			dests, _ := router.Route(update)
+			for range dests {
+				_ = update.CallbackQuery.Data
+			}
+		})
+		require.NotNil(t, p)
+		assert.Contains(t, p.value.(error).Error(), "nil pointer dereference")
+		assert.Contains(t, string(p.stack), "TestRunRecovered")
+	})
+}
+
+func TestPanicGuard(t *testing.T) {
+	now := time.Unix(0, 0)
+	guard := newPanicGuard(3, time.Minute)
+	guard.now = func() time.Time { return now }
+
+	assert.False(t, guard.record())
+	now = now.Add(30 * time.Second)
+	assert.False(t, guard.record())
+
+	// First panic falls out of the window
+	now = now.Add(45 * time.Second)
+	assert.False(t, guard.record())
+
+	now = now.Add(time.Second)
+	assert.True(t, guard.record())
+}
+
+func TestPanicRecovery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	var deadLettered []int64
+	var shutdowns int
+	recovery := &panicRecovery{
+		guard: newPanicGuard(2, time.Minute),
+		deadLetter: func(update Update, headers map[string]string) {
+			assert.Equal(t, "cid", headers[CorrelationIDHeader])
+			deadLettered = append(deadLettered, update.UpdateId)
+		},
+		shutdown: func() { shutdowns++ },
+	}
+	headers := map[string]string{CorrelationIDHeader: "cid"}
+
+	for id := int64(1); id <= 2; id++ {
+		update := gotgbot.Update{UpdateId: id}
+		p := runRecovered(func() { _ = update.Message.Text })
+		require.NotNil(t, p)
+		recovery.handle(update, headers, logger)
+	}
+
+	assert.Equal(t, []int64{1, 2}, deadLettered, "every panicking update is dead-lettered")
+	assert.Equal(t, 1, shutdowns, "the second panic reaches the limit")
+
+	t.Run("without dead letter subject", func(t *testing.T) {
+		recovery := &panicRecovery{guard: newPanicGuard(1, time.Minute), shutdown: func() { shutdowns++ }}
+		recovery.handle(gotgbot.Update{UpdateId: 3}, headers, logger)
+		assert.Equal(t, 2, shutdowns)
+	})
+}
@@ -0,0 +1,259 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ReplayedFromHeader marks republished messages with their source stream and sequence
+const ReplayedFromHeader = "Replayed-From"
+
+// ReplayOptions holds replay command options
+type ReplayOptions struct {
+	Stream   string
+	StartSeq uint64
+	DryRun   bool
+	Filter   string
+	Rate     int
+}
+
+// ReplayStats holds replay counters
+type ReplayStats struct {
+	Read      int
+	Skipped   int
+	Published int
+	Failed    int
+}
+
+type replayPublishFunc func(ctx context.Context, msg *nats.Msg) error
+
+// Replayer re-routes messages stored in a JetStream stream through the Router
+type Replayer struct {
+	js      jetstream.JetStream
+	router  *Router
+	filter  *vm.Program
+	publish replayPublishFunc
+	opts    ReplayOptions
+	logger  *slog.Logger
+}
+
+// NewReplayer creates a new Replayer
+func NewReplayer(js jetstream.JetStream, router *Router, publish replayPublishFunc, opts ReplayOptions, logger *slog.Logger) (*Replayer, error) {
+	var filter *vm.Program
+	if opts.Filter != "" {
+		var err error
+		filter, err = expr.Compile(opts.Filter, expr.Env(env), expr.AsBool())
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile filter: %w", err)
+		}
+	}
+
+	return &Replayer{
+		js:      js,
+		router:  router,
+		filter:  filter,
+		publish: publish,
+		opts:    opts,
+		logger:  logger,
+	}, nil
+}
+
+// Run consumes the stream from the start sequence up to the last sequence
+// known at start time, so republished messages are not replayed again
+func (r *Replayer) Run(ctx context.Context) (ReplayStats, error) {
+	var stats ReplayStats
+
+	stream, err := r.js.Stream(ctx, r.opts.Stream)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get stream: %w", err)
+	}
+
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get stream info: %w", err)
+	}
+
+	lastSeq := info.State.LastSeq
+	if lastSeq < r.opts.StartSeq {
+		r.logger.Info("nothing to replay", "stream", r.opts.Stream, "last_seq", lastSeq)
+		return stats, nil
+	}
+
+	cons, err := r.js.OrderedConsumer(ctx, r.opts.Stream, jetstream.OrderedConsumerConfig{
+		DeliverPolicy: jetstream.DeliverByStartSequencePolicy,
+		OptStartSeq:   r.opts.StartSeq,
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	r.logger.Info("replay started",
+		"stream", r.opts.Stream,
+		"start_seq", r.opts.StartSeq,
+		"last_seq", lastSeq,
+		"dry_run", r.opts.DryRun)
+
+	var throttle <-chan time.Time
+	if r.opts.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(r.opts.Rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		default:
+		}
+
+		msg, err := cons.Next(jetstream.FetchMaxWait(5 * time.Second))
+		if err != nil {
+			if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+				r.logger.Warn("no more messages before reaching last sequence", "last_seq", lastSeq)
+				return stats, nil
+			}
+			return stats, fmt.Errorf("failed to fetch message: %w", err)
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return stats, fmt.Errorf("failed to get message metadata: %w", err)
+		}
+		seq := meta.Sequence.Stream
+
+		if throttle != nil {
+			select {
+			case <-ctx.Done():
+				return stats, ctx.Err()
+			case <-throttle:
+			}
+		}
+
+		r.handle(ctx, msg.Data(), msg.Headers(), seq, &stats)
+
+		if seq >= lastSeq {
+			return stats, nil
+		}
+	}
+}
+
+// handle routes a single stored message and republishes it to matched subjects
+func (r *Replayer) handle(ctx context.Context, data []byte, header nats.Header, seq uint64, stats *ReplayStats) {
+	stats.Read++
+
+	update, err := decodeStoredUpdate(data)
+	if err != nil {
+		r.logger.Warn("failed to unmarshal update", "seq", seq, "error", err)
+		stats.Skipped++
+		return
+	}
+
+	if r.filter != nil {
+		ok, err := runExpr[bool](r.filter, exprEnv(update, nil, nil))
+		if err != nil {
+			r.logger.Warn("failed to evaluate filter", "seq", seq, "error", err)
+			stats.Skipped++
+			return
+		}
+		if !ok {
+			stats.Skipped++
+			return
+		}
+	}
+
+	destinations, err := r.router.Route(update)
+	if err != nil {
+		r.logger.Warn("failed to route update", "seq", seq, "update_id", update.UpdateId, "error", err)
+		stats.Skipped++
+		return
+	}
+
+	if len(destinations) == 0 {
+		stats.Skipped++
+		return
+	}
+
+	for _, dest := range destinations {
+		if r.opts.DryRun {
+			r.logger.Info("dry run: would publish", "seq", seq, "update_id", update.UpdateId, "subject", dest.Subject)
+			continue
+		}
+
+		msg := nats.NewMsg(dest.Subject)
+		msg.Data = data
+		msg.Header.Set(ReplayedFromHeader, fmt.Sprintf("%s:%d", r.opts.Stream, seq))
+		// The stored payload is republished as is, headers describing it have to be carried over
+		for _, key := range []string{BotIDHeader, BotUsernameHeader, PayloadSchemaHeader} {
+			if value := header.Get(key); value != "" {
+				msg.Header.Set(key, value)
+			}
+		}
+		// The shard follows the current sharding like the subject does
+		if sharder := r.router.sharder; sharder != nil {
+			msg.Header.Set(ShardHeader, strconv.Itoa(sharder.Shard(update)))
+		}
+
+		if err := r.publish(ctx, msg); err != nil {
+			r.logger.Error("failed to republish message", "seq", seq, "subject", dest.Subject, "error", err)
+			stats.Failed++
+			continue
+		}
+		stats.Published++
+	}
+}
+
+// ReplayJetStream re-routes the messages of opts.Stream with the routes of
+// a validated cfg and republishes them with the configured engine. Stats
+// are returned even when replay fails or ctx is canceled.
+func ReplayJetStream(ctx context.Context, cfg *Config, opts ReplayOptions, logger *slog.Logger) (ReplayStats, error) {
+	if cfg.Broker != BrokerNATS {
+		return ReplayStats{}, fmt.Errorf("replay requires broker 'nats'")
+	}
+
+	router, err := NewRouterFromConfig(cfg, logger)
+	if err != nil {
+		return ReplayStats{}, fmt.Errorf("failed to create router: %w", err)
+	}
+
+	client := NewJetStreamClient(cfg.NATS.URL, WithJetStreamLogger(logger), WithJetStreamReconnect(*cfg.NATS.Reconnect))
+
+	connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer connectCancel()
+
+	if err := client.Connect(connectCtx); err != nil {
+		return ReplayStats{}, fmt.Errorf("failed to connect to NATS with JetStream: %w", err)
+	}
+	defer client.Close()
+
+	// Republish using the configured engine
+	publish := func(ctx context.Context, msg *nats.Msg) error {
+		if cfg.NATS.Engine == EngineJetStream {
+			_, err := client.js.PublishMsg(ctx, msg)
+			return err
+		}
+		return client.nc.PublishMsg(msg)
+	}
+
+	replayer, err := NewReplayer(client.js, router, publish, opts, logger)
+	if err != nil {
+		return ReplayStats{}, err
+	}
+
+	stats, err := replayer.Run(ctx)
+	if cfg.NATS.Engine == EngineCore {
+		if flushErr := client.nc.Flush(); flushErr != nil {
+			logger.Error("failed to flush NATS connection", "error", flushErr)
+		}
+	}
+	return stats, err
+}
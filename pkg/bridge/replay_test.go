@@ -0,0 +1,139 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayer_Handle(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: "update.Message != nil",
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.messages",
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(gotgbot.Update{
+		UpdateId: 1,
+		Message: &gotgbot.Message{
+			Text: "hello",
+		},
+	})
+	require.NoError(t, err)
+
+	t.Run("republishes with header", func(t *testing.T) {
+		var published []*nats.Msg
+		publish := func(ctx context.Context, msg *nats.Msg) error {
+			published = append(published, msg)
+			return nil
+		}
+
+		replayer, err := NewReplayer(nil, router, publish, ReplayOptions{Stream: "TG"}, logger)
+		require.NoError(t, err)
+
+		var stats ReplayStats
+		replayer.handle(context.Background(), data, nil, 42, &stats)
+
+		require.Len(t, published, 1)
+		assert.Equal(t, "telegram.messages", published[0].Subject)
+		assert.Equal(t, "TG:42", published[0].Header.Get(ReplayedFromHeader))
+		assert.Equal(t, data, published[0].Data)
+		assert.Equal(t, ReplayStats{Read: 1, Published: 1}, stats)
+	})
+
+	t.Run("dry run does not publish", func(t *testing.T) {
+		publish := func(ctx context.Context, msg *nats.Msg) error {
+			t.Fatal("publish must not be called in dry run")
+			return nil
+		}
+
+		replayer, err := NewReplayer(nil, router, publish, ReplayOptions{Stream: "TG", DryRun: true}, logger)
+		require.NoError(t, err)
+
+		var stats ReplayStats
+		replayer.handle(context.Background(), data, nil, 1, &stats)
+		assert.Equal(t, ReplayStats{Read: 1}, stats)
+	})
+
+	t.Run("filter skips update", func(t *testing.T) {
+		publish := func(ctx context.Context, msg *nats.Msg) error {
+			t.Fatal("publish must not be called for filtered update")
+			return nil
+		}
+
+		replayer, err := NewReplayer(nil, router, publish, ReplayOptions{Stream: "TG", Filter: "update.UpdateId > 1"}, logger)
+		require.NoError(t, err)
+
+		var stats ReplayStats
+		replayer.handle(context.Background(), data, nil, 1, &stats)
+		assert.Equal(t, ReplayStats{Read: 1, Skipped: 1}, stats)
+	})
+
+	t.Run("bot identity is kept", func(t *testing.T) {
+		var published []*nats.Msg
+		publish := func(ctx context.Context, msg *nats.Msg) error {
+			published = append(published, msg)
+			return nil
+		}
+
+		replayer, err := NewReplayer(nil, router, publish, ReplayOptions{Stream: "TG"}, logger)
+		require.NoError(t, err)
+
+		wrapped, err := json.Marshal(BotMeta{ID: 7, Username: "shop_bot"}.wrap(gotgbot.Update{
+			UpdateId: 2,
+			Message:  &gotgbot.Message{Text: "hello"},
+		}))
+		require.NoError(t, err)
+		header := nats.Header{}
+		header.Set(BotIDHeader, "7")
+		header.Set(BotUsernameHeader, "shop_bot")
+
+		var stats ReplayStats
+		replayer.handle(context.Background(), wrapped, header, 3, &stats)
+
+		require.Len(t, published, 1)
+		assert.Equal(t, "telegram.messages", published[0].Subject)
+		assert.Equal(t, wrapped, published[0].Data)
+		assert.Equal(t, "7", published[0].Header.Get(BotIDHeader))
+		assert.Equal(t, "shop_bot", published[0].Header.Get(BotUsernameHeader))
+	})
+
+	t.Run("invalid json is skipped", func(t *testing.T) {
+		replayer, err := NewReplayer(nil, router, nil, ReplayOptions{Stream: "TG"}, logger)
+		require.NoError(t, err)
+
+		var stats ReplayStats
+		replayer.handle(context.Background(), []byte("invalid json"), nil, 1, &stats)
+		assert.Equal(t, ReplayStats{Read: 1, Skipped: 1}, stats)
+	})
+}
+
+func TestNewReplayer_InvalidFilter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	router, err := NewRouter([]Route{}, "first", 5, logger)
+	require.NoError(t, err)
+
+	_, err = NewReplayer(nil, router, nil, ReplayOptions{Filter: "update.!!!"}, logger)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to compile filter")
+}
@@ -0,0 +1,237 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+)
+
+// replyAnswerer delivers request-reply answers via Telegram Bot API
+type replyAnswerer interface {
+	AnswerInlineQuery(ctx context.Context, queryID string, results []json.RawMessage) error
+	AnswerCallbackQuery(ctx context.Context, queryID string, text string, showAlert bool, url string) error
+	SendMessage(ctx context.Context, chatID int64, threadID int64, text string, parseMode string, replyMarkup json.RawMessage) error
+}
+
+// CallbackQueryReply is the expected reply for the answerCallbackQuery action
+type CallbackQueryReply struct {
+	Text      string `json:"text,omitempty"`
+	ShowAlert bool   `json:"show_alert,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// MessageReply is the expected reply for the sendMessage action
+type MessageReply struct {
+	Text        string          `json:"text"`
+	ParseMode   string          `json:"parse_mode,omitempty"`
+	ReplyMarkup json.RawMessage `json:"reply_markup,omitempty"`
+	// IdempotencyKey makes replies with the same key within TTL sent once
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// ReplyHandler sends updates of routes with reply_mode: request as NATS
+// requests and delivers the reply to Telegram
+type ReplyHandler struct {
+	requester    RequesterInterface
+	answerer     replyAnswerer
+	invalidReply func(ctx context.Context, dest Destination, update Update, err *OutboundValidationError)
+	// idempotency suppresses replies with an already sent idempotency_key, nil sends all
+	idempotency *IdempotencyCache
+	logger      *slog.Logger
+}
+
+// OutboundErrorEvent is published when a reply fails outbound message validation
+type OutboundErrorEvent struct {
+	OutboundValidationError
+	// Subject is the request subject that produced the reply
+	Subject  string `json:"subject"`
+	UpdateID int64  `json:"update_id"`
+}
+
+// NewReplyHandler creates a new ReplyHandler
+func NewReplyHandler(requester RequesterInterface, answerer replyAnswerer, logger *slog.Logger) *ReplyHandler {
+	return &ReplyHandler{
+		requester:    requester,
+		answerer:     answerer,
+		invalidReply: func(context.Context, Destination, Update, *OutboundValidationError) {},
+		logger:       logger,
+	}
+}
+
+// SetIdempotencyCache makes replies with an idempotency_key sent once per key
+func (h *ReplyHandler) SetIdempotencyCache(cache *IdempotencyCache) {
+	h.idempotency = cache
+}
+
+// SetInvalidReplyHandler sets the function called for replies rejected by
+// outbound message validation
+func (h *ReplyHandler) SetInvalidReplyHandler(handler func(ctx context.Context, dest Destination, update Update, err *OutboundValidationError)) {
+	h.invalidReply = handler
+}
+
+// replyAction returns the action configured for dest or picks one by update type
+func replyAction(dest Destination, update Update) ReplyAction {
+	switch {
+	case dest.ReplyAction != "":
+		return dest.ReplyAction
+	case update.InlineQuery != nil:
+		return ReplyActionAnswerInlineQuery
+	case update.CallbackQuery != nil:
+		return ReplyActionAnswerCallbackQuery
+	default:
+		return ReplyActionSendMessage
+	}
+}
+
+// Handle sends the update as a request to dest.Subject and delivers the reply.
+// Inline and callback queries are answered with empty results on timeout or
+// invalid reply so the client doesn't wait; messages are not sent.
+func (h *ReplyHandler) Handle(ctx context.Context, dest Destination, update Update) {
+	action := replyAction(dest, update)
+
+	var err error
+	switch action {
+	case ReplyActionAnswerInlineQuery:
+		err = h.answerInlineQuery(ctx, dest, update)
+	case ReplyActionAnswerCallbackQuery:
+		err = h.answerCallbackQuery(ctx, dest, update)
+	case ReplyActionSendMessage:
+		err = h.sendMessage(ctx, dest, update)
+	default:
+		err = fmt.Errorf("unknown reply action '%s'", action)
+	}
+
+	if err != nil {
+		h.logger.Error("failed to deliver reply",
+			"update_id", update.UpdateId,
+			"subject", dest.Subject,
+			"action", action,
+			"error", err)
+		return
+	}
+
+	h.logger.Debug("reply delivered", "update_id", update.UpdateId, "subject", dest.Subject, "action", action)
+}
+
+func (h *ReplyHandler) answerInlineQuery(ctx context.Context, dest Destination, update Update) error {
+	if update.InlineQuery == nil {
+		return fmt.Errorf("update has no inline query")
+	}
+
+	var results []json.RawMessage
+	if err := h.request(ctx, dest, update, &results); err != nil {
+		h.logger.Warn("inline query request failed, answering with empty results",
+			"inline_query_id", update.InlineQuery.Id,
+			"subject", dest.Subject,
+			"error", err)
+		results = nil
+	}
+
+	return h.answerer.AnswerInlineQuery(ctx, update.InlineQuery.Id, results)
+}
+
+func (h *ReplyHandler) answerCallbackQuery(ctx context.Context, dest Destination, update Update) error {
+	if update.CallbackQuery == nil {
+		return fmt.Errorf("update has no callback query")
+	}
+
+	var reply CallbackQueryReply
+	if err := h.request(ctx, dest, update, &reply); err != nil {
+		h.logger.Warn("callback query request failed, answering without text",
+			"callback_query_id", update.CallbackQuery.Id,
+			"subject", dest.Subject,
+			"error", err)
+		reply = CallbackQueryReply{}
+	}
+
+	return h.answerer.AnswerCallbackQuery(ctx, update.CallbackQuery.Id, reply.Text, reply.ShowAlert, reply.URL)
+}
+
+func (h *ReplyHandler) sendMessage(ctx context.Context, dest Destination, update Update) error {
+	chat := updateChat(update)
+	if chat == nil {
+		return fmt.Errorf("update has no chat to reply to")
+	}
+
+	var raw json.RawMessage
+	header, err := h.requestWithHeader(ctx, dest, update, &raw)
+	if err != nil {
+		return err
+	}
+
+	// Garbage replies are rejected here with a reason instead of a Telegram 400
+	if verr := validateOutboundMessage(raw); verr != nil {
+		h.invalidReply(ctx, dest, update, verr)
+		return verr
+	}
+
+	var reply MessageReply
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return fmt.Errorf("invalid reply: %w", err)
+	}
+
+	if reply.Text == "" {
+		return fmt.Errorf("invalid reply: text is required for sendMessage")
+	}
+
+	send := func() error {
+		return h.answerer.SendMessage(ctx, chat.Id, topic(update), reply.Text, reply.ParseMode, reply.ReplyMarkup)
+	}
+	key := reply.IdempotencyKey
+	if key == "" {
+		key = header.Get(nats.MsgIdHdr)
+	}
+	if h.idempotency == nil || key == "" {
+		return send()
+	}
+
+	duplicate, err := h.idempotency.Do(ctx, key, send)
+	if duplicate {
+		h.logger.Info("skipping duplicate reply",
+			"update_id", update.UpdateId,
+			"subject", dest.Subject,
+			"idempotency_key", key)
+	}
+	return err
+}
+
+// request sends the update to dest.Subject and decodes the reply into v
+func (h *ReplyHandler) request(ctx context.Context, dest Destination, update Update, v interface{}) error {
+	_, err := h.requestWithHeader(ctx, dest, update, v)
+	return err
+}
+
+// requestWithHeader is request that also returns the reply headers, nil
+// when the broker doesn't report them
+func (h *ReplyHandler) requestWithHeader(ctx context.Context, dest Destination, update Update, v interface{}) (nats.Header, error) {
+	if h.requester == nil {
+		return nil, fmt.Errorf("broker does not support request-reply")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dest.RequestTimeout)
+	defer cancel()
+
+	var data []byte
+	var header nats.Header
+	if requester, ok := h.requester.(MsgRequesterInterface); ok {
+		msg, err := requester.RequestMsg(ctx, dest.Subject, update)
+		if err != nil {
+			return nil, err
+		}
+		data, header = msg.Data, msg.Header
+	} else {
+		var err error
+		if data, err = h.requester.Request(ctx, dest.Subject, update); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("invalid reply: %w", err)
+	}
+
+	return header, nil
+}
@@ -0,0 +1,365 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentMessage struct {
+	chatID    int64
+	threadID  int64
+	text      string
+	parseMode string
+}
+
+type callbackAnswer struct {
+	queryID   string
+	text      string
+	showAlert bool
+	url       string
+}
+
+type mockReplyAnswerer struct {
+	inlineQueryID string
+	inlineResults []json.RawMessage
+	inlineCalls   int
+	callbacks     []callbackAnswer
+	messages      []sentMessage
+}
+
+func (m *mockReplyAnswerer) AnswerInlineQuery(ctx context.Context, queryID string, results []json.RawMessage) error {
+	m.inlineQueryID = queryID
+	m.inlineResults = results
+	m.inlineCalls++
+	return nil
+}
+
+func (m *mockReplyAnswerer) AnswerCallbackQuery(ctx context.Context, queryID string, text string, showAlert bool, url string) error {
+	m.callbacks = append(m.callbacks, callbackAnswer{queryID: queryID, text: text, showAlert: showAlert, url: url})
+	return nil
+}
+
+func (m *mockReplyAnswerer) SendMessage(ctx context.Context, chatID int64, threadID int64, text string, parseMode string, replyMarkup json.RawMessage) error {
+	m.messages = append(m.messages, sentMessage{chatID: chatID, threadID: threadID, text: text, parseMode: parseMode})
+	return nil
+}
+
+func TestReplyHandler_InlineQuery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		InlineQuery: &gotgbot.InlineQuery{
+			Id:    "inline-1",
+			Query: "cats",
+		},
+	}
+	dest := Destination{Subject: "telegram.inline", Request: true, RequestTimeout: 50 * time.Millisecond}
+
+	t.Run("reply results are passed through", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		requester := &mockRequester{reply: []byte(`[{"type":"article","id":"1","title":"Cats","input_message_content":{"message_text":"meow"}}]`)}
+		handler := NewReplyHandler(requester, answerer, logger)
+
+		handler.Handle(context.Background(), dest, update)
+
+		assert.Equal(t, 1, answerer.inlineCalls)
+		assert.Equal(t, "inline-1", answerer.inlineQueryID)
+		require.Len(t, answerer.inlineResults, 1)
+		assert.JSONEq(t, `{"type":"article","id":"1","title":"Cats","input_message_content":{"message_text":"meow"}}`, string(answerer.inlineResults[0]))
+	})
+
+	t.Run("timeout answers with empty results", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{block: true}, answerer, logger)
+
+		start := time.Now()
+		handler.Handle(context.Background(), dest, update)
+
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, 1, answerer.inlineCalls)
+		assert.Empty(t, answerer.inlineResults)
+	})
+
+	t.Run("invalid reply answers with empty results", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{reply: []byte(`{"not":"array"}`)}, answerer, logger)
+
+		handler.Handle(context.Background(), dest, update)
+
+		assert.Equal(t, 1, answerer.inlineCalls)
+		assert.Empty(t, answerer.inlineResults)
+	})
+}
+
+func TestReplyHandler_CallbackQuery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		CallbackQuery: &gotgbot.CallbackQuery{
+			Id:   "callback-1",
+			Data: "like",
+		},
+	}
+	dest := Destination{Subject: "telegram.callbacks", Request: true, RequestTimeout: 50 * time.Millisecond}
+
+	t.Run("reply is delivered", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{reply: []byte(`{"text":"Liked","show_alert":true}`)}, answerer, logger)
+
+		handler.Handle(context.Background(), dest, update)
+
+		require.Len(t, answerer.callbacks, 1)
+		assert.Equal(t, callbackAnswer{queryID: "callback-1", text: "Liked", showAlert: true}, answerer.callbacks[0])
+	})
+
+	t.Run("timeout answers without text", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{block: true}, answerer, logger)
+
+		handler.Handle(context.Background(), dest, update)
+
+		require.Len(t, answerer.callbacks, 1)
+		assert.Equal(t, callbackAnswer{queryID: "callback-1"}, answerer.callbacks[0])
+	})
+}
+
+func TestReplyHandler_SendMessage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		Message: &gotgbot.Message{
+			Text: "/start",
+			Chat: gotgbot.Chat{Id: 12345, Type: "private"},
+		},
+	}
+	dest := Destination{Subject: "telegram.commands", Request: true, RequestTimeout: 50 * time.Millisecond}
+
+	t.Run("reply is sent to originating chat", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{reply: []byte(`{"text":"*Hello*","parse_mode":"MarkdownV2"}`)}, answerer, logger)
+
+		handler.Handle(context.Background(), dest, update)
+
+		require.Len(t, answerer.messages, 1)
+		assert.Equal(t, sentMessage{chatID: 12345, text: "*Hello*", parseMode: "MarkdownV2"}, answerer.messages[0])
+	})
+
+	t.Run("reply is sent to forum topic", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{reply: []byte(`{"text":"hi"}`)}, answerer, logger)
+
+		handler.Handle(context.Background(), dest, gotgbot.Update{
+			UpdateId: 3,
+			Message: &gotgbot.Message{
+				Chat:            gotgbot.Chat{Id: -100, Type: "supergroup", IsForum: true},
+				IsTopicMessage:  true,
+				MessageThreadId: 7,
+			},
+		})
+
+		require.Len(t, answerer.messages, 1)
+		assert.Equal(t, sentMessage{chatID: -100, threadID: 7, text: "hi"}, answerer.messages[0])
+	})
+
+	t.Run("reply without text is not sent", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{reply: []byte(`{"parse_mode":"HTML"}`)}, answerer, logger)
+
+		handler.Handle(context.Background(), dest, update)
+
+		assert.Empty(t, answerer.messages)
+	})
+
+	t.Run("reply failing validation is reported and not sent", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{reply: []byte(`{"text":"hi","parse_mode":"markdown"}`)}, answerer, logger)
+
+		var rejected []*OutboundValidationError
+		handler.SetInvalidReplyHandler(func(ctx context.Context, d Destination, u Update, err *OutboundValidationError) {
+			assert.Equal(t, dest.Subject, d.Subject)
+			assert.Equal(t, update.UpdateId, u.UpdateId)
+			rejected = append(rejected, err)
+		})
+
+		handler.Handle(context.Background(), dest, update)
+
+		assert.Empty(t, answerer.messages)
+		require.Len(t, rejected, 1)
+		assert.Equal(t, OutboundReasonInvalidParseMode, rejected[0].Reason)
+		assert.Equal(t, payloadHash([]byte(`{"text":"hi","parse_mode":"markdown"}`)), rejected[0].PayloadHash)
+	})
+
+	t.Run("reply with seen idempotency key is sent once", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{reply: []byte(`{"text":"Order accepted","idempotency_key":"order-42"}`)}, answerer, logger)
+		handler.SetIdempotencyCache(NewIdempotencyCache(10, time.Minute))
+
+		handler.Handle(context.Background(), dest, update)
+		handler.Handle(context.Background(), dest, update)
+
+		require.Len(t, answerer.messages, 1)
+		assert.Equal(t, "Order accepted", answerer.messages[0].text)
+	})
+
+	t.Run("Nats-Msg-Id of the reply is the default idempotency key", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		requester := &mockMsgRequester{reply: nats.Msg{
+			Data:   []byte(`{"text":"Order accepted"}`),
+			Header: nats.Header{nats.MsgIdHdr: []string{"order-43"}},
+		}}
+		handler := NewReplyHandler(requester, answerer, logger)
+		handler.SetIdempotencyCache(NewIdempotencyCache(10, time.Minute))
+
+		handler.Handle(context.Background(), dest, update)
+		handler.Handle(context.Background(), dest, update)
+
+		require.Len(t, answerer.messages, 1)
+		assert.Equal(t, "Order accepted", answerer.messages[0].text)
+	})
+
+	t.Run("timeout sends nothing", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{block: true}, answerer, logger)
+
+		handler.Handle(context.Background(), dest, update)
+
+		assert.Empty(t, answerer.messages)
+	})
+
+	t.Run("update without chat is not answered", func(t *testing.T) {
+		answerer := &mockReplyAnswerer{}
+		handler := NewReplyHandler(&mockRequester{reply: []byte(`{"text":"hi"}`)}, answerer, logger)
+
+		handler.Handle(context.Background(), dest, gotgbot.Update{UpdateId: 2})
+
+		assert.Empty(t, answerer.messages)
+	})
+}
+
+// mockMsgRequester replies with headers
+type mockMsgRequester struct {
+	reply nats.Msg
+}
+
+func (m *mockMsgRequester) Request(ctx context.Context, subject string, data interface{}) ([]byte, error) {
+	return m.reply.Data, nil
+}
+
+func (m *mockMsgRequester) RequestMsg(ctx context.Context, subject string, data interface{}) (*nats.Msg, error) {
+	reply := m.reply
+	return &reply, nil
+}
+
+// failFirstAnswerer fails the first sendMessage once release is closed
+type failFirstAnswerer struct {
+	mockReplyAnswerer
+	mu      sync.Mutex
+	calls   int
+	release chan struct{}
+}
+
+func (m *failFirstAnswerer) SendMessage(ctx context.Context, chatID int64, threadID int64, text string, parseMode string, replyMarkup json.RawMessage) error {
+	m.mu.Lock()
+	m.calls++
+	first := m.calls == 1
+	m.mu.Unlock()
+	if first {
+		<-m.release
+		return errors.New("telegram API error 502")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mockReplyAnswerer.SendMessage(ctx, chatID, threadID, text, parseMode, replyMarkup)
+}
+
+func TestReplyHandler_DuplicateOfFailedSend(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		Message:  &gotgbot.Message{Chat: gotgbot.Chat{Id: 12345, Type: "private"}},
+	}
+	dest := Destination{Subject: "telegram.commands", Request: true, RequestTimeout: time.Second}
+
+	answerer := &failFirstAnswerer{release: make(chan struct{})}
+	handler := NewReplyHandler(&mockRequester{reply: []byte(`{"text":"Order accepted","idempotency_key":"order-42"}`)}, answerer, logger)
+	handler.SetIdempotencyCache(NewIdempotencyCache(10, time.Minute))
+
+	// The duplicate arrives on another worker while the first send is in flight
+	var wg sync.WaitGroup
+	wg.Go(func() { handler.Handle(context.Background(), dest, update) })
+	require.Eventually(t, func() bool {
+		answerer.mu.Lock()
+		defer answerer.mu.Unlock()
+		return answerer.calls == 1
+	}, time.Second, time.Millisecond)
+	wg.Go(func() { handler.Handle(context.Background(), dest, update) })
+	time.Sleep(20 * time.Millisecond)
+
+	close(answerer.release)
+	wg.Wait()
+
+	// The first send failed, so the duplicate delivers the reply
+	require.Len(t, answerer.messages, 1)
+	assert.Equal(t, "Order accepted", answerer.messages[0].text)
+}
+
+func TestReplyAction(t *testing.T) {
+	tests := []struct {
+		name   string
+		dest   Destination
+		update Update
+		want   ReplyAction
+	}{
+		{
+			name:   "inline query",
+			update: gotgbot.Update{InlineQuery: &gotgbot.InlineQuery{Id: "1"}},
+			want:   ReplyActionAnswerInlineQuery,
+		},
+		{
+			name:   "callback query",
+			update: gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{Id: "1"}},
+			want:   ReplyActionAnswerCallbackQuery,
+		},
+		{
+			name:   "message",
+			update: gotgbot.Update{Message: &gotgbot.Message{}},
+			want:   ReplyActionSendMessage,
+		},
+		{
+			name:   "configured action wins",
+			dest:   Destination{ReplyAction: ReplyActionSendMessage},
+			update: gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{Id: "1"}},
+			want:   ReplyActionSendMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, replyAction(tt.dest, tt.update))
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+)
+
+// responseSender sends route responses via Telegram Bot API
+type responseSender interface {
+	SendMessage(ctx context.Context, chatID int64, threadID int64, text string, parseMode string, replyMarkup json.RawMessage) error
+}
+
+// Responder sends the text of routes with respond back to the originating chat
+type Responder struct {
+	sender responseSender
+	logger *slog.Logger
+}
+
+// NewResponder creates a new Responder
+func NewResponder(sender responseSender, logger *slog.Logger) *Responder {
+	return &Responder{
+		sender: sender,
+		logger: logger,
+	}
+}
+
+// Respond sends response to the chat of update. Only messages from users are
+// answered: channel posts, messages sent on behalf of a chat and messages
+// from bots are skipped so bots don't answer each other in a loop.
+func (r *Responder) Respond(ctx context.Context, update Update, response *Response) {
+	msg := update.Message
+	if msg == nil || msg.From == nil || msg.From.IsBot || msg.SenderChat != nil {
+		return
+	}
+	if response.Text == "" {
+		r.logger.Debug("skipping empty route response", "update_id", update.UpdateId)
+		return
+	}
+
+	if err := r.sender.SendMessage(ctx, msg.Chat.Id, topic(update), response.Text, response.ParseMode, nil); err != nil {
+		r.logger.Error("failed to send route response", "update_id", update.UpdateId, "chat_id", msg.Chat.Id, "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponder_Respond(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottest-token/sendMessage", r.URL.Path)
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":100,"type":"private"}}}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+	responder := NewResponder(client, logger)
+
+	user := &gotgbot.User{Id: 1, FirstName: "Ann"}
+
+	t.Run("private message", func(t *testing.T) {
+		bodies = nil
+		responder.Respond(context.Background(), Update{
+			UpdateId: 1,
+			Message:  &gotgbot.Message{Chat: gotgbot.Chat{Id: 100, Type: "private"}, From: user},
+		}, &Response{Text: "Got it!", ParseMode: "HTML"})
+
+		assert.Equal(t, []map[string]interface{}{{
+			"chat_id":    float64(100),
+			"text":       "Got it!",
+			"parse_mode": "HTML",
+		}}, bodies)
+	})
+
+	t.Run("forum topic message", func(t *testing.T) {
+		bodies = nil
+		responder.Respond(context.Background(), Update{
+			UpdateId: 2,
+			Message: &gotgbot.Message{
+				Chat:            gotgbot.Chat{Id: -100, Type: "supergroup", IsForum: true},
+				From:            user,
+				IsTopicMessage:  true,
+				MessageThreadId: 7,
+			},
+		}, &Response{Text: "Got it!"})
+
+		assert.Equal(t, []map[string]interface{}{{
+			"chat_id":           float64(-100),
+			"message_thread_id": float64(7),
+			"text":              "Got it!",
+		}}, bodies)
+	})
+
+	skipped := map[string]Update{
+		"bot sender": {
+			Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100}, From: &gotgbot.User{Id: 2, IsBot: true}},
+		},
+		"sent on behalf of a chat": {
+			Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100}, From: user, SenderChat: &gotgbot.Chat{Id: -100}},
+		},
+		"channel post": {
+			ChannelPost: &gotgbot.Message{Chat: gotgbot.Chat{Id: -200, Type: "channel"}, SenderChat: &gotgbot.Chat{Id: -200}},
+		},
+		"callback query": {
+			CallbackQuery: &gotgbot.CallbackQuery{Id: "cb-1", From: *user},
+		},
+	}
+	for name, update := range skipped {
+		t.Run(name, func(t *testing.T) {
+			bodies = nil
+			responder.Respond(context.Background(), update, &Response{Text: "Got it!"})
+			assert.Empty(t, bodies)
+		})
+	}
+
+	t.Run("empty text", func(t *testing.T) {
+		bodies = nil
+		responder.Respond(context.Background(), Update{
+			Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: 100}, From: user},
+		}, &Response{})
+		assert.Empty(t, bodies)
+	})
+}
@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// permanentError stops retryConnect without further attempts
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent marks err as not worth retrying, e.g. an invalid token
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// retryPolicy is ConnectRetryConfig converted to durations
+type retryPolicy struct {
+	attempts    int
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+func newRetryPolicy(cfg ConnectRetryConfig) retryPolicy {
+	return retryPolicy{
+		attempts:    cfg.Attempts,
+		interval:    time.Duration(cfg.IntervalSec) * time.Second,
+		maxInterval: time.Duration(cfg.MaxIntervalSec) * time.Second,
+	}
+}
+
+// retryConnect calls connect until it succeeds, returns a permanent error,
+// the attempt limit is reached or ctx is done. The delay between attempts
+// starts at the policy interval and doubles up to maxInterval.
+func retryConnect(ctx context.Context, policy retryPolicy, what string, logger *slog.Logger, connect func(ctx context.Context) error) error {
+	interval := policy.interval
+
+	for attempt := 1; ; attempt++ {
+		err := connect(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if policy.attempts > 0 && attempt >= policy.attempts {
+			return fmt.Errorf("%s: giving up after %d attempts: %w", what, attempt, err)
+		}
+
+		logger.Warn("connection attempt failed, retrying",
+			"target", what,
+			"attempt", attempt,
+			"retry_in", interval,
+			"error", err)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		interval = min(interval*2, policy.maxInterval)
+	}
+}
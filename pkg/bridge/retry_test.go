@@ -0,0 +1,92 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryConnect(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	policy := retryPolicy{interval: time.Millisecond, maxInterval: 4 * time.Millisecond}
+	errRefused := errors.New("connection refused")
+
+	t.Run("succeeds after failures", func(t *testing.T) {
+		calls := 0
+		err := retryConnect(context.Background(), policy, "nats", logger, func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return errRefused
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("gives up after attempts", func(t *testing.T) {
+		limited := policy
+		limited.attempts = 2
+
+		calls := 0
+		err := retryConnect(context.Background(), limited, "nats", logger, func(ctx context.Context) error {
+			calls++
+			return errRefused
+		})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, errRefused)
+		assert.Contains(t, err.Error(), "giving up after 2 attempts")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("permanent error stops retries", func(t *testing.T) {
+		calls := 0
+		err := retryConnect(context.Background(), policy, "telegram", logger, func(ctx context.Context) error {
+			calls++
+			return permanent(ErrUnauthorized)
+		})
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("cancellation stops waiting", func(t *testing.T) {
+		slow := retryPolicy{interval: time.Hour, maxInterval: time.Hour}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		start := time.Now()
+		err := retryConnect(ctx, slow, "nats", logger, func(ctx context.Context) error {
+			time.AfterFunc(10*time.Millisecond, cancel)
+			return errRefused
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestRetryConnect_Backoff(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	policy := retryPolicy{attempts: 5, interval: 10 * time.Millisecond, maxInterval: 20 * time.Millisecond}
+
+	var times []time.Time
+	err := retryConnect(context.Background(), policy, "nats", logger, func(ctx context.Context) error {
+		times = append(times, time.Now())
+		return errors.New("connection refused")
+	})
+	require.Error(t, err)
+	require.Len(t, times, 5)
+
+	// 10ms, then doubled to the 20ms cap
+	assert.GreaterOrEqual(t, times[1].Sub(times[0]), 10*time.Millisecond)
+	assert.GreaterOrEqual(t, times[2].Sub(times[1]), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, times[4].Sub(times[3]), 20*time.Millisecond)
+}
@@ -0,0 +1,128 @@
+package bridge
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// updateTypeFields are Update fields whose presence alone decides
+// update_type(update), keyed by their expr (Go) name
+var updateTypeFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeFor[Update]()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Type.Kind() != reflect.Pointer {
+			continue
+		}
+		var update Update
+		reflect.ValueOf(&update).Elem().Field(i).Set(reflect.New(field.Type.Elem()))
+		if updateType(update) != "" {
+			fields[field.Name] = true
+		}
+	}
+	return fields
+}()
+
+// typeOnlyCondition reports whether the condition depends only on which
+// top-level field of the update is present, e.g.
+// `update.Message != nil || update_type(update) == "channel_post"`.
+// The result of such a condition is the same for all updates of a type.
+func typeOnlyCondition(condition string) bool {
+	tree, err := parser.Parse(condition)
+	if err != nil {
+		return false
+	}
+	return isTypeOnly(tree.Node)
+}
+
+func isTypeOnly(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.BoolNode:
+		return true
+	case *ast.UnaryNode:
+		return (n.Operator == "!" || n.Operator == "not") && isTypeOnly(n.Node)
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "&&", "||", "and", "or":
+			return isTypeOnly(n.Left) && isTypeOnly(n.Right)
+		case "==", "!=":
+			return isPresenceCheck(n.Left, n.Right) || isPresenceCheck(n.Right, n.Left) ||
+				isUpdateTypeCall(n.Left) && isStringNode(n.Right) ||
+				isUpdateTypeCall(n.Right) && isStringNode(n.Left)
+		case "in", "not in":
+			array, ok := n.Right.(*ast.ArrayNode)
+			if !ok || !isUpdateTypeCall(n.Left) {
+				return false
+			}
+			for _, item := range array.Nodes {
+				if !isStringNode(item) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// isPresenceCheck reports whether field is update.<type field> compared with nil
+func isPresenceCheck(field, other ast.Node) bool {
+	if _, ok := other.(*ast.NilNode); !ok {
+		return false
+	}
+	if chain, ok := field.(*ast.ChainNode); ok {
+		field = chain.Node
+	}
+	member, ok := field.(*ast.MemberNode)
+	if !ok || !isUpdateIdent(member.Node) {
+		return false
+	}
+	name, ok := member.Property.(*ast.StringNode)
+	return ok && updateTypeFields[name.Value]
+}
+
+func isUpdateTypeCall(node ast.Node) bool {
+	call, ok := node.(*ast.CallNode)
+	if !ok || len(call.Arguments) != 1 || !isUpdateIdent(call.Arguments[0]) {
+		return false
+	}
+	callee, ok := call.Callee.(*ast.IdentifierNode)
+	return ok && callee.Value == "update_type"
+}
+
+func isUpdateIdent(node ast.Node) bool {
+	ident, ok := node.(*ast.IdentifierNode)
+	return ok && ident.Value == "update"
+}
+
+func isStringNode(node ast.Node) bool {
+	_, ok := node.(*ast.StringNode)
+	return ok
+}
+
+// typeCache holds results of a type-only condition per update_type
+type typeCache struct {
+	mu      sync.RWMutex
+	results map[string]bool
+}
+
+func newTypeCache() *typeCache {
+	return &typeCache{results: make(map[string]bool)}
+}
+
+func (c *typeCache) get(updateType string) (result, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result, ok = c.results[updateType]
+	return result, ok
+}
+
+func (c *typeCache) set(updateType string, result bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[updateType] = result
+}
@@ -0,0 +1,152 @@
+package bridge
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeOnlyCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{"update.Message != nil", true},
+		{"nil != update.CallbackQuery", true},
+		{"update.Message == nil && update.EditedMessage == nil", true},
+		{"update.Message != nil or update.ChannelPost != nil", true},
+		{"!(update.Message != nil)", true},
+		{"not (update.InlineQuery != nil)", true},
+		{"update?.Message != nil", true},
+		{"true", true},
+		{`update_type(update) == "channel_post"`, true},
+		{`"poll" != update_type(update)`, true},
+		{`update_type(update) in ["business_message", "edited_business_message"]`, true},
+		{`update_type(update) not in ["poll"]`, true},
+		{"update.Message.Text != nil", false},
+		{"update.Message != nil && update.Message.Chat.Type == 'private'", false},
+		{"update.UpdateId != nil", false},
+		{"update.Message != update.EditedMessage", false},
+		{`hasEntity(update, "bot_command")`, false},
+		{"is_admin(update)", false},
+		{"update.Message != nil && env.ENABLED == 1", false},
+		{`update_type(update) == env.TYPE`, false},
+		{"update.Message !=", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			assert.Equal(t, tt.want, typeOnlyCondition(tt.condition))
+		})
+	}
+}
+
+func TestUpdateTypeFields(t *testing.T) {
+	assert.True(t, updateTypeFields["Message"])
+	assert.True(t, updateTypeFields["RemovedChatBoost"])
+	assert.False(t, updateTypeFields["UpdateId"])
+
+	for field := range updateTypeFields {
+		assert.Contains(t, routeCacheConditions(), fmt.Sprintf("update.%s != nil", field))
+	}
+}
+
+// routeCacheConditions are conditions of the route cache corpus: type-only
+// ones for every update type and ones that need full evaluation
+func routeCacheConditions() []string {
+	var conditions []string
+	for field := range updateTypeFields {
+		conditions = append(conditions, fmt.Sprintf("update.%s != nil", field))
+	}
+	return append(conditions,
+		"update.Message == nil && update.EditedMessage == nil",
+		`update_type(update) in ["business_message", "edited_business_message", "deleted_business_messages"]`,
+		`not (update.PollAnswer != nil)`,
+		"update.Message != nil && update.Message.Chat.Type == 'private'",
+		`hasEntity(update, "bot_command")`,
+		"update.CallbackQuery != nil && update.CallbackQuery.Data startsWith 'size:'",
+		"update.UpdateId % 2 == 0",
+	)
+}
+
+func TestRouter_RouteCache_MatchesUncached(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "updates", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures)
+
+	var updates []Update
+	for _, fixture := range fixtures {
+		updates = append(updates, loadUpdateFixture(t, strings.TrimSuffix(filepath.Base(fixture), ".json")))
+	}
+	updates = append(updates,
+		Update{UpdateId: 301, Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: 1, Type: "private"}, Text: "hi"}},
+		Update{UpdateId: 302, CallbackQuery: &gotgbot.CallbackQuery{Data: "size:l"}},
+		Update{UpdateId: 303, ChatBoost: &gotgbot.ChatBoostUpdated{}},
+		Update{UpdateId: 304},
+	)
+
+	var routes []Route
+	for i, condition := range routeCacheConditions() {
+		routes = append(routes, Route{
+			Condition: condition,
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: fmt.Sprintf("telegram.route%d", i)},
+		})
+	}
+
+	for _, mode := range []string{"first", "all"} {
+		t.Run(mode, func(t *testing.T) {
+			uncached, err := NewRouter(routes, mode, 5, logger)
+			require.NoError(t, err)
+			cached, err := NewRouter(routes, mode, 5, logger)
+			require.NoError(t, err)
+			cached.SetRouteCache(true)
+
+			var typeOnly int
+			for _, route := range cached.routes {
+				if route.typeCache != nil {
+					typeOnly++
+				}
+			}
+			assert.Equal(t, len(updateTypeFields)+3, typeOnly)
+
+			// The second pass is served from the cache
+			for pass := range 2 {
+				for _, update := range updates {
+					want, err := uncached.Route(update)
+					require.NoError(t, err)
+					got, err := cached.Route(update)
+					require.NoError(t, err)
+					assert.Equal(t, want, got, "pass %d, update %d (%s)", pass, update.UpdateId, updateType(update))
+				}
+			}
+		})
+	}
+}
+
+func TestRouter_SetRouteCache_Disable(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	router, err := NewRouter([]Route{{
+		Condition: "update.Message != nil",
+		Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"},
+	}}, "first", 5, logger)
+	require.NoError(t, err)
+
+	router.SetRouteCache(true)
+	assert.NotNil(t, router.routes[0].typeCache)
+	router.SetRouteCache(false)
+	assert.Nil(t, router.routes[0].typeCache)
+}
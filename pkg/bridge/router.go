@@ -0,0 +1,825 @@
+package bridge
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+	"golang.org/x/sync/errgroup"
+)
+
+type compiledRoute struct {
+	name          string
+	condition     *vm.Program
+	subjectType   RouteSubjectType
+	subjectStatic string
+	subjectExpr   *vm.Program
+	topicType     RouteSubjectType
+	topicStatic   string
+	topicExpr     *vm.Program
+	keyType       RouteSubjectType
+	keyStatic     string
+	keyExpr       *vm.Program
+	sample        float64
+	stream        string
+	request       bool
+	timeout       time.Duration
+	replyAction   ReplyAction
+	respond       *RouteRespond
+	respondExpr   *vm.Program
+	// typeOnly conditions depend only on the update type, with route_cache
+	// their results are kept in typeCache
+	typeOnly  bool
+	typeCache *typeCache
+	// shadowStatic or shadowExpr is set for routes with shadow_subject
+	shadowStatic string
+	shadowExpr   *vm.Program
+	// transcribe attaches a transcript of voice notes before publishing
+	transcribe bool
+	// scrub is set from the route or, if scrubSet is false, by SetScrub
+	scrub    bool
+	scrubSet bool
+	payload  PayloadMode
+	// enrich is attached to the published update
+	enrich []EnrichKind
+}
+
+// sequentialRoutes is the number of enabled routes up to which Route
+// evaluates them on the calling goroutine: for typical expressions a
+// goroutine per route costs more than the evaluation itself
+const sequentialRoutes = 64
+
+type Router struct {
+	routes           []compiledRoute
+	mode             string
+	routeWorkers     int
+	sequential       bool
+	ordered          bool
+	unmatchedSubject string
+	defaultSubject   string
+	scrubUnmatched   bool
+	editMode         EditSubjectsMode
+	sharder          *Sharder
+	enrich           []EnrichKind
+	isAdmin          func(Update) bool
+	envVars          map[string]interface{}
+	command          func(Update) string
+	commandArgs      func(Update) string
+	logger           *slog.Logger
+	// results pools per-route results of Route calls
+	results sync.Pool
+}
+
+func NewRouter(routes []Route, mode string, routeWorkers int, logger *slog.Logger) (*Router, error) {
+	compiledRoutes := make([]compiledRoute, len(routes))
+	enabled := make([]bool, len(routes))
+
+	numWorkers := min(runtime.GOMAXPROCS(0), len(routes))
+
+	eg := errgroup.Group{}
+	eg.SetLimit(numWorkers)
+
+	for i := range routes {
+		eg.Go(func() error {
+			route := routes[i]
+
+			// Disabled routes are only checked for syntax so they don't rot
+			if !route.IsEnabled() {
+				return checkRouteSyntax(i, route)
+			}
+			enabled[i] = true
+
+			condition, err := expr.Compile(route.Condition, expr.Env(env), expr.AsBool())
+			if err != nil {
+				return fmt.Errorf("failed to compile condition for route[%d]: %w", i, err)
+			}
+
+			var subjectStatic string
+			var subjectExpr *vm.Program
+
+			if route.Subject != nil {
+				switch route.Subject.Type {
+				case SubjectTypeString:
+					subjectStatic = route.Subject.Value
+				case SubjectTypeExpr:
+					subjectExpr, err = expr.Compile(route.Subject.Value, expr.Env(env))
+					if err != nil {
+						return fmt.Errorf("failed to compile subject expression for route[%d]: %w", i, err)
+					}
+				}
+			}
+
+			var topicStatic string
+			var topicExpr *vm.Program
+
+			if route.Topic != nil {
+				switch route.Topic.Type {
+				case SubjectTypeString:
+					topicStatic = route.Topic.Value
+				case SubjectTypeExpr:
+					topicExpr, err = expr.Compile(route.Topic.Value, expr.Env(env))
+					if err != nil {
+						return fmt.Errorf("failed to compile topic expression for route[%d]: %w", i, err)
+					}
+				}
+			}
+
+			var keyStatic string
+			var keyExpr *vm.Program
+
+			if route.Key != nil {
+				switch route.Key.Type {
+				case SubjectTypeString:
+					keyStatic = route.Key.Value
+				case SubjectTypeExpr:
+					keyExpr, err = expr.Compile(route.Key.Value, expr.Env(env))
+					if err != nil {
+						return fmt.Errorf("failed to compile key expression for route[%d]: %w", i, err)
+					}
+				}
+			}
+
+			subjectType := RouteSubjectType("")
+			if route.Subject != nil {
+				subjectType = route.Subject.Type
+			}
+			topicType := RouteSubjectType("")
+			if route.Topic != nil {
+				topicType = route.Topic.Type
+			}
+			keyType := RouteSubjectType("")
+			if route.Key != nil {
+				keyType = route.Key.Type
+			}
+
+			var shadowStatic string
+			var shadowExpr *vm.Program
+
+			if route.ShadowSubject != nil {
+				switch route.ShadowSubject.Type {
+				case SubjectTypeString:
+					shadowStatic = route.ShadowSubject.Value
+				case SubjectTypeExpr:
+					shadowExpr, err = expr.Compile(route.ShadowSubject.Value, expr.Env(env))
+					if err != nil {
+						return fmt.Errorf("failed to compile shadow subject expression for route[%d]: %w", i, err)
+					}
+				}
+			}
+
+			var respondExpr *vm.Program
+			if route.Respond != nil && route.Respond.TextExpr != "" {
+				respondExpr, err = expr.Compile(route.Respond.TextExpr, expr.Env(env))
+				if err != nil {
+					return fmt.Errorf("failed to compile respond text expression for route[%d]: %w", i, err)
+				}
+			}
+
+			sample := 1.0
+			if route.Sample != nil {
+				sample = *route.Sample
+			}
+
+			compiledRoutes[i] = compiledRoute{
+				name:          route.Name,
+				condition:     condition,
+				subjectType:   subjectType,
+				subjectStatic: subjectStatic,
+				subjectExpr:   subjectExpr,
+				topicType:     topicType,
+				topicStatic:   topicStatic,
+				topicExpr:     topicExpr,
+				keyType:       keyType,
+				keyStatic:     keyStatic,
+				keyExpr:       keyExpr,
+				sample:        sample,
+				request:       route.ReplyMode == ReplyModeRequest,
+				timeout:       time.Duration(route.ReplyTimeoutMs) * time.Millisecond,
+				replyAction:   route.ReplyAction,
+				stream:        route.Stream,
+				respond:       route.Respond,
+				respondExpr:   respondExpr,
+				typeOnly:      typeOnlyCondition(route.Condition),
+				shadowStatic:  shadowStatic,
+				shadowExpr:    shadowExpr,
+				transcribe:    route.RequestTranscription,
+				scrub:         route.Scrub != nil && *route.Scrub,
+				scrubSet:      route.Scrub != nil,
+				payload:       route.Payload,
+				enrich:        route.Enrich,
+			}
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	if mode == "all" {
+		for _, collision := range subjectCollisions(routes) {
+			logger.Warn("routes may publish an update more than once", "collision", collision)
+		}
+	}
+
+	enabledRoutes := make([]compiledRoute, 0, len(compiledRoutes))
+	var enrich []EnrichKind
+	for i, route := range compiledRoutes {
+		if enabled[i] {
+			enabledRoutes = append(enabledRoutes, route)
+			// Other routes get their data once they matched
+			if !readsEnriched(routes[i]) {
+				continue
+			}
+			for _, kind := range routes[i].Enrich {
+				if !slices.Contains(enrich, kind) {
+					enrich = append(enrich, kind)
+				}
+			}
+		}
+	}
+
+	routeWorkers = clampRouteWorkers(routeWorkers, logger)
+
+	logger.Info("router initialized",
+		"mode", mode,
+		"routes_total", len(routes),
+		"routes_enabled", len(enabledRoutes),
+		"route_workers", routeWorkers)
+
+	return &Router{
+		routes:       enabledRoutes,
+		mode:         mode,
+		routeWorkers: routeWorkers,
+		sequential:   len(enabledRoutes) <= sequentialRoutes,
+		enrich:       enrich,
+		logger:       logger,
+	}, nil
+}
+
+// maxRouteWorkersPerCPU bounds route_workers: more goroutines per update than
+// that only add scheduling overhead
+const maxRouteWorkersPerCPU = 4
+
+// clampRouteWorkers keeps route_workers between 1 and GOMAXPROCS*4, Route
+// batches routes by this number and can't make progress with 0
+func clampRouteWorkers(routeWorkers int, logger *slog.Logger) int {
+	limit := runtime.GOMAXPROCS(0) * maxRouteWorkersPerCPU
+	switch {
+	case routeWorkers < 1:
+		logger.Warn("route_workers must be at least 1, using 1", "route_workers", routeWorkers)
+		return 1
+	case routeWorkers > limit:
+		logger.Warn("route_workers is too high, capping at GOMAXPROCS*4", "route_workers", routeWorkers, "limit", limit)
+		return limit
+	}
+	return routeWorkers
+}
+
+// NewRouterFromConfig creates the router configured by cfg. Settings that
+// depend on the running bot, such as the admin checker, are left to Run.
+func NewRouterFromConfig(cfg *Config, logger *slog.Logger) (*Router, error) {
+	router, err := NewRouter(cfg.Routes, cfg.Mode, cfg.RouteWorkers, logger)
+	if err != nil {
+		return nil, err
+	}
+	router.SetUnmatchedSubject(cfg.UnmatchedSubject)
+	router.SetDefaultSubject(cfg.DefaultSubject)
+	router.SetExprEnv(lookupExprEnv(cfg.ExprEnv))
+	router.SetRouteCache(cfg.RouteCache)
+	router.SetOrdered(cfg.OrderedRoutes)
+	if cfg.EditSubjects.Enabled {
+		router.SetEditSubjects(cfg.EditSubjects.Mode)
+	}
+	router.SetSharder(NewSharder(cfg.Sharding))
+	router.SetScrub(cfg.Scrub != nil && cfg.Scrub.Enabled)
+	return router, nil
+}
+
+// Len returns the number of enabled routes
+func (r *Router) Len() int {
+	return len(r.routes)
+}
+
+// SetUnmatchedSubject sets the subject for updates that match no route.
+// Empty subject disables publishing of unmatched updates.
+func (r *Router) SetUnmatchedSubject(subject string) {
+	r.unmatchedSubject = subject
+}
+
+// SetDefaultSubject sets the subject for updates that match no route when
+// no unmatched subject is set, with no routes every update goes there.
+// Empty subject disables it.
+func (r *Router) SetDefaultSubject(subject string) {
+	r.defaultSubject = subject
+}
+
+// SetScrub sets whether routes without their own scrub setting and
+// unmatched updates are scrubbed
+func (r *Router) SetScrub(byDefault bool) {
+	for i := range r.routes {
+		if !r.routes[i].scrubSet {
+			r.routes[i].scrub = byDefault
+		}
+	}
+	r.scrubUnmatched = byDefault
+}
+
+// SetEditSubjects makes matched edits of messages go to <subject>.edits as
+// selected by mode. Empty mode routes edits like any other update.
+func (r *Router) SetEditSubjects(mode EditSubjectsMode) {
+	r.editMode = mode
+}
+
+// SetSharder makes destination subjects end with the shard of the update
+// when sharding.suffix is set
+func (r *Router) SetSharder(sharder *Sharder) {
+	r.sharder = sharder
+}
+
+// SetAdminChecker sets the function behind the is_admin expr helper.
+// Without it is_admin always returns false.
+func (r *Router) SetAdminChecker(isAdmin func(Update) bool) {
+	r.isAdmin = isAdmin
+}
+
+// SetBotUsername makes the command and commandArgs expr helpers ignore
+// commands addressed to other bots. Without it any @username is accepted.
+func (r *Router) SetBotUsername(username string) {
+	r.command, r.commandArgs = commandHelpers(username)
+}
+
+// SetRouteCache enables caching of type-only condition results per update
+// type. Conditions touching anything but the presence of top-level update
+// fields are always evaluated.
+func (r *Router) SetRouteCache(enabled bool) {
+	for i := range r.routes {
+		r.routes[i].typeCache = nil
+		if enabled && r.routes[i].typeOnly {
+			r.routes[i].typeCache = newTypeCache()
+		}
+	}
+}
+
+// SetOrdered makes Route evaluate routes one at a time in definition order.
+// In "first" mode routes after the first match are not evaluated, so their
+// errors don't fail the update whatever route_workers is.
+func (r *Router) SetOrdered(ordered bool) {
+	r.ordered = ordered
+}
+
+// SetExprEnv sets the environment variables available to expressions as env.NAME
+func (r *Router) SetExprEnv(vars map[string]interface{}) {
+	r.envVars = vars
+}
+
+// EnrichKinds returns enrichment requested by enabled routes whose
+// expressions read enriched. They need the data before a route is chosen, so
+// it is fetched for every update.
+func (r *Router) EnrichKinds() []EnrichKind {
+	return r.enrich
+}
+
+// checkRouteSyntax parses route expressions without compiling them
+func checkRouteSyntax(i int, route Route) error {
+	if _, err := parser.Parse(route.Condition); err != nil {
+		return fmt.Errorf("failed to parse condition for disabled route[%d]: %w", i, err)
+	}
+
+	if route.Subject != nil && route.Subject.Type == SubjectTypeExpr {
+		if _, err := parser.Parse(route.Subject.Value); err != nil {
+			return fmt.Errorf("failed to parse subject expression for disabled route[%d]: %w", i, err)
+		}
+	}
+
+	if route.Topic != nil && route.Topic.Type == SubjectTypeExpr {
+		if _, err := parser.Parse(route.Topic.Value); err != nil {
+			return fmt.Errorf("failed to parse topic expression for disabled route[%d]: %w", i, err)
+		}
+	}
+
+	if route.Key != nil && route.Key.Type == SubjectTypeExpr {
+		if _, err := parser.Parse(route.Key.Value); err != nil {
+			return fmt.Errorf("failed to parse key expression for disabled route[%d]: %w", i, err)
+		}
+	}
+
+	if route.ShadowSubject != nil && route.ShadowSubject.Type == SubjectTypeExpr {
+		if _, err := parser.Parse(route.ShadowSubject.Value); err != nil {
+			return fmt.Errorf("failed to parse shadow subject expression for disabled route[%d]: %w", i, err)
+		}
+	}
+
+	if route.Respond != nil && route.Respond.TextExpr != "" {
+		if _, err := parser.Parse(route.Respond.TextExpr); err != nil {
+			return fmt.Errorf("failed to parse respond text expression for disabled route[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Router) Route(update Update) ([]Destination, error) {
+	return r.RouteEnriched(update, nil)
+}
+
+// routingResult is the outcome of a single route for an update
+type routingResult struct {
+	cond bool
+	dest Destination
+	err  error
+}
+
+// acquireResults returns a zeroed slice with a result per route from the pool
+func (r *Router) acquireResults() []routingResult {
+	if results, ok := r.results.Get().(*[]routingResult); ok {
+		return *results
+	}
+	return make([]routingResult, len(r.routes))
+}
+
+// releaseResults zeroes results and returns them to the pool, destinations
+// built from them are copies and stay valid
+func (r *Router) releaseResults(results []routingResult) {
+	clear(results)
+	r.results.Put(&results)
+}
+
+// RouteEnriched routes the update with enrichment available to expressions as enriched
+func (r *Router) RouteEnriched(update Update, enriched *Enrichment) ([]Destination, error) {
+	runEnv := acquireExprEnv(update, enriched, r.isAdmin)
+	defer releaseExprEnv(runEnv)
+	if r.envVars != nil {
+		runEnv["env"] = r.envVars
+	}
+	if r.command != nil {
+		runEnv["command"] = r.command
+		runEnv["commandArgs"] = r.commandArgs
+	}
+
+	results := r.acquireResults()
+	defer r.releaseResults(results)
+
+	routeWorkers := r.routeWorkers
+	if r.ordered {
+		routeWorkers = 1
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < len(r.routes); i += routeWorkers {
+		batchSize := min(routeWorkers, len(r.routes)-i)
+
+		// Batches are kept on the sequential path too, so "first" mode sees
+		// the same routes and errors either way
+		for j := range batchSize {
+			idx := i + j
+			route := &r.routes[idx]
+
+			if r.sequential || r.ordered {
+				results[idx] = evalRoute(route, update, runEnv, r.logger)
+				continue
+			}
+			wg.Go(func() {
+				results[idx] = evalRoute(route, update, runEnv, r.logger)
+			})
+		}
+
+		wg.Wait()
+
+		var match bool
+		for _, rr := range results[i : i+batchSize] {
+			if rr.err != nil {
+				return nil, rr.err
+			}
+			match = match || rr.cond
+		}
+
+		if r.mode == "first" && match {
+			for _, rr := range results {
+				if rr.cond {
+					return r.withShards(update, r.withEditSubjects(update, []Destination{rr.dest})), nil
+				}
+			}
+		}
+	}
+
+	seen := make(map[destinationKey]bool)
+	var final []Destination
+
+	for _, rr := range results {
+		if rr.cond {
+			key := newDestinationKey(rr.dest)
+			if !seen[key] {
+				seen[key] = true
+				final = append(final, rr.dest)
+			}
+		}
+	}
+
+	if len(final) == 0 {
+		// unmatched_subject takes precedence over default_subject
+		subject := r.unmatchedSubject
+		if subject == "" {
+			subject = r.defaultSubject
+		}
+		if subject != "" {
+			return r.withShards(update, []Destination{{Subject: subject, Scrub: r.scrubUnmatched}}), nil
+		}
+	}
+
+	return r.withShards(update, r.withEditSubjects(update, final)), nil
+}
+
+// evalRoute evaluates a single route for the update
+func evalRoute(route *compiledRoute, update Update, runEnv map[string]interface{}, logger *slog.Logger) routingResult {
+	cond, err := evalCondition(route, update, runEnv)
+	if err != nil {
+		return routingResult{err: err}
+	}
+
+	if !cond || !sampled(update.UpdateId, route.sample) {
+		return routingResult{cond: false}
+	}
+
+	dest := Destination{
+		Route:          route.name,
+		Stream:         route.stream,
+		Request:        route.request,
+		RequestTimeout: route.timeout,
+		ReplyAction:    route.replyAction,
+		Transcribe:     route.transcribe,
+		Scrub:          route.scrub,
+		Payload:        route.payload,
+		Enrich:         route.enrich,
+	}
+
+	if route.subjectExpr != nil || route.subjectStatic != "" {
+		switch route.subjectType {
+		case SubjectTypeString:
+			dest.Subject = route.subjectStatic
+		case SubjectTypeExpr:
+			dest.Subject, err = runExpr[string](route.subjectExpr, runEnv)
+			if err != nil {
+				return routingResult{err: err}
+			}
+		}
+	}
+
+	if route.topicExpr != nil || route.topicStatic != "" {
+		switch route.topicType {
+		case SubjectTypeString:
+			dest.Topic = route.topicStatic
+		case SubjectTypeExpr:
+			dest.Topic, err = runExpr[string](route.topicExpr, runEnv)
+			if err != nil {
+				return routingResult{err: err}
+			}
+		}
+	}
+
+	if route.keyExpr != nil || route.keyStatic != "" {
+		switch route.keyType {
+		case SubjectTypeString:
+			dest.Key = route.keyStatic
+		case SubjectTypeExpr:
+			dest.Key, err = runExpr[string](route.keyExpr, runEnv)
+			if err != nil {
+				return routingResult{err: err}
+			}
+		}
+	}
+
+	dest.ShadowSubject = route.shadowStatic
+	if route.shadowExpr != nil {
+		// A broken shadow subject must not stop the primary publication
+		dest.ShadowSubject, err = runExpr[string](route.shadowExpr, runEnv)
+		if err != nil {
+			logger.Warn("failed to evaluate shadow subject", "subject", dest.Subject, "error", err)
+			dest.ShadowSubject = ""
+		}
+	}
+
+	if route.respond != nil {
+		text := route.respond.Text
+		if route.respondExpr != nil {
+			text, err = runExpr[string](route.respondExpr, runEnv)
+			if err != nil {
+				return routingResult{err: err}
+			}
+		}
+		dest.Response = &Response{Text: text, ParseMode: route.respond.ParseMode}
+		dest.RespondOnly = route.respond.Only
+	}
+
+	return routingResult{cond: true, dest: dest}
+}
+
+// evalCondition evaluates the route condition, type-only conditions are
+// evaluated once per update type when the route cache is enabled
+func evalCondition(route *compiledRoute, update Update, runEnv map[string]interface{}) (bool, error) {
+	if route.typeCache == nil {
+		return runExpr[bool](route.condition, runEnv)
+	}
+
+	key := updateType(update)
+	if cond, ok := route.typeCache.get(key); ok {
+		return cond, nil
+	}
+	cond, err := runExpr[bool](route.condition, runEnv)
+	if err != nil {
+		return false, err
+	}
+	route.typeCache.set(key, cond)
+	return cond, nil
+}
+
+// withEditSubjects applies edit subjects to destinations of an edit update
+func (r *Router) withEditSubjects(update Update, dests []Destination) []Destination {
+	if r.editMode == "" || !isEditUpdate(update) {
+		return dests
+	}
+	return editDestinations(r.editMode, dests)
+}
+
+// withShards appends the shard of the update to destination subjects
+func (r *Router) withShards(update Update, dests []Destination) []Destination {
+	r.sharder.apply(update, dests)
+	return dests
+}
+
+// destinationKey identifies what is delivered and where: in "all" mode
+// destinations are deduplicated by it, so routes that produce the same
+// subject but deliver differently (e.g. publish and request) are all kept
+type destinationKey struct {
+	subject        string
+	topic          string
+	key            string
+	stream         string
+	request        bool
+	requestTimeout time.Duration
+	replyAction    ReplyAction
+	response       Response
+	respondOnly    bool
+	shadowSubject  string
+	enrich         string
+	transcribe     bool
+	scrub          bool
+	payload        PayloadMode
+}
+
+func newDestinationKey(dest Destination) destinationKey {
+	var response Response
+	if dest.Response != nil {
+		response = *dest.Response
+	}
+	return destinationKey{
+		subject:        dest.Subject,
+		topic:          dest.Topic,
+		key:            dest.Key,
+		stream:         dest.Stream,
+		request:        dest.Request,
+		requestTimeout: dest.RequestTimeout,
+		replyAction:    dest.ReplyAction,
+		response:       response,
+		respondOnly:    dest.RespondOnly,
+		shadowSubject:  dest.ShadowSubject,
+		enrich:         fmt.Sprint(dest.Enrich),
+		transcribe:     dest.Transcribe,
+		scrub:          dest.Scrub,
+		payload:        dest.Payload,
+	}
+}
+
+// sampled deterministically decides whether an update falls into the sampled
+// fraction: update_id is hashed with the murmur3 64-bit finalizer, mapped to
+// [0, 1) and compared to rate
+func sampled(updateID int64, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+
+	h := uint64(updateID)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return float64(h)/math.MaxUint64 < rate
+}
+
+// anyBotCommand and anyBotCommandArgs accept commands addressed to any bot
+var anyBotCommand, anyBotCommandArgs = commandHelpers("")
+
+var env = map[string]interface{}{
+	"sprintf":           fmt.Sprintf,
+	"str":               str,
+	"len":               exprLen,
+	"wordCount":         wordCount,
+	"transition":        chatMemberTransition,
+	"hasEntity":         hasEntity,
+	"entityText":        entityText,
+	"forwardOrigin":     forwardOrigin,
+	"topic":             topic,
+	"subtype":           subtype,
+	"update_type":       updateType,
+	"is_reply":          isReply,
+	"reply_to":          replyTo,
+	"reactions_added":   reactionsAdded,
+	"reactions_removed": reactionsRemoved,
+	"shard":             shard,
+	"command":           anyBotCommand,
+	"commandArgs":       anyBotCommandArgs,
+	"is_admin":          notAdmin,
+	"update":            gotgbot.Update{},
+	"enriched":          Enrichment{},
+	"env":               map[string]interface{}{},
+}
+
+// notAdmin is is_admin when no admin checker is set
+func notAdmin(Update) bool {
+	return false
+}
+
+// exprEnv builds the expr environment for a single update.
+// enriched and isAdmin may be nil.
+func exprEnv(update Update, enriched *Enrichment, isAdmin func(Update) bool) map[string]interface{} {
+	runEnv := maps.Clone(env)
+	setExprEnv(runEnv, update, enriched, isAdmin)
+	return runEnv
+}
+
+// exprEnvPool reuses environments between updates: helpers are copied once,
+// only update, enriched and is_admin are set for every update
+var exprEnvPool = sync.Pool{
+	New: func() any { return maps.Clone(env) },
+}
+
+// acquireExprEnv returns a pooled environment for update, release it with
+// releaseExprEnv when no expression runs against it anymore
+func acquireExprEnv(update Update, enriched *Enrichment, isAdmin func(Update) bool) map[string]interface{} {
+	runEnv := exprEnvPool.Get().(map[string]interface{})
+	setExprEnv(runEnv, update, enriched, isAdmin)
+	return runEnv
+}
+
+// releaseExprEnv returns runEnv to the pool without keeping the update alive
+func releaseExprEnv(runEnv map[string]interface{}) {
+	for _, key := range []string{"update", "enriched", "is_admin", "env", "command", "commandArgs"} {
+		runEnv[key] = env[key]
+	}
+	exprEnvPool.Put(runEnv)
+}
+
+// setExprEnv sets the per-update values of runEnv, enriched and isAdmin may be nil
+func setExprEnv(runEnv map[string]interface{}, update Update, enriched *Enrichment, isAdmin func(Update) bool) {
+	if enriched == nil {
+		runEnv["enriched"] = env["enriched"]
+	} else {
+		runEnv["enriched"] = *enriched
+	}
+	if isAdmin == nil {
+		runEnv["is_admin"] = env["is_admin"]
+	} else {
+		runEnv["is_admin"] = isAdmin
+	}
+	runEnv["update"] = update
+}
+
+// vmPool reuses expr virtual machines and their stacks between runs
+var vmPool = sync.Pool{
+	New: func() any { return &vm.VM{} },
+}
+
+// runExpr runs program against an environment built by exprEnv
+func runExpr[T any](program *vm.Program, runEnv map[string]interface{}) (T, error) {
+	var zero T
+
+	machine := vmPool.Get().(*vm.VM)
+	output, err := machine.Run(program, runEnv)
+	vmPool.Put(machine)
+	if err != nil {
+		return zero, err
+	}
+
+	val, ok := output.(T)
+	if !ok {
+		return zero, fmt.Errorf("expected %T, got %T", zero, output)
+	}
+
+	return val, nil
+}
@@ -0,0 +1,1721 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/expr-lang/expr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRouter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Run("valid routes", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+		assert.NotNil(t, router)
+	})
+
+	t.Run("invalid condition expr", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message.!!!",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		_, err := NewRouter(routes, "first", 5, logger)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to compile condition")
+	})
+
+	t.Run("invalid subject expr", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeExpr,
+					Value: "sprintf(!!!)",
+				},
+			},
+		}
+		_, err := NewRouter(routes, "first", 5, logger)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to compile subject expression")
+	})
+
+	t.Run("disabled route is not compiled", func(t *testing.T) {
+		disabled := false
+		routes := []Route{
+			{
+				Name:      "messages",
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+			{
+				Name:      "unknown-field",
+				Enabled:   &disabled,
+				Condition: "update.NoSuchField != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.noisy",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+		assert.Len(t, router.routes, 1)
+	})
+
+	t.Run("disabled route with invalid syntax", func(t *testing.T) {
+		disabled := false
+		routes := []Route{
+			{
+				Enabled:   &disabled,
+				Condition: "update.Message.!!!",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		_, err := NewRouter(routes, "first", 5, logger)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse condition for disabled route")
+	})
+
+	t.Run("empty routes", func(t *testing.T) {
+		router, err := NewRouter([]Route{}, "first", 5, logger)
+		require.NoError(t, err)
+		assert.NotNil(t, router)
+		assert.Empty(t, router.routes)
+	})
+}
+
+func TestRouter_Route(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Run("mode first - first match", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+			{
+				Condition: "update.CallbackQuery != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.callbacks",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			Message: &gotgbot.Message{
+				Text: "hello",
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.messages"}}, dests)
+	})
+
+	t.Run("mode first - second match", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+			{
+				Condition: "update.CallbackQuery != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.callbacks",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			CallbackQuery: &gotgbot.CallbackQuery{
+				Id:   "123",
+				Data: "test",
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.callbacks"}}, dests)
+	})
+
+	t.Run("mode all - multiple matches", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+			{
+				Condition: "update.Message.Text != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.texts",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "all", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			Message: &gotgbot.Message{
+				Text: "hello",
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.messages"}, {Subject: "telegram.texts"}}, dests)
+	})
+
+	t.Run("no match - empty result", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			CallbackQuery: &gotgbot.CallbackQuery{
+				Id:   "123",
+				Data: "test",
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Empty(t, dests)
+	})
+
+	t.Run("dynamic subject with expr", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeExpr,
+					Value: "sprintf(\"telegram.%d.messages\", update.Message.From.Id)",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			Message: &gotgbot.Message{
+				Text: "hello",
+				From: &gotgbot.User{
+					Id: 12345,
+				},
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.12345.messages"}}, dests)
+	})
+
+	t.Run("chat id compared with integer literal", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message?.Chat.Id == -1001234567890",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.group",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		var update gotgbot.Update
+		err = json.Unmarshal([]byte(`{"update_id":1,"message":{"message_id":1,"date":0,"chat":{"id":-1001234567890,"type":"supergroup"}}}`), &update)
+		require.NoError(t, err)
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.group"}}, dests)
+	})
+
+	t.Run("empty update", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Empty(t, dests)
+	})
+
+	t.Run("disabled route is not evaluated", func(t *testing.T) {
+		disabled := false
+		routes := []Route{
+			{
+				Enabled:   &disabled,
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.noisy",
+				},
+			},
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "all", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			Message: &gotgbot.Message{
+				Text: "hello",
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.messages"}}, dests)
+	})
+
+	t.Run("unmatched subject - no match", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "all", 5, logger)
+		require.NoError(t, err)
+		router.SetUnmatchedSubject("telegram.unmatched")
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			CallbackQuery: &gotgbot.CallbackQuery{
+				Id:   "123",
+				Data: "test",
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.unmatched"}}, dests)
+	})
+
+	t.Run("unmatched subject - match", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+		router.SetUnmatchedSubject("telegram.unmatched")
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			Message: &gotgbot.Message{
+				Text: "hello",
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.messages"}}, dests)
+	})
+
+	t.Run("default subject - no routes", func(t *testing.T) {
+		router, err := NewRouter([]Route{}, "first", 5, logger)
+		require.NoError(t, err)
+		router.SetDefaultSubject("telegram.updates")
+
+		for _, update := range []gotgbot.Update{
+			{UpdateId: 1, Message: &gotgbot.Message{Text: "hello"}},
+			{UpdateId: 2, CallbackQuery: &gotgbot.CallbackQuery{Id: "123"}},
+		} {
+			dests, err := router.Route(update)
+			require.NoError(t, err)
+			assert.Equal(t, []Destination{{Subject: "telegram.updates"}}, dests)
+		}
+	})
+
+	t.Run("default subject - unmatched subject takes precedence", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "all", 5, logger)
+		require.NoError(t, err)
+		router.SetDefaultSubject("telegram.updates")
+
+		update := gotgbot.Update{UpdateId: 1, CallbackQuery: &gotgbot.CallbackQuery{Id: "123"}}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.updates"}}, dests)
+
+		router.SetUnmatchedSubject("telegram.unmatched")
+		dests, err = router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.unmatched"}}, dests)
+
+		// Matched updates go to their routes only
+		dests, err = router.Route(gotgbot.Update{UpdateId: 2, Message: &gotgbot.Message{Text: "hello"}})
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.messages"}}, dests)
+	})
+
+	t.Run("chat member transition helper", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "transition(update) endsWith \"→kicked\"",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.bans",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			MyChatMember: &gotgbot.ChatMemberUpdated{
+				OldChatMember: gotgbot.ChatMemberMember{},
+				NewChatMember: gotgbot.ChatMemberBanned{},
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.bans"}}, dests)
+	})
+
+	t.Run("request reply mode", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.InlineQuery != nil",
+				Subject: &RouteSubject{
+					Type:  SubjectTypeString,
+					Value: "telegram.inline",
+				},
+				ReplyMode:      ReplyModeRequest,
+				ReplyTimeoutMs: 3000,
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			InlineQuery: &gotgbot.InlineQuery{
+				Id: "inline-1",
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.inline", Request: true, RequestTimeout: 3 * time.Second}}, dests)
+	})
+
+	t.Run("kafka routes with topic and key", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Topic: &RouteTopic{
+					Type:  SubjectTypeString,
+					Value: "telegram.messages",
+				},
+				Key: &RouteKey{
+					Type:  SubjectTypeExpr,
+					Value: "sprintf(\"%v\", update.Message.From.Id)",
+				},
+			},
+		}
+		router, err := NewRouter(routes, "first", 5, logger)
+		require.NoError(t, err)
+
+		update := gotgbot.Update{
+			UpdateId: 1,
+			Message: &gotgbot.Message{
+				Text: "hello",
+				From: &gotgbot.User{
+					Id: 12345,
+				},
+			},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Topic: "telegram.messages", Key: "12345"}}, dests)
+	})
+}
+
+func TestRouter_Route_Dedup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		Message: &gotgbot.Message{
+			Text: "hello",
+		},
+	}
+
+	subject := &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"}
+
+	t.Run("same subject and delivery", func(t *testing.T) {
+		routes := []Route{
+			{Condition: "update.Message != nil", Subject: subject},
+			{Condition: "update.Message.Text == \"hello\"", Subject: subject},
+		}
+		router, err := NewRouter(routes, "all", 5, logger)
+		require.NoError(t, err)
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{{Subject: "telegram.messages"}}, dests)
+	})
+
+	t.Run("same subject with different delivery", func(t *testing.T) {
+		routes := []Route{
+			{Condition: "update.Message != nil", Subject: subject},
+			{Condition: "update.Message != nil", Subject: subject, ReplyMode: ReplyModeRequest, ReplyTimeoutMs: 3000},
+		}
+		router, err := NewRouter(routes, "all", 5, logger)
+		require.NoError(t, err)
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, []Destination{
+			{Subject: "telegram.messages"},
+			{Subject: "telegram.messages", Request: true, RequestTimeout: 3 * time.Second},
+		}, dests)
+	})
+
+	t.Run("fields are not concatenated", func(t *testing.T) {
+		routes := []Route{
+			{
+				Condition: "update.Message != nil",
+				Topic:     &RouteTopic{Type: SubjectTypeString, Value: "a"},
+				Key:       &RouteKey{Type: SubjectTypeString, Value: "bc"},
+			},
+			{
+				Condition: "update.Message != nil",
+				Topic:     &RouteTopic{Type: SubjectTypeString, Value: "ab"},
+				Key:       &RouteKey{Type: SubjectTypeString, Value: "c"},
+			},
+		}
+		router, err := NewRouter(routes, "all", 5, logger)
+		require.NoError(t, err)
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Len(t, dests, 2)
+	})
+}
+
+func TestRouter_Route_Sample(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	sample := 0.25
+	routes := []Route{
+		{
+			Condition: "update.Message != nil",
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.sampled",
+			},
+			Sample: &sample,
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	const total = 10000
+	matched := 0
+	for i := range total {
+		update := gotgbot.Update{
+			UpdateId: int64(100000 + i),
+			Message:  &gotgbot.Message{Text: "hello"},
+		}
+
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		matched += len(dests)
+
+		// Sampling is deterministic per update_id
+		again, err := router.Route(update)
+		require.NoError(t, err)
+		assert.Equal(t, dests, again)
+	}
+
+	assert.InDelta(t, sample, float64(matched)/total, 0.02)
+}
+
+func TestSampled(t *testing.T) {
+	assert.True(t, sampled(1, 1.0))
+	assert.False(t, sampled(1, 0.0))
+	assert.Equal(t, sampled(42, 0.5), sampled(42, 0.5))
+}
+
+func TestRouter_RouteEnriched(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	disabled := false
+	routes := []Route{
+		{
+			Condition: `enriched.ChatMember != nil && enriched.ChatMember.Status == "administrator"`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `"telegram.admins." + enriched.Chat.Username`,
+			},
+			Enrich: []EnrichKind{EnrichChat, EnrichChatMember},
+		},
+		{
+			Condition: "update.Message != nil",
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.messages",
+			},
+			Enrich: []EnrichKind{EnrichChat},
+		},
+		{
+			Enabled:   &disabled,
+			Condition: "true",
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.disabled",
+			},
+			Enrich: []EnrichKind{EnrichChatMember},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []EnrichKind{EnrichChat, EnrichChatMember}, router.EnrichKinds())
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		Message:  &gotgbot.Message{Text: "hello"},
+	}
+
+	t.Run("enriched", func(t *testing.T) {
+		enriched := &Enrichment{
+			Chat:       &gotgbot.ChatFullInfo{Id: -100, Username: "team"},
+			ChatMember: &gotgbot.MergedChatMember{Status: "administrator"},
+		}
+		dests, err := router.RouteEnriched(update, enriched)
+		require.NoError(t, err)
+		require.Len(t, dests, 1)
+		assert.Equal(t, "telegram.admins.team", dests[0].Subject)
+		assert.Equal(t, []EnrichKind{EnrichChat, EnrichChatMember}, dests[0].Enrich)
+	})
+
+	t.Run("without enrichment", func(t *testing.T) {
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		require.Len(t, dests, 1)
+		assert.Equal(t, "telegram.messages", dests[0].Subject)
+		// Fetched after routing, the condition doesn't read it
+		assert.Equal(t, []EnrichKind{EnrichChat}, dests[0].Enrich)
+	})
+}
+
+func TestRouter_Route_Entities(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: `hasEntity(update, "bot_command")`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `"telegram.commands." + entityText(update, "bot_command", 0)[1:]`,
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	var update Update
+	require.NoError(t, json.Unmarshal([]byte(`{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"👋 /start","entities":[{"type":"bot_command","offset":3,"length":6}]}}`), &update))
+
+	dests, err := router.Route(update)
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.commands.start", dests[0].Subject)
+}
+
+func TestRouter_Route_Command(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: `command(update) == "start"`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `commandArgs(update) == "" ? "telegram.start" : "telegram.start.deeplink"`,
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	command := func(text string, length int64) Update {
+		return Update{UpdateId: 1, Message: &gotgbot.Message{
+			Text:     text,
+			Entities: []gotgbot.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}},
+		}}
+	}
+	subjects := func(update Update) []string {
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		var subjects []string
+		for _, dest := range dests {
+			subjects = append(subjects, dest.Subject)
+		}
+		return subjects
+	}
+
+	assert.Equal(t, []string{"telegram.start"}, subjects(command("/start", 6)))
+	assert.Equal(t, []string{"telegram.start.deeplink"}, subjects(command("/start ref_42", 6)))
+	assert.Equal(t, []string{"telegram.start"}, subjects(command("/start@other_bot", 16)), "any bot before the username is known")
+
+	router.SetBotUsername("my_bot")
+	assert.Equal(t, []string{"telegram.start.deeplink"}, subjects(command("/start@my_bot ref_42", 13)))
+	assert.Empty(t, subjects(command("/start@other_bot", 16)))
+	assert.Empty(t, subjects(command("/help", 5)))
+}
+
+func TestRouter_Route_IsAdmin(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: "is_admin(update)",
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.admin",
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		Message:  &gotgbot.Message{From: &gotgbot.User{Id: 42}, Text: "/ban"},
+	}
+
+	// Without a checker is_admin is always false
+	dests, err := router.Route(update)
+	require.NoError(t, err)
+	assert.Empty(t, dests)
+
+	router.SetAdminChecker(func(u Update) bool { return u.Message.From.Id == 42 })
+	dests, err = router.Route(update)
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.admin", dests[0].Subject)
+}
+
+func TestRouter_Route_ExprEnv(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: "update.Message != nil && update.Message.Chat.Id == env.ADMIN_CHAT_ID",
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `env.SUBJECT_PREFIX + ".admin"`,
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	update := gotgbot.Update{
+		UpdateId: 1,
+		Message:  &gotgbot.Message{Chat: gotgbot.Chat{Id: -1001234567890}, Text: "hi"},
+	}
+
+	// Without variables env.ADMIN_CHAT_ID is nil
+	dests, err := router.Route(update)
+	require.NoError(t, err)
+	assert.Empty(t, dests)
+
+	t.Setenv("ADMIN_CHAT_ID", "-1001234567890")
+	t.Setenv("SUBJECT_PREFIX", "telegram.prod")
+	router.SetExprEnv(lookupExprEnv([]string{"ADMIN_CHAT_ID", "SUBJECT_PREFIX"}))
+
+	dests, err = router.Route(update)
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.prod.admin", dests[0].Subject)
+
+	// Released environments don't keep the variables
+	runEnv := acquireExprEnv(update, nil, nil)
+	defer releaseExprEnv(runEnv)
+	assert.Empty(t, runEnv["env"])
+}
+
+func TestRouter_Route_RouteName(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{Name: "messages", Condition: "update.Message != nil", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"}},
+		{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.audit"}},
+	}
+	router, err := NewRouter(routes, "all", 5, logger)
+	require.NoError(t, err)
+
+	dests, err := router.Route(Update{UpdateId: 1, Message: &gotgbot.Message{}})
+	require.NoError(t, err)
+	assert.Equal(t, []Destination{
+		{Route: "messages", Subject: "telegram.messages"},
+		{Subject: "telegram.audit"},
+	}, dests)
+}
+
+func TestRouter_SetScrub(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	on, off := true, false
+	routes := []Route{
+		{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.default"}},
+		{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.in"}, Scrub: &on},
+		{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.out"}, Scrub: &off},
+	}
+	router, err := NewRouter(routes, "all", 5, logger)
+	require.NoError(t, err)
+
+	scrubbed := func() map[string]bool {
+		dests, err := router.Route(Update{UpdateId: 1, Message: &gotgbot.Message{}})
+		require.NoError(t, err)
+		result := make(map[string]bool)
+		for _, dest := range dests {
+			result[dest.Subject] = dest.Scrub
+		}
+		return result
+	}
+
+	assert.Equal(t, map[string]bool{"telegram.default": false, "telegram.in": true, "telegram.out": false}, scrubbed())
+	router.SetScrub(true)
+	assert.Equal(t, map[string]bool{"telegram.default": true, "telegram.in": true, "telegram.out": false}, scrubbed())
+}
+
+func TestRouter_Route_ShadowSubject(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition:     "update.Message != nil",
+			Subject:       &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"},
+			ShadowSubject: &RouteSubject{Type: SubjectTypeExpr, Value: `sprintf("telegram.v2.chats.%d", update.Message.Chat.Id)`},
+		},
+		{
+			Condition:     "update.EditedMessage != nil",
+			Subject:       &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"},
+			ShadowSubject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.v2.messages"},
+		},
+		{
+			Condition:     "update.CallbackQuery != nil",
+			Subject:       &RouteSubject{Type: SubjectTypeString, Value: "telegram.callbacks"},
+			ShadowSubject: &RouteSubject{Type: SubjectTypeExpr, Value: `"telegram.v2." + update.Message.Text`},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	dests, err := router.Route(Update{UpdateId: 1, Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -1001}}})
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.messages", dests[0].Subject)
+	assert.Equal(t, "telegram.v2.chats.-1001", dests[0].ShadowSubject)
+	assert.Equal(t, Destination{Subject: "telegram.v2.chats.-1001"}, dests[0].Shadow())
+
+	// Edits keep the shadow next to the primary subject
+	router.SetEditSubjects(EditSubjectsRedirect)
+	dests, err = router.Route(Update{UpdateId: 2, EditedMessage: &gotgbot.Message{}})
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.messages"+EditSubjectSuffix, dests[0].Subject)
+	assert.Equal(t, "telegram.v2.messages"+EditSubjectSuffix, dests[0].ShadowSubject)
+
+	// A failing shadow expression drops only the shadow publication
+	dests, err = router.Route(Update{UpdateId: 3, CallbackQuery: &gotgbot.CallbackQuery{}})
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.callbacks", dests[0].Subject)
+	assert.Empty(t, dests[0].ShadowSubject)
+}
+
+func TestRouter_Route_AllModeOrder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	subject := func(value string) *RouteSubject {
+		return &RouteSubject{Type: SubjectTypeString, Value: value}
+	}
+	routes := []Route{
+		{Condition: "true", Subject: subject("telegram.firehose")},
+		{Condition: "update.Message == nil", Subject: subject("telegram.other")},
+		{Condition: "update.Message != nil", Subject: &RouteSubject{Type: SubjectTypeExpr, Value: `"telegram.chats." + str(update.Message.Chat.Id)`}},
+		{Condition: "update.Message != nil", Subject: subject("telegram.firehose")},
+		{Condition: "update.Message != nil", Subject: subject("telegram.messages")},
+		{Condition: "update.Message != nil", Subject: subject("telegram.chats.7")},
+		{Condition: "true", Subject: subject("telegram.audit")},
+	}
+	want := []string{"telegram.firehose", "telegram.chats.7", "telegram.messages", "telegram.audit"}
+	update := Update{UpdateId: 1, Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: 7}}}
+
+	// Declaration order with duplicates at their first position, whether
+	// routes are evaluated sequentially or concurrently
+	for _, sequential := range []bool{true, false} {
+		router, err := NewRouter(routes, "all", 3, logger)
+		require.NoError(t, err)
+		router.sequential = sequential
+
+		for range 200 {
+			dests, err := router.Route(update)
+			require.NoError(t, err)
+			subjects := make([]string, len(dests))
+			for i, dest := range dests {
+				subjects[i] = dest.Subject
+			}
+			require.Equal(t, want, subjects, "sequential=%v", sequential)
+		}
+	}
+}
+
+func TestRouter_Route_ForwardOrigin(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: `forwardOrigin(update) != nil && forwardOrigin(update).Type == "channel"`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `sprintf("telegram.forwards.%d", forwardOrigin(update).Chat.Id)`,
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	var forwarded, plain Update
+	require.NoError(t, json.Unmarshal([]byte(`{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"hi","forward_origin":{"type":"channel","date":1,"chat":{"id":-200,"type":"channel"},"message_id":5}}}`), &forwarded))
+	require.NoError(t, json.Unmarshal([]byte(`{"update_id":2,"message":{"message_id":2,"date":1,"chat":{"id":1,"type":"private"},"text":"hi"}}`), &plain))
+
+	dests, err := router.Route(forwarded)
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.forwards.-200", dests[0].Subject)
+
+	dests, err = router.Route(plain)
+	require.NoError(t, err)
+	assert.Empty(t, dests)
+}
+
+func TestRouter_Route_ForumTopics(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			// Topic service messages are dropped explicitly
+			Condition: `subtype(update) startsWith "forum_topic_"`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.forum_events",
+			},
+		},
+		{
+			Condition: `update.Message != nil && update.Message.Chat.IsForum && subtype(update) == ""`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `sprintf("telegram.%v.%v", update.Message.Chat.Id, topic(update))`,
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		update string
+		want   string
+	}{
+		{
+			name:   "topic message",
+			update: `{"update_id":1,"message":{"message_id":20,"message_thread_id":9007199254740991,"is_topic_message":true,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"text":"hi"}}`,
+			want:   "telegram.-1001234567890.9007199254740991",
+		},
+		{
+			name:   "general topic",
+			update: `{"update_id":2,"message":{"message_id":21,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"text":"hi"}}`,
+			want:   "telegram.-1001234567890.0",
+		},
+		{
+			name:   "topic created",
+			update: `{"update_id":3,"message":{"message_id":15,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"forum_topic_created":{"name":"Support","icon_color":7322096}}}`,
+			want:   "telegram.forum_events",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update Update
+			require.NoError(t, json.Unmarshal([]byte(tt.update), &update))
+
+			dests, err := router.Route(update)
+			require.NoError(t, err)
+			require.Len(t, dests, 1)
+			assert.Equal(t, tt.want, dests[0].Subject)
+		})
+	}
+}
+
+func TestRouter_Route_Business(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: `update.BusinessMessage != nil && update.BusinessMessage.Text contains "open"`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `sprintf("telegram.business.%s.messages", update.BusinessMessage.BusinessConnectionId)`,
+			},
+		},
+		{
+			Condition: `update_type(update) in ["business_connection", "edited_business_message", "deleted_business_messages"]`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `sprintf("telegram.business.%s", update_type(update))`,
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	tests := []struct {
+		fixture string
+		want    string
+	}{
+		{fixture: "business_message", want: "telegram.business.bc-123.messages"},
+		{fixture: "edited_business_message", want: "telegram.business.edited_business_message"},
+		{fixture: "deleted_business_messages", want: "telegram.business.deleted_business_messages"},
+		{fixture: "business_connection", want: "telegram.business.business_connection"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			dests, err := router.Route(loadUpdateFixture(t, tt.fixture))
+			require.NoError(t, err)
+			require.Len(t, dests, 1)
+			assert.Equal(t, tt.want, dests[0].Subject)
+		})
+	}
+}
+
+func TestRouter_Route_Replies(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: `reply_to(update) != nil`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `sprintf("telegram.threads.%v.%v", update.Message.Chat.Id, reply_to(update).MessageId)`,
+			},
+		},
+		{
+			Condition: `is_reply(update)`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.external_replies",
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	var reply, external, plain Update
+	require.NoError(t, json.Unmarshal([]byte(`{"update_id":1,"message":{"message_id":11,"date":1,"chat":{"id":-100,"type":"group"},"text":"agreed","reply_to_message":{"message_id":10,"date":1,"chat":{"id":-100,"type":"group"},"text":"lunch?"}}}`), &reply))
+	require.NoError(t, json.Unmarshal([]byte(`{"update_id":2,"message":{"message_id":11,"date":1,"chat":{"id":1,"type":"private"},"text":"look","external_reply":{"origin":{"type":"hidden_user","date":1,"sender_user_name":"Sam"}}}}`), &external))
+	require.NoError(t, json.Unmarshal([]byte(`{"update_id":3,"message":{"message_id":11,"date":1,"chat":{"id":1,"type":"private"},"text":"hi"}}`), &plain))
+
+	dests, err := router.Route(reply)
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.threads.-100.10", dests[0].Subject)
+
+	dests, err = router.Route(external)
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.external_replies", dests[0].Subject)
+
+	dests, err = router.Route(plain)
+	require.NoError(t, err)
+	assert.Empty(t, dests)
+}
+
+func TestRouter_Route_Polls(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: `update.Poll != nil && update.Poll.IsAnonymous`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `sprintf("telegram.polls.anonymous.%s", update.Poll.Id)`,
+			},
+		},
+		{
+			Condition: `update_type(update) in ["poll", "poll_answer"]`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeExpr,
+				Value: `sprintf("telegram.%s", update_type(update))`,
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	tests := []struct {
+		fixture string
+		want    string
+	}{
+		{fixture: "poll_anonymous", want: "telegram.polls.anonymous.poll-anon"},
+		{fixture: "poll_public", want: "telegram.poll"},
+		{fixture: "poll_answer", want: "telegram.poll_answer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			dests, err := router.Route(loadUpdateFixture(t, tt.fixture))
+			require.NoError(t, err)
+			require.Len(t, dests, 1)
+			assert.Equal(t, tt.want, dests[0].Subject)
+		})
+	}
+}
+
+func TestRouter_Route_Reactions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: `"👍" in reactions_added(update)`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.reactions.likes",
+			},
+		},
+		{
+			Condition: `len(reactions_removed(update)) > 0`,
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.reactions.removed",
+			},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	dests, err := router.Route(loadUpdateFixture(t, "message_reaction"))
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.reactions.likes", dests[0].Subject)
+
+	dests, err = router.Route(loadUpdateFixture(t, "message_reaction_replaced"))
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.reactions.removed", dests[0].Subject)
+
+	dests, err = router.Route(loadUpdateFixture(t, "message_reaction_count"))
+	require.NoError(t, err)
+	assert.Empty(t, dests)
+}
+
+func TestRouter_Route_Respond(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: `update.Message != nil && update.Message.Text == "/ping"`,
+			Respond:   &RouteRespond{Text: "pong", Only: true},
+		},
+		{
+			Condition: "update.Message != nil",
+			Subject: &RouteSubject{
+				Type:  SubjectTypeString,
+				Value: "telegram.messages",
+			},
+			Respond: &RouteRespond{TextExpr: `"Got it, " + update.Message.From.FirstName`, ParseMode: "HTML"},
+		},
+	}
+	router, err := NewRouter(routes, "all", 5, logger)
+	require.NoError(t, err)
+
+	dests, err := router.Route(Update{
+		UpdateId: 1,
+		Message: &gotgbot.Message{
+			Text: "/ping",
+			From: &gotgbot.User{Id: 1, FirstName: "Ann"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, dests, 2)
+
+	assert.Empty(t, dests[0].Subject)
+	assert.True(t, dests[0].RespondOnly)
+	assert.Equal(t, &Response{Text: "pong"}, dests[0].Response)
+
+	assert.Equal(t, "telegram.messages", dests[1].Subject)
+	assert.False(t, dests[1].RespondOnly)
+	assert.Equal(t, &Response{Text: "Got it, Ann", ParseMode: "HTML"}, dests[1].Response)
+
+	// Responses are part of the destination, identical subjects don't hide them
+	router, err = NewRouter([]Route{
+		{
+			Condition: "true",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.all"},
+		},
+		{
+			Condition: "true",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.all"},
+			Respond:   &RouteRespond{Text: "pong"},
+		},
+	}, "all", 5, logger)
+	require.NoError(t, err)
+
+	dests, err = router.Route(Update{UpdateId: 2, Message: &gotgbot.Message{Text: "hi"}})
+	require.NoError(t, err)
+	require.Len(t, dests, 2)
+	assert.Nil(t, dests[0].Response)
+	assert.Equal(t, &Response{Text: "pong"}, dests[1].Response)
+
+	_, err = NewRouter([]Route{{
+		Condition: "true",
+		Respond:   &RouteRespond{TextExpr: "sprintf(!!!)", Only: true},
+	}}, "first", 5, logger)
+	assert.ErrorContains(t, err, "failed to compile respond text expression")
+}
+
+func TestRouter_Route_EditSubjects(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: "update.Message != nil || update.EditedMessage != nil",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"},
+		},
+		{
+			Condition: "update.ChannelPost != nil || update.EditedChannelPost != nil",
+			Subject:   &RouteSubject{Type: SubjectTypeExpr, Value: `"telegram.channels." + string(update.ChannelPost?.Chat.Id ?? update.EditedChannelPost.Chat.Id)`},
+		},
+		{
+			Condition: "update.BusinessMessage != nil || update.EditedBusinessMessage != nil",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.business"},
+		},
+	}
+
+	subjects := func(dests []Destination) []string {
+		var result []string
+		for _, dest := range dests {
+			result = append(result, dest.Subject)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		mode   EditSubjectsMode
+		update Update
+		want   []string
+	}{
+		{
+			name:   "new message",
+			mode:   EditSubjectsDuplicate,
+			update: Update{UpdateId: 1, Message: &gotgbot.Message{Text: "hi"}},
+			want:   []string{"telegram.messages"},
+		},
+		{
+			name:   "edited message duplicated",
+			mode:   EditSubjectsDuplicate,
+			update: Update{UpdateId: 2, EditedMessage: &gotgbot.Message{Text: "hi!"}},
+			want:   []string{"telegram.messages", "telegram.messages.edits"},
+		},
+		{
+			name:   "edited message redirected",
+			mode:   EditSubjectsRedirect,
+			update: Update{UpdateId: 3, EditedMessage: &gotgbot.Message{Text: "hi!"}},
+			want:   []string{"telegram.messages.edits"},
+		},
+		{
+			name:   "new channel post",
+			mode:   EditSubjectsRedirect,
+			update: Update{UpdateId: 4, ChannelPost: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100}}},
+			want:   []string{"telegram.channels.-100"},
+		},
+		{
+			name:   "edited channel post uses the evaluated subject",
+			mode:   EditSubjectsRedirect,
+			update: Update{UpdateId: 5, EditedChannelPost: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100}}},
+			want:   []string{"telegram.channels.-100.edits"},
+		},
+		{
+			name:   "edited business message",
+			mode:   EditSubjectsDuplicate,
+			update: Update{UpdateId: 6, EditedBusinessMessage: &gotgbot.Message{Text: "hi!"}},
+			want:   []string{"telegram.business", "telegram.business.edits"},
+		},
+		{
+			name:   "disabled",
+			update: Update{UpdateId: 7, EditedMessage: &gotgbot.Message{Text: "hi!"}},
+			want:   []string{"telegram.messages"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mode := range []string{"first", "all"} {
+				router, err := NewRouter(routes, mode, 5, logger)
+				require.NoError(t, err)
+				router.SetEditSubjects(tt.mode)
+
+				dests, err := router.Route(tt.update)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, subjects(dests), "mode %s", mode)
+			}
+		})
+	}
+
+	t.Run("unmatched edits keep the unmatched subject", func(t *testing.T) {
+		router, err := NewRouter(routes[:1], "all", 5, logger)
+		require.NoError(t, err)
+		router.SetEditSubjects(EditSubjectsRedirect)
+		router.SetUnmatchedSubject("telegram.unmatched")
+
+		dests, err := router.Route(Update{UpdateId: 8, EditedChannelPost: &gotgbot.Message{}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"telegram.unmatched"}, subjects(dests))
+	})
+}
+
+// benchRoutes builds n message routes matching texts of different lengths,
+// so "all" mode matches several of them
+func benchRoutes(n int, subjectType RouteSubjectType) []Route {
+	routes := make([]Route, n)
+	for i := range routes {
+		subject := &RouteSubject{Type: SubjectTypeString, Value: fmt.Sprintf("telegram.route%d", i)}
+		if subjectType == SubjectTypeExpr {
+			subject = &RouteSubject{Type: SubjectTypeExpr, Value: fmt.Sprintf(`sprintf("telegram.route%d.%%d", update.Message.Chat.Id)`, i)}
+		}
+		routes[i] = Route{
+			Condition: fmt.Sprintf("update.Message != nil && len(update.Message.Text) > %d", i%20),
+			Subject:   subject,
+		}
+	}
+	return routes
+}
+
+func benchUpdates() []Update {
+	updates := make([]Update, 20)
+	for i := range updates {
+		updates[i] = Update{
+			UpdateId: int64(i + 1),
+			Message: &gotgbot.Message{
+				MessageId: int64(i + 1),
+				Chat:      gotgbot.Chat{Id: int64(100 + i), Type: "private"},
+				Text:      strings.Repeat("a", i+1),
+			},
+		}
+	}
+	return updates
+}
+
+func BenchmarkRouter_Route(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	updates := benchUpdates()
+
+	for _, n := range []int{10, 100, 1000} {
+		for _, subjectType := range []RouteSubjectType{SubjectTypeString, SubjectTypeExpr} {
+			for _, mode := range []string{"first", "all"} {
+				b.Run(fmt.Sprintf("routes=%d/subject=%s/mode=%s", n, subjectType, mode), func(b *testing.B) {
+					router, err := NewRouter(benchRoutes(n, subjectType), mode, 10, logger)
+					require.NoError(b, err)
+
+					b.ReportAllocs()
+					i := 0
+					for b.Loop() {
+						if _, err := router.Route(updates[i%len(updates)]); err != nil {
+							b.Fatal(err)
+						}
+						i++
+					}
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkRouter_Evaluation compares evaluating routes on the calling
+// goroutine with a goroutine per route
+func BenchmarkRouter_Evaluation(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	updates := benchUpdates()
+
+	for _, n := range []int{5, 50, 500} {
+		for _, mode := range []string{"first", "all"} {
+			for _, sequential := range []bool{false, true} {
+				evaluation := "goroutines"
+				if sequential {
+					evaluation = "sequential"
+				}
+				b.Run(fmt.Sprintf("routes=%d/mode=%s/%s", n, mode, evaluation), func(b *testing.B) {
+					router, err := NewRouter(benchRoutes(n, SubjectTypeExpr), mode, 10, logger)
+					require.NoError(b, err)
+					router.sequential = sequential
+
+					b.ReportAllocs()
+					i := 0
+					for b.Loop() {
+						if _, err := router.Route(updates[i%len(updates)]); err != nil {
+							b.Fatal(err)
+						}
+						i++
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestAcquireExprEnv(t *testing.T) {
+	admin := func(Update) bool { return true }
+	update := Update{UpdateId: 1, Message: &gotgbot.Message{Text: "hi"}}
+
+	runEnv := acquireExprEnv(update, &Enrichment{Chat: &gotgbot.ChatFullInfo{Id: 10}}, admin)
+	assert.Equal(t, update, runEnv["update"])
+	assert.Equal(t, int64(10), runEnv["enriched"].(Enrichment).Chat.Id)
+	assert.True(t, runEnv["is_admin"].(func(Update) bool)(update))
+	assert.Len(t, runEnv, len(env))
+
+	// Released environments don't keep the update or per-router helpers
+	releaseExprEnv(runEnv)
+	assert.Equal(t, env["update"], runEnv["update"])
+	assert.Equal(t, env["enriched"], runEnv["enriched"])
+	assert.False(t, runEnv["is_admin"].(func(Update) bool)(update))
+
+	runEnv = acquireExprEnv(Update{UpdateId: 2}, nil, nil)
+	defer releaseExprEnv(runEnv)
+	assert.Equal(t, Enrichment{}, runEnv["enriched"])
+	assert.False(t, runEnv["is_admin"].(func(Update) bool)(update))
+}
+
+func BenchmarkExprEnv(b *testing.B) {
+	program, err := expr.Compile(`update.Message != nil && hasEntity(update, "bot_command")`, expr.Env(env), expr.AsBool())
+	require.NoError(b, err)
+	update := benchUpdates()[0]
+
+	b.Run("fresh", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := expr.Run(program, exprEnv(update, nil, nil)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			runEnv := acquireExprEnv(update, nil, nil)
+			if _, err := runExpr[bool](program, runEnv); err != nil {
+				b.Fatal(err)
+			}
+			releaseExprEnv(runEnv)
+		}
+	})
+}
+
+func TestClampRouteWorkers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	limit := runtime.GOMAXPROCS(0) * maxRouteWorkersPerCPU
+
+	assert.Equal(t, 1, clampRouteWorkers(0, logger))
+	assert.Equal(t, 1, clampRouteWorkers(-3, logger))
+	assert.Equal(t, 1, clampRouteWorkers(1, logger))
+	assert.Equal(t, limit, clampRouteWorkers(limit, logger))
+	assert.Equal(t, limit, clampRouteWorkers(limit+1, logger))
+}
+
+func TestRouter_Route_Ordered(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	subject := func(value string) *RouteSubject {
+		return &RouteSubject{Type: SubjectTypeString, Value: value}
+	}
+	subjects := func(t *testing.T, router *Router, update Update) []string {
+		dests, err := router.Route(update)
+		require.NoError(t, err)
+		var subjects []string
+		for _, dest := range dests {
+			subjects = append(subjects, dest.Subject)
+		}
+		return subjects
+	}
+
+	// An update carrying several fields goes to the first route in
+	// definition order, whichever field the route checks
+	both := Update{
+		UpdateId:      1,
+		Message:       &gotgbot.Message{Text: "hi"},
+		CallbackQuery: &gotgbot.CallbackQuery{Id: "1"},
+	}
+	messageRoute := Route{Condition: "update.Message != nil", Subject: subject("telegram.messages")}
+	callbackRoute := Route{Condition: "update.CallbackQuery != nil", Subject: subject("telegram.callbacks")}
+	for _, routeWorkers := range []int{1, 2, 5} {
+		for _, ordered := range []bool{false, true} {
+			router, err := NewRouter([]Route{callbackRoute, messageRoute}, "first", routeWorkers, logger)
+			require.NoError(t, err)
+			router.SetOrdered(ordered)
+			for range 50 {
+				require.Equal(t, []string{"telegram.callbacks"}, subjects(t, router, both))
+			}
+
+			router, err = NewRouter([]Route{messageRoute, callbackRoute}, "all", routeWorkers, logger)
+			require.NoError(t, err)
+			router.SetOrdered(ordered)
+			router.sequential = false
+			for range 50 {
+				require.Equal(t, []string{"telegram.messages", "telegram.callbacks"}, subjects(t, router, both))
+			}
+		}
+	}
+
+	// A failing route after the first match fails the update only when it
+	// shares a batch with the match
+	routes := []Route{
+		callbackRoute,
+		{Condition: `update.Message.Text == "x"`, Subject: subject("telegram.x")},
+	}
+	callback := Update{UpdateId: 2, CallbackQuery: &gotgbot.CallbackQuery{Id: "1"}}
+
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+	_, err = router.Route(callback)
+	assert.Error(t, err)
+
+	router.SetOrdered(true)
+	assert.Equal(t, []string{"telegram.callbacks"}, subjects(t, router, callback))
+}
+
+func TestRouter_Route_ZeroRouteWorkers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	routes := []Route{
+		{Condition: "update.CallbackQuery != nil", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.callbacks"}},
+		{Condition: "update.Message != nil", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"}},
+	}
+	router, err := NewRouter(routes, "first", 0, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 1, router.routeWorkers)
+
+	done := make(chan []Destination)
+	go func() {
+		dests, err := router.Route(Update{Message: &gotgbot.Message{Text: "hi"}})
+		assert.NoError(t, err)
+		done <- dests
+	}()
+	select {
+	case dests := <-done:
+		require.Len(t, dests, 1)
+		assert.Equal(t, "telegram.messages", dests[0].Subject)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Route did not return")
+	}
+}
+
+// TestNewRouter_FromConfig builds the router the way the run command does,
+// so a drift between Config and NewRouter shows up here
+func TestNewRouter_FromConfig(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "")
+	t.Setenv("NATS_URL", "")
+	t.Setenv("KAFKA_BROKERS", "")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+telegram_token: test-token
+nats:
+  url: nats://test:4222
+mode: all
+route_workers: 2
+default_subject: telegram.default
+scrub:
+  enabled: true
+  remove: [message.contact]
+edit_subjects:
+  enabled: true
+  mode: redirect
+routes:
+  - condition: "update.Message != nil"
+    subject:
+      type: string
+      value: telegram.messages
+  - condition: "update.Message?.Text == 'ping'"
+    subject:
+      type: string
+      value: telegram.pings
+  - condition: "update.Message?.Chat.Type == 'private'"
+    subject:
+      type: string
+      value: telegram.private
+`), 0644))
+
+	cfg, err := LoadConfig(configPath, logger)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	router, err := NewRouterFromConfig(cfg, logger)
+	require.NoError(t, err)
+	assert.Equal(t, min(2, runtime.GOMAXPROCS(0)*maxRouteWorkersPerCPU), router.routeWorkers)
+	assert.Equal(t, "telegram.default", router.defaultSubject)
+	assert.Equal(t, EditSubjectsRedirect, router.editMode)
+	assert.True(t, router.scrubUnmatched)
+
+	dests, err := router.Route(Update{Message: &gotgbot.Message{Text: "ping", Chat: gotgbot.Chat{Type: "private"}}})
+	require.NoError(t, err)
+	var subjects []string
+	for _, dest := range dests {
+		subjects = append(subjects, dest.Subject)
+	}
+	assert.Equal(t, []string{"telegram.messages", "telegram.pings", "telegram.private"}, subjects)
+}
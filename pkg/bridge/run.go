@@ -0,0 +1,1027 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// ErrNATSConnectionLost is returned by Run when the NATS connection is closed
+// for good after reconnects gave up
+var ErrNATSConnectionLost = errors.New("NATS connection lost")
+
+// ErrTooManyConflicts is returned by Run when getUpdates kept failing with
+// HTTP 409 for telegram.max_conflicts polls in a row
+var ErrTooManyConflicts = errors.New("too many getUpdates conflicts")
+
+// ConflictExitCode is the exit code used when the bridge stops on ErrTooManyConflicts
+const ConflictExitCode = 5
+
+// updatesLimiter is implemented by TelegramClient for the adaptive getUpdates limit
+type updatesLimiter interface {
+	SetUpdatesLimit(limit int)
+	LastUpdatesSize() int64
+}
+
+// Options are optional dependencies of Run. Nil fields are created from the
+// config like the run command does.
+type Options struct {
+	// Logger defaults to slog.Default()
+	Logger *slog.Logger
+	// Telegram replaces the Bot API client created from telegram_token
+	Telegram TelegramClientInterface
+	// Broker replaces the NATS or Kafka client created from the config. Run
+	// connects and closes it, JetStream streams are not provisioned for it.
+	Broker BrokerInterface
+	// HandleSignals makes SIGINT and SIGTERM stop the bridge and bounds the
+	// shutdown with ShutdownGuard, which exits the process. Set by the CLI.
+	HandleSignals bool
+}
+
+// Run runs the bridge with a validated config until ctx is canceled, then
+// shuts down gracefully and returns nil. It returns context.Canceled when ctx
+// is canceled or a handled signal arrives during startup.
+func Run(ctx context.Context, cfg *Config, opts Options) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	hash := ConfigHash(cfg)
+	logger.Info("effective configuration", "config_hash", hash)
+
+	// Deferred first, so it is closed after every cleanup step below and
+	// ShutdownGuard bounds all of them
+	shutdownDone := make(chan struct{})
+	defer close(shutdownDone)
+
+	// Lifecycle events go to control_subject once NATS is connected
+	instanceID := newInstanceID()
+	control := NewControlEvents(cfg.ControlSubject, instanceID, logger)
+	onNATSReconnect := func() {
+		control.Emit(ControlEventNATSReconnected, nil)
+	}
+
+	// Create Telegram client (token is loaded from env or YAML)
+	tgClient := opts.Telegram
+	if tgClient == nil {
+		tgClient = NewTelegramClientFromConfig(cfg, logger)
+	}
+
+	// Dependencies may start after the bridge, so the initial GetMe and NATS
+	// connection are retried; a signal during startup stops the retries
+	startCtx, stopStartup := context.WithCancel(ctx)
+	if opts.HandleSignals {
+		startCtx, stopStartup = signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	}
+	defer stopStartup()
+
+	// Kafka has no retry settings, so only a single attempt is made
+	startupRetry := retryPolicy{attempts: 1}
+	if cfg.NATS != nil && cfg.NATS.ConnectRetry != nil {
+		startupRetry = newRetryPolicy(*cfg.NATS.ConnectRetry)
+	}
+
+	// Test: Get bot info
+	var botInfo *gotgbot.User
+	err := retryConnect(startCtx, startupRetry, "telegram", logger, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		var err error
+		botInfo, err = tgClient.GetMe(ctx)
+		if errors.Is(err, ErrUnauthorized) {
+			return permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		if startCtx.Err() != nil {
+			return startCtx.Err()
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			return fmt.Errorf("your TELEGRAM_BOT_TOKEN appears invalid: %w", err)
+		}
+		return fmt.Errorf("failed to get bot info: %w", err)
+	}
+
+	logger.Info("bot connected",
+		"id", botInfo.Id,
+		"username", botInfo.Username,
+		"name", botInfo.FirstName)
+
+	// Create and connect broker client based on broker type
+	brokerClient := opts.Broker
+
+	connectCtx, cancel := context.WithTimeout(startCtx, 10*time.Second)
+	defer cancel()
+
+	// NATS clients report here when reconnects give up and the connection is closed for good
+	natsClosed := make(chan struct{}, 1)
+	onNATSClosed := func() {
+		select {
+		case natsClosed <- struct{}{}:
+		default:
+		}
+	}
+
+	// connectBroker retries the initial connection with a fresh timeout per attempt
+	connectBroker := func(client BrokerInterface) error {
+		return retryConnect(startCtx, startupRetry, string(cfg.Broker), logger, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			return client.Connect(ctx)
+		})
+	}
+
+	var natsName string
+	if cfg.Broker == BrokerNATS {
+		natsName = natsConnectionName(cfg.NATS.ConnectionName, botInfo.Username)
+	}
+
+	switch {
+	case brokerClient != nil:
+		if err := connectBroker(brokerClient); err != nil {
+			if startCtx.Err() != nil {
+				return startCtx.Err()
+			}
+			return fmt.Errorf("failed to connect to broker: %w", err)
+		}
+		defer brokerClient.Close()
+
+		logger.Info("broker connected", "broker", cfg.Broker)
+
+	case cfg.Broker == BrokerNATS:
+		switch cfg.NATS.Engine {
+		case EngineJetStream:
+			jsClient := NewJetStreamClient(cfg.NATS.URL, jetStreamClientOptions(cfg.NATS, natsName, logger, onNATSClosed, onNATSReconnect)...)
+			brokerClient = jsClient
+			if err := connectBroker(brokerClient); err != nil {
+				if startCtx.Err() != nil {
+					return startCtx.Err()
+				}
+				return fmt.Errorf("failed to connect to NATS with JetStream: %w", err)
+			}
+			defer brokerClient.Close()
+
+			connectCtx, cancel = context.WithTimeout(startCtx, 10*time.Second)
+			defer cancel()
+
+			if spec := cfg.NATS.JetStream.Stream; spec != nil {
+				subjects, err := jsClient.ProvisionStream(connectCtx, spec, cfg.NATS.JetStream.ManageStream)
+				if err != nil {
+					return fmt.Errorf("failed to provision JetStream stream: %w", err)
+				}
+				warnExpr := func(i int) {
+					logger.Warn("route subject is an expression, stream coverage can't be checked", "route", i, "stream", spec.Name)
+				}
+				if err := checkStreamCoverage(cfg, spec.Name, subjects, warnExpr); err != nil {
+					return fmt.Errorf("JetStream stream doesn't cover route subjects: %w", err)
+				}
+			} else if err := jsClient.EnsureStream(connectCtx, cfg.NATS.JetStream.StreamConfig); err != nil {
+				return fmt.Errorf("failed to ensure JetStream stream: %w", err)
+			}
+
+			for name, path := range cfg.NATS.JetStream.Streams {
+				if err := jsClient.EnsureStream(connectCtx, path); err != nil {
+					return fmt.Errorf("failed to ensure JetStream stream %s: %w", name, err)
+				}
+			}
+
+			logger.Info("NATS connected with JetStream", "url", cfg.NATS.URL, "stream_config", cfg.NATS.JetStream.StreamConfig)
+
+		case EngineCore:
+			brokerClient = NewNATSClient(cfg.NATS.URL, natsClientOptions(cfg.NATS, natsName, logger, onNATSClosed, onNATSReconnect)...)
+			if err := connectBroker(brokerClient); err != nil {
+				if startCtx.Err() != nil {
+					return startCtx.Err()
+				}
+				return fmt.Errorf("failed to connect to NATS: %w", err)
+			}
+			defer brokerClient.Close()
+
+			logger.Info("NATS connected", "url", cfg.NATS.URL)
+		}
+
+	case cfg.Broker == BrokerKafka:
+		kafkaCfg := KafkaClientConfig{
+			Brokers:     cfg.Kafka.Brokers,
+			Async:       cfg.Kafka.Async,
+			AckRequired: cfg.Kafka.AckRequired,
+			BatchSize:   cfg.Kafka.BatchSize,
+			BatchBytes:  cfg.Kafka.BatchBytes,
+		}
+		brokerClient = NewKafkaClient(kafkaCfg, logger)
+		if err := brokerClient.Connect(connectCtx); err != nil {
+			return fmt.Errorf("failed to connect to Kafka: %w", err)
+		}
+		defer brokerClient.Close()
+
+		logger.Info("Kafka connected", "brokers", cfg.Kafka.Brokers)
+	}
+
+	if provider, ok := brokerClient.(NATSConnProvider); ok && control != nil {
+		control.SetBot(newBotMeta(botInfo))
+		control.SetConn(provider.NATSConn())
+		control.Emit(ControlEventStarted, map[string]interface{}{
+			"version":     Version,
+			"config_hash": hash,
+		})
+		control.Emit(ControlEventTelegramConnected, map[string]interface{}{
+			"bot_id":   botInfo.Id,
+			"username": botInfo.Username,
+		})
+	}
+
+	// With ha only the leader goes on, standbys wait here until its lease
+	// expires and then continue from the stored offset
+	leaderLost := make(chan error, 1)
+	if cfg.HA != nil && cfg.HA.Enabled {
+		provider, ok := brokerClient.(NATSConnProvider)
+		if !ok {
+			return fmt.Errorf("ha needs a broker with a NATS connection")
+		}
+		electionCtx, electionCancel := context.WithTimeout(startCtx, 10*time.Second)
+		election, err := NewLeaderElection(electionCtx, provider.NATSConn(), cfg.HA.Bucket,
+			time.Duration(cfg.HA.LeaseSec)*time.Second, botInfo.Id, instanceID, logger)
+		electionCancel()
+		if err != nil {
+			if startCtx.Err() != nil {
+				return startCtx.Err()
+			}
+			return fmt.Errorf("failed to start leader election: %w", err)
+		}
+		if err := election.Acquire(startCtx); err != nil {
+			return fmt.Errorf("stopped while standing by: %w", err)
+		}
+		control.Emit(ControlEventLeaderElected, nil)
+
+		// Renewals start right away, the rest of the startup may take longer than the lease
+		holdCtx, stopHold := context.WithCancel(context.Background())
+		holdDone := make(chan struct{})
+		go func() {
+			defer close(holdDone)
+			if err := election.Hold(holdCtx); errors.Is(err, ErrLeadershipLost) {
+				leaderLost <- err
+			}
+		}()
+		defer func() {
+			stopHold()
+			<-holdDone
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer releaseCancel()
+			if err := election.Release(releaseCtx); err != nil {
+				logger.Warn("failed to release leadership", "error", err)
+			}
+		}()
+	}
+
+	// Verify that the bridge is actually allowed to publish before polling.
+	// In warn mode a failure is reported by /healthz.
+	probeOK := true
+	if prober, ok := brokerClient.(Prober); ok && cfg.StartupProbe {
+		probeCtx, probeCancel := context.WithTimeout(startCtx, 5*time.Second)
+		err := prober.Probe(probeCtx, cfg.StartupProbeRoundTrip)
+		probeCancel()
+
+		switch {
+		case startCtx.Err() != nil:
+			return startCtx.Err()
+		case err == nil:
+			logger.Info("startup probe succeeded", "subject", ProbeSubject, "round_trip", cfg.StartupProbeRoundTrip)
+		case cfg.StartupProbeOnFailure == ProbeFailureExit:
+			return fmt.Errorf("startup probe failed on %s: %w", ProbeSubject, err)
+		default:
+			logger.Warn("startup probe failed, bridge is not ready", "subject", ProbeSubject, "error", err)
+			probeOK = false
+		}
+	}
+
+	// Continue from the offset stored by a previous run
+	var offsetStore OffsetStore
+	var offset int64 = 0
+	if cfg.Broker == BrokerNATS && cfg.NATS.OffsetStore.Enabled {
+		provider, ok := brokerClient.(NATSConnProvider)
+		if !ok {
+			return fmt.Errorf("nats.offset_store needs a broker with a NATS connection")
+		}
+		conn := provider.NATSConn()
+		storeCtx, storeCancel := context.WithTimeout(startCtx, 10*time.Second)
+		store, err := NewKVOffsetStore(storeCtx, conn, cfg.NATS.OffsetStore.Bucket, botInfo.Id)
+		if err == nil {
+			offset, err = store.Load(storeCtx)
+		}
+		storeCancel()
+		if err != nil {
+			return fmt.Errorf("failed to load offset from bucket %s: %w", cfg.NATS.OffsetStore.Bucket, err)
+		}
+		offsetStore = store
+		logger.Info("offset loaded", "bucket", cfg.NATS.OffsetStore.Bucket, "key", offsetKey(botInfo.Id), "offset", offset)
+	}
+
+	// Create router
+	router, err := NewRouterFromConfig(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create router: %w", err)
+	}
+	if router.Len() == 0 && cfg.UnmatchedSubject == "" && cfg.DefaultSubject == "" {
+		logger.Warn("no routes are enabled, updates won't be published; set default_subject to publish every update")
+	}
+	sharder := router.sharder
+
+	// Personal data is removed from the payloads of scrubbed routes only
+	// when they are marshaled, conditions see the original update
+	scrubber, err := NewScrubber(cfg.Scrub)
+	if err != nil {
+		return fmt.Errorf("failed to create scrubber: %w", err)
+	}
+
+	// Fetch chat data for routes with enrich; the same cache backs is_admin
+	enricher := NewEnricher(tgClient, cfg.Enrichment.CacheSize, time.Duration(cfg.Enrichment.TTLSec)*time.Second, logger)
+	enricher.SetLookupTimeout(time.Duration(cfg.Enrichment.LookupTimeoutMs) * time.Millisecond)
+	router.SetAdminChecker(enricher.IsAdmin)
+	router.SetBotUsername(botInfo.Username)
+
+	// Remember message texts to describe edits
+	var editTracker *EditTracker
+	if cfg.EditTracking.Enabled {
+		editTracker = NewEditTracker(cfg.EditTracking.CacheSize, time.Duration(cfg.EditTracking.TTLSec)*time.Second)
+	}
+
+	// Request-reply is available only for NATS brokers
+	requester, _ := brokerClient.(RequesterInterface)
+
+	// Create payment handler for shipping and pre-checkout queries
+	var paymentHandler *PaymentHandler
+	if cfg.Payments != nil {
+		paymentHandler = NewPaymentHandler(cfg.Payments, tgClient, requester, logger)
+	}
+
+	// Migration events go to a dedicated subject (topic for Kafka)
+	migrationDest := Destination{Subject: cfg.ChatMigrationsSubject}
+	if cfg.Broker == BrokerKafka {
+		migrationDest = Destination{Topic: cfg.ChatMigrationsSubject}
+	}
+
+	// Poll tallies go to a dedicated subject (topic for Kafka)
+	var pollAggregator *PollAggregator
+	pollDest := Destination{Subject: cfg.PollAggregation.Subject}
+	if cfg.Broker == BrokerKafka {
+		pollDest = Destination{Topic: cfg.PollAggregation.Subject}
+	}
+	if cfg.PollAggregation.Enabled {
+		pollAggregator = NewPollAggregator(cfg.PollAggregation.CacheSize, time.Duration(cfg.PollAggregation.TTLSec)*time.Second)
+	}
+
+	// Updates that panic during processing go to the dead-letter subject if configured
+	var deadLetterDest *Destination
+	if cfg.DeadLetterSubject != "" {
+		deadLetterDest = &Destination{Subject: cfg.DeadLetterSubject}
+		if cfg.Broker == BrokerKafka {
+			deadLetterDest = &Destination{Topic: cfg.DeadLetterSubject}
+		}
+	}
+	// One "update processed" record per update, failed updates are always logged
+	updateLog := NewUpdateLog(cfg.Log)
+	// Messages of bots are dropped before routing with ignore_bots/ignore_self
+	botFilter := NewBotFilter(cfg.IgnoreBots, cfg.IgnoreSelf, botInfo.Id)
+	chatLimiter := NewChatLimiter(cfg.ChatLimit)
+
+	// Create handler for routes with reply_mode: request
+	replyHandler := NewReplyHandler(requester, tgClient, logger)
+	// Rejected replies are published directly: the handler runs on a publisher worker
+	replyHandler.SetInvalidReplyHandler(func(ctx context.Context, dest Destination, update Update, verr *OutboundValidationError) {
+		if cfg.OutboundErrorsSubject == "" {
+			return
+		}
+		event := OutboundErrorEvent{
+			OutboundValidationError: *verr,
+			Subject:                 dest.Subject,
+			UpdateID:                update.UpdateId,
+		}
+		if err := brokerClient.Publish(ctx, Destination{Subject: cfg.OutboundErrorsSubject}, event); err != nil {
+			logger.Error("failed to publish outbound error", "subject", cfg.OutboundErrorsSubject, "error", err)
+		}
+	})
+
+	if cfg.Idempotency.Enabled {
+		replyHandler.SetIdempotencyCache(NewIdempotencyCache(cfg.Idempotency.CacheSize, time.Duration(cfg.Idempotency.TTLSec)*time.Second))
+	}
+
+	// Voice notes of routes with request_transcription get a transcript before publishing
+	var transcriber *Transcriber
+	if cfg.TranscriptionRequestSubject != "" {
+		transcriber = NewTranscriber(requester, tgClient, cfg.TranscriptionRequestSubject, time.Duration(cfg.TranscriptionTimeoutMs)*time.Millisecond, logger)
+	}
+
+	// JetStream drops an update published again with the same Nats-Msg-Id
+	var msgIDs *MsgIDBuilder
+	if cfg.Broker == BrokerNATS && cfg.NATS.Engine == EngineJetStream {
+		msgIDs, err = NewMsgIDBuilder(cfg.NATS.JetStream.MsgID, botInfo.Id)
+		if err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		if reason := msgIDCollision(cfg); reason != "" {
+			logger.Warn("publications of one update into the same stream share nats.jetstream.msg_id and all but the first are dropped as duplicates; include subject in msg_id",
+				"reason", reason)
+		}
+	}
+
+	// Create responder for routes with respond
+	responder := NewResponder(tgClient, logger)
+
+	// Create publisher
+	stats := NewStats()
+	stats.SetConfigHash(hash)
+	publisher := NewPublisher(cfg.PublishWorkers, cfg.PublishShutdownTimeout, brokerClient, logger)
+	if cfg.PublishTimeout > 0 {
+		publisher.SetPublishTimeout(time.Duration(cfg.PublishTimeout) * time.Second)
+	}
+	if cfg.PublishQueueSize > 0 {
+		publisher.SetQueueSize(cfg.PublishQueueSize)
+	}
+	if cfg.PublishMaxAttempts > 0 {
+		publisher.SetRetry(cfg.PublishMaxAttempts, time.Duration(cfg.PublishRetryBackoffMs)*time.Millisecond)
+	}
+	// Publications failing permanently or out of attempts go to the dead-letter subject too
+	if deadLetterDest != nil {
+		publisher.SetDeadLetter(*deadLetterDest)
+	}
+	publisher.SetResultHandler(stats.RecordPublish)
+	publisher.SetRequestHandler(func(ctx context.Context, dest Destination, data interface{}) {
+		replyHandler.Handle(ctx, dest, unwrapUpdate(data))
+	})
+	publisher.Start()
+	batcher := NewBatcher(cfg.Publish.Batch, publisher)
+
+	// Pause polling while the NATS outgoing buffer is nearly full
+	var backpressure *Backpressure
+	if reporter, ok := brokerClient.(pendingReporter); ok && cfg.NATS.PendingLimitBytes > 0 {
+		backpressure = NewBackpressure(reporter, publisher, stats, cfg.NATS.PendingLimitBytes, logger)
+	}
+
+	// Expose stats through the NATS services API on a separate connection
+	if cfg.Broker == BrokerNATS && cfg.NATS.Micro {
+		microService := NewMicroService(cfg.NATS.URL, stats, logger)
+		microService.SetConnectionName(natsName + "-micro")
+		microCtx, microCancel := context.WithTimeout(startCtx, 10*time.Second)
+		if err := microService.Start(microCtx); err != nil {
+			logger.Warn("failed to register NATS micro service", "error", err)
+		}
+		microCancel()
+		defer microService.Close()
+	}
+
+	// Started by the poll loop, created here for the health endpoint
+	watchdog := NewWatchdog(
+		time.Duration(cfg.Watchdog.Multiplier)*DefaultPollTimeout,
+		time.Duration(cfg.Watchdog.IntervalSec)*time.Second,
+		cfg.Watchdog.Action,
+		logger)
+
+	// Serve JSON stats over HTTP for setups without Prometheus
+	if cfg.HTTPServer.Enabled {
+		var connected natsConnChecker
+		if provider, ok := brokerClient.(NATSConnProvider); ok {
+			connected = func() bool { return provider.NATSConn().IsConnected() }
+		}
+		checks := map[string]HealthCheck{"poll_loop": watchdog.Healthy}
+		if cfg.StartupProbe {
+			checks["startup_probe"] = func() bool { return probeOK }
+		}
+		httpServer := NewHTTPServer(cfg.HTTPServer, stats, connected, checks, logger)
+		if err := httpServer.Start(); err != nil {
+			return fmt.Errorf("failed to start HTTP server: %w", err)
+		}
+		defer func() {
+			closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer closeCancel()
+			if err := httpServer.Close(closeCtx); err != nil {
+				logger.Warn("failed to stop HTTP server", "error", err)
+			}
+		}()
+	}
+
+	// Startup is over, signals are handled by the poll loop from now on
+	stopStartup()
+
+	// Start polling for updates
+	logger.Info("starting to poll for updates...")
+
+	// Setup graceful shutdown
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	if opts.HandleSignals {
+		sigChan := make(chan os.Signal, 2)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigChan)
+
+		// A stuck publish or drain must not hang shutdown forever
+		shutdownGuard := NewShutdownGuard(time.Duration(cfg.ShutdownTimeout)*time.Second, logger)
+		shutdownGuard.SetPendingReporter(func() []any {
+			pending := []any{"publish_queue", publisher.Pending()}
+			if reporter, ok := brokerClient.(pendingReporter); ok {
+				pending = append(pending, "broker_pending_bytes", reporter.PendingBytes())
+			}
+			return pending
+		})
+		go shutdownGuard.Run(ctx, cancel, sigChan, shutdownDone)
+	}
+
+	// Watch for a wedged poll loop, with the exit action a stall stops the bridge
+	go watchdog.Run(ctx, cancel)
+
+	// Publishing is impossible without NATS, stop with ErrNATSConnectionLost
+	// so the supervisor restarts the bridge instead of consuming updates
+	var natsLost atomic.Bool
+	// A standby took over or is about to, stop with ErrLeadershipLost
+	var leadershipLost atomic.Bool
+	go func() {
+		select {
+		case <-natsClosed:
+			logger.Error("NATS connection lost, stopping")
+			natsLost.Store(true)
+			cancel()
+		case err := <-leaderLost:
+			logger.Error("leadership lost, stopping", "error", err)
+			leadershipLost.Store(true)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// shutdown drains and stops the bridge, reason is reported in the
+	// shutdown control event when the bridge stops on its own
+	shutdown := func(reason string) error {
+		var data map[string]interface{}
+		if reason != "" {
+			data = map[string]interface{}{"reason": reason}
+		}
+		// Before draining, so consumers learn about the shutdown first
+		control.Emit(ControlEventShutdown, data)
+		batcher.Close()
+		publisher.Close()
+		logStats(logger, stats)
+		logger.Info("shutdown complete")
+		if natsLost.Load() {
+			return ErrNATSConnectionLost
+		}
+		if leadershipLost.Load() {
+			return ErrLeadershipLost
+		}
+		if watchdog.Stopped() {
+			return ErrWatchdogStall
+		}
+		return nil
+	}
+
+	// Poll for updates and publish to broker
+	streamDecode := cfg.Telegram != nil && cfg.Telegram.StreamDecode
+	// The adaptive limit needs response sizes, which only TelegramClient reports
+	limiter, _ := tgClient.(updatesLimiter)
+	var pollLimit *adaptiveLimit
+	if cfg.Telegram != nil && limiter != nil {
+		pollLimit = newAdaptiveLimit(cfg.Telegram.AdaptiveLimit)
+	}
+	botMeta := newBotMeta(botInfo)
+	var wrappedBot *BotMeta
+	if cfg.IncludeBotMeta && cfg.BotMetaMode == BotMetaWrap {
+		wrappedBot = &botMeta
+	}
+	encoder, err := newPayloadEncoder(cfg.PayloadSchemaVersion, wrappedBot)
+	if err != nil {
+		return fmt.Errorf("failed to create payload encoder: %w", err)
+	}
+	recovery := &panicRecovery{guard: newPanicGuard(panicLimit, panicWindow), shutdown: cancel}
+	if deadLetterDest != nil {
+		recovery.deadLetter = func(update Update, headers map[string]string) {
+			dest := *deadLetterDest
+			dest.Headers = schemaHeaders(headers, encoder.version())
+			payload := encoder.encode(update, nil, nil)
+			if cfg.Publish.StringifyIDs {
+				payload = StringIDsPayload{Payload: payload}
+			}
+			publisher.Publish(dest, payload)
+		}
+	}
+	inFlight := NewInFlightLimiter(cfg.MaxInFlight)
+	latency := NewLatencyTracker(stats, time.Duration(cfg.SlowUpdateThresholdMs)*time.Millisecond)
+	// getUpdates conflicts since the last successful poll
+	var conflicts int
+	maxConflicts := DefaultMaxConflicts
+	if cfg.Telegram != nil && cfg.Telegram.MaxConflicts != nil {
+		maxConflicts = *cfg.Telegram.MaxConflicts
+	}
+	for {
+		watchdog.Beat()
+
+		select {
+		case <-ctx.Done():
+			return shutdown("")
+		default:
+		}
+
+		if backpressure != nil {
+			// Waiting for the broker is not a stall of the poll loop
+			watchdog.Idle(func() { backpressure.Wait(ctx) })
+		}
+
+		nextOffset := offset
+		received := 0
+		var pollErr error
+		limit := pollLimit.Limit()
+		if limiter != nil {
+			limiter.SetUpdatesLimit(limit)
+		}
+		pollStart := time.Now()
+		for update, err := range pollUpdates(ctx, tgClient, offset, streamDecode) {
+			var malformed *MalformedUpdateError
+			if errors.As(err, &malformed) {
+				// Skip the update, so it doesn't block the rest of the batch
+				logger.Error("failed to decode update, skipping it", "update_id", malformed.UpdateID, "error", malformed.Err)
+				if malformed.UpdateID >= nextOffset {
+					nextOffset = malformed.UpdateID + 1
+				}
+				if deadLetterDest != nil {
+					dest := *deadLetterDest
+					dest.Headers = map[string]string{DecodeErrorHeader: malformed.Err.Error()}
+					publisher.Publish(dest, malformed.Raw)
+				}
+				continue
+			}
+			if err != nil {
+				pollErr = err
+				break
+			}
+			timing := latency.Receive()
+			// Wait for a free slot before the update counts as received, so
+			// the offset doesn't move past updates that were never processed
+			var acquireErr error
+			watchdog.Idle(func() { acquireErr = inFlight.Acquire(ctx) })
+			if acquireErr != nil {
+				pollErr = acquireErr
+				break
+			}
+			received++
+			if update.UpdateId >= nextOffset {
+				nextOffset = update.UpdateId + 1
+			}
+
+			slot := inFlight.Slot()
+
+			go func(update Update) {
+				defer slot.Done()
+				defer timing.Done()
+				cid := correlationID(botInfo.Id, update)
+				logger := logger.With("correlation_id", cid, "update_id", update.UpdateId)
+				headers := sharder.Headers(updateHeaders(update, cid), update)
+				if cfg.IncludeBotMeta && cfg.BotMetaMode == BotMetaHeaders {
+					headers = botMeta.addHeaders(headers)
+				}
+				// Publications of the update go to one publisher worker in route order
+				publishKey := uint64(update.UpdateId)
+				record := updateLog.Start(update, logger)
+				defer record.Done()
+				timing.Start(logger)
+
+				p := runRecovered(func() {
+					if drop, reason := botFilter.Drop(update); drop {
+						record.Dropped(reason)
+						return
+					}
+					if drop, reason := chatLimiter.Drop(update); drop {
+						stats.RecordChatLimited()
+						record.Dropped(reason)
+						return
+					}
+
+					if migration := chatMigration(update); migration != nil {
+						logger.Warn("group migrated to supergroup, routes matching the old chat id will stop matching",
+							"old_chat_id", migration.OldChatID,
+							"new_chat_id", migration.NewChatID)
+						dest := migrationDest
+						dest.Headers = headers
+						publisher.PublishOrdered(publishKey, dest, migration)
+					}
+
+					if pollAggregator != nil {
+						if tally := pollAggregator.Track(update); tally != nil {
+							dest := pollDest
+							dest.Headers = headers
+							publisher.PublishOrdered(publishKey, dest, tally)
+						}
+					}
+
+					// Only routes reading enriched need it before routing
+					enriched := enricher.Enrich(ctx, update, nil, router.EnrichKinds())
+					if editTracker != nil {
+						enriched = enriched.withEdit(editTracker.Track(update))
+						stats.SetEditCache(editTracker.Usage())
+					}
+
+					timing.RouteStarted()
+					destinations, err := router.RouteEnriched(update, enriched)
+					timing.Routed()
+					if err != nil {
+						logger.Error("failed to route update", "error", err)
+						record.Failed(UpdateOutcomeRouteFailed, err)
+						return
+					}
+					record.Routed(destinations)
+					enriched = enricher.Enrich(ctx, update, enriched, destinationEnrichKinds(destinations, router.EnrichKinds()))
+
+					stringify := func(payload interface{}) interface{} {
+						if cfg.Publish.StringifyIDs {
+							payload = StringIDsPayload{Payload: payload}
+						}
+						return payload
+					}
+					// Routes get only the enrichment they asked for, routes asking
+					// for the same share the payload
+					payloads := make(map[string]interface{})
+					payloadFor := func(dest Destination, transcript *string) interface{} {
+						key := fmt.Sprint(dest.Enrich, transcript != nil)
+						payload, ok := payloads[key]
+						if !ok {
+							payload = stringify(encoder.encode(update, enriched.only(dest.Enrich), transcript))
+							payloads[key] = payload
+						}
+						return payload
+					}
+					payloadHeaders := schemaHeaders(headers, encoder.version())
+					// Routes with request_transcription share one transcript request
+					var transcript *string
+					transcribed := false
+					for _, dest := range destinations {
+						if !dest.RespondOnly {
+							destHeaders := timing.Headers(payloadHeaders)
+							if dest.Payload == PayloadFlatten {
+								// The flat event doesn't depend on the schema version
+								destHeaders = timing.Headers(headers)
+							}
+							if dest.Scrub {
+								destHeaders = scrubber.Headers(destHeaders)
+							}
+							dest.Headers = destHeaders
+							if msgIDs != nil {
+								if dest.Headers, err = msgIDs.Headers(destHeaders, update, dest.Subject); err != nil {
+									logger.Warn("publishing without message id", "subject", dest.Subject, "error", err)
+								}
+							}
+							var destPayload interface{}
+							if dest.Payload == PayloadFlatten {
+								var flat interface{} = flattenUpdate(update)
+								if wrappedBot != nil {
+									flat = wrappedBot.wrap(flat)
+								}
+								destPayload = stringify(flat)
+							} else if dest.Transcribe && transcriber != nil {
+								if !transcribed {
+									transcribed = true
+									if text, ok := transcriber.Transcribe(ctx, update); ok {
+										transcript = &text
+									}
+								}
+								destPayload = payloadFor(dest, transcript)
+							} else {
+								destPayload = payloadFor(dest, nil)
+							}
+							if dest.Scrub {
+								destPayload = scrubber.Wrap(destPayload)
+							}
+							if batcher.Accepts(dest) {
+								batcher.Add(dest, destPayload, timing.Publication(slot.Publication(record.Publication())))
+							} else {
+								publisher.PublishTracked(publishKey, dest, destPayload, timing.Publication(slot.Publication(record.Publication())))
+							}
+							if dest.ShadowSubject != "" {
+								shadow := dest.Shadow()
+								if msgIDs != nil {
+									if shadow.Headers, err = msgIDs.Headers(destHeaders, update, shadow.Subject); err != nil {
+										logger.Warn("publishing without message id", "subject", shadow.Subject, "error", err)
+									}
+								}
+								publisher.PublishShadow(publishKey, shadow, destPayload)
+							}
+						}
+						if dest.Response != nil {
+							responder.Respond(ctx, update, dest.Response)
+						}
+					}
+
+					// Stop the client spinner unless a request-reply route answers the query
+					if cfg.AutoAnswerCallbacks && update.CallbackQuery != nil && !hasRequest(destinations) {
+						if err := tgClient.AnswerCallbackQuery(ctx, update.CallbackQuery.Id, cfg.AutoAnswerCallbackText, false, ""); err != nil {
+							logger.Warn("failed to auto-answer callback query", "callback_query_id", update.CallbackQuery.Id, "error", err)
+						}
+					}
+
+					if paymentHandler != nil {
+						paymentHandler.Handle(ctx, update)
+					}
+				})
+				if p == nil {
+					return
+				}
+
+				logger.Error("panic while processing update", "panic", p.value, "stack", string(p.stack))
+				stats.RecordPanic()
+				record.Failed(UpdateOutcomePanic, fmt.Errorf("%v", p.value))
+				recovery.handle(update, headers, logger)
+			}(update)
+		}
+
+		stats.RecordReceived(received)
+		if pollErr == nil {
+			stats.RecordPoll(time.Now())
+			conflicts = 0
+		}
+		if pollLimit != nil && pollErr == nil {
+			size := limiter.LastUpdatesSize()
+			if next := pollLimit.Observe(received, size, time.Since(pollStart)); next != limit {
+				logger.Info("getUpdates limit changed", "limit", next, "previous", limit,
+					"received", received, "bytes", size)
+			}
+		}
+
+		// Update offset for next poll, updates received before a failed
+		// streamed poll are already being processed
+		if offsetStore != nil && nextOffset != offset {
+			saveCtx, saveCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := offsetStore.Save(saveCtx, nextOffset); err != nil {
+				logger.Warn("failed to save offset", "offset", nextOffset, "error", err)
+			}
+			saveCancel()
+		}
+		offset = nextOffset
+
+		if pollErr != nil {
+			// Check if this is a graceful shutdown
+			select {
+			case <-ctx.Done():
+				return shutdown("")
+			default:
+			}
+			if errors.Is(pollErr, ErrUnauthorized) {
+				// Token was revoked while running, retrying won't help
+				logger.Error("your TELEGRAM_BOT_TOKEN appears invalid, stopping")
+				if err := shutdown("unauthorized"); err != nil {
+					return err
+				}
+				return pollErr
+			}
+			if errors.Is(pollErr, ErrConflict) {
+				// Another poller or a webhook won't go away by itself,
+				// retry rarely and give up so the operator notices
+				conflicts++
+				if maxConflicts > 0 && conflicts >= maxConflicts {
+					logger.Error("getUpdates conflicts with another bot instance or a webhook, stopping",
+						"conflicts", conflicts, "error", pollErr, "hint", conflictHint(pollErr))
+					if err := shutdown("conflict"); err != nil {
+						return err
+					}
+					return fmt.Errorf("%w: %d in a row: %w", ErrTooManyConflicts, conflicts, pollErr)
+				}
+				delay := conflictRetryDelay(conflicts)
+				logger.Error("getUpdates conflicts with another bot instance or a webhook",
+					"conflicts", conflicts, "retry_in", delay, "error", pollErr, "hint", conflictHint(pollErr))
+				// The backoff is longer than the minimal watchdog timeout
+				watchdog.Idle(func() {
+					select {
+					case <-ctx.Done():
+					case <-time.After(delay):
+					}
+				})
+				continue
+			}
+			logPollError(logger, pollErr)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollRetryDelay(pollErr)):
+			}
+			continue
+		}
+
+		if received == 0 {
+			// No updates, optional short sleep before next poll
+			select {
+			case <-ctx.Done():
+			case <-time.After(cfg.Telegram.IdleSleep()):
+			}
+		}
+	}
+}
+
+// natsClientOptions returns the NATSClient options of the nats config section
+func natsClientOptions(cfg *NATSConfig, name string, logger *slog.Logger, onClosed, onReconnect func()) []NATSClientOption {
+	opts := []NATSClientOption{
+		WithNATSLogger(logger),
+		WithConnectionName(name),
+		WithPendingLimit(cfg.PendingLimitBytes),
+		WithNoEcho(cfg.NoEcho),
+		WithClosedHandler(onClosed),
+		WithReconnectHandler(onReconnect),
+	}
+	if cfg.Reconnect != nil {
+		opts = append(opts, WithReconnect(*cfg.Reconnect))
+	}
+	return opts
+}
+
+// jetStreamClientOptions is natsClientOptions for the JetStream engine
+func jetStreamClientOptions(cfg *NATSConfig, name string, logger *slog.Logger, onClosed, onReconnect func()) []JetStreamClientOption {
+	opts := []JetStreamClientOption{
+		WithJetStreamLogger(logger),
+		WithJetStreamConnectionName(name),
+		WithJetStreamPendingLimit(cfg.PendingLimitBytes),
+		WithJetStreamNoEcho(cfg.NoEcho),
+		WithJetStreamClosedHandler(onClosed),
+		WithJetStreamReconnectHandler(onReconnect),
+	}
+	if cfg.Reconnect != nil {
+		opts = append(opts, WithJetStreamReconnect(*cfg.Reconnect))
+	}
+	return opts
+}
+
+// pollUpdates yields one getUpdates batch. With stream set the response is
+// decoded incrementally, otherwise the whole batch is decoded first.
+// Malformed updates are yielded with *MalformedUpdateError. Clients other than
+// TelegramClient are polled with GetUpdatesWithTimeout.
+func pollUpdates(ctx context.Context, tgClient TelegramClientInterface, offset int64, stream bool) iter.Seq2[Update, error] {
+	timeout := int(DefaultPollTimeout.Seconds())
+	client, ok := tgClient.(*TelegramClient)
+	if !ok {
+		return func(yield func(Update, error) bool) {
+			updates, _, err := tgClient.GetUpdatesWithTimeout(ctx, offset, timeout)
+			if err != nil {
+				yield(Update{}, err)
+				return
+			}
+			for _, update := range updates {
+				if !yield(update, nil) {
+					return
+				}
+			}
+		}
+	}
+	if stream {
+		return client.StreamUpdates(ctx, offset, timeout)
+	}
+
+	return func(yield func(Update, error) bool) {
+		updates, malformed, err := client.fetchUpdates(ctx, offset, timeout)
+		if err != nil {
+			yield(Update{}, err)
+			return
+		}
+		for _, update := range updates {
+			if !yield(update, nil) {
+				return
+			}
+		}
+		for _, bad := range malformed {
+			if !yield(Update{UpdateId: bad.UpdateID}, bad) {
+				return
+			}
+		}
+	}
+}
+
+// hasRequest reports whether any destination uses request-reply
+func hasRequest(destinations []Destination) bool {
+	for _, dest := range destinations {
+		if dest.Request {
+			return true
+		}
+	}
+	return false
+}
+
+// logStats logs aggregated bridge counters
+func logStats(logger *slog.Logger, stats *Stats) {
+	snap := stats.Snapshot()
+	logger.Info("publish stats",
+		"received", snap.Received,
+		"chat_limit_dropped", snap.ChatLimitDropped,
+		"published", snap.Published,
+		"publish_failed", snap.PublishFailed,
+		"avg_publish_duration", snap.AvgPublishDuration,
+		"panics", snap.Panics,
+		"pending_bytes", snap.PendingBytes,
+		"pending_messages", snap.PendingMessages,
+		"edit_cache_entries", snap.EditCacheEntries,
+		"edit_cache_bytes", snap.EditCacheBytes)
+}
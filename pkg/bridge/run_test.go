@@ -0,0 +1,267 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBotClient answers getMe only
+type fakeBotClient struct {
+	TelegramClientInterface
+	getMeErr error
+}
+
+func (f *fakeBotClient) GetMe(ctx context.Context) (*gotgbot.User, error) {
+	if f.getMeErr != nil {
+		return nil, f.getMeErr
+	}
+	return &gotgbot.User{Id: 1, IsBot: true, Username: "test_bot"}, nil
+}
+
+// conflictBotClient fails every getUpdates with HTTP 409
+type conflictBotClient struct {
+	fakeBotClient
+	polls atomic.Int32
+}
+
+func (f *conflictBotClient) GetUpdatesWithTimeout(ctx context.Context, offset int64, timeout int) ([]Update, int64, error) {
+	f.polls.Add(1)
+	return nil, offset, &TelegramAPIError{Code: 409, Description: "Conflict: terminated by other getUpdates request"}
+}
+
+// failingBotClient fails every getUpdates with a network error
+type failingBotClient struct {
+	fakeBotClient
+	polled chan struct{}
+	once   sync.Once
+}
+
+func (f *failingBotClient) GetUpdatesWithTimeout(ctx context.Context, offset int64, timeout int) ([]Update, int64, error) {
+	f.once.Do(func() { close(f.polled) })
+	return nil, offset, errors.New("connection reset by peer")
+}
+
+// hangingBroker blocks Connect until ctx is done
+type hangingBroker struct {
+	mockBroker
+	connecting chan struct{}
+}
+
+func (b *hangingBroker) Connect(ctx context.Context) error {
+	close(b.connecting)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// hangingProbeBroker blocks Probe until ctx is done
+type hangingProbeBroker struct {
+	mockBroker
+	probing chan struct{}
+}
+
+func (b *hangingProbeBroker) Probe(ctx context.Context, roundTrip bool) error {
+	close(b.probing)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRun_Errors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	newConfig := func(t *testing.T) *Config {
+		cfg, err := LoadConfigStruct(&Config{
+			TelegramToken: "test-token",
+			NATS:          &NATSConfig{URL: "nats://127.0.0.1:1"},
+			Routes: []Route{{
+				Condition: "true",
+				Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.updates"},
+			}},
+		}, logger)
+		require.NoError(t, err)
+		return cfg
+	}
+
+	t.Run("invalid config", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.Mode = "some"
+
+		err := Run(t.Context(), cfg, Options{Logger: logger, Telegram: &fakeBotClient{}, Broker: &mockBroker{}})
+		assert.ErrorContains(t, err, "invalid configuration")
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		err := Run(t.Context(), newConfig(t), Options{Logger: logger, Telegram: &fakeBotClient{getMeErr: ErrUnauthorized}, Broker: &mockBroker{}})
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("too many conflicts", func(t *testing.T) {
+		cfg := newConfig(t)
+		maxConflicts := 1
+		cfg.Telegram.MaxConflicts = &maxConflicts
+		telegram := &conflictBotClient{}
+
+		err := Run(t.Context(), cfg, Options{Logger: logger, Telegram: telegram, Broker: &mockBroker{}})
+		assert.ErrorIs(t, err, ErrTooManyConflicts)
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.Equal(t, int32(1), telegram.polls.Load())
+	})
+
+	t.Run("canceled during startup", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		err := Run(ctx, newConfig(t), Options{Logger: logger, Telegram: &fakeBotClient{getMeErr: errors.New("connection refused")}, Broker: &mockBroker{}})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("canceled during poll backoff", func(t *testing.T) {
+		telegram := &failingBotClient{polled: make(chan struct{})}
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error, 1)
+		go func() {
+			done <- Run(ctx, newConfig(t), Options{Logger: logger, Telegram: telegram, Broker: &mockBroker{}})
+		}()
+
+		// The retry after a network error waits 5s, shutdown doesn't
+		<-telegram.polled
+		cancel()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("bridge waited for the poll backoff")
+		}
+	})
+
+	t.Run("canceled during startup probe", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.StartupProbe = true
+		broker := &hangingProbeBroker{probing: make(chan struct{})}
+		ctx, cancel := context.WithCancel(t.Context())
+		go func() {
+			<-broker.probing
+			cancel()
+		}()
+
+		start := time.Now()
+		err := Run(ctx, cfg, Options{Logger: logger, Telegram: &fakeBotClient{}, Broker: broker})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second, "the probe timeout must not hold up the shutdown")
+	})
+
+	t.Run("signal during startup", func(t *testing.T) {
+		broker := &hangingBroker{connecting: make(chan struct{})}
+		go func() {
+			<-broker.connecting
+			_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		}()
+
+		// ctx itself is not canceled, only the signal stops the startup
+		err := Run(t.Context(), newConfig(t), Options{Logger: logger, Telegram: &fakeBotClient{}, Broker: broker, HandleSignals: true})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestNATSClientOptions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	maxReconnects := 5
+	cfg := &NATSConfig{
+		URL:               "nats://localhost:4222",
+		PendingLimitBytes: 2048,
+		NoEcho:            true,
+		Reconnect:         &ReconnectConfig{MaxReconnects: &maxReconnects, WaitSec: 3, MaxWaitSec: 3},
+	}
+	onClosed := func() {}
+	onReconnect := func() {}
+
+	client := NewNATSClient(cfg.URL, natsClientOptions(cfg, "bridge@host", logger, onClosed, onReconnect)...)
+
+	assert.Same(t, logger, client.logger)
+	assert.Equal(t, "bridge@host", client.name)
+	assert.Equal(t, 2048, client.pendingLimit)
+	assert.True(t, client.noEcho)
+	assert.Equal(t, newReconnectPolicy(*cfg.Reconnect), client.reconnect)
+	assert.NotNil(t, client.onClosed)
+	assert.NotNil(t, client.onReconnect)
+
+	// Without the reconnect section the default policy stays
+	client = NewNATSClient(cfg.URL, natsClientOptions(&NATSConfig{}, DefaultNATSConnectionName, logger, nil, nil)...)
+	assert.Equal(t, defaultReconnectPolicy, client.reconnect)
+}
+
+func TestHasRequest(t *testing.T) {
+	assert.False(t, hasRequest(nil))
+	assert.False(t, hasRequest([]Destination{{Subject: "telegram.callbacks"}}))
+	assert.True(t, hasRequest([]Destination{{Subject: "telegram.callbacks"}, {Subject: "telegram.answers", Request: true}}))
+}
+
+func TestRun_ChatMigrations(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	srv := runEmbeddedNATS(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync(DefaultChatMigrationsSubject)
+	require.NoError(t, err)
+
+	// No chat_migrations_subject, the default one is used
+	cfg, err := LoadConfigStruct(&Config{
+		TelegramToken: "unused",
+		NATS:          &NATSConfig{URL: srv.ClientURL()},
+	}, logger)
+	require.NoError(t, err)
+
+	// Telegram sends migrate_to_chat_id to the old group and
+	// migrate_from_chat_id to the new supergroup
+	source := newUpdateSource()
+	source.updates = []Update{
+		{UpdateId: 1, Message: &gotgbot.Message{MessageId: 10, Chat: gotgbot.Chat{Id: -123, Type: "group"}, MigrateToChatId: -1001234567890}},
+		{UpdateId: 2, Message: &gotgbot.Message{MessageId: 1, Chat: gotgbot.Chat{Id: -1001234567890, Type: "supergroup"}, MigrateFromChatId: -123}},
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, cfg, Options{Logger: logger, Telegram: &haTelegram{source: source}})
+	}()
+
+	msg, err := sub.NextMsg(10 * time.Second)
+	require.NoError(t, err)
+	var migration ChatMigration
+	require.NoError(t, json.Unmarshal(msg.Data, &migration))
+	assert.Equal(t, ChatMigration{OldChatID: -123, NewChatID: -1001234567890}, migration)
+
+	// One event per migration
+	_, err = sub.NextMsg(500 * time.Millisecond)
+	assert.ErrorIs(t, err, nats.ErrTimeout)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("bridge didn't stop")
+	}
+}
@@ -0,0 +1,108 @@
+package bridge
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+)
+
+// PayloadSchemaHeader carries the payload schema version of update publications
+const PayloadSchemaHeader = "Tg-Bridge-Schema"
+
+const (
+	// PayloadSchemaV1 is the update itself with _enriched and transcript
+	// next to its fields, wrapped into {"bot", "update"} with bot_meta_mode: wrap
+	PayloadSchemaV1 = 1
+	// PayloadSchemaV2 is PayloadEnvelope
+	PayloadSchemaV2 = 2
+	// LatestPayloadSchema is published when payload_schema_version is not set
+	LatestPayloadSchema = PayloadSchemaV2
+)
+
+// PayloadEnvelope is the payload of schema version 2. The update is kept
+// apart from what the bridge attaches to it, so new attachments don't
+// collide with Bot API fields.
+type PayloadEnvelope struct {
+	SchemaVersion int         `json:"schema_version"`
+	Bot           *BotMeta    `json:"bot,omitempty"`
+	Update        Update      `json:"update"`
+	Enriched      *Enrichment `json:"enriched,omitempty"`
+	Transcript    *string     `json:"transcript,omitempty"`
+}
+
+// payloadEncoder builds the published payload of an update in one schema version
+type payloadEncoder interface {
+	// encode returns the payload of update, enriched and transcript are nil
+	// when the update wasn't enriched or transcribed
+	encode(update Update, enriched *Enrichment, transcript *string) interface{}
+	// version is the value of PayloadSchemaHeader
+	version() int
+}
+
+// newPayloadEncoder returns the encoder of schema version, bot is attached
+// to payloads when not nil (bot_meta_mode: wrap). Version 0 is the latest.
+func newPayloadEncoder(version int, bot *BotMeta) (payloadEncoder, error) {
+	switch version {
+	case 0, PayloadSchemaV2:
+		return payloadEncoderV2{bot: bot}, nil
+	case PayloadSchemaV1:
+		return payloadEncoderV1{bot: bot}, nil
+	default:
+		return nil, fmt.Errorf("payload_schema_version %d is not supported, use %d or %d", version, PayloadSchemaV1, PayloadSchemaV2)
+	}
+}
+
+type payloadEncoderV1 struct {
+	bot *BotMeta
+}
+
+func (e payloadEncoderV1) encode(update Update, enriched *Enrichment, transcript *string) interface{} {
+	payload := publishedUpdate(update, enriched)
+	if transcript != nil {
+		payload = transcribedUpdate(update, enriched, *transcript)
+	}
+	if e.bot != nil {
+		payload = e.bot.wrap(payload)
+	}
+	return payload
+}
+
+func (e payloadEncoderV1) version() int { return PayloadSchemaV1 }
+
+type payloadEncoderV2 struct {
+	bot *BotMeta
+}
+
+func (e payloadEncoderV2) encode(update Update, enriched *Enrichment, transcript *string) interface{} {
+	return PayloadEnvelope{
+		SchemaVersion: PayloadSchemaV2,
+		Bot:           e.bot,
+		Update:        update,
+		Enriched:      enriched,
+		Transcript:    transcript,
+	}
+}
+
+func (e payloadEncoderV2) version() int { return PayloadSchemaV2 }
+
+// isEnvelope reports whether a decoded payload keeps the update under
+// "update": bot wrapped version 1 payloads and version 2 envelopes
+func isEnvelope(root map[string]interface{}) bool {
+	if root["update"] == nil {
+		return false
+	}
+	_, bot := root["bot"]
+	_, versioned := root["schema_version"]
+	return bot || versioned
+}
+
+// schemaHeaders returns headers with PayloadSchemaHeader set to version,
+// headers is shared by the publications of an update, so it is copied
+func schemaHeaders(headers map[string]string, version int) map[string]string {
+	headers = maps.Clone(headers)
+	if headers == nil {
+		headers = make(map[string]string, 1)
+	}
+	headers[PayloadSchemaHeader] = strconv.Itoa(version)
+	return headers
+}
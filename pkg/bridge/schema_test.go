@@ -0,0 +1,130 @@
+package bridge
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata/payloads")
+
+// TestPayloadEncoder_Golden pins the published layout of every schema
+// version, a changed golden file means consumers of that version break
+func TestPayloadEncoder_Golden(t *testing.T) {
+	update := loadUpdateFixture(t, "message")
+	enriched := &Enrichment{Chat: &gotgbot.ChatFullInfo{Id: -1001234567890, Type: "supergroup", Title: "Shop chat"}}
+	transcript := "hello there"
+	bot := &BotMeta{ID: 42, Username: "bridge_bot"}
+
+	tests := []struct {
+		name       string
+		bot        *BotMeta
+		enriched   *Enrichment
+		transcript *string
+	}{
+		{name: "bare"},
+		{name: "enriched", enriched: enriched},
+		{name: "transcribed", enriched: enriched, transcript: &transcript},
+		{name: "bot_wrapped", bot: bot},
+	}
+
+	for _, version := range []int{PayloadSchemaV1, PayloadSchemaV2} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("v%d/%s", version, tt.name), func(t *testing.T) {
+				encoder, err := newPayloadEncoder(version, tt.bot)
+				require.NoError(t, err)
+				assert.Equal(t, version, encoder.version())
+
+				data, err := json.MarshalIndent(encoder.encode(update, tt.enriched, tt.transcript), "", "  ")
+				require.NoError(t, err)
+
+				path := filepath.Join("testdata", "payloads", fmt.Sprintf("v%d", version), tt.name+".json")
+				if *updateGolden {
+					require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+					require.NoError(t, os.WriteFile(path, append(data, '\n'), 0o644))
+				}
+				golden, err := os.ReadFile(path)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(golden), string(data))
+
+				// Replay reads payloads of every version back
+				decoded, err := decodeStoredUpdate(golden)
+				require.NoError(t, err)
+				assert.Equal(t, update.UpdateId, decoded.UpdateId)
+				assert.Equal(t, update.Message.Text, decoded.Message.Text)
+			})
+		}
+	}
+}
+
+func TestNewPayloadEncoder(t *testing.T) {
+	encoder, err := newPayloadEncoder(0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, LatestPayloadSchema, encoder.version())
+
+	_, err = newPayloadEncoder(3, nil)
+	assert.ErrorContains(t, err, "payload_schema_version 3 is not supported")
+}
+
+func TestPayloadEnvelope_StringIDs(t *testing.T) {
+	encoder, err := newPayloadEncoder(PayloadSchemaV2, &BotMeta{ID: 42})
+	require.NoError(t, err)
+	update := Update{UpdateId: 7, Message: &gotgbot.Message{MessageId: 3, Chat: gotgbot.Chat{Id: -100}}}
+
+	data, err := json.Marshal(StringIDsPayload{Payload: encoder.encode(update, nil, nil)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":2,"bot":{"id":"42","username":""},"update":{"update_id":"7","message":{"message_id":"3","date":0,"chat":{"id":"-100","type":""}}}}`, string(data))
+
+	decoded, err := decodeStoredUpdate(data)
+	require.NoError(t, err)
+	assert.Equal(t, update, decoded)
+	assert.Equal(t, update, unwrapUpdate(StringIDsPayload{Payload: encoder.encode(update, nil, nil)}))
+}
+
+func TestPayloadEnvelope_Scrub(t *testing.T) {
+	scrubber := newTestScrubber(t)
+	encoder, err := newPayloadEncoder(PayloadSchemaV2, nil)
+	require.NoError(t, err)
+
+	update := Update{UpdateId: 1, Message: &gotgbot.Message{From: &gotgbot.User{Id: 555, FirstName: "Alice"}}}
+	enriched := &Enrichment{ChatMember: &gotgbot.MergedChatMember{Status: "member", User: gotgbot.User{Id: 555, FirstName: "Alice"}}}
+
+	data, err := json.Marshal(scrubber.Wrap(encoder.encode(update, enriched, nil)))
+	require.NoError(t, err)
+
+	type user struct {
+		ID interface{} `json:"id"`
+	}
+	var envelope struct {
+		Update struct {
+			Message struct {
+				From user `json:"from"`
+			} `json:"message"`
+		} `json:"update"`
+		Enriched struct {
+			ChatMember struct {
+				User user `json:"user"`
+			} `json:"chat_member"`
+		} `json:"enriched"`
+	}
+	require.NoError(t, json.Unmarshal(data, &envelope))
+	assert.Equal(t, expectedHash("555"), envelope.Update.Message.From.ID)
+	assert.Equal(t, expectedHash("555"), envelope.Enriched.ChatMember.User.ID, "enrichment next to the update is scrubbed too")
+}
+
+func TestSchemaHeaders(t *testing.T) {
+	shared := map[string]string{CorrelationIDHeader: "42-1"}
+
+	headers := schemaHeaders(shared, PayloadSchemaV2)
+	assert.Equal(t, map[string]string{CorrelationIDHeader: "42-1", PayloadSchemaHeader: "2"}, headers)
+	assert.NotContains(t, shared, PayloadSchemaHeader, "shared headers are not modified")
+
+	assert.Equal(t, map[string]string{PayloadSchemaHeader: "1"}, schemaHeaders(nil, PayloadSchemaV1))
+}
@@ -0,0 +1,230 @@
+package bridge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+)
+
+// DefaultScrubReplacement replaces text matched by a scrub.redact pattern
+const DefaultScrubReplacement = "[redacted]"
+
+// scrubTextKeys are object keys whose string values scrub.redact applies to:
+// message texts, the previous text and diff of edit tracking and transcripts
+var scrubTextKeys = map[string]bool{
+	"text":          true,
+	"caption":       true,
+	"previous_text": true,
+	"removed":       true,
+	"added":         true,
+	"transcript":    true,
+}
+
+// Scrubber removes personal data from published updates: fields by path,
+// text matched by patterns and user ids, replaced by a salted hash. It works
+// on the marshaled payload, so routing still sees the original update.
+type Scrubber struct {
+	remove      [][]string
+	redact      []scrubRedaction
+	hashUserIDs bool
+	salt        []byte
+}
+
+type scrubRedaction struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// NewScrubber compiles the scrub config, it returns nil when cfg is nil
+func NewScrubber(cfg *ScrubConfig) (*Scrubber, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	s := &Scrubber{hashUserIDs: cfg.HashUserIDs, salt: []byte(cfg.Salt)}
+	for i, path := range cfg.Remove {
+		segments := strings.Split(path, ".")
+		for _, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("scrub.remove[%d]: invalid path '%s'", i, path)
+			}
+		}
+		s.remove = append(s.remove, segments)
+	}
+	for i, rule := range cfg.Redact {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("scrub.redact[%d]: invalid pattern: %w", i, err)
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = DefaultScrubReplacement
+		}
+		s.redact = append(s.redact, scrubRedaction{pattern: pattern, replacement: replacement})
+	}
+	if s.hashUserIDs && len(s.salt) == 0 {
+		return nil, fmt.Errorf("scrub.salt is required with scrub.hash_user_ids")
+	}
+	return s, nil
+}
+
+// ScrubbedPayload is published instead of the payload of routes with scrub
+type ScrubbedPayload struct {
+	Payload  interface{}
+	scrubber *Scrubber
+}
+
+// Wrap returns payload scrubbed when marshaled, a nil scrubber returns
+// payload as is
+func (s *Scrubber) Wrap(payload interface{}) interface{} {
+	if s == nil {
+		return payload
+	}
+	return ScrubbedPayload{Payload: payload, scrubber: s}
+}
+
+// MarshalJSON marshals Payload with the scrub rules applied. The bot identity
+// of bot_meta_mode: wrap is left as is.
+func (p ScrubbedPayload) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(p.Payload)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := decodeJSONTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := tree.(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	if isEnvelope(root) {
+		// The version 2 envelope keeps enrichment next to the update
+		if enriched, ok := root["enriched"]; ok && (len(p.scrubber.redact) > 0 || p.scrubber.hashUserIDs) {
+			p.scrubber.walk(enriched)
+		}
+		if update, ok := root["update"].(map[string]interface{}); ok {
+			root = update
+		}
+	}
+	p.scrubber.scrub(root)
+	return json.Marshal(tree)
+}
+
+// Headers returns headers with the user id of ReplyToUserIDHeader hashed,
+// headers is shared by the publications of an update, so it is copied
+func (s *Scrubber) Headers(headers map[string]string) map[string]string {
+	if s == nil || !s.hashUserIDs {
+		return headers
+	}
+	id, ok := headers[ReplyToUserIDHeader]
+	if !ok {
+		return headers
+	}
+	headers = maps.Clone(headers)
+	headers[ReplyToUserIDHeader] = s.hashID(id)
+	return headers
+}
+
+func (s *Scrubber) scrub(root map[string]interface{}) {
+	for _, path := range s.remove {
+		removePath(root, path)
+	}
+	if len(s.redact) > 0 || s.hashUserIDs {
+		s.walk(root)
+	}
+}
+
+// removePath deletes the field at path from node. "*" matches any key,
+// arrays are transparent: the path continues in every element.
+func removePath(node interface{}, path []string) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		key := path[0]
+		if len(path) == 1 {
+			if key == "*" {
+				clear(v)
+			} else {
+				delete(v, key)
+			}
+			return
+		}
+		if key == "*" {
+			for _, child := range v {
+				removePath(child, path[1:])
+			}
+			return
+		}
+		if child, ok := v[key]; ok {
+			removePath(child, path[1:])
+		}
+	case []interface{}:
+		for _, item := range v {
+			removePath(item, path)
+		}
+	}
+}
+
+// walk redacts texts and hashes user ids in node
+func (s *Scrubber) walk(node interface{}) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if s.hashUserIDs && isUserObject(v) {
+			v["id"] = s.hashID(v["id"])
+		}
+		// Private chat ids of payload: flatten events are user ids too
+		if id := v["chat_id"]; s.hashUserIDs && id != nil && v["chat_type"] == "private" {
+			v["chat_id"] = s.hashID(id)
+		}
+		for key, value := range v {
+			switch {
+			case s.hashUserIDs && key == "user_id":
+				v[key] = s.hashID(value)
+			case scrubTextKeys[key]:
+				if text, ok := value.(string); ok {
+					v[key] = s.redactText(text)
+				}
+			default:
+				s.walk(value)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			s.walk(item)
+		}
+	}
+}
+
+// isUserObject reports whether obj is a user or a private chat, whose id is
+// the id of the user
+func isUserObject(obj map[string]interface{}) bool {
+	if _, ok := obj["id"]; !ok {
+		return false
+	}
+	if _, ok := obj["is_bot"]; ok {
+		return true
+	}
+	return obj["type"] == "private"
+}
+
+func (s *Scrubber) redactText(text string) string {
+	for _, rule := range s.redact {
+		text = rule.pattern.ReplaceAllString(text, rule.replacement)
+	}
+	return text
+}
+
+// hashID returns the first 16 hex digits of HMAC-SHA256 of the decimal id,
+// so the same id and salt give the same hash across restarts and ids
+// published with publish.stringify_ids hash the same way
+func (s *Scrubber) hashID(id interface{}) string {
+	mac := hmac.New(sha256.New, s.salt)
+	mac.Write([]byte(str(id)))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
@@ -0,0 +1,215 @@
+package bridge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testScrubSalt = "pepper"
+
+// contactUpdate is a private message with a contact card and a phone number in the caption
+func contactUpdate() Update {
+	return Update{
+		UpdateId: 10,
+		Message: &gotgbot.Message{
+			MessageId: 5,
+			From:      &gotgbot.User{Id: 123456789, FirstName: "Ivan", LastName: "Petrov"},
+			Chat:      gotgbot.Chat{Id: 123456789, Type: "private", FirstName: "Ivan", LastName: "Petrov"},
+			Caption:   "call me at +7 999 123-45-67",
+			Contact:   &gotgbot.Contact{PhoneNumber: "+79991234567", FirstName: "Anna", UserId: 987654321},
+			Entities:  []gotgbot.MessageEntity{{Type: "text_mention", User: &gotgbot.User{Id: 555, FirstName: "Oleg", LastName: "Sidorov"}}},
+		},
+	}
+}
+
+func newTestScrubber(t *testing.T) *Scrubber {
+	scrubber, err := NewScrubber(&ScrubConfig{
+		Remove:      []string{"message.contact", "*.from.last_name", "message.chat.last_name", "message.entities.user.last_name"},
+		Redact:      []ScrubRedactConfig{{Pattern: `\+?\d[\d\s()-]{7,}\d`, Replacement: "[phone]"}},
+		HashUserIDs: true,
+		Salt:        testScrubSalt,
+	})
+	require.NoError(t, err)
+	return scrubber
+}
+
+func expectedHash(id string) string {
+	mac := hmac.New(sha256.New, []byte(testScrubSalt))
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func TestScrubber_Payload(t *testing.T) {
+	data, err := json.Marshal(newTestScrubber(t).Wrap(contactUpdate()))
+	require.NoError(t, err)
+
+	for _, scrubbed := range []string{"+79991234567", "999 123-45-67", "Petrov", "Sidorov", "123456789", "987654321", `"id":555`} {
+		assert.NotContains(t, string(data), scrubbed)
+	}
+
+	var published map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &published))
+	message := published["message"].(map[string]interface{})
+	assert.NotContains(t, message, "contact")
+	assert.Equal(t, "call me at [phone]", message["caption"])
+	assert.Equal(t, expectedHash("123456789"), message["from"].(map[string]interface{})["id"])
+	assert.Equal(t, "Ivan", message["from"].(map[string]interface{})["first_name"])
+	assert.Equal(t, expectedHash("123456789"), message["chat"].(map[string]interface{})["id"], "private chat id is the user id")
+	assert.Equal(t, expectedHash("555"), message["entities"].([]interface{})[0].(map[string]interface{})["user"].(map[string]interface{})["id"])
+	assert.Equal(t, float64(5), message["message_id"], "other ids are kept")
+}
+
+func TestScrubber_EditAndTranscript(t *testing.T) {
+	scrubber := newTestScrubber(t)
+	update := Update{
+		UpdateId: 11,
+		EditedMessage: &gotgbot.Message{
+			MessageId: 5,
+			Chat:      gotgbot.Chat{Id: -100, Type: "group"},
+			Text:      "call me at +7 999 765-43-21",
+		},
+	}
+	enriched := &Enrichment{Edit: &EditInfo{
+		PreviousText: "call me at +7 999 123-45-67",
+		Diff:         diffText("call me at +7 999 123-45-67", "call me at +7 999 765-43-21"),
+	}}
+
+	payloads := map[string]interface{}{
+		"edit":       publishedUpdate(update, enriched),
+		"transcript": transcribedUpdate(update, enriched, "my number is +7 999 000-11-22"),
+	}
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(scrubber.Wrap(payload))
+			require.NoError(t, err)
+
+			var scrubbed struct {
+				EditedMessage struct {
+					Text string `json:"text"`
+				} `json:"edited_message"`
+				Enriched struct {
+					Edit EditInfo `json:"edit"`
+				} `json:"_enriched"`
+				Transcript string `json:"transcript"`
+			}
+			require.NoError(t, json.Unmarshal(data, &scrubbed))
+			assert.Equal(t, "call me at [phone]", scrubbed.EditedMessage.Text)
+			assert.Equal(t, "call me at [phone]", scrubbed.Enriched.Edit.PreviousText)
+			assert.Equal(t, "[phone]", scrubbed.Enriched.Edit.Diff.Removed)
+			assert.Equal(t, "[phone]", scrubbed.Enriched.Edit.Diff.Added)
+			if name == "transcript" {
+				assert.Equal(t, "my number is [phone]", scrubbed.Transcript)
+			}
+		})
+	}
+}
+
+func TestScrubber_HashStable(t *testing.T) {
+	first, err := json.Marshal(newTestScrubber(t).Wrap(contactUpdate()))
+	require.NoError(t, err)
+	// A scrubber created after a restart with the same salt
+	second, err := json.Marshal(newTestScrubber(t).Wrap(contactUpdate()))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(first), string(second))
+
+	other, err := NewScrubber(&ScrubConfig{HashUserIDs: true, Salt: "another"})
+	require.NoError(t, err)
+	assert.NotEqual(t, expectedHash("123456789"), other.hashID(int64(123456789)))
+
+	// Ids published with stringify_ids hash the same way
+	stringified, err := json.Marshal(newTestScrubber(t).Wrap(StringIDsPayload{Payload: contactUpdate()}))
+	require.NoError(t, err)
+	assert.Contains(t, string(stringified), `"id":"`+expectedHash("123456789")+`"`)
+}
+
+func TestScrubber_BotWrapped(t *testing.T) {
+	payload := BotMeta{ID: 42, Username: "bridge_bot"}.wrap(contactUpdate())
+	data, err := json.Marshal(newTestScrubber(t).Wrap(payload))
+	require.NoError(t, err)
+
+	var published map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &published))
+	assert.Equal(t, map[string]interface{}{"id": float64(42), "username": "bridge_bot"}, published["bot"])
+	assert.NotContains(t, string(data), "Petrov")
+	assert.NotContains(t, string(data), "123456789")
+}
+
+func TestScrubber_Headers(t *testing.T) {
+	scrubber := newTestScrubber(t)
+	shared := map[string]string{CorrelationIDHeader: "42-10", ReplyToUserIDHeader: "123456789"}
+
+	headers := scrubber.Headers(shared)
+	assert.Equal(t, expectedHash("123456789"), headers[ReplyToUserIDHeader])
+	assert.Equal(t, "123456789", shared[ReplyToUserIDHeader], "shared headers are not modified")
+
+	var nilScrubber *Scrubber
+	assert.Equal(t, shared, nilScrubber.Headers(shared))
+	assert.Equal(t, "payload", nilScrubber.Wrap("payload"))
+}
+
+func TestNewScrubber_Invalid(t *testing.T) {
+	_, err := NewScrubber(&ScrubConfig{Redact: []ScrubRedactConfig{{Pattern: "("}}})
+	assert.ErrorContains(t, err, "scrub.redact[0]: invalid pattern")
+
+	_, err = NewScrubber(&ScrubConfig{Remove: []string{"message..contact"}})
+	assert.ErrorContains(t, err, "scrub.remove[0]: invalid path")
+
+	_, err = NewScrubber(&ScrubConfig{HashUserIDs: true})
+	assert.ErrorContains(t, err, "scrub.salt is required")
+}
+
+func TestScrubber_PublishedBytes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	srv := runEmbeddedNATS(t)
+	sub, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer sub.Close()
+	received := make(chan *nats.Msg, 1)
+	_, err = sub.ChanSubscribe("telegram.contacts", received)
+	require.NoError(t, err)
+	require.NoError(t, sub.Flush())
+
+	client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger))
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	scrubber := newTestScrubber(t)
+	update := contactUpdate()
+	headers := scrubber.Headers(updateHeaders(update, correlationID(42, update)))
+	dest := Destination{Subject: "telegram.contacts", Headers: headers}
+	require.NoError(t, client.Publish(context.Background(), dest, scrubber.Wrap(update)))
+
+	select {
+	case msg := <-received:
+		for _, scrubbed := range []string{"+79991234567", "Petrov", "123456789", "987654321"} {
+			assert.NotContains(t, string(msg.Data), scrubbed)
+		}
+		assert.NotContains(t, msg.Header.Get(ReplyToUserIDHeader), "123456789")
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestScrubber_Flatten(t *testing.T) {
+	data, err := json.Marshal(newTestScrubber(t).Wrap(flattenUpdate(contactUpdate())))
+	require.NoError(t, err)
+
+	var published map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &published))
+	assert.Equal(t, expectedHash("123456789"), published["user_id"])
+	assert.Equal(t, expectedHash("123456789"), published["chat_id"], "private chat id is the user id")
+	assert.Equal(t, "call me at [phone]", published["text"])
+}
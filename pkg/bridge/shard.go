@@ -0,0 +1,163 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"strconv"
+)
+
+// ShardHeader carries the shard of the update when sharding is configured
+const ShardHeader = "Tg-Shard"
+
+// ShardSubjectInfix separates a subject and the shard appended with sharding.suffix
+const ShardSubjectInfix = ".shard."
+
+// ShardKey selects the id updates are sharded by
+type ShardKey string
+
+const (
+	// ShardKeyChatID shards by chat, falling back to the sender for updates
+	// without a chat, so a user's inline queries share the shard of their
+	// private chat
+	ShardKeyChatID ShardKey = "chat_id"
+	// ShardKeyUserID shards by the sender of the update
+	ShardKeyUserID ShardKey = "user_id"
+)
+
+// shardOf maps id to one of n shards: the 64-bit FNV-1a hash of the decimal
+// id modulo n. Consumers may compute shards the same way, so the algorithm
+// must never change.
+func shardOf(id int64, n int) int {
+	h := fnv.New64a()
+	h.Write(strconv.AppendInt(nil, id, 10))
+	return int(h.Sum64() % uint64(n))
+}
+
+// shardID returns the id update is sharded by, 0 when the update has none
+func shardID(update Update, key ShardKey) int64 {
+	if key == ShardKeyChatID {
+		if chat := updateChat(update); chat != nil {
+			return chat.Id
+		}
+	}
+	if sender := flatSender(update); sender != nil {
+		return sender.Id
+	}
+	return 0
+}
+
+// shard is the shard(value, n) expr helper: shardOf of the id or of the
+// chat id of an update, so both forms agree with Tg-Shard
+func shard(value interface{}, n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("shard: n must be > 0, got %d", n)
+	}
+	if update, ok := value.(Update); ok {
+		return shardOf(shardID(update, ShardKeyChatID), n), nil
+	}
+	id, err := shardValueID(value)
+	if err != nil {
+		return 0, fmt.Errorf("shard: %w", err)
+	}
+	return shardOf(id, n), nil
+}
+
+// shardValueID converts an id passed to shard to int64: integers, json.Number
+// and decimal strings from stringified ids
+func shardValueID(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case json.Number:
+		id, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("id %q is not an integer", v)
+		}
+		return id, nil
+	case string:
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("id %q is not an integer", v)
+		}
+		return id, nil
+	case float64:
+		// Ids from decoded JSON without json.Number, exact only up to 2^53
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("id %v is not an integer", v)
+		}
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("expected an update or an id, got %T", value)
+	}
+}
+
+// Sharder assigns updates to shards by sharding.key and appends the shard
+// to destination subjects with sharding.suffix
+type Sharder struct {
+	key    ShardKey
+	shards int
+	suffix bool
+}
+
+// NewSharder returns nil when sharding is not configured
+func NewSharder(cfg *ShardingConfig) *Sharder {
+	if cfg == nil {
+		return nil
+	}
+	return &Sharder{key: cfg.Key, shards: cfg.Shards, suffix: cfg.Suffix}
+}
+
+// Shard returns the shard of update
+func (s *Sharder) Shard(update Update) int {
+	return shardOf(shardID(update, s.key), s.shards)
+}
+
+// Headers returns headers with the shard of update, headers is shared by
+// the publications of an update, so it is copied
+func (s *Sharder) Headers(headers map[string]string, update Update) map[string]string {
+	if s == nil {
+		return headers
+	}
+	headers = maps.Clone(headers)
+	if headers == nil {
+		headers = make(map[string]string, 1)
+	}
+	headers[ShardHeader] = strconv.Itoa(s.Shard(update))
+	return headers
+}
+
+// apply appends the shard of update to subjects of dests with
+// sharding.suffix. Requests keep their subject, responders scale with
+// queue groups.
+func (s *Sharder) apply(update Update, dests []Destination) {
+	if s == nil || !s.suffix {
+		return
+	}
+	suffix := ShardSubjectInfix + strconv.Itoa(s.Shard(update))
+	for i := range dests {
+		dest := &dests[i]
+		if dest.Request || dest.RespondOnly || dest.Subject == "" {
+			continue
+		}
+		dest.Subject += suffix
+		if dest.ShadowSubject != "" {
+			dest.ShadowSubject += suffix
+		}
+	}
+}
+
+// shardSubjects returns subject with every shard appended
+func (s *Sharder) shardSubjects(subject string) []string {
+	subjects := make([]string, s.shards)
+	for i := range subjects {
+		subjects[i] = subject + ShardSubjectInfix + strconv.Itoa(i)
+	}
+	return subjects
+}
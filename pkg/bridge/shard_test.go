@@ -0,0 +1,202 @@
+package bridge
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShardOf_Pinned fails when a shard assignment changes: consumers keep
+// per-chat state by shard, so the algorithm is part of the contract
+func TestShardOf_Pinned(t *testing.T) {
+	tests := []struct {
+		id   int64
+		n    int
+		want int
+	}{
+		{id: 0, n: 8, want: 7},
+		{id: 1, n: 8, want: 4},
+		{id: 555, n: 8, want: 6},
+		{id: 123456789, n: 8, want: 4},
+		{id: -1001234567890, n: 8, want: 2},
+		{id: 9007199254740993, n: 8, want: 1},
+		{id: 555, n: 16, want: 14},
+		{id: -1001234567890, n: 16, want: 10},
+		{id: 555, n: 3, want: 0},
+		{id: -1001234567890, n: 3, want: 2},
+		{id: 555, n: 1, want: 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, shardOf(tt.id, tt.n), "id %d, %d shards", tt.id, tt.n)
+	}
+}
+
+// TestShardOf_FNV1a documents the algorithm for consumers computing shards
+// themselves: 64-bit FNV-1a over the decimal id, modulo the shard count
+func TestShardOf_FNV1a(t *testing.T) {
+	fnv1a := func(data string) uint64 {
+		h := uint64(14695981039346656037)
+		for i := range len(data) {
+			h ^= uint64(data[i])
+			h *= 1099511628211
+		}
+		return h
+	}
+
+	for _, id := range []int64{0, 42, -100200, -1001234567890, 1 << 62} {
+		assert.Equal(t, int(fnv1a(strconv.FormatInt(id, 10))%32), shardOf(id, 32), "id %d", id)
+	}
+}
+
+func TestShardID(t *testing.T) {
+	group := Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100200}, From: &gotgbot.User{Id: 555}}}
+	inline := Update{InlineQuery: &gotgbot.InlineQuery{From: gotgbot.User{Id: 555}}}
+
+	assert.Equal(t, int64(-100200), shardID(group, ShardKeyChatID))
+	assert.Equal(t, int64(555), shardID(group, ShardKeyUserID))
+	assert.Equal(t, int64(555), shardID(inline, ShardKeyChatID), "updates without a chat fall back to the sender")
+	assert.Equal(t, int64(0), shardID(Update{Poll: &gotgbot.Poll{}}, ShardKeyChatID))
+}
+
+func TestShard_Expr(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{{
+		Condition: "update.Message != nil",
+		Subject:   &RouteSubject{Type: SubjectTypeExpr, Value: `sprintf("telegram.messages.%d", shard(update, 8))`},
+	}}
+	router, err := NewRouter(routes, "first", 1, logger)
+	require.NoError(t, err)
+
+	dests, err := router.Route(Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -1001234567890}}})
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.messages.2", dests[0].Subject)
+
+	_, err = shard(Update{}, 0)
+	assert.ErrorContains(t, err, "shard: n must be > 0")
+}
+
+func TestShard_ID(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		id    int64
+	}{
+		{name: "int", value: 555, id: 555},
+		{name: "int64", value: int64(9007199254740993), id: 9007199254740993},
+		{name: "negative", value: int64(-1001234567890), id: -1001234567890},
+		{name: "json.Number", value: json.Number("-1009007199254740993"), id: -1009007199254740993},
+		{name: "string", value: "-100200", id: -100200},
+		{name: "float64", value: float64(-100200), id: -100200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shard(tt.value, 16)
+			require.NoError(t, err)
+			assert.Equal(t, shardOf(tt.id, 16), got)
+		})
+	}
+
+	for _, value := range []interface{}{json.Number("1.5"), "abc", 1.5, true, nil} {
+		_, err := shard(value, 16)
+		assert.Error(t, err, "%v", value)
+	}
+}
+
+func TestShard_ExprID(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// An id and its update land in the same shard
+	routes := []Route{{
+		Condition: "update.Message != nil",
+		Subject:   &RouteSubject{Type: SubjectTypeExpr, Value: `sprintf("telegram.messages.%d.%d", shard(update.Message.Chat.Id, 16), shard(update, 16))`},
+	}}
+	router, err := NewRouter(routes, "first", 1, logger)
+	require.NoError(t, err)
+
+	dests, err := router.Route(Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -1001234567890}}})
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.messages.10.10", dests[0].Subject)
+}
+
+func TestSharder(t *testing.T) {
+	assert.Nil(t, NewSharder(nil))
+
+	update := Update{UpdateId: 1, Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -1001234567890}}}
+	sharder := NewSharder(&ShardingConfig{Key: ShardKeyChatID, Shards: 8, Suffix: true})
+	assert.Equal(t, 2, sharder.Shard(update))
+
+	t.Run("headers", func(t *testing.T) {
+		shared := map[string]string{CorrelationIDHeader: "42-1"}
+		headers := sharder.Headers(shared, update)
+		assert.Equal(t, map[string]string{CorrelationIDHeader: "42-1", ShardHeader: "2"}, headers)
+		assert.NotContains(t, shared, ShardHeader, "shared headers are not modified")
+
+		var none *Sharder
+		assert.Equal(t, shared, none.Headers(shared, update))
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		dests := []Destination{
+			{Subject: "telegram.messages", ShadowSubject: "telegram.v2"},
+			{Subject: "telegram.commands", Request: true},
+			{RespondOnly: true},
+		}
+		sharder.apply(update, dests)
+		assert.Equal(t, []Destination{
+			{Subject: "telegram.messages.shard.2", ShadowSubject: "telegram.v2.shard.2"},
+			{Subject: "telegram.commands", Request: true},
+			{RespondOnly: true},
+		}, dests)
+	})
+
+	t.Run("without suffix", func(t *testing.T) {
+		dests := []Destination{{Subject: "telegram.messages"}}
+		NewSharder(&ShardingConfig{Key: ShardKeyChatID, Shards: 8}).apply(update, dests)
+		assert.Equal(t, "telegram.messages", dests[0].Subject)
+	})
+
+	assert.Equal(t, []string{"telegram.a.shard.0", "telegram.a.shard.1"},
+		NewSharder(&ShardingConfig{Key: ShardKeyChatID, Shards: 2}).shardSubjects("telegram.a"))
+}
+
+func TestRouter_SetSharder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{{
+		Condition: "update.EditedMessage != nil",
+		Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"},
+	}}
+	router, err := NewRouter(routes, "first", 1, logger)
+	require.NoError(t, err)
+	router.SetUnmatchedSubject("telegram.unmatched")
+	router.SetEditSubjects(EditSubjectsRedirect)
+	router.SetSharder(NewSharder(&ShardingConfig{Key: ShardKeyUserID, Shards: 8, Suffix: true}))
+
+	sender := &gotgbot.User{Id: 555}
+	dests, err := router.Route(Update{EditedMessage: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100}, From: sender}})
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.messages.edits.shard.6", dests[0].Subject, "the shard follows the edit suffix")
+
+	dests, err = router.Route(Update{Message: &gotgbot.Message{Chat: gotgbot.Chat{Id: -100}, From: sender}})
+	require.NoError(t, err)
+	require.Len(t, dests, 1)
+	assert.Equal(t, "telegram.unmatched.shard.6", dests[0].Subject)
+}
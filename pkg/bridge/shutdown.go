@@ -0,0 +1,63 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ForcedShutdownExitCode is the exit code used when graceful shutdown is cut short
+const ForcedShutdownExitCode = 4
+
+// ShutdownGuard bounds graceful shutdown: once shutdown starts, the process
+// is force-exited after timeout or on a second signal
+type ShutdownGuard struct {
+	timeout time.Duration
+	// pending returns log attributes describing work still in progress
+	pending func() []any
+	exit    func(code int)
+	logger  *slog.Logger
+}
+
+// NewShutdownGuard creates a new ShutdownGuard
+func NewShutdownGuard(timeout time.Duration, logger *slog.Logger) *ShutdownGuard {
+	return &ShutdownGuard{
+		timeout: timeout,
+		pending: func() []any { return nil },
+		exit:    os.Exit,
+		logger:  logger,
+	}
+}
+
+// SetPendingReporter sets the function reporting unfinished work on forced exit
+func (g *ShutdownGuard) SetPendingReporter(pending func() []any) {
+	g.pending = pending
+}
+
+// Run waits for the first signal, cancels the bridge context and then waits
+// for done. Shutdown started by other means (ctx canceled) is bounded too.
+// A second signal or the timeout exits the process.
+func (g *ShutdownGuard) Run(ctx context.Context, cancel context.CancelFunc, signals <-chan os.Signal, done <-chan struct{}) {
+	select {
+	case <-signals:
+		g.logger.Info("shutting down...", "timeout", g.timeout)
+		cancel()
+	case <-ctx.Done():
+	case <-done:
+		return
+	}
+
+	timer := time.NewTimer(g.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case sig := <-signals:
+		g.logger.Warn("second signal received, exiting immediately", append([]any{"signal", sig.String()}, g.pending()...)...)
+		g.exit(ForcedShutdownExitCode)
+	case <-timer.C:
+		g.logger.Error("graceful shutdown timed out, exiting", append([]any{"timeout", g.timeout}, g.pending()...)...)
+		g.exit(ForcedShutdownExitCode)
+	}
+}
@@ -0,0 +1,99 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownGuard_Run(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	// run starts the guard and returns a channel receiving the exit code
+	run := func(g *ShutdownGuard, ctx context.Context, cancel context.CancelFunc, signals chan os.Signal, done chan struct{}) (<-chan int, <-chan struct{}) {
+		codes := make(chan int, 1)
+		g.exit = func(code int) { codes <- code }
+
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			g.Run(ctx, cancel, signals, done)
+		}()
+		return codes, finished
+	}
+
+	t.Run("graceful shutdown in time", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signals := make(chan os.Signal, 2)
+		done := make(chan struct{})
+
+		codes, finished := run(NewShutdownGuard(time.Minute, logger), ctx, cancel, signals, done)
+
+		signals <- syscall.SIGTERM
+		<-ctx.Done()
+		close(done)
+
+		<-finished
+		assert.Empty(t, codes)
+	})
+
+	t.Run("second signal exits immediately", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signals := make(chan os.Signal, 2)
+
+		codes, finished := run(NewShutdownGuard(time.Minute, logger), ctx, cancel, signals, make(chan struct{}))
+
+		signals <- syscall.SIGTERM
+		<-ctx.Done()
+		signals <- syscall.SIGINT
+
+		<-finished
+		require.Len(t, codes, 1)
+		assert.Equal(t, ForcedShutdownExitCode, <-codes)
+	})
+
+	t.Run("timeout exits and reports pending work", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		reported := false
+		g := NewShutdownGuard(10*time.Millisecond, logger)
+		g.SetPendingReporter(func() []any {
+			reported = true
+			return []any{"publish_queue", 3}
+		})
+
+		codes, finished := run(g, ctx, cancel, make(chan os.Signal, 2), make(chan struct{}))
+
+		// Shutdown started without a signal, e.g. by the panic limit
+		cancel()
+
+		<-finished
+		require.Len(t, codes, 1)
+		assert.Equal(t, ForcedShutdownExitCode, <-codes)
+		assert.True(t, reported)
+	})
+
+	t.Run("done before shutdown", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan struct{})
+
+		codes, finished := run(NewShutdownGuard(time.Minute, logger), ctx, cancel, make(chan os.Signal, 2), done)
+		close(done)
+
+		<-finished
+		assert.Empty(t, codes)
+		assert.NoError(t, ctx.Err())
+	})
+}
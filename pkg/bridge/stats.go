@@ -0,0 +1,200 @@
+package bridge
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats aggregates bridge counters. All methods are safe for concurrent use.
+type Stats struct {
+	published       atomic.Int64
+	publishFailed   atomic.Int64
+	publishDuration atomic.Int64
+	panics          atomic.Int64
+	pendingBytes    atomic.Int64
+	pendingMessages atomic.Int64
+	editEntries     atomic.Int64
+	editBytes       atomic.Int64
+	received        atomic.Int64
+	chatLimited     atomic.Int64
+	// lastPoll is the time of the last successful getUpdates in Unix nanoseconds
+	lastPoll   atomic.Int64
+	configHash atomic.Pointer[string]
+
+	updateLatency  latencyHistogram
+	routeLatency   latencyHistogram
+	publishLatency latencyHistogram
+}
+
+// StatsSnapshot is a point-in-time copy of Stats counters
+type StatsSnapshot struct {
+	Published          int64         `json:"published"`
+	PublishFailed      int64         `json:"publish_failed"`
+	AvgPublishDuration time.Duration `json:"avg_publish_duration"`
+	Panics             int64         `json:"panics"`
+	PendingBytes       int64         `json:"pending_bytes"`
+	PendingMessages    int64         `json:"pending_messages"`
+	EditCacheEntries   int64         `json:"edit_cache_entries"`
+	EditCacheBytes     int64         `json:"edit_cache_bytes"`
+	Received           int64         `json:"received"`
+	ChatLimitDropped   int64         `json:"chat_limit_dropped"`
+	LastPoll           time.Time     `json:"last_poll,omitzero"`
+	// ConfigHash is ConfigHash of the running configuration, so dashboards
+	// can spot instances with a different config
+	ConfigHash string `json:"config_hash,omitempty"`
+	// UpdateLatency is the time from receiving an update to the end of its
+	// processing and publications
+	UpdateLatency  LatencySnapshot `json:"update_latency,omitzero"`
+	RouteLatency   LatencySnapshot `json:"route_latency,omitzero"`
+	PublishLatency LatencySnapshot `json:"publish_latency,omitzero"`
+}
+
+// latencyBucketsMs are the upper bounds of latency histogram buckets
+var latencyBucketsMs = [...]int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// latencyHistogram counts latencies by latencyBucketsMs, the last count is
+// for latencies above all bounds
+type latencyHistogram struct {
+	counts [len(latencyBucketsMs) + 1]atomic.Int64
+	sum    atomic.Int64
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	ms := d.Milliseconds()
+	i := 0
+	for i < len(latencyBucketsMs) && ms > latencyBucketsMs[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *latencyHistogram) snapshot() LatencySnapshot {
+	var snap LatencySnapshot
+	var cumulative int64
+	buckets := make([]LatencyBucket, len(latencyBucketsMs))
+	for i, le := range latencyBucketsMs {
+		cumulative += h.counts[i].Load()
+		buckets[i] = LatencyBucket{LeMs: le, Count: cumulative}
+	}
+	snap.Count = cumulative + h.counts[len(latencyBucketsMs)].Load()
+	if snap.Count == 0 {
+		return LatencySnapshot{}
+	}
+	snap.Buckets = buckets
+	snap.Avg = time.Duration(h.sum.Load() / snap.Count)
+	return snap
+}
+
+// LatencySnapshot is a cumulative latency histogram, Count includes
+// latencies above the last bucket
+type LatencySnapshot struct {
+	Count   int64           `json:"count"`
+	Avg     time.Duration   `json:"avg"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket is the number of latencies of at most LeMs milliseconds
+type LatencyBucket struct {
+	LeMs  int64 `json:"le_ms"`
+	Count int64 `json:"count"`
+}
+
+// NewStats creates a new Stats
+func NewStats() *Stats {
+	return &Stats{}
+}
+
+// RecordPublish updates counters from a publish result.
+// It can be used as a PublishResultHandler.
+func (s *Stats) RecordPublish(result PublishResult) {
+	if result.Success {
+		s.published.Add(1)
+	} else {
+		s.publishFailed.Add(1)
+	}
+	s.publishDuration.Add(int64(result.Duration))
+}
+
+// RecordPanic counts a panic recovered while processing an update
+func (s *Stats) RecordPanic() {
+	s.panics.Add(1)
+}
+
+// SetPending records the last observed size of not yet published data
+func (s *Stats) SetPending(bytes, messages int) {
+	s.pendingBytes.Store(int64(bytes))
+	s.pendingMessages.Store(int64(messages))
+}
+
+// SetEditCache records the last observed size of the edit tracking cache
+func (s *Stats) SetEditCache(entries int, bytes int64) {
+	s.editEntries.Store(int64(entries))
+	s.editBytes.Store(bytes)
+}
+
+// RecordReceived counts updates received from Telegram
+func (s *Stats) RecordReceived(n int) {
+	s.received.Add(int64(n))
+}
+
+// RecordChatLimited counts an update dropped by chat_limit
+func (s *Stats) RecordChatLimited() {
+	s.chatLimited.Add(1)
+}
+
+// RecordPoll records the time of a successful getUpdates call
+func (s *Stats) RecordPoll(t time.Time) {
+	s.lastPoll.Store(t.UnixNano())
+}
+
+// SetConfigHash sets the config hash reported with the counters
+func (s *Stats) SetConfigHash(hash string) {
+	s.configHash.Store(&hash)
+}
+
+// RecordUpdateLatency records the total latency of an update
+func (s *Stats) RecordUpdateLatency(d time.Duration) {
+	s.updateLatency.record(d)
+}
+
+// RecordRouteLatency records the time spent routing an update
+func (s *Stats) RecordRouteLatency(d time.Duration) {
+	s.routeLatency.record(d)
+}
+
+// RecordPublishLatency records the time from routing an update to the end
+// of its publications
+func (s *Stats) RecordPublishLatency(d time.Duration) {
+	s.publishLatency.record(d)
+}
+
+// Snapshot returns current counter values
+func (s *Stats) Snapshot() StatsSnapshot {
+	snap := StatsSnapshot{
+		Published:        s.published.Load(),
+		PublishFailed:    s.publishFailed.Load(),
+		Panics:           s.panics.Load(),
+		PendingBytes:     s.pendingBytes.Load(),
+		PendingMessages:  s.pendingMessages.Load(),
+		EditCacheEntries: s.editEntries.Load(),
+		EditCacheBytes:   s.editBytes.Load(),
+		Received:         s.received.Load(),
+		ChatLimitDropped: s.chatLimited.Load(),
+		UpdateLatency:    s.updateLatency.snapshot(),
+		RouteLatency:     s.routeLatency.snapshot(),
+		PublishLatency:   s.publishLatency.snapshot(),
+	}
+	if lastPoll := s.lastPoll.Load(); lastPoll != 0 {
+		snap.LastPoll = time.Unix(0, lastPoll).UTC()
+	}
+	if hash := s.configHash.Load(); hash != nil {
+		snap.ConfigHash = *hash
+	}
+
+	if total := snap.Published + snap.PublishFailed; total > 0 {
+		snap.AvgPublishDuration = time.Duration(s.publishDuration.Load() / total)
+	}
+
+	return snap
+}
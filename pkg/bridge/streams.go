@@ -0,0 +1,205 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	streamRetentions = map[string]jetstream.RetentionPolicy{
+		"limits":    jetstream.LimitsPolicy,
+		"interest":  jetstream.InterestPolicy,
+		"workqueue": jetstream.WorkQueuePolicy,
+	}
+	streamStorages = map[string]jetstream.StorageType{
+		"file":   jetstream.FileStorage,
+		"memory": jetstream.MemoryStorage,
+	}
+)
+
+// validate checks the stream declared in nats.jetstream.stream
+func (s *StreamSpec) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("nats.jetstream.stream.name is required")
+	}
+	if len(s.Subjects) == 0 {
+		return fmt.Errorf("nats.jetstream.stream.subjects must not be empty")
+	}
+	if _, ok := streamRetentions[s.Retention]; !ok {
+		return fmt.Errorf("nats.jetstream.stream.retention must be 'limits', 'interest' or 'workqueue'")
+	}
+	if _, ok := streamStorages[s.Storage]; !ok {
+		return fmt.Errorf("nats.jetstream.stream.storage must be 'file' or 'memory'")
+	}
+	if s.MaxAgeSec < 0 {
+		return fmt.Errorf("nats.jetstream.stream.max_age_sec must be >= 0")
+	}
+	if s.Replicas < 1 || s.Replicas > 5 {
+		return fmt.Errorf("nats.jetstream.stream.replicas must be between 1 and 5")
+	}
+	return nil
+}
+
+// jetStreamConfig returns the stream config to create the stream with
+func (s *StreamSpec) jetStreamConfig() jetstream.StreamConfig {
+	return jetstream.StreamConfig{
+		Name:      s.Name,
+		Subjects:  s.Subjects,
+		Retention: streamRetentions[s.Retention],
+		MaxAge:    time.Duration(s.MaxAgeSec) * time.Second,
+		Storage:   streamStorages[s.Storage],
+		Replicas:  s.Replicas,
+	}
+}
+
+// applyTo returns current with the declared settings applied, other
+// settings of the existing stream are kept. changed is false when the
+// stream already matches the declaration.
+func (s *StreamSpec) applyTo(current jetstream.StreamConfig) (updated jetstream.StreamConfig, changed bool) {
+	want := s.jetStreamConfig()
+	updated = current
+	updated.Subjects = want.Subjects
+	updated.Retention = want.Retention
+	updated.MaxAge = want.MaxAge
+	updated.Storage = want.Storage
+	updated.Replicas = want.Replicas
+	// The server rejects a duplicates window longer than max age
+	if updated.MaxAge > 0 && updated.Duplicates > updated.MaxAge {
+		updated.Duplicates = updated.MaxAge
+	}
+
+	changed = !slices.Equal(current.Subjects, updated.Subjects) ||
+		current.Retention != updated.Retention ||
+		current.MaxAge != updated.MaxAge ||
+		current.Storage != updated.Storage ||
+		current.Replicas != updated.Replicas
+	return updated, changed
+}
+
+// ProvisionStream makes sure the declared stream exists and returns its
+// subjects. With manage the stream is created when missing and updated when
+// it differs from spec, otherwise it must already exist.
+func (c *JetStreamClient) ProvisionStream(ctx context.Context, spec *StreamSpec, manage bool) ([]string, error) {
+	if c.js == nil {
+		return nil, fmt.Errorf("JetStream is not connected")
+	}
+
+	stream, err := c.js.Stream(ctx, spec.Name)
+	switch {
+	case errors.Is(err, jetstream.ErrStreamNotFound):
+		if !manage {
+			return nil, fmt.Errorf("stream '%s' does not exist, create it or set nats.jetstream.manage_stream: true", spec.Name)
+		}
+		created, err := c.js.CreateStream(ctx, spec.jetStreamConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream '%s': %w", spec.Name, err)
+		}
+		c.logger.Info("stream created", "name", spec.Name)
+		return created.CachedInfo().Config.Subjects, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get stream '%s': %w", spec.Name, err)
+	}
+
+	current := stream.CachedInfo().Config
+	if !manage {
+		return current.Subjects, nil
+	}
+
+	updated, changed := spec.applyTo(current)
+	if !changed {
+		c.logger.Info("stream is up to date", "name", spec.Name)
+		return current.Subjects, nil
+	}
+	if _, err := c.js.UpdateStream(ctx, updated); err != nil {
+		return nil, fmt.Errorf("failed to update stream '%s': %w", spec.Name, err)
+	}
+	c.logger.Info("stream updated", "name", spec.Name)
+	return updated.Subjects, nil
+}
+
+// subjectMatches reports whether subject is matched by the NATS subject
+// filter, where '*' matches one token and '>' one or more trailing tokens
+func subjectMatches(filter, subject string) bool {
+	filterTokens := strings.Split(filter, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(filterTokens) == len(subjectTokens)
+}
+
+// uncoveredSubjects returns subjects that none of filters matches
+func uncoveredSubjects(filters, subjects []string) []string {
+	var uncovered []string
+	for _, subject := range subjects {
+		covered := slices.ContainsFunc(filters, func(filter string) bool {
+			return subjectMatches(filter, subject)
+		})
+		if !covered {
+			uncovered = append(uncovered, subject)
+		}
+	}
+	return uncovered
+}
+
+// defaultStreamSubjects returns static subjects that enabled routes publish
+// to the default stream and indexes of routes whose subject is an
+// expression. Requests are not stored and are skipped. With sharding.suffix
+// the subject of every shard is returned.
+func defaultStreamSubjects(cfg *Config) (static []string, dynamic []int) {
+	editSubjects := cfg.EditSubjects != nil && cfg.EditSubjects.Enabled
+
+	for i, route := range cfg.Routes {
+		if !route.IsEnabled() || route.RespondsOnly() || route.Stream != "" ||
+			route.ReplyMode == ReplyModeRequest || route.Subject == nil {
+			continue
+		}
+		if route.Subject.Type == SubjectTypeExpr {
+			dynamic = append(dynamic, i)
+			continue
+		}
+		if !slices.Contains(static, route.Subject.Value) {
+			static = append(static, route.Subject.Value)
+		}
+		if editSubjects {
+			static = append(static, route.Subject.Value+EditSubjectSuffix)
+		}
+	}
+	if sharder := NewSharder(cfg.Sharding); sharder != nil && sharder.suffix {
+		var sharded []string
+		for _, subject := range static {
+			sharded = append(sharded, sharder.shardSubjects(subject)...)
+		}
+		static = sharded
+	}
+	return static, dynamic
+}
+
+// checkStreamCoverage fails when stream subjects miss a static route
+// subject; expression subjects can only be warned about
+func checkStreamCoverage(cfg *Config, streamName string, streamSubjects []string, warn func(routeIdx int)) error {
+	static, dynamic := defaultStreamSubjects(cfg)
+	for _, i := range dynamic {
+		warn(i)
+	}
+	if uncovered := uncoveredSubjects(streamSubjects, static); len(uncovered) > 0 {
+		return fmt.Errorf("stream '%s' subjects %v don't cover route subjects: %s",
+			streamName, streamSubjects, strings.Join(uncovered, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runEmbeddedJetStream(t *testing.T) *server.Server {
+	t.Helper()
+
+	opts := natstest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	srv := natstest.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		filter  string
+		subject string
+		want    bool
+	}{
+		{"telegram.messages", "telegram.messages", true},
+		{"telegram.messages", "telegram.callbacks", false},
+		{"telegram.*", "telegram.messages", true},
+		{"telegram.*", "telegram.messages.edits", false},
+		{"telegram.>", "telegram.messages.edits", true},
+		{"telegram.>", "telegram", false},
+		{"*.messages", "telegram.messages", true},
+		{">", "telegram.messages", true},
+		{"telegram.messages.edits", "telegram.messages", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter+" "+tt.subject, func(t *testing.T) {
+			assert.Equal(t, tt.want, subjectMatches(tt.filter, tt.subject))
+		})
+	}
+}
+
+func TestCheckStreamCoverage(t *testing.T) {
+	disabled := false
+	cfg := &Config{
+		Routes: []Route{
+			{Condition: "update.Message != nil", Subject: &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"}},
+			{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeExpr, Value: `"telegram.chat." + string(update.Message.Chat.Id)`}},
+			{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "events.other"}, Stream: "EVENTS"},
+			{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "bot.inline"}, ReplyMode: ReplyModeRequest},
+			{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "old.subject"}, Enabled: &disabled},
+		},
+	}
+
+	t.Run("covered", func(t *testing.T) {
+		var warned []int
+		err := checkStreamCoverage(cfg, "TELEGRAM", []string{"telegram.>"}, func(i int) { warned = append(warned, i) })
+		require.NoError(t, err)
+		assert.Equal(t, []int{1}, warned)
+	})
+
+	t.Run("uncovered", func(t *testing.T) {
+		err := checkStreamCoverage(cfg, "TELEGRAM", []string{"telegram.callbacks"}, func(int) {})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "don't cover route subjects: telegram.messages")
+	})
+
+	t.Run("edit subjects", func(t *testing.T) {
+		edits := *cfg
+		edits.EditSubjects = &EditSubjectsConfig{Enabled: true}
+		err := checkStreamCoverage(&edits, "TELEGRAM", []string{"telegram.*"}, func(int) {})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "telegram.messages.edits")
+	})
+
+	t.Run("sharding", func(t *testing.T) {
+		sharded := *cfg
+		sharded.Sharding = &ShardingConfig{Key: ShardKeyChatID, Shards: 2, Suffix: true}
+		require.NoError(t, checkStreamCoverage(&sharded, "TELEGRAM", []string{"telegram.messages.shard.*"}, func(int) {}))
+
+		err := checkStreamCoverage(&sharded, "TELEGRAM", []string{"telegram.messages"}, func(int) {})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "telegram.messages.shard.0, telegram.messages.shard.1")
+	})
+}
+
+func TestJetStreamClient_ProvisionStream(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	srv := runEmbeddedJetStream(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := NewJetStreamClient(srv.ClientURL(), WithJetStreamLogger(logger))
+	require.NoError(t, client.Connect(ctx))
+	defer client.Close()
+
+	spec := &StreamSpec{
+		Name:      "TELEGRAM",
+		Subjects:  []string{"telegram.>"},
+		Retention: "limits",
+		MaxAgeSec: 3600,
+		Storage:   "memory",
+		Replicas:  1,
+	}
+
+	t.Run("missing without manage_stream", func(t *testing.T) {
+		_, err := client.ProvisionStream(ctx, spec, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stream 'TELEGRAM' does not exist")
+	})
+
+	t.Run("creates missing stream", func(t *testing.T) {
+		subjects, err := client.ProvisionStream(ctx, spec, true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"telegram.>"}, subjects)
+
+		stream, err := client.js.Stream(ctx, "TELEGRAM")
+		require.NoError(t, err)
+		got := stream.CachedInfo().Config
+		assert.Equal(t, jetstream.LimitsPolicy, got.Retention)
+		assert.Equal(t, jetstream.MemoryStorage, got.Storage)
+		assert.Equal(t, time.Hour, got.MaxAge)
+	})
+
+	t.Run("updates changed stream", func(t *testing.T) {
+		changed := *spec
+		changed.Subjects = []string{"telegram.>", "bot.>"}
+		changed.MaxAgeSec = 60
+
+		subjects, err := client.ProvisionStream(ctx, &changed, true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"telegram.>", "bot.>"}, subjects)
+
+		stream, err := client.js.Stream(ctx, "TELEGRAM")
+		require.NoError(t, err)
+		got := stream.CachedInfo().Config
+		assert.Equal(t, []string{"telegram.>", "bot.>"}, got.Subjects)
+		assert.Equal(t, time.Minute, got.MaxAge)
+	})
+
+	t.Run("existing stream without manage_stream is left as is", func(t *testing.T) {
+		subjects, err := client.ProvisionStream(ctx, spec, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"telegram.>", "bot.>"}, subjects)
+	})
+
+	t.Run("existing stream doesn't cover routes", func(t *testing.T) {
+		_, err := client.js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     "NARROW",
+			Subjects: []string{"narrow.callbacks"},
+			Storage:  jetstream.MemoryStorage,
+		})
+		require.NoError(t, err)
+
+		narrow := *spec
+		narrow.Name = "NARROW"
+		subjects, err := client.ProvisionStream(ctx, &narrow, false)
+		require.NoError(t, err)
+
+		cfg := &Config{Routes: []Route{
+			{Condition: "true", Subject: &RouteSubject{Type: SubjectTypeString, Value: "narrow.messages"}},
+		}}
+		err = checkStreamCoverage(cfg, narrow.Name, subjects, func(int) {})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stream 'NARROW'")
+		assert.Contains(t, err.Error(), "narrow.messages")
+	})
+}
@@ -0,0 +1,1088 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/go-resty/resty/v2"
+)
+
+// TelegramClientInterface defines the interface for Telegram Bot API client
+type TelegramClientInterface interface {
+	// GetUpdates retrieves updates from Telegram with specified offset
+	// Returns updates, next offset (max update_id + 1), and error
+	GetUpdates(ctx context.Context, offset int64) ([]Update, int64, error)
+	// GetUpdatesWithTimeout retrieves updates with custom timeout for long polling
+	// Returns updates, next offset (max update_id + 1), and error
+	GetUpdatesWithTimeout(ctx context.Context, offset int64, timeout int) ([]Update, int64, error)
+	// GetBotInfo retrieves information about the bot
+	GetBotInfo(ctx context.Context) (*gotgbot.User, error)
+	// GetMe is alias for GetBotInfo
+	GetMe(ctx context.Context) (*gotgbot.User, error)
+	// GetFile retrieves file info required for downloading
+	GetFile(ctx context.Context, fileID string) (*gotgbot.File, error)
+	// DownloadFile writes file content by file_path returned from GetFile to w
+	DownloadFile(ctx context.Context, filePath string, w io.Writer) error
+	// AnswerPreCheckoutQuery responds to a pre-checkout query
+	AnswerPreCheckoutQuery(ctx context.Context, queryID string, ok bool, errorMessage string) error
+	// AnswerShippingQuery responds to a shipping query
+	AnswerShippingQuery(ctx context.Context, queryID string, ok bool, options []gotgbot.ShippingOption, errorMessage string) error
+	// AnswerInlineQuery sends results for an inline query
+	AnswerInlineQuery(ctx context.Context, queryID string, results []json.RawMessage) error
+	// AnswerCallbackQuery responds to a callback query
+	AnswerCallbackQuery(ctx context.Context, queryID string, text string, showAlert bool, url string) error
+	// SendMessage sends a text message to a chat, threadID 0 sends outside forum topics
+	SendMessage(ctx context.Context, chatID int64, threadID int64, text string, parseMode string, replyMarkup json.RawMessage) error
+	// GetChat retrieves up-to-date information about a chat
+	GetChat(ctx context.Context, chatID int64) (*gotgbot.ChatFullInfo, error)
+	// GetChatMember retrieves information about a member of a chat
+	GetChatMember(ctx context.Context, chatID int64, userID int64) (*gotgbot.MergedChatMember, error)
+}
+
+// Errors returned by TelegramClient, check them with errors.Is. Failed API
+// calls return *TelegramAPIError, which matches ErrUnauthorized and
+// ErrConflict by its code.
+var (
+	// ErrUnauthorized means Telegram rejected the bot token (HTTP 401).
+	// Retrying with the same token is pointless.
+	ErrUnauthorized = errors.New("telegram bot token is invalid")
+	// ErrConflict means another getUpdates consumer or a webhook is active (HTTP 409)
+	ErrConflict = errors.New("telegram getUpdates conflict")
+	// ErrDecode means the Telegram response could not be decoded
+	ErrDecode = errors.New("failed to decode telegram response")
+	// ErrNetwork means the request did not get a response, e.g. a dial error or timeout
+	ErrNetwork = errors.New("telegram request failed")
+	// ErrOutsideLocalDir means a local file_path is not under the local Bot API directory
+	ErrOutsideLocalDir = errors.New("file is outside the local Bot API directory")
+)
+
+// TelegramAPIError is an error response of the Bot API
+type TelegramAPIError struct {
+	Code        int
+	Description string
+	// RetryAfter is how long Telegram asks to wait before repeating the request (HTTP 429)
+	RetryAfter time.Duration
+}
+
+func (e *TelegramAPIError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("telegram API error: status %d", e.Code)
+	}
+	return fmt.Sprintf("telegram API error %d: %s", e.Code, e.Description)
+}
+
+// Is matches ErrUnauthorized and ErrConflict by the error code
+func (e *TelegramAPIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Code == http.StatusUnauthorized
+	case ErrConflict:
+		return e.Code == http.StatusConflict
+	}
+	return false
+}
+
+// apiError is the error part of a Bot API response
+type apiError struct {
+	ErrorCode   int    `json:"error_code,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  *struct {
+		RetryAfter int `json:"retry_after,omitempty"`
+	} `json:"parameters,omitempty"`
+}
+
+// err converts the response error, status is used when the body has no error code
+func (a apiError) err(status int) *TelegramAPIError {
+	apiErr := &TelegramAPIError{Code: a.ErrorCode, Description: a.Description}
+	if apiErr.Code == 0 {
+		apiErr.Code = status
+	}
+	if a.Parameters != nil {
+		apiErr.RetryAfter = time.Duration(a.Parameters.RetryAfter) * time.Second
+	}
+	return apiErr
+}
+
+// statusError returns the API error of a non-2xx response, the body may not be JSON
+func statusError(status int, body []byte) *TelegramAPIError {
+	var response apiError
+	json.Unmarshal(body, &response)
+	return response.err(status)
+}
+
+// networkError wraps a failed request to method with ErrNetwork
+func networkError(method string, err error) error {
+	return fmt.Errorf("%w: %s: %w", ErrNetwork, method, err)
+}
+
+// decodeError wraps a response decoding error with ErrDecode
+func decodeError(err error) error {
+	return fmt.Errorf("%w: %w", ErrDecode, err)
+}
+
+// DecodeErrorHeader carries the decoding error of a malformed update
+// published to dead_letter_subject
+const DecodeErrorHeader = "Decode-Error"
+
+// MalformedUpdateError reports an update of a getUpdates batch that can't be
+// decoded into Update. The rest of the batch is decoded as usual, so one
+// malformed update doesn't stop the ones after it. It matches ErrDecode.
+type MalformedUpdateError struct {
+	// UpdateID is 0 when update_id itself can't be decoded
+	UpdateID int64
+	// Raw is the update as received
+	Raw json.RawMessage
+	Err error
+}
+
+func (e *MalformedUpdateError) Error() string {
+	return fmt.Sprintf("%v: update %d: %v", ErrDecode, e.UpdateID, e.Err)
+}
+
+func (e *MalformedUpdateError) Unwrap() []error {
+	return []error{ErrDecode, e.Err}
+}
+
+// decodeUpdate decodes an element of the getUpdates result, returning
+// *MalformedUpdateError with the update id if it can be read
+func decodeUpdate(raw json.RawMessage) (Update, error) {
+	var update Update
+	if err := json.Unmarshal(raw, &update); err != nil {
+		var id struct {
+			UpdateId int64 `json:"update_id"`
+		}
+		json.Unmarshal(raw, &id)
+		return Update{UpdateId: id.UpdateId}, &MalformedUpdateError{UpdateID: id.UpdateId, Raw: raw, Err: err}
+	}
+	return update, nil
+}
+
+// DefaultPollTimeout is the long polling timeout used by GetUpdates
+const DefaultPollTimeout = 30 * time.Second
+
+// MaxUpdatesLimit is the largest getUpdates limit accepted by Bot API
+const MaxUpdatesLimit = 100
+
+// DefaultPollTimeoutBuffer is added to the long polling timeout to get the getUpdates deadline
+const DefaultPollTimeoutBuffer = 10 * time.Second
+
+// requestTimeout bounds Bot API calls other than getUpdates when ctx has no earlier deadline
+const requestTimeout = 60 * time.Second
+
+// DefaultTelegramAPIURL is the public Telegram Bot API server
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// TelegramClient implements TelegramClientInterface
+type TelegramClient struct {
+	client   *resty.Client
+	apiURL   string
+	baseURL  string
+	token    string
+	localDir string
+	// pollBuffer is added to the long polling timeout to get the request deadline
+	pollBuffer time.Duration
+	// allowedUpdates is passed to getUpdates when not empty
+	allowedUpdates []string
+	// sendLimiter throttles sendMessage, nil sends right away
+	sendLimiter *SendLimiter
+	// updatesLimit is the getUpdates limit, 0 requests MaxUpdatesLimit
+	updatesLimit atomic.Int64
+	// lastUpdatesSize is the body size of the last getUpdates response
+	lastUpdatesSize atomic.Int64
+	// requestTimeout bounds Bot API calls other than getUpdates
+	requestTimeout time.Duration
+	logger         *slog.Logger
+}
+
+// telegramOptions are collected from TelegramOption before the client is built
+type telegramOptions struct {
+	logger         *slog.Logger
+	apiURL         string
+	httpClient     *http.Client
+	requestTimeout time.Duration
+	retries        int
+	retryBackoff   time.Duration
+	userAgent      string
+}
+
+// TelegramOption customizes a TelegramClient created by NewTelegramClient
+type TelegramOption func(*telegramOptions)
+
+// WithLogger sets the client logger, slog.Default() by default
+func WithLogger(logger *slog.Logger) TelegramOption {
+	return func(o *telegramOptions) { o.logger = logger }
+}
+
+// WithBaseURL sets the Bot API server URL (e.g. a local Bot API server),
+// DefaultTelegramAPIURL by default
+func WithBaseURL(apiURL string) TelegramOption {
+	return func(o *telegramOptions) { o.apiURL = apiURL }
+}
+
+// WithHTTPClient sets the HTTP client used for Bot API calls, e.g. with a
+// proxy or custom TLS settings. Its Timeout must be 0 or longer than the
+// long polling deadline, or it cuts getUpdates.
+func WithHTTPClient(client *http.Client) TelegramOption {
+	return func(o *telegramOptions) { o.httpClient = client }
+}
+
+// WithTimeout bounds Bot API calls other than getUpdates, which are bounded
+// by the long polling timeout instead. 60 seconds by default.
+func WithTimeout(timeout time.Duration) TelegramOption {
+	return func(o *telegramOptions) { o.requestTimeout = timeout }
+}
+
+// WithRetry retries calls failed with a network error up to max times,
+// waiting from backoff to ten times backoff between attempts. Bot API error
+// responses are not retried. A retried sendMessage may be delivered twice.
+func WithRetry(max int, backoff time.Duration) TelegramOption {
+	return func(o *telegramOptions) {
+		o.retries = max
+		o.retryBackoff = backoff
+	}
+}
+
+// WithUserAgent sets the User-Agent header of Bot API calls
+func WithUserAgent(userAgent string) TelegramOption {
+	return func(o *telegramOptions) { o.userAgent = userAgent }
+}
+
+// NewTelegramClient creates a new Telegram client
+func NewTelegramClient(token string, opts ...TelegramOption) *TelegramClient {
+	o := telegramOptions{
+		logger:         slog.Default(),
+		apiURL:         DefaultTelegramAPIURL,
+		requestTimeout: requestTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// No client-wide timeout: it would cut long polls, deadlines are set per request
+	client := resty.New()
+	if o.httpClient != nil {
+		client = resty.NewWithClient(o.httpClient)
+	}
+	if o.userAgent != "" {
+		client.SetHeader("User-Agent", o.userAgent)
+	}
+	if o.retries > 0 {
+		client.SetRetryCount(o.retries).
+			SetRetryWaitTime(o.retryBackoff).
+			SetRetryMaxWaitTime(10 * o.retryBackoff)
+	}
+
+	c := &TelegramClient{
+		client:         client,
+		token:          token,
+		pollBuffer:     DefaultPollTimeoutBuffer,
+		requestTimeout: o.requestTimeout,
+		logger:         o.logger,
+	}
+	c.SetAPIURL(o.apiURL)
+	return c
+}
+
+// NewTelegramClientWithLogger creates a Telegram client with default options.
+//
+// Deprecated: use NewTelegramClient(token, WithLogger(logger)).
+func NewTelegramClientWithLogger(token string, logger *slog.Logger) *TelegramClient {
+	return NewTelegramClient(token, WithLogger(logger))
+}
+
+// SetAPIURL sets Bot API server URL (e.g. a local Bot API server)
+func (c *TelegramClient) SetAPIURL(apiURL string) {
+	c.apiURL = apiURL
+	c.baseURL = fmt.Sprintf("%s/bot%s", apiURL, c.token)
+	c.client.SetBaseURL(c.baseURL)
+}
+
+// SetPollTimeoutBuffer sets the time added to the long polling timeout
+// to get the getUpdates deadline
+func (c *TelegramClient) SetPollTimeoutBuffer(buffer time.Duration) {
+	c.pollBuffer = buffer
+}
+
+// pollDeadline returns the getUpdates request deadline for the long polling timeout.
+// Short polls (timeout 0) get the buffer alone.
+func (c *TelegramClient) pollDeadline(timeout int) time.Duration {
+	return time.Duration(timeout)*time.Second + c.pollBuffer
+}
+
+// SetAllowedUpdates sets update types requested from getUpdates.
+// Empty list keeps the Bot API default.
+func (c *TelegramClient) SetAllowedUpdates(updateTypes []string) {
+	c.allowedUpdates = updateTypes
+}
+
+// SetUpdatesLimit sets the number of updates requested by getUpdates,
+// values outside 1..MaxUpdatesLimit request MaxUpdatesLimit
+func (c *TelegramClient) SetUpdatesLimit(limit int) {
+	c.updatesLimit.Store(int64(limit))
+}
+
+// LastUpdatesSize returns the body size in bytes of the last getUpdates
+// response, for a streamed response the part read so far
+func (c *TelegramClient) LastUpdatesSize() int64 {
+	return c.lastUpdatesSize.Load()
+}
+
+// SetSendLimiter makes SendMessage wait for the limiter before calling Bot API
+func (c *TelegramClient) SetSendLimiter(limiter *SendLimiter) {
+	c.sendLimiter = limiter
+}
+
+// SetLocalDir enables reading files from disk when a local Bot API server
+// returns an absolute file_path; only paths under dir, the working directory
+// of the server, are read. Empty dir disables it.
+func (c *TelegramClient) SetLocalDir(dir string) {
+	c.localDir = dir
+}
+
+// GetUpdates retrieves updates from Telegram
+// offset - identifier of the first update to be returned
+// Returns updates, next offset (max update_id + 1), and nil error on success
+func (c *TelegramClient) GetUpdates(ctx context.Context, offset int64) ([]Update, int64, error) {
+	return c.GetUpdatesWithTimeout(ctx, offset, int(DefaultPollTimeout.Seconds()))
+}
+
+// GetUpdatesWithTimeout retrieves updates with specified timeout for long polling
+// timeout - timeout in seconds for long polling (0 for short polling)
+// Returns updates, next offset (max update_id + 1), and error. Malformed
+// updates are logged and skipped, the next offset moves past them.
+func (c *TelegramClient) GetUpdatesWithTimeout(ctx context.Context, offset int64, timeout int) ([]Update, int64, error) {
+	updates, malformed, err := c.fetchUpdates(ctx, offset, timeout)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	// Calculate next offset (max update_id + 1)
+	nextOffset := offset
+	for _, update := range updates {
+		if update.UpdateId >= nextOffset {
+			nextOffset = update.UpdateId + 1
+		}
+	}
+	for _, bad := range malformed {
+		c.logger.Warn("skipping malformed update", "update_id", bad.UpdateID, "error", bad.Err)
+		if bad.UpdateID >= nextOffset {
+			nextOffset = bad.UpdateID + 1
+		}
+	}
+
+	return updates, nextOffset, nil
+}
+
+// fetchUpdates makes a getUpdates request. When the batch doesn't decode as
+// a whole, its updates are decoded one by one and the ones that fail are
+// returned as malformed.
+func (c *TelegramClient) fetchUpdates(ctx context.Context, offset int64, timeout int) ([]Update, []*MalformedUpdateError, error) {
+	c.logger.Debug("getting updates from Telegram",
+		"offset", offset,
+		"timeout", timeout)
+
+	// Every poll gets a deadline, a hung connection must not wedge the loop
+	ctx, cancel := context.WithTimeout(ctx, c.pollDeadline(timeout))
+	defer cancel()
+
+	req, err := c.updatesRequest(ctx, offset, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.lastUpdatesSize.Store(0)
+	resp, err := req.Get("/getUpdates")
+
+	if err != nil {
+		// Don't treat context cancellation as an error
+		if errors.Is(err, context.Canceled) {
+			c.logger.Debug("getUpdates cancelled")
+			return nil, nil, nil
+		}
+		c.logger.Error("failed to get updates", "error", err)
+		return nil, nil, networkError("getUpdates", err)
+	}
+
+	if resp.StatusCode() == http.StatusUnauthorized {
+		return nil, nil, statusError(resp.StatusCode(), resp.Body())
+	}
+
+	if resp.IsError() {
+		c.logger.Error("telegram API error",
+			"status", resp.StatusCode(),
+			"body", string(resp.Body()))
+		return nil, nil, statusError(resp.StatusCode(), resp.Body())
+	}
+
+	c.lastUpdatesSize.Store(int64(len(resp.Body())))
+
+	// Parse JSON response using gotgbot.Update
+	var response struct {
+		Ok     bool             `json:"ok"`
+		Result []gotgbot.Update `json:"result,omitempty"`
+		apiError
+	}
+
+	if err := json.Unmarshal(resp.Body(), &response); err != nil {
+		return c.decodeUpdateBatch(resp.StatusCode(), resp.Body(), err)
+	}
+
+	if !response.Ok {
+		c.logger.Error("telegram API returned error",
+			"error_code", response.ErrorCode,
+			"description", response.Description)
+		return nil, nil, response.err(resp.StatusCode())
+	}
+
+	c.logger.Debug("received updates", "count", len(response.Result))
+
+	return response.Result, nil, nil
+}
+
+// decodeUpdateBatch decodes the updates of a getUpdates response one by one
+// after the batch failed to decode with batchErr
+func (c *TelegramClient) decodeUpdateBatch(status int, body []byte, batchErr error) ([]Update, []*MalformedUpdateError, error) {
+	var response struct {
+		Ok     bool              `json:"ok"`
+		Result []json.RawMessage `json:"result,omitempty"`
+		apiError
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		c.logger.Error("failed to decode response", "error", batchErr)
+		return nil, nil, decodeError(batchErr)
+	}
+
+	if !response.Ok {
+		c.logger.Error("telegram API returned error",
+			"error_code", response.ErrorCode,
+			"description", response.Description)
+		return nil, nil, response.err(status)
+	}
+
+	updates := make([]Update, 0, len(response.Result))
+	var malformed []*MalformedUpdateError
+	for _, raw := range response.Result {
+		update, err := decodeUpdate(raw)
+		var bad *MalformedUpdateError
+		if errors.As(err, &bad) {
+			malformed = append(malformed, bad)
+			continue
+		}
+		updates = append(updates, update)
+	}
+
+	c.logger.Debug("received updates", "count", len(updates), "malformed", len(malformed))
+
+	return updates, malformed, nil
+}
+
+// updatesRequest builds a getUpdates request
+func (c *TelegramClient) updatesRequest(ctx context.Context, offset int64, timeout int) (*resty.Request, error) {
+	limit := c.updatesLimit.Load()
+	if limit < 1 || limit > MaxUpdatesLimit {
+		limit = MaxUpdatesLimit
+	}
+	req := c.client.R().
+		SetContext(ctx).
+		SetQueryParam("limit", strconv.FormatInt(limit, 10))
+
+	if offset > 0 {
+		req.SetQueryParam("offset", fmt.Sprintf("%d", offset))
+	}
+
+	if timeout > 0 {
+		req.SetQueryParam("timeout", fmt.Sprintf("%d", timeout))
+	}
+
+	if len(c.allowedUpdates) > 0 {
+		allowed, err := json.Marshal(c.allowedUpdates)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal allowed_updates: %w", err)
+		}
+		req.SetQueryParam("allowed_updates", string(allowed))
+	}
+
+	return req, nil
+}
+
+// StreamUpdates works like GetUpdatesWithTimeout but reads the response body
+// incrementally and yields every update as soon as it is decoded, so a batch
+// of large updates is never held in memory at once. An error ends the
+// sequence, updates yielded before it were received, except
+// *MalformedUpdateError: it is yielded with the update id and the updates
+// after it follow. The caller computes the next offset from the yielded
+// updates.
+func (c *TelegramClient) StreamUpdates(ctx context.Context, offset int64, timeout int) iter.Seq2[Update, error] {
+	return func(yield func(Update, error) bool) {
+		c.logger.Debug("streaming updates from Telegram",
+			"offset", offset,
+			"timeout", timeout)
+
+		// Every poll gets a deadline, a hung connection must not wedge the loop
+		ctx, cancel := context.WithTimeout(ctx, c.pollDeadline(timeout))
+		defer cancel()
+
+		req, err := c.updatesRequest(ctx, offset, timeout)
+		if err != nil {
+			yield(Update{}, err)
+			return
+		}
+
+		c.lastUpdatesSize.Store(0)
+		resp, err := req.SetDoNotParseResponse(true).Get("/getUpdates")
+		if err != nil {
+			// Don't treat context cancellation as an error
+			if errors.Is(err, context.Canceled) {
+				c.logger.Debug("getUpdates cancelled")
+				return
+			}
+			c.logger.Error("failed to get updates", "error", err)
+			yield(Update{}, networkError("getUpdates", err))
+			return
+		}
+		body := resp.RawBody()
+		defer body.Close()
+
+		if resp.IsError() {
+			// Error bodies are small, read a bounded prefix
+			data, _ := io.ReadAll(io.LimitReader(body, 4096))
+			if resp.StatusCode() != http.StatusUnauthorized {
+				c.logger.Error("telegram API error",
+					"status", resp.StatusCode(),
+					"body", string(data))
+			}
+			yield(Update{}, statusError(resp.StatusCode(), data))
+			return
+		}
+
+		var count int
+		stopped := false
+		err = decodeUpdates(&countingReader{r: body, n: &c.lastUpdatesSize}, func(update Update, err error) bool {
+			count++
+			if !yield(update, err) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if stopped {
+			return
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			c.logger.Error("failed to decode updates", "error", err, "decoded", count)
+			yield(Update{}, err)
+			return
+		}
+
+		c.logger.Debug("received updates", "count", count)
+	}
+}
+
+// countingReader adds the number of bytes read to n
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// decodeUpdates reads a getUpdates response and passes updates to yield one
+// by one. Updates are decoded with the same rules as json.Unmarshal of the
+// whole response, only one of them is held at a time. An update that can't
+// be decoded is passed with *MalformedUpdateError and decoding goes on. It
+// stops early when yield returns false.
+func decodeUpdates(r io.Reader, yield func(Update, error) bool) error {
+	decoder := json.NewDecoder(r)
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	var ok bool
+	var response apiError
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return decodeError(err)
+		}
+
+		switch token {
+		case "ok":
+			err = decoder.Decode(&ok)
+		case "error_code":
+			err = decoder.Decode(&response.ErrorCode)
+		case "description":
+			err = decoder.Decode(&response.Description)
+		case "parameters":
+			err = decoder.Decode(&response.Parameters)
+		case "result":
+			if !ok {
+				// Telegram sends "ok" first, there is no result to stream without it
+				var skip json.RawMessage
+				err = decoder.Decode(&skip)
+				break
+			}
+			if err := expectDelim(decoder, '['); err != nil {
+				return err
+			}
+			for decoder.More() {
+				var raw json.RawMessage
+				if err := decoder.Decode(&raw); err != nil {
+					return fmt.Errorf("%w: update: %w", ErrDecode, err)
+				}
+				if !yield(decodeUpdate(raw)) {
+					return nil
+				}
+			}
+			err = expectDelim(decoder, ']')
+		default:
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+		if err != nil {
+			return decodeError(err)
+		}
+	}
+
+	if !ok {
+		return response.err(http.StatusOK)
+	}
+
+	return nil
+}
+
+// expectDelim reads the next JSON token and checks it is delim
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return decodeError(err)
+	}
+	if token != delim {
+		return fmt.Errorf("%w: expected '%v', got '%v'", ErrDecode, delim, token)
+	}
+	return nil
+}
+
+// GetBotInfo retrieves information about the bot
+func (c *TelegramClient) GetBotInfo(ctx context.Context) (*gotgbot.User, error) {
+	return c.GetMe(ctx)
+}
+
+// GetMe retrieves information about the bot (alias for GetBotInfo)
+func (c *TelegramClient) GetMe(ctx context.Context) (*gotgbot.User, error) {
+	c.logger.Debug("getting bot info")
+
+	type getMeResponse struct {
+		Ok     bool          `json:"ok"`
+		Result *gotgbot.User `json:"result,omitempty"`
+		apiError
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	var response getMeResponse
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetResult(&response).
+		Get("/getMe")
+
+	if err != nil {
+		// Don't log context cancellation as an error
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		c.logger.Error("failed to get bot info", "error", err)
+		return nil, networkError("getMe", err)
+	}
+
+	if resp.IsError() {
+		return nil, statusError(resp.StatusCode(), resp.Body())
+	}
+
+	if !response.Ok {
+		return nil, response.err(resp.StatusCode())
+	}
+
+	c.logger.Info("bot info retrieved",
+		"id", response.Result.Id,
+		"username", response.Result.Username,
+		"first_name", response.Result.FirstName)
+
+	return response.Result, nil
+}
+
+// GetFile retrieves file info required for downloading
+func (c *TelegramClient) GetFile(ctx context.Context, fileID string) (*gotgbot.File, error) {
+	c.logger.Debug("getting file info", "file_id", fileID)
+
+	type getFileResponse struct {
+		Ok     bool          `json:"ok"`
+		Result *gotgbot.File `json:"result,omitempty"`
+		apiError
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	var response getFileResponse
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetQueryParam("file_id", fileID).
+		SetResult(&response).
+		Get("/getFile")
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		c.logger.Error("failed to get file info", "file_id", fileID, "error", err)
+		return nil, networkError("getFile", err)
+	}
+
+	if resp.IsError() {
+		return nil, statusError(resp.StatusCode(), resp.Body())
+	}
+
+	if !response.Ok {
+		return nil, response.err(resp.StatusCode())
+	}
+
+	return response.Result, nil
+}
+
+// DownloadFile writes file content by file_path returned from GetFile to w
+// without buffering it. In local mode an absolute file_path is read from
+// disk if it is under the local Bot API directory.
+func (c *TelegramClient) DownloadFile(ctx context.Context, filePath string, w io.Writer) error {
+	if filePath == "" {
+		return fmt.Errorf("file path is required")
+	}
+
+	if c.localDir != "" && filepath.IsAbs(filePath) {
+		return c.copyLocalFile(filePath, w)
+	}
+
+	fileURL := fmt.Sprintf("%s/file/bot%s/%s", c.apiURL, c.token, filePath)
+	c.logger.Debug("downloading file", "path", filePath)
+
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		Get(fileURL)
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		c.logger.Error("failed to download file", "path", filePath, "error", err)
+		return networkError("download file", err)
+	}
+	body := resp.RawBody()
+	defer body.Close()
+
+	if resp.IsError() {
+		data, _ := io.ReadAll(io.LimitReader(body, 4096))
+		return statusError(resp.StatusCode(), data)
+	}
+
+	if _, err := io.Copy(w, body); err != nil {
+		c.logger.Error("failed to download file", "path", filePath, "error", err)
+		return networkError("download file", err)
+	}
+	return nil
+}
+
+// copyLocalFile copies a file of the local Bot API server to w. Symlinks are
+// resolved first, so a link can't lead out of the local directory.
+func (c *TelegramClient) copyLocalFile(filePath string, w io.Writer) error {
+	c.logger.Debug("reading local file", "path", filePath)
+
+	dir, err := filepath.EvalSymlinks(c.localDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve local Bot API directory: %w", err)
+	}
+	path, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		c.logger.Error("failed to read local file", "path", filePath, "error", err)
+		return fmt.Errorf("failed to read local file: %w", err)
+	}
+	if rel, err := filepath.Rel(dir, path); err != nil || !filepath.IsLocal(rel) {
+		c.logger.Error("local file is outside the local Bot API directory", "path", filePath, "dir", c.localDir)
+		return fmt.Errorf("%w: %s is outside %s", ErrOutsideLocalDir, filePath, c.localDir)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		c.logger.Error("failed to read local file", "path", filePath, "error", err)
+		return fmt.Errorf("failed to read local file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to read local file: %w", err)
+	}
+	return nil
+}
+
+// AnswerPreCheckoutQuery responds to a pre-checkout query.
+// errorMessage is required when ok is false.
+func (c *TelegramClient) AnswerPreCheckoutQuery(ctx context.Context, queryID string, ok bool, errorMessage string) error {
+	params := map[string]interface{}{
+		"pre_checkout_query_id": queryID,
+		"ok":                    ok,
+	}
+	if !ok {
+		params["error_message"] = errorMessage
+	}
+
+	return c.callMethod(ctx, "answerPreCheckoutQuery", params, nil)
+}
+
+// AnswerShippingQuery responds to a shipping query.
+// options are required when ok is true, errorMessage when ok is false.
+func (c *TelegramClient) AnswerShippingQuery(ctx context.Context, queryID string, ok bool, options []gotgbot.ShippingOption, errorMessage string) error {
+	params := map[string]interface{}{
+		"shipping_query_id": queryID,
+		"ok":                ok,
+	}
+	if ok {
+		params["shipping_options"] = options
+	} else {
+		params["error_message"] = errorMessage
+	}
+
+	return c.callMethod(ctx, "answerShippingQuery", params, nil)
+}
+
+// AnswerInlineQuery sends results for an inline query.
+// results are InlineQueryResult objects passed through as is.
+func (c *TelegramClient) AnswerInlineQuery(ctx context.Context, queryID string, results []json.RawMessage) error {
+	if results == nil {
+		results = []json.RawMessage{}
+	}
+
+	params := map[string]interface{}{
+		"inline_query_id": queryID,
+		"results":         results,
+	}
+
+	return c.callMethod(ctx, "answerInlineQuery", params, nil)
+}
+
+// AnswerCallbackQuery responds to a callback query.
+// All fields except queryID are optional.
+func (c *TelegramClient) AnswerCallbackQuery(ctx context.Context, queryID string, text string, showAlert bool, url string) error {
+	params := map[string]interface{}{
+		"callback_query_id": queryID,
+	}
+	if text != "" {
+		params["text"] = text
+		params["show_alert"] = showAlert
+	}
+	if url != "" {
+		params["url"] = url
+	}
+
+	return c.callMethod(ctx, "answerCallbackQuery", params, nil)
+}
+
+// SendMessage sends a text message to a chat.
+// replyMarkup is passed through as is. With a send limiter set, the call
+// waits for the chat and global rate limits first.
+func (c *TelegramClient) SendMessage(ctx context.Context, chatID int64, threadID int64, text string, parseMode string, replyMarkup json.RawMessage) error {
+	if c.sendLimiter != nil {
+		if err := c.sendLimiter.Wait(ctx, chatID); err != nil {
+			return fmt.Errorf("waiting for send rate limit: %w", err)
+		}
+	}
+
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if threadID != 0 {
+		params["message_thread_id"] = threadID
+	}
+	if parseMode != "" {
+		params["parse_mode"] = parseMode
+	}
+	if len(replyMarkup) > 0 {
+		params["reply_markup"] = replyMarkup
+	}
+
+	return c.callMethod(ctx, "sendMessage", params, nil)
+}
+
+// GetChat retrieves up-to-date information about a chat
+func (c *TelegramClient) GetChat(ctx context.Context, chatID int64) (*gotgbot.ChatFullInfo, error) {
+	params := map[string]interface{}{
+		"chat_id": chatID,
+	}
+
+	var chat gotgbot.ChatFullInfo
+	if err := c.callMethod(ctx, "getChat", params, &chat); err != nil {
+		return nil, err
+	}
+
+	return &chat, nil
+}
+
+// GetChatMember retrieves information about a member of a chat.
+// All member variants are decoded into MergedChatMember, Status tells them apart.
+func (c *TelegramClient) GetChatMember(ctx context.Context, chatID int64, userID int64) (*gotgbot.MergedChatMember, error) {
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"user_id": userID,
+	}
+
+	var member gotgbot.MergedChatMember
+	if err := c.callMethod(ctx, "getChatMember", params, &member); err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// GetWebhookInfo retrieves the current webhook status, Url is empty when
+// updates are received with getUpdates
+func (c *TelegramClient) GetWebhookInfo(ctx context.Context) (*gotgbot.WebhookInfo, error) {
+	var info gotgbot.WebhookInfo
+	if err := c.callMethod(ctx, "getWebhookInfo", map[string]interface{}{}, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// DeleteWebhook removes the webhook so getUpdates can be used again.
+// dropPending discards updates Telegram has queued for the webhook.
+func (c *TelegramClient) DeleteWebhook(ctx context.Context, dropPending bool) error {
+	params := map[string]interface{}{
+		"drop_pending_updates": dropPending,
+	}
+
+	return c.callMethod(ctx, "deleteWebhook", params, nil)
+}
+
+// callMethod calls a Bot API method with JSON params and decodes
+// the response result into result (if not nil)
+func (c *TelegramClient) callMethod(ctx context.Context, method string, params interface{}, result interface{}) error {
+	c.logger.Debug("calling telegram method", "method", method)
+
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(params).
+		Post("/" + method)
+
+	if err != nil {
+		// Don't log context cancellation as an error
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		c.logger.Error("failed to call telegram method", "method", method, "error", err)
+		return networkError(method, err)
+	}
+
+	var response struct {
+		Ok     bool            `json:"ok"`
+		Result json.RawMessage `json:"result,omitempty"`
+		apiError
+	}
+
+	if err := json.Unmarshal(resp.Body(), &response); err != nil {
+		if resp.IsError() {
+			return statusError(resp.StatusCode(), nil)
+		}
+		c.logger.Error("failed to decode response", "method", method, "error", err)
+		return decodeError(err)
+	}
+
+	if !response.Ok {
+		c.logger.Error("telegram API returned error",
+			"method", method,
+			"error_code", response.ErrorCode,
+			"description", response.Description)
+		return response.err(resp.StatusCode())
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("%w: %s result: %w", ErrDecode, method, err)
+		}
+	}
+
+	return nil
+}
+
+// Ensure TelegramClient implements TelegramClientInterface
+var _ TelegramClientInterface = (*TelegramClient)(nil)
+
+// NewTelegramClientFromConfig creates a Telegram client configured from
+// telegram_token and the telegram config section
+func NewTelegramClientFromConfig(cfg *Config, logger *slog.Logger) *TelegramClient {
+	client := NewTelegramClient(cfg.TelegramToken, telegramClientOptions(cfg.Telegram, logger)...)
+	if cfg.Telegram != nil {
+		if cfg.Telegram.LocalMode {
+			client.SetLocalDir(cfg.Telegram.LocalDir)
+		}
+		if cfg.Telegram.PollTimeoutBufferSec > 0 {
+			client.SetPollTimeoutBuffer(time.Duration(cfg.Telegram.PollTimeoutBufferSec) * time.Second)
+		}
+		client.SetAllowedUpdates(cfg.Telegram.AllowedUpdates)
+		if cfg.Telegram.RateLimit != nil {
+			client.SetSendLimiter(NewSendLimiter(*cfg.Telegram.RateLimit))
+		}
+	}
+	return client
+}
+
+// telegramClientOptions returns the TelegramClient options of the telegram config section
+func telegramClientOptions(cfg *TelegramConfig, logger *slog.Logger) []TelegramOption {
+	opts := []TelegramOption{WithLogger(logger)}
+	if cfg == nil {
+		return opts
+	}
+	if cfg.APIURL != "" {
+		opts = append(opts, WithBaseURL(cfg.APIURL))
+	}
+	if cfg.ProxyURL != "" {
+		// The URL is checked by Validate
+		if proxy, err := url.Parse(cfg.ProxyURL); err == nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.Proxy = http.ProxyURL(proxy)
+			opts = append(opts, WithHTTPClient(&http.Client{Transport: transport}))
+		}
+	}
+	if cfg.RequestTimeoutSec > 0 {
+		opts = append(opts, WithTimeout(time.Duration(cfg.RequestTimeoutSec)*time.Second))
+	}
+	return opts
+}
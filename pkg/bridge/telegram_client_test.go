@@ -0,0 +1,850 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelegramClient_GetFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottest-token/getFile", r.URL.Path)
+		assert.Equal(t, "file-123", r.URL.Query().Get("file_id"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"file_id":"file-123","file_unique_id":"u1","file_path":"photos/file_1.jpg"}}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	file, err := client.GetFile(context.Background(), "file-123")
+	require.NoError(t, err)
+	assert.Equal(t, "photos/file_1.jpg", file.FilePath)
+}
+
+func TestTelegramClient_DownloadFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file/bottest-token/photos/missing.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"ok":false,"error_code":404,"description":"Not Found"}`))
+			return
+		}
+		assert.Equal(t, "/file/bottest-token/photos/file_1.jpg", r.URL.Path)
+		w.Write([]byte("remote content"))
+	}))
+	defer server.Close()
+
+	localDir := t.TempDir()
+	localPath := filepath.Join(localDir, "file_1.jpg")
+	require.NoError(t, os.WriteFile(localPath, []byte("local content"), 0644))
+	outsidePath := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(outsidePath, []byte("secret"), 0644))
+
+	t.Run("url path", func(t *testing.T) {
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+		var buf bytes.Buffer
+		require.NoError(t, client.DownloadFile(context.Background(), "photos/file_1.jpg", &buf))
+		assert.Equal(t, "remote content", buf.String())
+	})
+
+	t.Run("url path error", func(t *testing.T) {
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+		var buf bytes.Buffer
+		err := client.DownloadFile(context.Background(), "photos/missing.jpg", &buf)
+		var apiErr *TelegramAPIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 404, apiErr.Code)
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("url path in local mode", func(t *testing.T) {
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+		client.SetLocalDir(localDir)
+
+		var buf bytes.Buffer
+		require.NoError(t, client.DownloadFile(context.Background(), "photos/file_1.jpg", &buf))
+		assert.Equal(t, "remote content", buf.String())
+	})
+
+	t.Run("local path in local mode", func(t *testing.T) {
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+		client.SetLocalDir(localDir)
+
+		var buf bytes.Buffer
+		require.NoError(t, client.DownloadFile(context.Background(), localPath, &buf))
+		assert.Equal(t, "local content", buf.String())
+	})
+
+	t.Run("local path outside local dir", func(t *testing.T) {
+		client := NewTelegramClient("test-token", WithLogger(logger))
+		client.SetLocalDir(localDir)
+
+		var buf bytes.Buffer
+		err := client.DownloadFile(context.Background(), outsidePath, &buf)
+		assert.ErrorIs(t, err, ErrOutsideLocalDir)
+		err = client.DownloadFile(context.Background(), filepath.Join(localDir, "..", filepath.Base(filepath.Dir(outsidePath)), "secret"), &buf)
+		assert.ErrorIs(t, err, ErrOutsideLocalDir)
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("symlink out of local dir", func(t *testing.T) {
+		link := filepath.Join(localDir, "link")
+		require.NoError(t, os.Symlink(outsidePath, link))
+		client := NewTelegramClient("test-token", WithLogger(logger))
+		client.SetLocalDir(localDir)
+
+		var buf bytes.Buffer
+		assert.ErrorIs(t, client.DownloadFile(context.Background(), link, &buf), ErrOutsideLocalDir)
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("missing local file", func(t *testing.T) {
+		client := NewTelegramClient("test-token", WithLogger(logger))
+		client.SetLocalDir(localDir)
+
+		var buf bytes.Buffer
+		err := client.DownloadFile(context.Background(), filepath.Join(localDir, "nonexistent.jpg"), &buf)
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+}
+
+func TestTelegramClient_AnswerPreCheckoutQuery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/bottest-token/answerPreCheckoutQuery", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	err := client.AnswerPreCheckoutQuery(context.Background(), "query-1", false, "out of stock")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"pre_checkout_query_id": "query-1",
+		"ok":                    false,
+		"error_message":         "out of stock",
+	}, body)
+}
+
+func TestTelegramClient_CallMethod_APIError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: query is too old"}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	err := client.AnswerShippingQuery(context.Background(), "query-1", false, nil, "unavailable")
+	var apiErr *TelegramAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 400, apiErr.Code)
+	assert.Equal(t, "Bad Request: query is too old", apiErr.Description)
+}
+
+func TestTelegramClient_AnswerInlineQuery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottest-token/answerInlineQuery", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	err := client.AnswerInlineQuery(context.Background(), "inline-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"inline_query_id": "inline-1",
+		"results":         []interface{}{},
+	}, body)
+}
+
+func TestTelegramClient_InvalidToken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("bad-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	t.Run("get me", func(t *testing.T) {
+		_, err := client.GetMe(context.Background())
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("get updates", func(t *testing.T) {
+		_, offset, err := client.GetUpdatesWithTimeout(context.Background(), 10, 0)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.Equal(t, int64(10), offset)
+	})
+}
+
+func TestTelegramClient_GetMe_ServerError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	_, err := client.GetMe(context.Background())
+	var apiErr *TelegramAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.Code)
+	assert.NotErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestTelegramClient_GetUpdates_Errors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name:   "conflict",
+			status: http.StatusConflict,
+			body:   `{"ok":false,"error_code":409,"description":"Conflict: can't use getUpdates method while webhook is active"}`,
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrConflict)
+				assert.NotErrorIs(t, err, ErrUnauthorized)
+			},
+		},
+		{
+			name:   "flood wait",
+			status: http.StatusTooManyRequests,
+			body:   `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 12","parameters":{"retry_after":12}}`,
+			check: func(t *testing.T, err error) {
+				var apiErr *TelegramAPIError
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, 429, apiErr.Code)
+				assert.Equal(t, 12*time.Second, apiErr.RetryAfter)
+			},
+		},
+		{
+			name:   "not ok with status 200",
+			status: http.StatusOK,
+			body:   `{"ok":false,"error_code":409,"description":"Conflict"}`,
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrConflict)
+			},
+		},
+		{
+			name:   "malformed body",
+			status: http.StatusOK,
+			body:   `{"ok":true,"result":[{`,
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrDecode)
+				assert.NotErrorIs(t, err, ErrNetwork)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+			_, offset, err := client.GetUpdatesWithTimeout(context.Background(), 10, 0)
+			tt.check(t, err)
+			assert.Equal(t, int64(10), offset)
+
+			for _, err := range client.StreamUpdates(context.Background(), 10, 0) {
+				tt.check(t, err)
+			}
+		})
+	}
+
+	t.Run("network", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.Close()
+
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+		_, _, err := client.GetUpdatesWithTimeout(context.Background(), 0, 0)
+		assert.ErrorIs(t, err, ErrNetwork)
+		var apiErr *TelegramAPIError
+		assert.False(t, errors.As(err, &apiErr))
+	})
+}
+
+func TestTelegramClient_AnswerCallbackQuery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/bottest-token/answerCallbackQuery", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	t.Run("without text", func(t *testing.T) {
+		body = nil
+		err := client.AnswerCallbackQuery(context.Background(), "callback-1", "", false, "")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"callback_query_id": "callback-1",
+		}, body)
+	})
+
+	t.Run("with text and alert", func(t *testing.T) {
+		body = nil
+		err := client.AnswerCallbackQuery(context.Background(), "callback-1", "Saved", true, "")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"callback_query_id": "callback-1",
+			"text":              "Saved",
+			"show_alert":        true,
+		}, body)
+	})
+}
+
+func TestTelegramClient_GetChat(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottest-token/getChat", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"id":-100123,"type":"supergroup","title":"Team","username":"team_chat","accent_color_id":0,"max_reaction_count":11,"accepted_gift_types":{"unlimited_gifts":true,"limited_gifts":true,"unique_gifts":true,"premium_subscription":true}}}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	chat, err := client.GetChat(context.Background(), -100123)
+	require.NoError(t, err)
+	assert.Equal(t, float64(-100123), body["chat_id"])
+	assert.Equal(t, "Team", chat.Title)
+	assert.Equal(t, "team_chat", chat.Username)
+}
+
+func TestTelegramClient_GetChatMember(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottest-token/getChatMember", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"status":"administrator","user":{"id":42,"is_bot":false,"first_name":"Admin"},"custom_title":"Boss","can_be_edited":false}}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	member, err := client.GetChatMember(context.Background(), -100123, 42)
+	require.NoError(t, err)
+	assert.Equal(t, float64(-100123), body["chat_id"])
+	assert.Equal(t, float64(42), body["user_id"])
+	assert.Equal(t, "administrator", member.Status)
+	assert.Equal(t, "Boss", member.CustomTitle)
+	assert.Equal(t, int64(42), member.User.Id)
+}
+
+func TestTelegramClient_PollDeadline(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	client := NewTelegramClient("test-token", WithLogger(logger))
+
+	tests := []struct {
+		timeout int
+		want    time.Duration
+	}{
+		{timeout: 0, want: 10 * time.Second},
+		{timeout: 30, want: 40 * time.Second},
+		{timeout: 90, want: 100 * time.Second},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, client.pollDeadline(tt.timeout), "timeout %d", tt.timeout)
+	}
+}
+
+func TestTelegramClient_GetUpdates_HungServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	for _, timeout := range []int{0, 1} {
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+		client.SetPollTimeoutBuffer(200 * time.Millisecond)
+
+		start := time.Now()
+		_, _, err := client.GetUpdatesWithTimeout(context.Background(), 0, timeout)
+		elapsed := time.Since(start)
+
+		assert.ErrorIs(t, err, ErrNetwork, "timeout %d", timeout)
+		expected := client.pollDeadline(timeout)
+		assert.GreaterOrEqual(t, elapsed, expected, "timeout %d", timeout)
+		assert.Less(t, elapsed, expected+time.Second, "timeout %d", timeout)
+	}
+}
+
+func TestTelegramClient_GetUpdates_AllowedUpdates(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	var allowed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed = r.URL.Query()["allowed_updates"]
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	_, _, err := client.GetUpdatesWithTimeout(context.Background(), 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, allowed)
+
+	client.SetAllowedUpdates([]string{"message", "business_message"})
+	_, _, err = client.GetUpdatesWithTimeout(context.Background(), 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`["message","business_message"]`}, allowed)
+}
+
+// updatesResponse builds a getUpdates response from all update fixtures and
+// an update with ids beyond float64 precision
+func updatesResponse(t *testing.T) []byte {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join("testdata", "updates", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	result := []json.RawMessage{
+		json.RawMessage(`{"update_id":9007199254740993,"message":{"message_id":1,"date":0,"chat":{"id":-1009007199254740993,"type":"supergroup"},"text":"big"}}`),
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		result = append(result, data)
+	}
+
+	body, err := json.Marshal(map[string]any{"ok": true, "result": result})
+	require.NoError(t, err)
+	return body
+}
+
+func TestDecodeUpdates(t *testing.T) {
+	body := updatesResponse(t)
+
+	var want struct {
+		Result []Update `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(body, &want))
+
+	var got []Update
+	require.NoError(t, decodeUpdates(bytes.NewReader(body), func(update Update, err error) bool {
+		require.NoError(t, err)
+		got = append(got, update)
+		return true
+	}))
+
+	assert.Equal(t, want.Result, got)
+	assert.Equal(t, int64(9007199254740993), got[0].UpdateId)
+	assert.Equal(t, int64(-1009007199254740993), got[0].Message.Chat.Id)
+
+	t.Run("stops when yield returns false", func(t *testing.T) {
+		var count int
+		require.NoError(t, decodeUpdates(bytes.NewReader(body), func(Update, error) bool {
+			count++
+			return false
+		}))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("error response", func(t *testing.T) {
+		err := decodeUpdates(strings.NewReader(`{"ok":false,"error_code":409,"description":"Conflict"}`), func(Update, error) bool {
+			t.Fatal("no updates expected")
+			return true
+		})
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.EqualError(t, err, "telegram API error 409: Conflict")
+	})
+
+	t.Run("truncated body", func(t *testing.T) {
+		var count int
+		err := decodeUpdates(bytes.NewReader(body[:len(body)/2]), func(Update, error) bool {
+			count++
+			return true
+		})
+		assert.ErrorIs(t, err, ErrDecode)
+		assert.Positive(t, count)
+	})
+
+	t.Run("malformed update", func(t *testing.T) {
+		var ids []int64
+		var malformed []*MalformedUpdateError
+		require.NoError(t, decodeUpdates(strings.NewReader(malformedBatch), func(update Update, err error) bool {
+			ids = append(ids, update.UpdateId)
+			var bad *MalformedUpdateError
+			if errors.As(err, &bad) {
+				malformed = append(malformed, bad)
+			}
+			return true
+		}))
+		assert.Equal(t, []int64{1, 2, 3}, ids)
+		require.Len(t, malformed, 1)
+		assert.Equal(t, int64(2), malformed[0].UpdateID)
+		assert.JSONEq(t, malformedUpdate, string(malformed[0].Raw))
+		assert.ErrorIs(t, malformed[0], ErrDecode)
+	})
+}
+
+// malformedUpdate has a string message_id, it can't be decoded into Update
+const malformedUpdate = `{"update_id":2,"message":{"message_id":"abc","date":0,"chat":{"id":1,"type":"private"}}}`
+
+var malformedBatch = `{"ok":true,"result":[` +
+	`{"update_id":1,"message":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"},"text":"first"}},` +
+	malformedUpdate + `,` +
+	`{"update_id":3,"message":{"message_id":3,"date":0,"chat":{"id":1,"type":"private"},"text":"third"}}]}`
+
+func TestTelegramClient_MalformedUpdate(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(malformedBatch))
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	t.Run("buffered", func(t *testing.T) {
+		updates, offset, err := client.GetUpdatesWithTimeout(context.Background(), 0, 0)
+		require.NoError(t, err)
+		require.Len(t, updates, 2)
+		assert.Equal(t, "first", updates[0].Message.Text)
+		assert.Equal(t, "third", updates[1].Message.Text)
+		assert.Equal(t, int64(4), offset)
+
+		var ids []int64
+		var malformed *MalformedUpdateError
+		for update, err := range pollUpdates(context.Background(), client, 0, false) {
+			ids = append(ids, update.UpdateId)
+			if err != nil {
+				require.ErrorAs(t, err, &malformed)
+			}
+		}
+		assert.Equal(t, []int64{1, 3, 2}, ids)
+		require.NotNil(t, malformed)
+		assert.JSONEq(t, malformedUpdate, string(malformed.Raw))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var ids []int64
+		var malformed *MalformedUpdateError
+		for update, err := range pollUpdates(context.Background(), client, 0, true) {
+			ids = append(ids, update.UpdateId)
+			if err != nil {
+				require.ErrorAs(t, err, &malformed)
+			}
+		}
+		assert.Equal(t, []int64{1, 2, 3}, ids)
+		require.NotNil(t, malformed)
+		assert.Equal(t, int64(2), malformed.UpdateID)
+	})
+}
+
+func TestTelegramClient_StreamUpdates(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	body := updatesResponse(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/botrevoked/getUpdates" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+			return
+		}
+		assert.Equal(t, "5", r.URL.Query().Get("offset"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+	want, _, err := client.GetUpdatesWithTimeout(context.Background(), 5, 0)
+	require.NoError(t, err)
+
+	var got []Update
+	for update, err := range client.StreamUpdates(context.Background(), 5, 0) {
+		require.NoError(t, err)
+		got = append(got, update)
+	}
+	assert.Equal(t, want, got)
+
+	revoked := NewTelegramClient("revoked", WithLogger(logger))
+	revoked.SetAPIURL(server.URL)
+
+	var errs []error
+	for _, err := range revoked.StreamUpdates(context.Background(), 0, 0) {
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrUnauthorized)
+}
+
+// roundTripFunc is an http.RoundTripper implemented by a function
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestTelegramClient_Options(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	getMe := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`))
+	}
+
+	t.Run("base url", func(t *testing.T) {
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			getMe(w, r)
+		}))
+		defer server.Close()
+
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+		_, err := client.GetMe(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "/bottest-token/getMe", path)
+	})
+
+	t.Run("logger", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(getMe))
+		defer server.Close()
+
+		var logs bytes.Buffer
+		debug := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		client := NewTelegramClient("test-token", WithLogger(debug), WithBaseURL(server.URL))
+
+		_, err := client.GetMe(t.Context())
+		require.NoError(t, err)
+		assert.Contains(t, logs.String(), "getting bot info")
+	})
+
+	t.Run("http client", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(getMe))
+		defer server.Close()
+
+		var requests int
+		httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			requests++
+			return http.DefaultTransport.RoundTrip(r)
+		})}
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL), WithHTTPClient(httpClient))
+
+		_, err := client.GetMe(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			getMe(w, r)
+		}))
+		defer server.Close()
+
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL), WithTimeout(50*time.Millisecond))
+
+		start := time.Now()
+		_, err := client.GetMe(t.Context())
+		assert.ErrorIs(t, err, ErrNetwork)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				// Drop the connection without a response
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				conn.Close()
+				return
+			}
+			getMe(w, r)
+		}))
+		defer server.Close()
+
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+		_, err := client.GetMe(t.Context())
+		assert.ErrorIs(t, err, ErrNetwork, "no retries by default")
+
+		requests = 0
+		client = NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL), WithRetry(2, time.Millisecond))
+		bot, err := client.GetMe(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "test_bot", bot.Username)
+		assert.Equal(t, 2, requests)
+	})
+
+	t.Run("retry skips API errors", func(t *testing.T) {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+		}))
+		defer server.Close()
+
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL), WithRetry(2, time.Millisecond))
+
+		_, err := client.GetMe(t.Context())
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("user agent", func(t *testing.T) {
+		var userAgent string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent = r.UserAgent()
+			getMe(w, r)
+		}))
+		defer server.Close()
+
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL), WithUserAgent("my-bridge/1.0"))
+
+		_, err := client.GetMe(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "my-bridge/1.0", userAgent)
+	})
+}
+
+func TestNewTelegramClient_Config(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// The proxy gets requests with the absolute URL of the Bot API server
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.String())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`))
+	}))
+	defer proxy.Close()
+
+	cfg := &Config{
+		TelegramToken: "test-token",
+		Telegram: &TelegramConfig{
+			APIURL:            "http://bot-api.invalid",
+			ProxyURL:          proxy.URL,
+			RequestTimeoutSec: 5,
+		},
+	}
+	client := NewTelegramClientFromConfig(cfg, logger)
+	assert.Equal(t, 5*time.Second, client.requestTimeout)
+
+	bot, err := client.GetMe(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "test_bot", bot.Username)
+	assert.Equal(t, "http://bot-api.invalid/bottest-token/getMe", proxied.Load())
+}
@@ -0,0 +1,292 @@
+package bridge
+
+import (
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+type Update = gotgbot.Update
+
+// chatMemberTransition returns status transition of chat_member/my_chat_member
+// updates in "old→new" form (e.g. "member→administrator"), or empty string
+// for other updates. Missing statuses are reported as "unknown".
+func chatMemberTransition(update Update) string {
+	changed := update.ChatMember
+	if changed == nil {
+		changed = update.MyChatMember
+	}
+	if changed == nil {
+		return ""
+	}
+
+	return chatMemberStatus(changed.OldChatMember) + "→" + chatMemberStatus(changed.NewChatMember)
+}
+
+func chatMemberStatus(member gotgbot.ChatMember) string {
+	if member == nil || member.GetStatus() == "" {
+		return "unknown"
+	}
+	return member.GetStatus()
+}
+
+// updateTypes lists Bot API update types, as accepted by allowed_updates
+var updateTypes = []string{
+	"message",
+	"edited_message",
+	"channel_post",
+	"edited_channel_post",
+	"business_connection",
+	"business_message",
+	"edited_business_message",
+	"deleted_business_messages",
+	"message_reaction",
+	"message_reaction_count",
+	"inline_query",
+	"chosen_inline_result",
+	"callback_query",
+	"shipping_query",
+	"pre_checkout_query",
+	"purchased_paid_media",
+	"poll",
+	"poll_answer",
+	"my_chat_member",
+	"chat_member",
+	"chat_join_request",
+	"chat_boost",
+	"removed_chat_boost",
+}
+
+// updateType returns the type of the update (the name of its payload field,
+// e.g. "business_message"), or empty string for unknown updates
+func updateType(update Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.ChannelPost != nil:
+		return "channel_post"
+	case update.EditedChannelPost != nil:
+		return "edited_channel_post"
+	case update.BusinessConnection != nil:
+		return "business_connection"
+	case update.BusinessMessage != nil:
+		return "business_message"
+	case update.EditedBusinessMessage != nil:
+		return "edited_business_message"
+	case update.DeletedBusinessMessages != nil:
+		return "deleted_business_messages"
+	case update.MessageReaction != nil:
+		return "message_reaction"
+	case update.MessageReactionCount != nil:
+		return "message_reaction_count"
+	case update.InlineQuery != nil:
+		return "inline_query"
+	case update.ChosenInlineResult != nil:
+		return "chosen_inline_result"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.ShippingQuery != nil:
+		return "shipping_query"
+	case update.PreCheckoutQuery != nil:
+		return "pre_checkout_query"
+	case update.PurchasedPaidMedia != nil:
+		return "purchased_paid_media"
+	case update.Poll != nil:
+		return "poll"
+	case update.PollAnswer != nil:
+		return "poll_answer"
+	case update.MyChatMember != nil:
+		return "my_chat_member"
+	case update.ChatMember != nil:
+		return "chat_member"
+	case update.ChatJoinRequest != nil:
+		return "chat_join_request"
+	case update.ChatBoost != nil:
+		return "chat_boost"
+	case update.RemovedChatBoost != nil:
+		return "removed_chat_boost"
+	}
+	return ""
+}
+
+// businessConnectionID returns the business connection the update came
+// through, or empty string. Replies to business messages must be sent
+// with this connection id.
+func businessConnectionID(update Update) string {
+	switch {
+	case update.BusinessConnection != nil:
+		return update.BusinessConnection.Id
+	case update.BusinessMessage != nil:
+		return update.BusinessMessage.BusinessConnectionId
+	case update.EditedBusinessMessage != nil:
+		return update.EditedBusinessMessage.BusinessConnectionId
+	case update.DeletedBusinessMessages != nil:
+		return update.DeletedBusinessMessages.BusinessConnectionId
+	}
+	return ""
+}
+
+// updateChat returns the chat the update originates from, or nil
+func updateChat(update Update) *gotgbot.Chat {
+	switch {
+	case update.Message != nil:
+		return &update.Message.Chat
+	case update.EditedMessage != nil:
+		return &update.EditedMessage.Chat
+	case update.ChannelPost != nil:
+		return &update.ChannelPost.Chat
+	case update.EditedChannelPost != nil:
+		return &update.EditedChannelPost.Chat
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		chat := update.CallbackQuery.Message.GetChat()
+		return &chat
+	case update.ChatMember != nil:
+		return &update.ChatMember.Chat
+	case update.MyChatMember != nil:
+		return &update.MyChatMember.Chat
+	case update.ChatJoinRequest != nil:
+		return &update.ChatJoinRequest.Chat
+	case update.BusinessMessage != nil:
+		return &update.BusinessMessage.Chat
+	case update.EditedBusinessMessage != nil:
+		return &update.EditedBusinessMessage.Chat
+	case update.DeletedBusinessMessages != nil:
+		return &update.DeletedBusinessMessages.Chat
+	case update.MessageReaction != nil:
+		return &update.MessageReaction.Chat
+	case update.MessageReactionCount != nil:
+		return &update.MessageReactionCount.Chat
+	}
+	return nil
+}
+
+// updateSender returns the user who caused the update, or nil
+func updateSender(update Update) *gotgbot.User {
+	switch {
+	case update.Message != nil:
+		return update.Message.From
+	case update.EditedMessage != nil:
+		return update.EditedMessage.From
+	case update.CallbackQuery != nil:
+		return &update.CallbackQuery.From
+	case update.ChatMember != nil:
+		return &update.ChatMember.From
+	case update.MyChatMember != nil:
+		return &update.MyChatMember.From
+	case update.ChatJoinRequest != nil:
+		return &update.ChatJoinRequest.From
+	case update.BusinessMessage != nil:
+		return update.BusinessMessage.From
+	case update.EditedBusinessMessage != nil:
+		return update.EditedBusinessMessage.From
+	case update.BusinessConnection != nil:
+		return &update.BusinessConnection.User
+	case update.PollAnswer != nil:
+		return update.PollAnswer.User
+	case update.MessageReaction != nil:
+		return update.MessageReaction.User
+	}
+	return nil
+}
+
+// topic returns the forum topic (message_thread_id) of the update message,
+// or 0 for messages outside topics, including the General topic
+func topic(update Update) int64 {
+	msg := updateMessage(update)
+	if msg == nil || !msg.IsTopicMessage {
+		return 0
+	}
+	return msg.MessageThreadId
+}
+
+// subtype returns a computed sub-type for service messages that are easy to
+// miss among regular messages (forum topic events), or empty string
+func subtype(update Update) string {
+	msg := updateMessage(update)
+	if msg == nil {
+		return ""
+	}
+
+	switch {
+	case msg.ForumTopicCreated != nil:
+		return "forum_topic_created"
+	case msg.ForumTopicEdited != nil:
+		return "forum_topic_edited"
+	case msg.ForumTopicClosed != nil:
+		return "forum_topic_closed"
+	case msg.ForumTopicReopened != nil:
+		return "forum_topic_reopened"
+	case msg.GeneralForumTopicHidden != nil:
+		return "general_forum_topic_hidden"
+	case msg.GeneralForumTopicUnhidden != nil:
+		return "general_forum_topic_unhidden"
+	}
+	return ""
+}
+
+// replyTo returns the message in the same chat the update message replies to,
+// or nil. In forum topics Telegram sets reply_to_message to the topic creation
+// message for every message in the topic; that is not treated as a reply.
+// External replies (external_reply) have no message in the same chat and give nil.
+func replyTo(update Update) *gotgbot.Message {
+	msg := updateMessage(update)
+	if msg == nil || msg.ReplyToMessage == nil {
+		return nil
+	}
+
+	reply := msg.ReplyToMessage
+	if msg.IsTopicMessage && reply.ForumTopicCreated != nil && reply.MessageId == msg.MessageThreadId {
+		return nil
+	}
+	return reply
+}
+
+// isReply reports whether the update message is a reply, either to a message
+// in the same chat or an external reply
+func isReply(update Update) bool {
+	if replyTo(update) != nil {
+		return true
+	}
+	msg := updateMessage(update)
+	return msg != nil && msg.ExternalReply != nil
+}
+
+// Message origin types of forward_origin
+const (
+	OriginUser       = "user"
+	OriginHiddenUser = "hidden_user"
+	OriginChat       = "chat"
+	OriginChannel    = "channel"
+)
+
+// forwardOrigin returns forward_origin of the update message with all origin
+// variants merged into one struct, or nil if the message is not forwarded.
+// Fields not used by the origin Type are empty. The published payload keeps
+// forward_origin as received.
+func forwardOrigin(update Update) *gotgbot.MergedMessageOrigin {
+	msg := updateMessage(update)
+	if msg == nil || msg.ForwardOrigin == nil {
+		return nil
+	}
+
+	origin := msg.ForwardOrigin.MergeMessageOrigin()
+	return &origin
+}
+
+// ChatMigration describes a group upgraded to a supergroup.
+// The old chat id stops working after migration.
+type ChatMigration struct {
+	OldChatID int64 `json:"old_chat_id"`
+	NewChatID int64 `json:"new_chat_id"`
+}
+
+// chatMigration returns the migration carried by a migrate_from_chat_id
+// service message, or nil. Telegram also sends migrate_to_chat_id to the old
+// chat; it is ignored so that every migration is reported once.
+func chatMigration(update Update) *ChatMigration {
+	msg := update.Message
+	if msg == nil || msg.MigrateFromChatId == 0 {
+		return nil
+	}
+	return &ChatMigration{OldChatID: msg.MigrateFromChatId, NewChatID: msg.Chat.Id}
+}
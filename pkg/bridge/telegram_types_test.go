@@ -0,0 +1,383 @@
+package bridge
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatMemberTransition(t *testing.T) {
+	tests := []struct {
+		name   string
+		update string
+		want   string
+	}{
+		{
+			name: "promotion",
+			update: `{"update_id":1,"chat_member":{"chat":{"id":-100,"type":"supergroup"},"from":{"id":1,"is_bot":false,"first_name":"Admin"},"date":1,
+				"old_chat_member":{"status":"member","user":{"id":2,"is_bot":false,"first_name":"User"}},
+				"new_chat_member":{"status":"administrator","user":{"id":2,"is_bot":false,"first_name":"User"},"can_be_edited":true}}}`,
+			want: "member→administrator",
+		},
+		{
+			name: "demotion",
+			update: `{"update_id":1,"chat_member":{"chat":{"id":-100,"type":"supergroup"},"from":{"id":1,"is_bot":false,"first_name":"Admin"},"date":1,
+				"old_chat_member":{"status":"administrator","user":{"id":2,"is_bot":false,"first_name":"User"}},
+				"new_chat_member":{"status":"member","user":{"id":2,"is_bot":false,"first_name":"User"}}}}`,
+			want: "administrator→member",
+		},
+		{
+			name: "ban",
+			update: `{"update_id":1,"my_chat_member":{"chat":{"id":-100,"type":"supergroup"},"from":{"id":1,"is_bot":false,"first_name":"Admin"},"date":1,
+				"old_chat_member":{"status":"member","user":{"id":3,"is_bot":true,"first_name":"Bot"}},
+				"new_chat_member":{"status":"kicked","user":{"id":3,"is_bot":true,"first_name":"Bot"},"until_date":0}}}`,
+			want: "member→kicked",
+		},
+		{
+			name: "join via invite",
+			update: `{"update_id":1,"chat_member":{"chat":{"id":-100,"type":"supergroup"},"from":{"id":2,"is_bot":false,"first_name":"User"},"date":1,
+				"old_chat_member":{"status":"left","user":{"id":2,"is_bot":false,"first_name":"User"}},
+				"new_chat_member":{"status":"member","user":{"id":2,"is_bot":false,"first_name":"User"}},
+				"invite_link":{"invite_link":"https://t.me/+abc","creator":{"id":1,"is_bot":false,"first_name":"Admin"},"creates_join_request":false,"is_primary":false,"is_revoked":false}}}`,
+			want: "left→member",
+		},
+		{
+			name:   "not a chat member update",
+			update: `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"hello"}}`,
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update Update
+			require.NoError(t, json.Unmarshal([]byte(tt.update), &update))
+			assert.Equal(t, tt.want, chatMemberTransition(update))
+		})
+	}
+}
+
+func TestChatMemberTransition_UnknownStatus(t *testing.T) {
+	update := Update{
+		UpdateId: 1,
+		MyChatMember: &gotgbot.ChatMemberUpdated{
+			NewChatMember: gotgbot.ChatMemberMember{},
+		},
+	}
+
+	assert.Equal(t, "unknown→member", chatMemberTransition(update))
+}
+
+func TestChatMigration(t *testing.T) {
+	tests := []struct {
+		name   string
+		update string
+		want   *ChatMigration
+	}{
+		{
+			name:   "migrate to chat id in old group is ignored",
+			update: `{"update_id":1,"message":{"message_id":10,"date":1,"chat":{"id":-123,"type":"group"},"migrate_to_chat_id":-1001234567890}}`,
+			want:   nil,
+		},
+		{
+			name:   "migrate from chat id in new supergroup",
+			update: `{"update_id":2,"message":{"message_id":1,"date":1,"chat":{"id":-1001234567890,"type":"supergroup"},"migrate_from_chat_id":-123}}`,
+			want:   &ChatMigration{OldChatID: -123, NewChatID: -1001234567890},
+		},
+		{
+			name:   "regular message",
+			update: `{"update_id":3,"message":{"message_id":11,"date":1,"chat":{"id":-123,"type":"group"},"text":"hello"}}`,
+			want:   nil,
+		},
+		{
+			name:   "not a message",
+			update: `{"update_id":4,"callback_query":{"id":"1","from":{"id":1,"is_bot":false,"first_name":"User"},"chat_instance":"1"}}`,
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update Update
+			require.NoError(t, json.Unmarshal([]byte(tt.update), &update))
+			assert.Equal(t, tt.want, chatMigration(update))
+		})
+	}
+}
+
+func TestForwardOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		check  func(t *testing.T, origin *gotgbot.MergedMessageOrigin)
+	}{
+		{
+			name:   "user",
+			origin: `{"type":"user","date":100,"sender_user":{"id":7,"is_bot":false,"first_name":"Ann"}}`,
+			check: func(t *testing.T, origin *gotgbot.MergedMessageOrigin) {
+				assert.Equal(t, OriginUser, origin.Type)
+				assert.Equal(t, int64(100), origin.Date)
+				require.NotNil(t, origin.SenderUser)
+				assert.Equal(t, int64(7), origin.SenderUser.Id)
+			},
+		},
+		{
+			name:   "hidden user",
+			origin: `{"type":"hidden_user","date":100,"sender_user_name":"Secret Sam"}`,
+			check: func(t *testing.T, origin *gotgbot.MergedMessageOrigin) {
+				assert.Equal(t, OriginHiddenUser, origin.Type)
+				assert.Equal(t, "Secret Sam", origin.SenderUserName)
+				assert.Nil(t, origin.SenderUser)
+			},
+		},
+		{
+			name:   "chat",
+			origin: `{"type":"chat","date":100,"sender_chat":{"id":-100,"type":"supergroup","title":"Group"},"author_signature":"admin"}`,
+			check: func(t *testing.T, origin *gotgbot.MergedMessageOrigin) {
+				assert.Equal(t, OriginChat, origin.Type)
+				require.NotNil(t, origin.SenderChat)
+				assert.Equal(t, int64(-100), origin.SenderChat.Id)
+				assert.Equal(t, "admin", origin.AuthorSignature)
+			},
+		},
+		{
+			name:   "channel",
+			origin: `{"type":"channel","date":100,"chat":{"id":-200,"type":"channel","title":"News"},"message_id":55}`,
+			check: func(t *testing.T, origin *gotgbot.MergedMessageOrigin) {
+				assert.Equal(t, OriginChannel, origin.Type)
+				require.NotNil(t, origin.Chat)
+				assert.Equal(t, int64(-200), origin.Chat.Id)
+				assert.Equal(t, int64(55), origin.MessageId)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := `{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"hi","forward_origin":` + tt.origin + `}}`
+
+			var update Update
+			require.NoError(t, json.Unmarshal([]byte(raw), &update))
+
+			origin := forwardOrigin(update)
+			require.NotNil(t, origin)
+			tt.check(t, origin)
+
+			// The payload keeps forward_origin as received
+			data, err := json.Marshal(update)
+			require.NoError(t, err)
+			var payload struct {
+				Message struct {
+					ForwardOrigin json.RawMessage `json:"forward_origin"`
+				} `json:"message"`
+			}
+			require.NoError(t, json.Unmarshal(data, &payload))
+			assert.JSONEq(t, tt.origin, string(payload.Message.ForwardOrigin))
+		})
+	}
+
+	t.Run("not forwarded", func(t *testing.T) {
+		var update Update
+		require.NoError(t, json.Unmarshal([]byte(`{"update_id":1,"message":{"message_id":1,"date":1,"chat":{"id":1,"type":"private"},"text":"hi"}}`), &update))
+		assert.Nil(t, forwardOrigin(update))
+		assert.Nil(t, forwardOrigin(Update{UpdateId: 2}))
+	})
+}
+
+func TestTopicAndSubtype(t *testing.T) {
+	tests := []struct {
+		name        string
+		update      string
+		wantTopic   int64
+		wantSubtype string
+	}{
+		{
+			name:      "message in topic",
+			update:    `{"update_id":1,"message":{"message_id":20,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"text":"hi"}}`,
+			wantTopic: 15,
+		},
+		{
+			name:      "message in general topic",
+			update:    `{"update_id":2,"message":{"message_id":21,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"text":"hi"}}`,
+			wantTopic: 0,
+		},
+		{
+			name:      "reply thread outside forum",
+			update:    `{"update_id":3,"message":{"message_id":22,"message_thread_id":10,"date":1,"chat":{"id":-1001234567890,"type":"supergroup"},"text":"hi"}}`,
+			wantTopic: 0,
+		},
+		{
+			name:        "topic created",
+			update:      `{"update_id":4,"message":{"message_id":15,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"forum_topic_created":{"name":"Support","icon_color":7322096}}}`,
+			wantTopic:   15,
+			wantSubtype: "forum_topic_created",
+		},
+		{
+			name:        "topic edited",
+			update:      `{"update_id":5,"message":{"message_id":30,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"forum_topic_edited":{"name":"Help"}}}`,
+			wantTopic:   15,
+			wantSubtype: "forum_topic_edited",
+		},
+		{
+			name:        "topic closed",
+			update:      `{"update_id":6,"message":{"message_id":31,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"forum_topic_closed":{}}}`,
+			wantTopic:   15,
+			wantSubtype: "forum_topic_closed",
+		},
+		{
+			name:        "topic reopened",
+			update:      `{"update_id":7,"message":{"message_id":32,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-1001234567890,"type":"supergroup","is_forum":true},"forum_topic_reopened":{}}}`,
+			wantTopic:   15,
+			wantSubtype: "forum_topic_reopened",
+		},
+		{
+			name:   "not a message",
+			update: `{"update_id":8,"callback_query":{"id":"1","from":{"id":1,"is_bot":false,"first_name":"User"},"chat_instance":"1"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update Update
+			require.NoError(t, json.Unmarshal([]byte(tt.update), &update))
+			assert.Equal(t, tt.wantTopic, topic(update))
+			assert.Equal(t, tt.wantSubtype, subtype(update))
+		})
+	}
+}
+
+// loadUpdateFixture reads an update from testdata/updates
+func loadUpdateFixture(t *testing.T, name string) Update {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "updates", name+".json"))
+	require.NoError(t, err)
+
+	var update Update
+	require.NoError(t, json.Unmarshal(data, &update))
+	return update
+}
+
+func TestBusinessUpdates(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		chatID   int64
+		senderID int64
+		text     string
+	}{
+		{fixture: "business_connection", senderID: 555},
+		{fixture: "business_message", chatID: 777, senderID: 777, text: "Is the shop open today?"},
+		{fixture: "edited_business_message", chatID: 777, senderID: 777, text: "Is the shop open tomorrow?"},
+		{fixture: "deleted_business_messages", chatID: 777},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			update := loadUpdateFixture(t, tt.fixture)
+
+			assert.Equal(t, tt.fixture, updateType(update))
+			assert.Equal(t, "bc-123", businessConnectionID(update))
+
+			if chat := updateChat(update); tt.chatID != 0 {
+				require.NotNil(t, chat)
+				assert.Equal(t, tt.chatID, chat.Id)
+			} else {
+				assert.Nil(t, chat)
+			}
+
+			if sender := updateSender(update); tt.senderID != 0 {
+				require.NotNil(t, sender)
+				assert.Equal(t, tt.senderID, sender.Id)
+			} else {
+				assert.Nil(t, sender)
+			}
+
+			text, _ := messageEntities(update)
+			assert.Equal(t, tt.text, text)
+		})
+	}
+}
+
+func TestUpdateType(t *testing.T) {
+	assert.Equal(t, "message", updateType(Update{Message: &gotgbot.Message{}}))
+	assert.Equal(t, "callback_query", updateType(Update{CallbackQuery: &gotgbot.CallbackQuery{}}))
+	assert.Equal(t, "removed_chat_boost", updateType(Update{RemovedChatBoost: &gotgbot.ChatBoostRemoved{}}))
+	assert.Empty(t, updateType(Update{UpdateId: 1}))
+	assert.Empty(t, businessConnectionID(Update{Message: &gotgbot.Message{}}))
+}
+
+func TestReplyTo(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    string
+		wantReply bool
+		wantID    int64
+		wantUser  int64
+	}{
+		{
+			name:      "reply",
+			update:    `{"update_id":1,"message":{"message_id":11,"date":1,"chat":{"id":-100,"type":"group"},"text":"agreed","reply_to_message":{"message_id":10,"date":1,"chat":{"id":-100,"type":"group"},"from":{"id":7,"is_bot":false,"first_name":"Ann"},"text":"lunch?"}}}`,
+			wantReply: true,
+			wantID:    10,
+			wantUser:  7,
+		},
+		{
+			name:      "reply with quote to a channel post",
+			update:    `{"update_id":2,"message":{"message_id":11,"date":1,"chat":{"id":-100,"type":"supergroup"},"text":"agreed","quote":{"text":"lunch","position":0},"reply_to_message":{"message_id":10,"date":1,"chat":{"id":-100,"type":"supergroup"},"sender_chat":{"id":-200,"type":"channel"},"text":"lunch?"}}}`,
+			wantReply: true,
+			wantID:    10,
+		},
+		{
+			name:   "topic message without explicit reply",
+			update: `{"update_id":3,"message":{"message_id":21,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-100,"type":"supergroup","is_forum":true},"text":"hi","reply_to_message":{"message_id":15,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-100,"type":"supergroup","is_forum":true},"forum_topic_created":{"name":"Support","icon_color":7322096}}}}`,
+		},
+		{
+			name:      "reply in topic",
+			update:    `{"update_id":4,"message":{"message_id":22,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-100,"type":"supergroup","is_forum":true},"text":"same","reply_to_message":{"message_id":21,"message_thread_id":15,"is_topic_message":true,"date":1,"chat":{"id":-100,"type":"supergroup","is_forum":true},"from":{"id":8,"is_bot":false,"first_name":"Bob"},"text":"hi"}}}`,
+			wantReply: true,
+			wantID:    21,
+			wantUser:  8,
+		},
+		{
+			name:      "external reply",
+			update:    `{"update_id":5,"message":{"message_id":11,"date":1,"chat":{"id":1,"type":"private"},"text":"look","external_reply":{"origin":{"type":"channel","date":1,"chat":{"id":-200,"type":"channel"},"message_id":5},"chat":{"id":-200,"type":"channel"},"message_id":5}}}`,
+			wantReply: true,
+		},
+		{
+			name:   "not a reply",
+			update: `{"update_id":6,"message":{"message_id":11,"date":1,"chat":{"id":1,"type":"private"},"text":"hi"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update Update
+			require.NoError(t, json.Unmarshal([]byte(tt.update), &update))
+
+			assert.Equal(t, tt.wantReply, isReply(update))
+
+			reply := replyTo(update)
+			headers := updateHeaders(update, "")
+			if tt.wantID == 0 {
+				assert.Nil(t, reply)
+				assert.NotContains(t, headers, ReplyToMessageIDHeader)
+				return
+			}
+
+			require.NotNil(t, reply)
+			assert.Equal(t, tt.wantID, reply.MessageId)
+			assert.Equal(t, strconv.FormatInt(tt.wantID, 10), headers[ReplyToMessageIDHeader])
+			if tt.wantUser != 0 {
+				assert.Equal(t, strconv.FormatInt(tt.wantUser, 10), headers[ReplyToUserIDHeader])
+			} else {
+				assert.NotContains(t, headers, ReplyToUserIDHeader)
+			}
+		})
+	}
+}
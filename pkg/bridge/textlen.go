@@ -0,0 +1,69 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf16"
+)
+
+// exprLen is the expr len helper replacing the builtin one: strings are
+// measured in UTF-16 code units, not bytes, like Telegram counts message
+// length and entity offsets; arrays, slices and maps in elements. nil,
+// including a missing field reached with ?., has length 0 instead of
+// failing the expression.
+func exprLen(x interface{}) (int, error) {
+	switch v := x.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		return utf16Len(v), nil
+	case json.Number:
+		return utf16Len(v.String()), nil
+	}
+
+	v := reflect.ValueOf(x)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return 0, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		return v.Len(), nil
+	case reflect.String:
+		return utf16Len(v.String()), nil
+	}
+	return 0, fmt.Errorf("invalid argument for len (type %T)", x)
+}
+
+// utf16Len returns the length of s in UTF-16 code units: characters outside
+// the Basic Multilingual Plane, such as most emoji, count twice
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// wordCount is the expr helper counting words of a text: runs of characters
+// separated by Unicode whitespace. nil and empty strings have 0 words.
+func wordCount(x interface{}) (int, error) {
+	switch v := x.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		return len(strings.Fields(v)), nil
+	case *string:
+		if v == nil {
+			return 0, nil
+		}
+		return len(strings.Fields(*v)), nil
+	case json.Number:
+		return len(strings.Fields(v.String())), nil
+	}
+	return 0, fmt.Errorf("invalid argument for wordCount (type %T)", x)
+}
@@ -0,0 +1,147 @@
+package bridge
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExprLen(t *testing.T) {
+	var nilMessage *gotgbot.Message
+	text := "привет"
+
+	tests := []struct {
+		name string
+		x    interface{}
+		want int
+	}{
+		{"nil", nil, 0},
+		{"empty", "", 0},
+		{"ascii", "hello", 5},
+		{"multi-byte", "привет", 6},
+		{"emoji in surrogate pairs", "👍🏻", 4},
+		{"json number", json.Number("-1001234567890"), 14},
+		{"string pointer", &text, 6},
+		{"slice", []gotgbot.MessageEntity{{Type: "bold"}, {Type: "url"}}, 2},
+		{"empty slice", []gotgbot.PhotoSize(nil), 0},
+		{"map", map[string]interface{}{"a": 1}, 1},
+		{"nil pointer", nilMessage, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := exprLen(tt.x)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := exprLen(42)
+	assert.ErrorContains(t, err, "invalid argument for len (type int)")
+}
+
+func TestWordCount(t *testing.T) {
+	tests := []struct {
+		name string
+		x    interface{}
+		want int
+	}{
+		{"nil", nil, 0},
+		{"empty", "", 0},
+		{"spaces only", "  \n\t ", 0},
+		{"one", "hi", 1},
+		{"surrounding spaces", "  buy cheap  now ", 3},
+		{"newlines and tabs", "line one\nline\ttwo", 4},
+		{"multi-byte", "привет, как дела?", 3},
+		{"no-break space", "a b", 2},
+		{"json number", json.Number("12"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wordCount(tt.x)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := wordCount(42)
+	assert.ErrorContains(t, err, "invalid argument for wordCount (type int)")
+}
+
+func TestRouter_Route_TextLength(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	routes := []Route{
+		{
+			Condition: "len(update.Message?.Text) > 4000",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.flood"},
+		},
+		{
+			Condition: "update.Message != nil && wordCount(update.Message.Text) < 3",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.short"},
+		},
+		{
+			Condition: "len(update.Message?.Entities) > 0",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.entities"},
+		},
+		{
+			Condition: "true",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.other"},
+		},
+	}
+	router, err := NewRouter(routes, "first", 5, logger)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		update Update
+		want   string
+	}{
+		{
+			name:   "long text in characters",
+			update: Update{Message: &gotgbot.Message{Text: strings.Repeat("я ", 2001)}},
+			want:   "telegram.flood",
+		},
+		{
+			name:   "4000 characters in 7000 bytes",
+			update: Update{Message: &gotgbot.Message{Text: strings.Repeat("яяя ", 1000)}},
+			want:   "telegram.other",
+		},
+		{
+			name:   "short text",
+			update: Update{Message: &gotgbot.Message{Text: "buy now"}},
+			want:   "telegram.short",
+		},
+		{
+			name: "entities",
+			update: Update{Message: &gotgbot.Message{
+				Text:     "see https://example.com today",
+				Entities: []gotgbot.MessageEntity{{Type: "url", Offset: 4, Length: 19}},
+			}},
+			want: "telegram.entities",
+		},
+		{
+			name:   "no message",
+			update: Update{CallbackQuery: &gotgbot.CallbackQuery{Data: "x"}},
+			want:   "telegram.other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dests, err := router.Route(tt.update)
+			require.NoError(t, err)
+			require.Len(t, dests, 1)
+			assert.Equal(t, tt.want, dests[0].Subject)
+		})
+	}
+}
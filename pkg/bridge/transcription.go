@@ -0,0 +1,161 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// DefaultTranscriptionTimeoutMs is the default time to wait for a transcript,
+// speech recognition of a long voice note takes a while
+const DefaultTranscriptionTimeoutMs = 30000
+
+// videoNoteMimeType is the MIME type of video notes, Telegram doesn't send one
+const videoNoteMimeType = "video/mp4"
+
+// TranscriptionRequest is sent to transcription_request_subject for a voice
+// note or a video note. FilePath comes from getFile and is empty when the
+// lookup failed; the file is downloaded from the Bot API file endpoint.
+type TranscriptionRequest struct {
+	Kind         string `json:"kind"`
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Duration     int64  `json:"duration"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int64  `json:"file_size,omitempty"`
+	FilePath     string `json:"file_path,omitempty"`
+	ChatID       int64  `json:"chat_id"`
+	MessageID    int64  `json:"message_id"`
+	UpdateID     int64  `json:"update_id"`
+}
+
+// TranscriptionReply is the expected reply on the transcription request subject
+type TranscriptionReply struct {
+	Text *string `json:"text"`
+}
+
+// TranscribedUpdate is an update published with the transcript of its voice
+// note or video note
+type TranscribedUpdate struct {
+	Update
+	Enriched   *Enrichment `json:"_enriched,omitempty"`
+	Transcript string      `json:"transcript"`
+}
+
+// transcribedUpdate returns the update with enrichment and transcript attached
+func transcribedUpdate(update Update, enriched *Enrichment, transcript string) interface{} {
+	return TranscribedUpdate{Update: update, Enriched: enriched, Transcript: transcript}
+}
+
+// fileGetter looks up file metadata via Bot API getFile
+type fileGetter interface {
+	GetFile(ctx context.Context, fileID string) (*gotgbot.File, error)
+}
+
+// Transcriber asks an external service for transcripts of voice notes and
+// video notes over NATS request-reply
+type Transcriber struct {
+	requester RequesterInterface
+	files     fileGetter
+	subject   string
+	timeout   time.Duration
+	logger    *slog.Logger
+}
+
+// NewTranscriber creates a new Transcriber
+func NewTranscriber(requester RequesterInterface, files fileGetter, subject string, timeout time.Duration, logger *slog.Logger) *Transcriber {
+	return &Transcriber{
+		requester: requester,
+		files:     files,
+		subject:   subject,
+		timeout:   timeout,
+		logger:    logger,
+	}
+}
+
+// transcriptionRequest describes the voice note or video note of the
+// update, it returns nil for other updates
+func transcriptionRequest(update Update) *TranscriptionRequest {
+	msg := updateMessage(update)
+	if msg == nil {
+		return nil
+	}
+
+	req := TranscriptionRequest{
+		ChatID:    msg.Chat.Id,
+		MessageID: msg.MessageId,
+		UpdateID:  update.UpdateId,
+	}
+	switch {
+	case msg.Voice != nil:
+		req.Kind = "voice"
+		req.FileID = msg.Voice.FileId
+		req.FileUniqueID = msg.Voice.FileUniqueId
+		req.Duration = msg.Voice.Duration
+		req.MimeType = msg.Voice.MimeType
+		req.FileSize = msg.Voice.FileSize
+	case msg.VideoNote != nil:
+		req.Kind = "video_note"
+		req.FileID = msg.VideoNote.FileId
+		req.FileUniqueID = msg.VideoNote.FileUniqueId
+		req.Duration = msg.VideoNote.Duration
+		req.MimeType = videoNoteMimeType
+		req.FileSize = msg.VideoNote.FileSize
+	default:
+		return nil
+	}
+	return &req
+}
+
+// Transcribe requests the transcript of the update's voice note or video
+// note. It reports false for other updates and when no transcript arrived
+// within the timeout, the update is then published without it.
+func (t *Transcriber) Transcribe(ctx context.Context, update Update) (string, bool) {
+	req := transcriptionRequest(update)
+	if req == nil {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	if file, err := t.files.GetFile(ctx, req.FileID); err != nil {
+		t.logger.Warn("failed to get file for transcription", "file_id", req.FileID, "error", err)
+	} else {
+		req.FilePath = file.FilePath
+		if file.FileSize > 0 {
+			req.FileSize = file.FileSize
+		}
+	}
+
+	text, err := t.request(ctx, req)
+	if err != nil {
+		t.logger.Warn("no transcript, publishing without it", "subject", t.subject, "kind", req.Kind, "error", err)
+		return "", false
+	}
+	return text, true
+}
+
+func (t *Transcriber) request(ctx context.Context, req *TranscriptionRequest) (string, error) {
+	if t.requester == nil {
+		return "", fmt.Errorf("broker does not support request-reply")
+	}
+
+	data, err := t.requester.Request(ctx, t.subject, req)
+	if err != nil {
+		return "", err
+	}
+
+	var reply TranscriptionReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return "", fmt.Errorf("failed to decode transcription reply: %w", err)
+	}
+	if reply.Text == nil {
+		return "", fmt.Errorf("transcription reply has no text")
+	}
+	return *reply.Text, nil
+}
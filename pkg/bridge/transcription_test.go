@@ -0,0 +1,184 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFileGetter struct {
+	file *gotgbot.File
+	err  error
+}
+
+func (f *fakeFileGetter) GetFile(ctx context.Context, fileID string) (*gotgbot.File, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.file, nil
+}
+
+// runTranscriptionResponder answers transcription requests with reply, a nil
+// reply leaves requests unanswered. Received requests are sent to the
+// returned channel.
+func runTranscriptionResponder(t *testing.T, url string, reply []byte) <-chan TranscriptionRequest {
+	t.Helper()
+
+	conn, err := nats.Connect(url)
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+
+	requests := make(chan TranscriptionRequest, 10)
+	_, err = conn.Subscribe("transcribe", func(msg *nats.Msg) {
+		var req TranscriptionRequest
+		assert.NoError(t, json.Unmarshal(msg.Data, &req))
+		requests <- req
+		if reply != nil {
+			msg.Respond(reply)
+		}
+	})
+	require.NoError(t, err)
+	require.NoError(t, conn.Flush())
+	return requests
+}
+
+func voiceUpdate() Update {
+	return Update{
+		UpdateId: 7,
+		Message: &gotgbot.Message{
+			MessageId: 42,
+			Chat:      gotgbot.Chat{Id: -100123, Type: "supergroup"},
+			Voice:     &gotgbot.Voice{FileId: "voice-1", FileUniqueId: "u1", Duration: 12, MimeType: "audio/ogg", FileSize: 2048},
+		},
+	}
+}
+
+func TestTranscriber_Transcribe(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	srv := runEmbeddedNATS(t)
+
+	client := NewNATSClient(srv.ClientURL(), WithNATSLogger(logger))
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	files := &fakeFileGetter{file: &gotgbot.File{FileId: "voice-1", FilePath: "voice/file_3.oga", FileSize: 2048}}
+
+	t.Run("voice", func(t *testing.T) {
+		requests := runTranscriptionResponder(t, srv.ClientURL(), []byte(`{"text":"привет, это тест"}`))
+		transcriber := NewTranscriber(client, files, "transcribe", time.Second, logger)
+
+		text, ok := transcriber.Transcribe(context.Background(), voiceUpdate())
+		require.True(t, ok)
+		assert.Equal(t, "привет, это тест", text)
+		assert.Equal(t, TranscriptionRequest{
+			Kind:         "voice",
+			FileID:       "voice-1",
+			FileUniqueID: "u1",
+			Duration:     12,
+			MimeType:     "audio/ogg",
+			FileSize:     2048,
+			FilePath:     "voice/file_3.oga",
+			ChatID:       -100123,
+			MessageID:    42,
+			UpdateID:     7,
+		}, <-requests)
+	})
+
+	t.Run("video note", func(t *testing.T) {
+		requests := runTranscriptionResponder(t, srv.ClientURL(), []byte(`{"text":""}`))
+		transcriber := NewTranscriber(client, &fakeFileGetter{err: errors.New("file is too big")}, "transcribe", time.Second, logger)
+
+		update := Update{UpdateId: 8, ChannelPost: &gotgbot.Message{
+			MessageId: 5,
+			Chat:      gotgbot.Chat{Id: -100456, Type: "channel"},
+			VideoNote: &gotgbot.VideoNote{FileId: "note-1", FileUniqueId: "u2", Duration: 30, Length: 240},
+		}}
+		text, ok := transcriber.Transcribe(context.Background(), update)
+		require.True(t, ok, "an empty transcript is still a transcript")
+		assert.Empty(t, text)
+
+		req := <-requests
+		assert.Equal(t, "video_note", req.Kind)
+		assert.Equal(t, "video/mp4", req.MimeType)
+		assert.Equal(t, int64(30), req.Duration)
+		assert.Empty(t, req.FilePath, "getFile failures don't stop the request")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		requests := runTranscriptionResponder(t, srv.ClientURL(), nil)
+		transcriber := NewTranscriber(client, files, "transcribe", 100*time.Millisecond, logger)
+
+		start := time.Now()
+		_, ok := transcriber.Transcribe(context.Background(), voiceUpdate())
+		assert.False(t, ok)
+		assert.Less(t, time.Since(start), time.Second)
+		<-requests
+	})
+
+	t.Run("reply without text", func(t *testing.T) {
+		runTranscriptionResponder(t, srv.ClientURL(), []byte(`{"error":"unsupported language"}`))
+		transcriber := NewTranscriber(client, files, "transcribe", time.Second, logger)
+
+		_, ok := transcriber.Transcribe(context.Background(), voiceUpdate())
+		assert.False(t, ok)
+	})
+
+	t.Run("not a voice note", func(t *testing.T) {
+		requests := runTranscriptionResponder(t, srv.ClientURL(), []byte(`{"text":"x"}`))
+		transcriber := NewTranscriber(client, files, "transcribe", time.Second, logger)
+
+		_, ok := transcriber.Transcribe(context.Background(), Update{Message: &gotgbot.Message{Text: "hi"}})
+		assert.False(t, ok)
+		assert.Empty(t, requests)
+	})
+}
+
+func TestTranscribedUpdate_JSON(t *testing.T) {
+	update := voiceUpdate()
+	payload := transcribedUpdate(update, nil, "hello")
+
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "hello", got["transcript"])
+	assert.Equal(t, float64(7), got["update_id"])
+	assert.Contains(t, got, "message")
+	assert.NotContains(t, got, "_enriched")
+
+	assert.Equal(t, update, unwrapUpdate(StringIDsPayload{Payload: BotMeta{ID: 1}.wrap(payload)}))
+}
+
+func TestRouter_Route_RequestTranscription(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	routes := []Route{
+		{
+			Condition:            "update.Message?.Voice != nil",
+			Subject:              &RouteSubject{Type: SubjectTypeString, Value: "telegram.voice"},
+			RequestTranscription: true,
+		},
+		{
+			Condition: "update.Message != nil",
+			Subject:   &RouteSubject{Type: SubjectTypeString, Value: "telegram.messages"},
+		},
+	}
+	router, err := NewRouter(routes, "all", 5, logger)
+	require.NoError(t, err)
+
+	dests, err := router.Route(voiceUpdate())
+	require.NoError(t, err)
+	require.Len(t, dests, 2)
+	assert.True(t, dests[0].Transcribe)
+	assert.False(t, dests[1].Transcribe)
+}
@@ -0,0 +1,120 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// WatchdogExitCode is the exit code used when the bridge stops on ErrWatchdogStall
+const WatchdogExitCode = 3
+
+// ErrWatchdogStall is returned by Run when watchdog.action is exit and the
+// poll loop missed its heartbeat
+var ErrWatchdogStall = errors.New("poll loop stalled")
+
+// Watchdog detects a stalled poll loop: the loop calls Beat on every
+// iteration, and a missing heartbeat for longer than timeout is reported
+type Watchdog struct {
+	timeout  time.Duration
+	interval time.Duration
+	action   WatchdogAction
+	lastBeat atomic.Int64
+	healthy  atomic.Bool
+	// idle counts intentional waits in progress, no stall is reported during them
+	idle atomic.Int32
+	// stopped is set once the exit action canceled the run
+	stopped atomic.Bool
+	stop    context.CancelFunc
+	logger  *slog.Logger
+}
+
+// NewWatchdog creates a new Watchdog
+func NewWatchdog(timeout, interval time.Duration, action WatchdogAction, logger *slog.Logger) *Watchdog {
+	w := &Watchdog{
+		timeout:  timeout,
+		interval: interval,
+		action:   action,
+		stop:     func() {},
+		logger:   logger,
+	}
+	w.lastBeat.Store(time.Now().UnixNano())
+	w.healthy.Store(true)
+	return w
+}
+
+// Beat records a heartbeat from the poll loop
+func (w *Watchdog) Beat() {
+	w.lastBeat.Store(time.Now().UnixNano())
+	if !w.healthy.Swap(true) {
+		w.logger.Info("poll loop heartbeat restored")
+	}
+}
+
+// Idle runs wait, an intentional pause of the poll loop such as a backoff,
+// without reporting a stall, and records a heartbeat when it returns
+func (w *Watchdog) Idle(wait func()) {
+	w.idle.Add(1)
+	defer func() {
+		w.idle.Add(-1)
+		w.Beat()
+	}()
+	wait()
+}
+
+// Healthy reports whether the poll loop sent a heartbeat within timeout
+func (w *Watchdog) Healthy() bool {
+	return w.healthy.Load()
+}
+
+// Stopped reports whether the exit action canceled the run
+func (w *Watchdog) Stopped() bool {
+	return w.stopped.Load()
+}
+
+// Run checks heartbeats every interval until ctx is done. With the exit
+// action a stall calls cancel.
+func (w *Watchdog) Run(ctx context.Context, cancel context.CancelFunc) {
+	w.stop = cancel
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+// check reports a stall once per missed heartbeat period
+func (w *Watchdog) check(now time.Time) {
+	since := now.Sub(time.Unix(0, w.lastBeat.Load()))
+	if since < w.timeout || !w.healthy.Load() || w.idle.Load() > 0 {
+		return
+	}
+
+	w.healthy.Store(false)
+	w.logger.Error("poll loop stalled: no heartbeat",
+		"since_last_heartbeat", since,
+		"timeout", w.timeout,
+		"action", w.action,
+		"goroutines", goroutineDump())
+
+	if w.action == WatchdogActionExit {
+		w.stopped.Store(true)
+		w.stop()
+	}
+}
+
+// goroutineDump returns stacks of all goroutines
+func goroutineDump() string {
+	buf := make([]byte, 1<<20)
+	n := runtime.Stack(buf, true)
+	return string(buf[:n])
+}
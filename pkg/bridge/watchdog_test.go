@@ -0,0 +1,56 @@
+package bridge
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdog_Check(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError + 4,
+	}))
+
+	t.Run("warn marks unhealthy until next heartbeat", func(t *testing.T) {
+		w := NewWatchdog(time.Minute, time.Second, WatchdogActionWarn, logger)
+		w.stop = func() { t.Fatal("warn action must not stop the run") }
+
+		w.check(time.Now().Add(30 * time.Second))
+		assert.True(t, w.Healthy())
+
+		w.check(time.Now().Add(2 * time.Minute))
+		assert.False(t, w.Healthy())
+
+		w.Beat()
+		assert.True(t, w.Healthy())
+	})
+
+	t.Run("exit action stops the run", func(t *testing.T) {
+		var stops int
+		w := NewWatchdog(time.Minute, time.Second, WatchdogActionExit, logger)
+		w.stop = func() { stops++ }
+
+		w.check(time.Now().Add(2 * time.Minute))
+		// Stall is reported once
+		w.check(time.Now().Add(3 * time.Minute))
+
+		assert.Equal(t, 1, stops)
+		assert.True(t, w.Stopped())
+	})
+	t.Run("idle wait is not a stall", func(t *testing.T) {
+		w := NewWatchdog(time.Minute, time.Second, WatchdogActionExit, logger)
+		w.stop = func() { t.Fatal("idle wait must not stop the run") }
+
+		w.Idle(func() {
+			w.check(time.Now().Add(2 * time.Minute))
+			assert.True(t, w.Healthy())
+		})
+
+		// Idle records a heartbeat on return
+		w.check(time.Now().Add(30 * time.Second))
+		assert.True(t, w.Healthy())
+	})
+}
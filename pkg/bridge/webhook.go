@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// WebhookDeleter is the part of TelegramClient used by delete-webhook
+type WebhookDeleter interface {
+	GetWebhookInfo(ctx context.Context) (*gotgbot.WebhookInfo, error)
+	DeleteWebhook(ctx context.Context, dropPending bool) error
+}
+
+// DeleteWebhook deletes the webhook and writes the webhook info before and
+// after to out
+func DeleteWebhook(ctx context.Context, client WebhookDeleter, out io.Writer, dropPending bool) error {
+	before, err := client.GetWebhookInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get webhook info: %w", err)
+	}
+	printWebhookInfo(out, "before", before)
+
+	if err := client.DeleteWebhook(ctx, dropPending); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if dropPending {
+		fmt.Fprintln(out, "webhook deleted, pending updates dropped")
+	} else {
+		fmt.Fprintln(out, "webhook deleted")
+	}
+
+	after, err := client.GetWebhookInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get webhook info: %w", err)
+	}
+	printWebhookInfo(out, "after", after)
+	return nil
+}
+
+func printWebhookInfo(out io.Writer, label string, info *gotgbot.WebhookInfo) {
+	url := info.Url
+	if url == "" {
+		url = "(none)"
+	}
+	fmt.Fprintf(out, "%s: url=%s pending_update_count=%d", label, url, info.PendingUpdateCount)
+	if info.LastErrorMessage != "" {
+		fmt.Fprintf(out, " last_error=%q", info.LastErrorMessage)
+	}
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,106 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWebhookServer fakes getWebhookInfo and deleteWebhook for a bot with a
+// webhook set and two pending updates
+func newWebhookServer(t *testing.T, deleteResponse string) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var calls []string
+	url, pending := "https://example.com/hook", 2
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/bottest-token/getWebhookInfo":
+			calls = append(calls, "getWebhookInfo")
+			fmt.Fprintf(w, `{"ok":true,"result":{"url":%q,"has_custom_certificate":false,"pending_update_count":%d}}`, url, pending)
+		case "/bottest-token/deleteWebhook":
+			var params struct {
+				DropPendingUpdates bool `json:"drop_pending_updates"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+			calls = append(calls, fmt.Sprintf("deleteWebhook drop=%t", params.DropPendingUpdates))
+			if deleteResponse != "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, deleteResponse)
+				return
+			}
+			url = ""
+			if params.DropPendingUpdates {
+				pending = 0
+			}
+			fmt.Fprint(w, `{"ok":true,"result":true,"description":"Webhook was deleted"}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Run("keeps pending updates", func(t *testing.T) {
+		server, calls := newWebhookServer(t, "")
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+		var out bytes.Buffer
+		require.NoError(t, DeleteWebhook(context.Background(), client, &out, false))
+		assert.Equal(t, []string{"getWebhookInfo", "deleteWebhook drop=false", "getWebhookInfo"}, *calls)
+		assert.Equal(t, "before: url=https://example.com/hook pending_update_count=2\n"+
+			"webhook deleted\n"+
+			"after: url=(none) pending_update_count=2\n", out.String())
+	})
+
+	t.Run("drops pending updates", func(t *testing.T) {
+		server, calls := newWebhookServer(t, "")
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+		var out bytes.Buffer
+		require.NoError(t, DeleteWebhook(context.Background(), client, &out, true))
+		assert.Equal(t, []string{"getWebhookInfo", "deleteWebhook drop=true", "getWebhookInfo"}, *calls)
+		assert.Contains(t, out.String(), "webhook deleted, pending updates dropped\n")
+		assert.Contains(t, out.String(), "after: url=(none) pending_update_count=0\n")
+	})
+
+	t.Run("delete fails", func(t *testing.T) {
+		server, calls := newWebhookServer(t, `{"ok":false,"error_code":401,"description":"Unauthorized"}`)
+		client := NewTelegramClient("test-token", WithLogger(logger), WithBaseURL(server.URL))
+
+		var out bytes.Buffer
+		err := DeleteWebhook(context.Background(), client, &out, false)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.Equal(t, []string{"getWebhookInfo", "deleteWebhook drop=false"}, *calls)
+	})
+}
+
+func TestPrintWebhookInfo(t *testing.T) {
+	var out bytes.Buffer
+	printWebhookInfo(&out, "before", &gotgbot.WebhookInfo{Url: "https://example.com/hook", LastErrorMessage: "Connection refused"})
+	assert.Equal(t, "before: url=https://example.com/hook pending_update_count=0 last_error=\"Connection refused\"\n", out.String())
+}
@@ -1,7 +0,0 @@
-package main
-
-import (
-	"github.com/PaulSonOfLars/gotgbot/v2"
-)
-
-type Update = gotgbot.Update